@@ -34,6 +34,7 @@ type SafeRpcConnPools struct {
 	MaxIdle     int
 	ConnTimeout int
 	CallTimeout int
+	jsonrpc     bool
 }
 
 func CreateSafeRpcConnPools(maxConns, maxIdle, connTimeout, callTimeout int, cluster []string) *SafeRpcConnPools {
@@ -53,7 +54,7 @@ func CreateSafeRpcConnPools(maxConns, maxIdle, connTimeout, callTimeout int, clu
 
 func CreateSafeJsonrpcConnPools(maxConns, maxIdle, connTimeout, callTimeout int, cluster []string) *SafeRpcConnPools {
 	cp := &SafeRpcConnPools{M: make(map[string]*connp.ConnPool), MaxConns: maxConns, MaxIdle: maxIdle,
-		ConnTimeout: connTimeout, CallTimeout: callTimeout}
+		ConnTimeout: connTimeout, CallTimeout: callTimeout, jsonrpc: true}
 
 	ct := time.Duration(cp.ConnTimeout) * time.Millisecond
 	for _, address := range cluster {
@@ -108,6 +109,33 @@ func (this *SafeRpcConnPools) Get(address string) (*connp.ConnPool, bool) {
 	return p, exists
 }
 
+// 为新的地址创建连接池, 已经存在的地址不受影响
+func (this *SafeRpcConnPools) Add(addresses ...string) {
+	this.Lock()
+	defer this.Unlock()
+	ct := time.Duration(this.ConnTimeout) * time.Millisecond
+	for _, address := range addresses {
+		if _, exist := this.M[address]; exist {
+			continue
+		}
+		if this.jsonrpc {
+			this.M[address] = createOneJsonrpcPool(address, address, ct, this.MaxConns, this.MaxIdle)
+		} else {
+			this.M[address] = createOneRpcPool(address, address, ct, this.MaxConns, this.MaxIdle)
+		}
+	}
+}
+
+// 关闭并删除地址对应的连接池
+func (this *SafeRpcConnPools) Remove(address string) {
+	this.Lock()
+	defer this.Unlock()
+	if p, exist := this.M[address]; exist {
+		p.Destroy()
+		delete(this.M, address)
+	}
+}
+
 func (this *SafeRpcConnPools) Destroy() {
 	this.Lock()
 	defer this.Unlock()
@@ -123,6 +151,8 @@ func (this *SafeRpcConnPools) Destroy() {
 }
 
 func (this *SafeRpcConnPools) Proc() []string {
+	this.RLock()
+	defer this.RUnlock()
 	procs := []string{}
 	for _, cp := range this.M {
 		procs = append(procs, cp.Proc())
@@ -0,0 +1,78 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"math"
+)
+
+// Downsample 把数据按step重新分桶, 每个点表示(ts-step, ts]区间的值, 桶的时间戳是step的整数倍;
+// cf为AVERAGE、MAX、MIN、LAST, 忽略NaN, 没有数据的桶为NaN; 返回[start, end]范围内所有的桶
+func Downsample(values []*RRDData, cf string, start, end, step int64) []*RRDData {
+	if step <= 0 {
+		return values
+	}
+	first := start
+	if r := first % step; r != 0 {
+		first += step - r
+	}
+	last := end - end%step
+	if last < first {
+		return []*RRDData{}
+	}
+	n := int((last-first)/step) + 1
+	sums := make([]float64, n)
+	counts := make([]int, n)
+	for _, v := range values {
+		if v == nil || math.IsNaN(float64(v.Value)) {
+			continue
+		}
+		f := float64(v.Value)
+		ts := v.Timestamp
+		if r := ts % step; r != 0 {
+			ts += step - r
+		}
+		i := int((ts - first) / step)
+		if ts < first || i >= n {
+			continue
+		}
+		switch {
+		case counts[i] == 0:
+			sums[i] = f
+		case cf == "MAX":
+			sums[i] = math.Max(sums[i], f)
+		case cf == "MIN":
+			sums[i] = math.Min(sums[i], f)
+		case cf == "LAST":
+			sums[i] = f
+		default:
+			sums[i] += f
+		}
+		counts[i]++
+	}
+
+	ret := make([]*RRDData, n)
+	for i := range ret {
+		v := math.NaN()
+		if counts[i] > 0 {
+			v = sums[i]
+			if cf != "MAX" && cf != "MIN" && cf != "LAST" {
+				v /= float64(counts[i])
+			}
+		}
+		ret[i] = NewRRDData(first+int64(i)*step, v)
+	}
+	return ret
+}
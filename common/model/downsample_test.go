@@ -0,0 +1,53 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDownsample(t *testing.T) {
+	var values []*RRDData
+	for i, v := range []float64{1, 2, 3, 4, math.NaN(), math.NaN(), 7, 8} {
+		values = append(values, NewRRDData(int64(60*(i+1)), v))
+	}
+
+	cases := []struct {
+		cf         string
+		start, end int64
+		step       int64
+		ts         []int64
+		want       []float64
+	}{
+		{"AVERAGE", 60, 480, 120, []int64{120, 240, 360, 480}, []float64{1.5, 3.5, math.NaN(), 7.5}},
+		{"MAX", 60, 480, 120, []int64{120, 240, 360, 480}, []float64{2, 4, math.NaN(), 8}},
+		{"MIN", 60, 480, 240, []int64{240, 480}, []float64{1, 7}},
+		{"LAST", 0, 500, 240, []int64{0, 240, 480}, []float64{math.NaN(), 4, 8}},
+		{"AVERAGE", 130, 230, 120, []int64{}, []float64{}},
+	}
+	for _, c := range cases {
+		got := Downsample(values, c.cf, c.start, c.end, c.step)
+		if len(got) != len(c.want) {
+			t.Fatalf("%s/%d: got %d points, want %d", c.cf, c.step, len(got), len(c.want))
+		}
+		for i, p := range got {
+			v := float64(p.Value)
+			if p.Timestamp != c.ts[i] || !(v == c.want[i] || math.IsNaN(v) && math.IsNaN(c.want[i])) {
+				t.Errorf("%s/%d: point %d got (%d, %v), want (%d, %v)", c.cf, c.step, i, p.Timestamp, v, c.ts[i], c.want[i])
+			}
+		}
+	}
+}
@@ -17,6 +17,8 @@ package model
 import (
 	"fmt"
 	"math"
+	"strconv"
+	"strings"
 
 	MUtils "github.com/open-falcon/falcon-plus/common/utils"
 )
@@ -76,6 +78,7 @@ type GraphDeleteResp struct {
 }
 
 // ConsolFun 是RRD中的概念，比如：MIN|MAX|AVERAGE
+// Step和MaxPoints为期望的数据间隔和最多返回的点数, 比counter的上报周期大时graph会降采样
 type GraphQueryParam struct {
 	Start     int64  `json:"start"`
 	End       int64  `json:"end"`
@@ -83,6 +86,18 @@ type GraphQueryParam struct {
 	Endpoint  string `json:"endpoint"`
 	Counter   string `json:"counter"`
 	Step      int    `json:"step"`
+	MaxPoints int    `json:"max_points"`
+}
+
+// Resolution 按Step和MaxPoints计算返回数据的间隔
+func (this *GraphQueryParam) Resolution() int64 {
+	res := int64(this.Step)
+	if this.MaxPoints > 0 && this.End > this.Start {
+		if r := (this.End - this.Start + int64(this.MaxPoints) - 1) / int64(this.MaxPoints); r > res {
+			res = r
+		}
+	}
+	return res
 }
 
 type GraphQueryResponse struct {
@@ -166,3 +181,90 @@ type GraphLastResp struct {
 	Counter  string   `json:"counter"`
 	Value    *RRDData `json:"value"`
 }
+
+// GraphMatcher 按label过滤series, Name为endpoint、metric或者tag的key, Op为=、!=、=~、!~
+type GraphMatcher struct {
+	Name  string `json:"name"`
+	Op    string `json:"op"`
+	Value string `json:"value"`
+}
+
+func (this *GraphMatcher) String() string {
+	return fmt.Sprintf("%s%s%q", this.Name, this.Op, this.Value)
+}
+
+// ParseGraphMatcher 解析name=value、name!=value、name=~regexp、name!~regexp, value可以用双引号括起来
+func ParseGraphMatcher(s string) (*GraphMatcher, error) {
+	i := strings.IndexAny(s, "=!")
+	if i <= 0 {
+		return nil, fmt.Errorf("bad matcher %q", s)
+	}
+	m := &GraphMatcher{Name: strings.TrimSpace(s[:i])}
+	rest := s[i:]
+	for _, op := range []string{"=~", "!~", "!=", "="} {
+		if strings.HasPrefix(rest, op) {
+			m.Op = op
+			rest = rest[len(op):]
+			break
+		}
+	}
+	if m.Op == "" {
+		return nil, fmt.Errorf("bad matcher %q", s)
+	}
+	m.Value = strings.TrimSpace(rest)
+	if len(m.Value) >= 2 && m.Value[0] == '"' && m.Value[len(m.Value)-1] == '"' {
+		v, err := strconv.Unquote(m.Value)
+		if err != nil {
+			return nil, fmt.Errorf("bad matcher %q: %v", s, err)
+		}
+		m.Value = v
+	}
+	return m, nil
+}
+
+type GraphSeriesParam struct {
+	Matchers []*GraphMatcher `json:"matchers"`
+	Limit    int             `json:"limit"`
+}
+
+type GraphSeries struct {
+	Endpoint string            `json:"endpoint"`
+	Counter  string            `json:"counter"`
+	Metric   string            `json:"metric"`
+	Tags     map[string]string `json:"tags"`
+	DsType   string            `json:"dstype"`
+	Step     int               `json:"step"`
+}
+
+// 按endpoint、counter排序
+type GraphSeriesSlice []*GraphSeries
+
+func (this GraphSeriesSlice) Len() int {
+	return len(this)
+}
+func (this GraphSeriesSlice) Swap(i, j int) {
+	this[i], this[j] = this[j], this[i]
+}
+func (this GraphSeriesSlice) Less(i, j int) bool {
+	if this[i].Endpoint != this[j].Endpoint {
+		return this[i].Endpoint < this[j].Endpoint
+	}
+	return this[i].Counter < this[j].Counter
+}
+
+type GraphSeriesResp struct {
+	Series    []*GraphSeries `json:"series"`
+	Truncated bool           `json:"truncated"`
+}
+
+// GraphLabelParam Name为空时查询label名, 否则查询这个label的取值
+type GraphLabelParam struct {
+	Name     string          `json:"name"`
+	Matchers []*GraphMatcher `json:"matchers"`
+	Limit    int             `json:"limit"`
+}
+
+type GraphLabelResp struct {
+	Values    []string `json:"values"`
+	Truncated bool     `json:"truncated"`
+}
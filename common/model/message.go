@@ -0,0 +1,100 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"bytes"
+	"strings"
+	"text/template"
+
+	"github.com/open-falcon/falcon-plus/common/utils"
+)
+
+// 告警消息模板(text/template)可以使用的数据
+type MessageData struct {
+	Event        *Event
+	Status       string
+	Priority     int
+	Endpoint     string
+	Metric       string
+	Tags         string
+	Func         string
+	LeftValue    string
+	Operator     string
+	RightValue   string
+	Note         string
+	MaxStep      int
+	CurrentStep  int
+	Time         string
+	StrategyId   int
+	ExpressionId int
+	TplId        int
+	TplName      string
+	TplCreator   string
+	Hostgroups   []string
+	Link         string
+}
+
+func NewMessageData(event *Event, hostgroups []string, link string) *MessageData {
+	data := &MessageData{
+		Event:        event,
+		Status:       event.Status,
+		Priority:     event.Priority(),
+		Endpoint:     event.Endpoint,
+		Metric:       event.Metric(),
+		Tags:         utils.SortedTags(event.PushedTags),
+		Func:         event.Func(),
+		LeftValue:    utils.ReadableFloat(event.LeftValue),
+		Operator:     event.Operator(),
+		RightValue:   utils.ReadableFloat(event.RightValue()),
+		Note:         event.Note(),
+		MaxStep:      event.MaxStep(),
+		CurrentStep:  event.CurrentStep,
+		Time:         event.FormattedTime(),
+		StrategyId:   event.StrategyId(),
+		ExpressionId: event.ExpressionId(),
+		Hostgroups:   hostgroups,
+		Link:         link,
+	}
+	if tpl := event.Tpl(); tpl != nil {
+		data.TplId = tpl.Id
+		data.TplName = tpl.Name
+		data.TplCreator = tpl.Creator
+	}
+	return data
+}
+
+var messageFuncs = template.FuncMap{
+	"join":  strings.Join,
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+}
+
+func ParseMessageTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).Funcs(messageFuncs).Option("missingkey=error").Parse(text)
+}
+
+func RenderMessage(name, text string, data *MessageData) (string, error) {
+	tpl, err := ParseMessageTemplate(name, text)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err = tpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
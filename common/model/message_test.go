@@ -0,0 +1,66 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"testing"
+)
+
+func TestRenderMessage(t *testing.T) {
+	event := &Event{
+		Id:          "s_1_abc",
+		Endpoint:    "host01",
+		Status:      "PROBLEM",
+		LeftValue:   95.5,
+		CurrentStep: 2,
+		EventTime:   1500000000,
+		PushedTags:  map[string]string{"mount": "/home"},
+		Strategy: &Strategy{
+			Id:         1,
+			Metric:     "df.bytes.used.percent",
+			Func:       "all(#3)",
+			Operator:   ">",
+			RightValue: 90,
+			MaxStep:    3,
+			Priority:   1,
+			Note:       "disk full",
+			Tpl:        &Template{Id: 7, Name: "tpl-disk", Creator: "root"},
+		},
+	}
+	data := NewMessageData(event, []string{"grp-a", "grp-b"}, "http://dashboard")
+
+	tests := []struct {
+		text     string
+		expected string
+		ok       bool
+	}{
+		{"[P{{.Priority}}] {{.Endpoint}} {{.Metric}}{{if .Tags}}/{{.Tags}}{{end}} {{.LeftValue}}{{.Operator}}{{.RightValue}}",
+			"[P1] host01 df.bytes.used.percent/mount=/home 95.5>90", true},
+		{"{{.TplName}} by {{.TplCreator}} in {{join .Hostgroups \",\"}}", "tpl-disk by root in grp-a,grp-b", true},
+		{"{{upper .Status}} {{.CurrentStep}}/{{.MaxStep}} {{.Event.Id}}", "PROBLEM 2/3 s_1_abc", true},
+		{"{{.NoSuchField}}", "", false},
+		{"{{.Endpoint", "", false},
+	}
+	for _, tt := range tests {
+		got, err := RenderMessage("test", tt.text, data)
+		if (err == nil) != tt.ok {
+			t.Errorf("RenderMessage(%q) error: %v, expected ok:%v", tt.text, err, tt.ok)
+			continue
+		}
+		if got != tt.expected {
+			t.Errorf("RenderMessage(%q) = %q, expected %q", tt.text, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/open-falcon/falcon-plus/common/utils"
+)
+
+// 告警屏蔽规则，所有非空的条件都满足时，event被屏蔽
+// Endpoint是正则，Tags是k1=v1,k2=v2的格式，要求是event tags的子集
+type Silence struct {
+	Id           int64     `json:"id"`
+	Endpoint     string    `json:"endpoint"`
+	Metric       string    `json:"metric"`
+	Tags         string    `json:"tags"`
+	StrategyId   int64     `json:"strategy_id"`
+	ExpressionId int64     `json:"expression_id"`
+	Hostgroup    string    `json:"hostgroup"`
+	Creator      string    `json:"creator"`
+	Comment      string    `json:"comment"`
+	StartAt      time.Time `json:"start_at"`
+	EndAt        time.Time `json:"end_at"`
+}
+
+func (this *Silence) String() string {
+	return fmt.Sprintf(
+		"<Id:%d, Endpoint:%s, Metric:%s, Tags:%s, StrategyId:%d, ExpressionId:%d, Hostgroup:%s, %v ~ %v>",
+		this.Id,
+		this.Endpoint,
+		this.Metric,
+		this.Tags,
+		this.StrategyId,
+		this.ExpressionId,
+		this.Hostgroup,
+		this.StartAt,
+		this.EndAt,
+	)
+}
+
+func (this *Silence) IsActive(now time.Time) bool {
+	return !now.Before(this.StartAt) && now.Before(this.EndAt)
+}
+
+type SilenceMatcher struct {
+	*Silence
+	endpoint *regexp.Regexp
+	tags     map[string]string
+}
+
+func NewSilenceMatcher(s *Silence) (*SilenceMatcher, error) {
+	endpoint, err := regexp.Compile(s.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	err, tags := utils.SplitTagsString(s.Tags)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SilenceMatcher{Silence: s, endpoint: endpoint, tags: tags}, nil
+}
+
+// @param hostgroups: 查询endpoint所属的hostgroup，为nil时带有hostgroup条件的规则不匹配
+func (this *SilenceMatcher) Match(event *Event, hostgroups func(endpoint string) []string) bool {
+	if this.StrategyId != 0 && int64(event.StrategyId()) != this.StrategyId {
+		return false
+	}
+	if this.ExpressionId != 0 && int64(event.ExpressionId()) != this.ExpressionId {
+		return false
+	}
+	if this.Metric != "" && event.Metric() != this.Metric {
+		return false
+	}
+	if !this.endpoint.MatchString(event.Endpoint) {
+		return false
+	}
+	for k, v := range this.tags {
+		if myVal, exists := event.PushedTags[k]; !exists || myVal != v {
+			return false
+		}
+	}
+
+	if this.Hostgroup == "" {
+		return true
+	}
+	if hostgroups == nil {
+		return false
+	}
+	for _, grp := range hostgroups(event.Endpoint) {
+		if grp == this.Hostgroup {
+			return true
+		}
+	}
+	return false
+}
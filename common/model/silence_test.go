@@ -0,0 +1,111 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSilenceMatcher(t *testing.T) {
+	event := &Event{
+		Endpoint:   "web-01.bj",
+		PushedTags: map[string]string{"mount": "/home", "fstype": "ext4"},
+		Strategy:   &Strategy{Id: 1, Metric: "df.bytes.used.percent"},
+	}
+	exprEvent := &Event{
+		Endpoint:   "web-01.bj",
+		Expression: &Expression{Id: 9, Metric: "cpu.idle"},
+	}
+	hostgroups := func(endpoint string) []string {
+		if endpoint == "web-01.bj" {
+			return []string{"web", "bj"}
+		}
+		return nil
+	}
+
+	tests := []struct {
+		silence Silence
+		event   *Event
+		want    bool
+	}{
+		// 相等的条件
+		{Silence{Metric: "df.bytes.used.percent"}, event, true},
+		{Silence{StrategyId: 1}, event, true},
+		{Silence{ExpressionId: 9}, exprEvent, true},
+		{Silence{Tags: "mount=/home"}, event, true},
+		{Silence{Tags: "mount=/home,fstype=ext4"}, event, true},
+		{Silence{Hostgroup: "bj"}, event, true},
+		// 不相等的条件
+		{Silence{Metric: "cpu.idle"}, event, false},
+		{Silence{StrategyId: 2}, event, false},
+		{Silence{ExpressionId: 9}, event, false},
+		{Silence{Tags: "mount=/data"}, event, false},
+		{Silence{Tags: "mount=/home,iface=eth0"}, event, false},
+		{Silence{Hostgroup: "db"}, event, false},
+		// endpoint是正则
+		{Silence{Endpoint: `^web-\d+\.bj$`}, event, true},
+		{Silence{Endpoint: "web"}, event, true},
+		{Silence{Endpoint: "^db-"}, event, false},
+		// 所有条件都要满足
+		{Silence{Endpoint: "^web-", Metric: "df.bytes.used.percent", Tags: "mount=/home", Hostgroup: "web"}, event, true},
+		{Silence{Endpoint: "^web-", Metric: "df.bytes.used.percent", Tags: "mount=/data"}, event, false},
+	}
+	for i, tt := range tests {
+		m, err := NewSilenceMatcher(&tt.silence)
+		if err != nil {
+			t.Errorf("case %d: %v", i, err)
+			continue
+		}
+		if got := m.Match(tt.event, hostgroups); got != tt.want {
+			t.Errorf("case %d %s: Match = %v, want %v", i, tt.silence.String(), got, tt.want)
+		}
+	}
+
+	// 没有提供hostgroup查询时, 带hostgroup条件的规则不匹配
+	m, _ := NewSilenceMatcher(&Silence{Hostgroup: "web"})
+	if m.Match(event, nil) {
+		t.Errorf("hostgroup silence should not match without hostgroups")
+	}
+
+	bad := []Silence{{Endpoint: "("}, {Tags: "mount"}}
+	for _, s := range bad {
+		if _, err := NewSilenceMatcher(&s); err == nil {
+			t.Errorf("NewSilenceMatcher(%s) should fail", s.String())
+		}
+	}
+}
+
+func TestSilenceIsActive(t *testing.T) {
+	start := time.Unix(1500000000, 0)
+	s := &Silence{StartAt: start, EndAt: start.Add(time.Hour)}
+	tests := []struct {
+		now  time.Time
+		want bool
+	}{
+		{start.Add(-time.Second), false},
+		{start, true},
+		{start.Add(30 * time.Minute), true},
+		{start.Add(time.Hour - time.Second), true},
+		// 到期之后不再生效
+		{start.Add(time.Hour), false},
+		{start.Add(2 * time.Hour), false},
+	}
+	for i, tt := range tests {
+		if got := s.IsActive(tt.now); got != tt.want {
+			t.Errorf("case %d: IsActive(%v) = %v, want %v", i, tt.now, got, tt.want)
+		}
+	}
+}
@@ -34,3 +34,13 @@ func (this *TransferResponse) String() string {
 		this.Message,
 	)
 }
+
+// hbs下发给transfer的judge/graph集群, node -> 地址, graph的多个地址用逗号分隔
+type ClusterResponse struct {
+	Judge map[string]string
+	Graph map[string]string
+}
+
+func (this *ClusterResponse) String() string {
+	return fmt.Sprintf("<Judge:%v, Graph:%v>", this.Judge, this.Graph)
+}
@@ -0,0 +1,142 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// argument kinds of judge functions, one byte per argument.
+// n: count of history points, a positive integer
+// f: any float number
+// p: percentile, a float number in (0, 100]
+// d: time offset, e.g. 30m 12h 1d 1w
+var judgeFuncArgs = map[string]string{
+	"max":         "n",
+	"min":         "n",
+	"all":         "n",
+	"sum":         "n",
+	"avg":         "n",
+	"diff":        "n",
+	"pdiff":       "n",
+	"lookup":      "nn",
+	"median":      "n",
+	"stddev":      "n",
+	"rate":        "n",
+	"percentile":  "np",
+	"count_above": "nf",
+	"count_below": "nf",
+	"compare":     "nd",
+}
+
+// @str: e.g. all(#3) lookup(#2,3) percentile(#10,95) compare(#3,1d)
+// @return name: the function name, e.g. percentile
+// @return args: the arguments after '#', e.g. ["10", "95"]
+func ParseJudgeFunc(str string) (name string, args []string, err error) {
+	str = strings.TrimSpace(str)
+	idx := strings.Index(str, "(#")
+	if idx <= 0 || !strings.HasSuffix(str, ")") {
+		err = fmt.Errorf("func %s is not in format name(#args)", str)
+		return
+	}
+
+	name = str[:idx]
+	kinds, ok := judgeFuncArgs[name]
+	if !ok {
+		err = fmt.Errorf("func %s is not supported", name)
+		return
+	}
+
+	args = strings.Split(str[idx+2:len(str)-1], ",")
+	if len(args) != len(kinds) {
+		err = fmt.Errorf("func %s needs %d args, but got %d", name, len(kinds), len(args))
+		return
+	}
+
+	for i := range args {
+		args[i] = strings.TrimSpace(args[i])
+		if err = checkJudgeFuncArg(kinds[i], args[i]); err != nil {
+			err = fmt.Errorf("func %s arg %d: %v", name, i+1, err)
+			return
+		}
+	}
+
+	if name == "rate" && args[0] == "1" {
+		err = fmt.Errorf("func rate needs at least 2 points")
+	}
+
+	return
+}
+
+// @str: the func of a strategy or expression, e.g. all(#3)
+// @return whether the func can be parsed by ParseJudgeFunc
+func IsJudgeFuncValid(str string) bool {
+	_, _, err := ParseJudgeFunc(str)
+	return err == nil
+}
+
+func checkJudgeFuncArg(kind byte, arg string) error {
+	switch kind {
+	case 'n':
+		n, err := strconv.Atoi(arg)
+		if err != nil || n < 1 {
+			return fmt.Errorf("%s is not a positive integer", arg)
+		}
+	case 'f':
+		if _, err := strconv.ParseFloat(arg, 64); err != nil {
+			return fmt.Errorf("%s is not a number", arg)
+		}
+	case 'p':
+		p, err := strconv.ParseFloat(arg, 64)
+		if err != nil || p <= 0 || p > 100 {
+			return fmt.Errorf("%s is not a percentile in (0, 100]", arg)
+		}
+	case 'd':
+		if _, err := ParseOffset(arg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var offsetUnits = map[byte]int64{
+	's': 1,
+	'm': 60,
+	'h': 3600,
+	'd': 86400,
+	'w': 604800,
+}
+
+// @str: e.g. 30m 12h 1d 1w
+// @return seconds of the offset
+func ParseOffset(str string) (int64, error) {
+	if len(str) < 2 {
+		return 0, fmt.Errorf("%s is not a valid offset", str)
+	}
+
+	unit, ok := offsetUnits[str[len(str)-1]]
+	if !ok {
+		return 0, fmt.Errorf("%s is not a valid offset, unit should be one of s,m,h,d,w", str)
+	}
+
+	n, err := strconv.ParseInt(str[:len(str)-1], 10, 64)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("%s is not a valid offset", str)
+	}
+
+	return n * unit, nil
+}
@@ -0,0 +1,60 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"testing"
+)
+
+func TestParseJudgeFunc(t *testing.T) {
+	tests := []struct {
+		input string
+		name  string
+		valid bool
+	}{
+		{"all(#3)", "all", true},
+		{"lookup(#2,3)", "lookup", true},
+		{"percentile(#10,95)", "percentile", true},
+		{"percentile(#10, 99.9)", "percentile", true},
+		{"count_above(#10,-1.5)", "count_above", true},
+		{"rate(#2)", "rate", true},
+		{"rate(#1)", "rate", false},
+		{"compare(#3, 1d)", "compare", true},
+		{"compare(#3,7d)", "compare", true},
+		{"compare(#3,1x)", "compare", false},
+		{"compare(#3,d)", "compare", false},
+		{"percentile(#10,101)", "percentile", false},
+		{"stddev(#0)", "stddev", false},
+		{"avg(#3,4)", "avg", false},
+		{"lookup(#3)", "lookup", false},
+		{"foo(#3)", "foo", false},
+		{"avg(3)", "", false},
+		{"avg(#3", "", false},
+		{"", "", false},
+	}
+
+	for i, v := range tests {
+		name, _, err := ParseJudgeFunc(v.input)
+		if (err == nil) != v.valid {
+			t.Errorf("Error on case %d: %s, valid(actual) = %v, err: %v", i, v.input, err == nil, err)
+		}
+		if IsJudgeFuncValid(v.input) != v.valid {
+			t.Errorf("Error on case %d: IsJudgeFuncValid(%s) != %v", i, v.input, v.valid)
+		}
+		if v.valid && name != v.name {
+			t.Errorf("Error on case %d: %s(actual) != %s(expected)", i, name, v.name)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/open-falcon/falcon-plus/modules/alarm/g"
+	"github.com/open-falcon/falcon-plus/modules/api/app/model/alarm"
+	"github.com/toolkits/net/httplib"
+)
+
+func CurlInhibitRules() ([]*alarm.InhibitRule, error) {
+	uri := fmt.Sprintf("%s/api/v1/alarm/inhibit_rules", g.Config().Api.PlusApi)
+	req := httplib.Get(uri).SetTimeout(5*time.Second, 30*time.Second)
+	token, _ := json.Marshal(map[string]string{
+		"name": "falcon-alarm",
+		"sig":  g.Config().Api.PlusApiToken,
+	})
+	req.Header("Apitoken", string(token))
+
+	var rules []*alarm.InhibitRule
+	err := req.ToJson(&rules)
+	if err != nil {
+		log.Errorf("curl %s fail: %v", uri, err)
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+type hostGroupsItem struct {
+	Groups []string
+	Expire int64
+}
+
+type HostGroupsCache struct {
+	sync.RWMutex
+	M       map[string]*hostGroupsItem
+	pending map[string]bool
+}
+
+var HostGroups = &HostGroupsCache{M: make(map[string]*hostGroupsItem), pending: make(map[string]bool)}
+
+func (this *HostGroupsCache) Get(endpoint string) *hostGroupsItem {
+	this.RLock()
+	defer this.RUnlock()
+	return this.M[endpoint]
+}
+
+func (this *HostGroupsCache) Set(endpoint string, groups []string) {
+	this.Lock()
+	defer this.Unlock()
+	this.M[endpoint] = &hostGroupsItem{Groups: groups, Expire: time.Now().Unix() + 300}
+}
+
+// refresh 在后台查询, 同一个endpoint同时只查一次; 查询失败且没有旧数据时缓存30秒的空列表, 避免反复请求api
+func (this *HostGroupsCache) refresh(endpoint string) {
+	this.Lock()
+	if this.pending[endpoint] {
+		this.Unlock()
+		return
+	}
+	this.pending[endpoint] = true
+	this.Unlock()
+
+	go func() {
+		groups := CurlHostGroups(endpoint)
+
+		this.Lock()
+		defer this.Unlock()
+		delete(this.pending, endpoint)
+		if groups != nil {
+			this.M[endpoint] = &hostGroupsItem{Groups: groups, Expire: time.Now().Unix() + 300}
+		} else if _, ok := this.M[endpoint]; !ok {
+			this.M[endpoint] = &hostGroupsItem{Groups: []string{}, Expire: time.Now().Unix() + 30}
+		}
+	}()
+}
+
+// hostgroup很少变化，缓存5分钟
+func HostGroupsOf(endpoint string) []string {
+	item := HostGroups.Get(endpoint)
+	if item != nil && item.Expire > time.Now().Unix() {
+		return item.Groups
+	}
+
+	groups := CurlHostGroups(endpoint)
+	if groups != nil {
+		HostGroups.Set(endpoint, groups)
+	} else if item != nil {
+		groups = item.Groups
+	}
+
+	return groups
+}
+
+// CachedHostGroupsOf 只读缓存, 不会阻塞调用方; 缓存中没有或者已经过期时在后台查询, 没有缓存时ok为false
+func CachedHostGroupsOf(endpoint string) (groups []string, ok bool) {
+	item := HostGroups.Get(endpoint)
+	if item == nil || item.Expire <= time.Now().Unix() {
+		HostGroups.refresh(endpoint)
+	}
+	if item == nil {
+		return nil, false
+	}
+	return item.Groups, true
+}
+
+func CurlHostGroups(endpoint string) []string {
+	uri := fmt.Sprintf("%s/api/v1/hostgroup?hostname=%s", g.Config().Api.PlusApi, url.QueryEscape(endpoint))
+	req := httplib.Get(uri).SetTimeout(2*time.Second, 10*time.Second)
+	token, _ := json.Marshal(map[string]string{
+		"name": "falcon-alarm",
+		"sig":  g.Config().Api.PlusApiToken,
+	})
+	req.Header("Apitoken", string(token))
+
+	var grps []struct {
+		Name string `json:"grp_name"`
+	}
+	err := req.ToJson(&grps)
+	if err != nil {
+		log.Errorf("curl %s fail: %v", uri, err)
+		return nil
+	}
+
+	groups := make([]string, 0, len(grps))
+	for _, grp := range grps {
+		groups = append(groups, grp.Name)
+	}
+	return groups
+}
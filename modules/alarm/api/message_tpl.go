@@ -0,0 +1,93 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/open-falcon/falcon-plus/modules/alarm/g"
+	"github.com/open-falcon/falcon-plus/modules/api/app/model/falcon_portal"
+	"github.com/toolkits/net/httplib"
+)
+
+type messageTplItem struct {
+	Tpl    *falcon_portal.MessageTpl
+	Expire int64
+}
+
+type MessageTplCache struct {
+	sync.RWMutex
+	M map[string]*messageTplItem
+}
+
+var MessageTpls = &MessageTplCache{M: make(map[string]*messageTplItem)}
+
+func (this *MessageTplCache) Get(key string) *messageTplItem {
+	this.RLock()
+	defer this.RUnlock()
+	return this.M[key]
+}
+
+func (this *MessageTplCache) Set(key string, tpl *falcon_portal.MessageTpl) {
+	this.Lock()
+	defer this.Unlock()
+	this.M[key] = &messageTplItem{Tpl: tpl, Expire: time.Now().Unix() + 60}
+}
+
+// 没有配置消息模板时返回nil，结果缓存1分钟
+func GetMessageTpl(actionId, tplId int) *falcon_portal.MessageTpl {
+	key := fmt.Sprintf("%d/%d", actionId, tplId)
+	item := MessageTpls.Get(key)
+	if item != nil && item.Expire > time.Now().Unix() {
+		return item.Tpl
+	}
+
+	tpl, err := CurlMessageTpl(actionId, tplId)
+	if err != nil {
+		if item != nil {
+			return item.Tpl
+		}
+		return nil
+	}
+
+	if tpl.ID == 0 {
+		tpl = nil
+	}
+	MessageTpls.Set(key, tpl)
+	return tpl
+}
+
+func CurlMessageTpl(actionId, tplId int) (*falcon_portal.MessageTpl, error) {
+	uri := fmt.Sprintf("%s/api/v1/message_tpl_match?action_id=%d&tpl_id=%d", g.Config().Api.PlusApi, actionId, tplId)
+	req := httplib.Get(uri).SetTimeout(2*time.Second, 10*time.Second)
+	token, _ := json.Marshal(map[string]string{
+		"name": "falcon-alarm",
+		"sig":  g.Config().Api.PlusApiToken,
+	})
+	req.Header("Apitoken", string(token))
+
+	var tpl falcon_portal.MessageTpl
+	err := req.ToJson(&tpl)
+	if err != nil {
+		log.Errorf("curl %s fail: %v", uri, err)
+		return nil, err
+	}
+
+	return &tpl, nil
+}
@@ -34,6 +34,16 @@ type Action struct {
 	BeforeCallbackMail int    `json:"before_callback_mail"`
 	AfterCallbackSms   int    `json:"after_callback_sms"`
 	AfterCallbackMail  int    `json:"after_callback_mail"`
+	// 逗号分隔的channel名称
+	Channels string `json:"channels"`
+	// 按Step升序
+	Escalations []*Escalation `json:"escalations"`
+}
+
+type Escalation struct {
+	Step         int    `json:"step"`
+	AfterMinutes int    `json:"after_minutes"`
+	Uic          string `json:"uic"`
 }
 
 type ActionCache struct {
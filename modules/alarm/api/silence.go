@@ -0,0 +1,46 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	cmodel "github.com/open-falcon/falcon-plus/common/model"
+	"github.com/open-falcon/falcon-plus/modules/alarm/g"
+	"github.com/toolkits/net/httplib"
+)
+
+// 只拉取当前生效的屏蔽规则
+func CurlSilences() ([]*cmodel.Silence, error) {
+	uri := fmt.Sprintf("%s/api/v1/silence?active=true", g.Config().Api.PlusApi)
+	req := httplib.Get(uri).SetTimeout(5*time.Second, 30*time.Second)
+	token, _ := json.Marshal(map[string]string{
+		"name": "falcon-alarm",
+		"sig":  g.Config().Api.PlusApiToken,
+	})
+	req.Header("Apitoken", string(token))
+
+	var silences []*cmodel.Silence
+	err := req.ToJson(&silences)
+	if err != nil {
+		log.Errorf("curl %s fail: %v", uri, err)
+		return nil, err
+	}
+
+	return silences, nil
+}
@@ -57,8 +57,16 @@ func (this *UsersCache) Set(team string, users []*uic.User) {
 	this.M[team] = users
 }
 
+// oncall:<team> 表示team当前的值班人
+const OncallPrefix = "oncall:"
+
 func UsersOf(team string) []*uic.User {
-	users := CurlUic(team)
+	var users []*uic.User
+	if strings.HasPrefix(team, OncallPrefix) {
+		users = CurlOncall(strings.TrimPrefix(team, OncallPrefix))
+	} else {
+		users = CurlUic(team)
+	}
 
 	if users != nil {
 		Users.Set(team, users)
@@ -135,3 +143,33 @@ func CurlUic(team string) []*uic.User {
 
 	return team_users.Users
 }
+
+type APIGetOncallOutput struct {
+	Team      uic.Team    `json:"team"`
+	Scheduled bool        `json:"scheduled"`
+	Override  bool        `json:"override"`
+	Users     []*uic.User `json:"users"`
+}
+
+func CurlOncall(team string) []*uic.User {
+	if team == "" {
+		return []*uic.User{}
+	}
+
+	uri := fmt.Sprintf("%s/api/v1/oncall/team_name/%s", g.Config().Api.PlusApi, team)
+	req := httplib.Get(uri).SetTimeout(2*time.Second, 10*time.Second)
+	token, _ := json.Marshal(map[string]string{
+		"name": "falcon-alarm",
+		"sig":  g.Config().Api.PlusApiToken,
+	})
+	req.Header("Apitoken", string(token))
+
+	var oncall APIGetOncallOutput
+	err := req.ToJson(&oncall)
+	if err != nil || oncall.Team.ID == 0 {
+		log.Errorf("curl %s fail: %v", uri, err)
+		return nil
+	}
+
+	return oncall.Users
+}
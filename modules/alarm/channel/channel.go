@@ -0,0 +1,142 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package channel
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	cmodel "github.com/open-falcon/falcon-plus/common/model"
+	"github.com/open-falcon/falcon-plus/modules/alarm/g"
+	nproc "github.com/toolkits/proc"
+)
+
+// 发给channel的一条告警通知
+type Message struct {
+	Event   *cmodel.Event
+	Subject string
+	Content string
+	Link    string
+	// action中uic对应的用户邮箱，smtp channel使用
+	Mails []string
+}
+
+type Channel interface {
+	Name() string
+	Type() string
+	Send(msg *Message) error
+}
+
+// 每个channel的发送统计
+type Stat struct {
+	Send  *nproc.SCounterQps
+	Fail  *nproc.SCounterQps
+	Retry *nproc.SCounterQps
+}
+
+func newStat(name string) *Stat {
+	return &Stat{
+		Send:  nproc.NewSCounterQps(name + ".Send"),
+		Fail:  nproc.NewSCounterQps(name + ".Fail"),
+		Retry: nproc.NewSCounterQps(name + ".Retry"),
+	}
+}
+
+type channelItem struct {
+	Channel
+	cfg  *g.ChannelConfig
+	stat *Stat
+}
+
+var channels = make(map[string]*channelItem)
+
+func InitChannels() {
+	for name, cfg := range g.Config().Channels {
+		ch, err := New(name, cfg)
+		if err != nil {
+			log.Fatalf("init channel %s fail: %v", name, err)
+		}
+		channels[name] = &channelItem{
+			Channel: ch,
+			cfg:     cfg,
+			stat:    newStat(name),
+		}
+		log.Infof("channel %s(%s) is ready", name, cfg.Type)
+	}
+}
+
+func New(name string, cfg *g.ChannelConfig) (Channel, error) {
+	switch cfg.Type {
+	case "webhook":
+		return NewWebhookChannel(name, cfg)
+	case "slack":
+		return NewSlackChannel(name, cfg)
+	case "smtp":
+		return NewSmtpChannel(name, cfg)
+	default:
+		return nil, fmt.Errorf("unknown channel type: %s", cfg.Type)
+	}
+}
+
+func Get(name string) (Channel, bool) {
+	item, exists := channels[name]
+	if !exists {
+		return nil, false
+	}
+	return item.Channel, true
+}
+
+// 失败时按指数退避重试
+func Send(name string, msg *Message) error {
+	item, exists := channels[name]
+	if !exists {
+		return fmt.Errorf("channel %s is not configured", name)
+	}
+
+	backoff := time.Duration(item.cfg.Backoff) * time.Millisecond
+	var err error
+	for i := 0; i <= item.cfg.Retry; i++ {
+		if i > 0 {
+			item.stat.Retry.Incr()
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		if err = item.Send(msg); err == nil {
+			item.stat.Send.Incr()
+			return nil
+		}
+		log.Warnf("send to channel %s fail, event:%s, attempt:%d, error:%v", name, msg.Event.Id, i+1, err)
+	}
+
+	item.stat.Fail.Incr()
+	log.Errorf("send to channel %s fail after %d attempts, event:%s, error:%v", name, item.cfg.Retry+1, msg.Event.Id, err)
+	return err
+}
+
+func Stats() []interface{} {
+	ret := make([]interface{}, 0, len(channels)*3)
+	for _, item := range channels {
+		ret = append(ret, item.stat.Send.Get(), item.stat.Fail.Get(), item.stat.Retry.Get())
+	}
+	return ret
+}
+
+func timeout(cfg *g.ChannelConfig) time.Duration {
+	if cfg.Timeout <= 0 {
+		return 5 * time.Second
+	}
+	return time.Duration(cfg.Timeout) * time.Millisecond
+}
@@ -0,0 +1,122 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package channel
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	cmodel "github.com/open-falcon/falcon-plus/common/model"
+	"github.com/open-falcon/falcon-plus/modules/alarm/g"
+)
+
+func testMessage() *Message {
+	return &Message{
+		Event: &cmodel.Event{
+			Id:        "s_1_abc",
+			Endpoint:  "host01",
+			Status:    "PROBLEM",
+			EventTime: 1500000000,
+			Strategy:  &cmodel.Strategy{Metric: "cpu.idle", Priority: 1},
+		},
+		Subject: "[P1][PROBLEM][host01]",
+		Content: "PROBLEM\r\nP1",
+	}
+}
+
+func TestWebhookChannel(t *testing.T) {
+	var body string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bs, _ := ioutil.ReadAll(r.Body)
+		body = string(bs)
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		template string
+		expected string
+	}{
+		{"{{.Event.Endpoint}} {{.Event.Metric}} P{{.Event.Priority}}", "host01 cpu.idle P1"},
+		{`{"endpoint":{{json .Event.Endpoint}},"content":{{json .Content}}}`, `{"endpoint":"host01","content":"PROBLEM\r\nP1"}`},
+		{"", `{"endpoint":"host01","status":"PROBLEM","subject":"[P1][PROBLEM][host01]"}` + "\n"},
+	}
+	for _, tt := range tests {
+		ch, err := NewWebhookChannel("test", &g.ChannelConfig{Url: ts.URL, Template: tt.template})
+		if err != nil {
+			t.Fatalf("NewWebhookChannel(%q) error: %v", tt.template, err)
+		}
+		if err := ch.Send(testMessage()); err != nil {
+			t.Errorf("Send with template %q error: %v", tt.template, err)
+		}
+		if body != tt.expected {
+			t.Errorf("Send with template %q got body %q, expected %q", tt.template, body, tt.expected)
+		}
+	}
+}
+
+func TestSlackChannel(t *testing.T) {
+	var payload slackPayload
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&payload)
+	}))
+	defer ts.Close()
+
+	ch, _ := NewSlackChannel("test", &g.ChannelConfig{Url: ts.URL, Channel: "#ops"})
+	if err := ch.Send(testMessage()); err != nil {
+		t.Fatalf("Send error: %v", err)
+	}
+	if payload.Channel != "#ops" || payload.Text != "[P1][PROBLEM][host01]" {
+		t.Errorf("unexpected payload: %+v", payload)
+	}
+	if len(payload.Attachments) != 1 || payload.Attachments[0].Color != "danger" {
+		t.Errorf("unexpected attachments: %+v", payload.Attachments)
+	}
+}
+
+func TestSendRetry(t *testing.T) {
+	tests := []struct {
+		failures int
+		retry    int
+		calls    int
+		ok       bool
+	}{
+		{0, 2, 1, true},
+		{2, 2, 3, true},
+		{3, 2, 3, false},
+	}
+	for _, tt := range tests {
+		calls := 0
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			if calls <= tt.failures {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		}))
+
+		cfg := &g.ChannelConfig{Type: "webhook", Url: ts.URL, Retry: tt.retry, Backoff: 1}
+		ch, _ := New("retry", cfg)
+		channels["retry"] = &channelItem{Channel: ch, cfg: cfg, stat: newStat("retry")}
+		err := Send("retry", testMessage())
+		ts.Close()
+
+		if calls != tt.calls || (err == nil) != tt.ok {
+			t.Errorf("failures:%d retry:%d got calls:%d err:%v, expected calls:%d ok:%v",
+				tt.failures, tt.retry, calls, err, tt.calls, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package channel
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/open-falcon/falcon-plus/modules/alarm/g"
+)
+
+// Slack incoming webhook的payload，Mattermost兼容这个格式
+type slackPayload struct {
+	Channel     string            `json:"channel,omitempty"`
+	Username    string            `json:"username,omitempty"`
+	Text        string            `json:"text"`
+	Attachments []slackAttachment `json:"attachments,omitempty"`
+}
+
+type slackAttachment struct {
+	Color     string `json:"color"`
+	Title     string `json:"title"`
+	TitleLink string `json:"title_link,omitempty"`
+	Text      string `json:"text"`
+	Ts        int64  `json:"ts"`
+}
+
+type SlackChannel struct {
+	name   string
+	cfg    *g.ChannelConfig
+	client *http.Client
+}
+
+func NewSlackChannel(name string, cfg *g.ChannelConfig) (*SlackChannel, error) {
+	if cfg.Url == "" {
+		return nil, fmt.Errorf("url is required")
+	}
+	return &SlackChannel{
+		name:   name,
+		cfg:    cfg,
+		client: &http.Client{Timeout: timeout(cfg)},
+	}, nil
+}
+
+func (this *SlackChannel) Name() string {
+	return this.name
+}
+
+func (this *SlackChannel) Type() string {
+	return "slack"
+}
+
+func (this *SlackChannel) Send(msg *Message) error {
+	color := "danger"
+	if msg.Event.Status == "OK" {
+		color = "good"
+	}
+	payload := slackPayload{
+		Channel:  this.cfg.Channel,
+		Username: this.cfg.Username,
+		Text:     msg.Subject,
+		Attachments: []slackAttachment{
+			{
+				Color:     color,
+				Title:     fmt.Sprintf("[%s] %s %s", msg.Event.Status, msg.Event.Endpoint, msg.Event.Metric()),
+				TitleLink: msg.Link,
+				Text:      msg.Content,
+				Ts:        msg.Event.EventTime,
+			},
+		},
+	}
+	bs, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return doRequest(this.client, "POST", this.cfg.Url, this.cfg.Headers, bytes.NewReader(bs))
+}
@@ -0,0 +1,150 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package channel
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/open-falcon/falcon-plus/modules/alarm/g"
+)
+
+// 直接通过SMTP发送邮件，收件人是action中uic的用户
+type SmtpChannel struct {
+	name string
+	cfg  *g.ChannelConfig
+	host string
+}
+
+func NewSmtpChannel(name string, cfg *g.ChannelConfig) (*SmtpChannel, error) {
+	if cfg.Addr == "" || cfg.From == "" {
+		return nil, fmt.Errorf("addr and from are required")
+	}
+	host, _, err := net.SplitHostPort(cfg.Addr)
+	if err != nil {
+		return nil, err
+	}
+	return &SmtpChannel{name: name, cfg: cfg, host: host}, nil
+}
+
+func (this *SmtpChannel) Name() string {
+	return this.name
+}
+
+func (this *SmtpChannel) Type() string {
+	return "smtp"
+}
+
+func (this *SmtpChannel) Send(msg *Message) error {
+	if len(msg.Mails) == 0 {
+		return nil
+	}
+
+	var auth smtp.Auth
+	if this.cfg.User != "" {
+		auth = smtp.PlainAuth("", this.cfg.User, this.cfg.Password, this.host)
+	}
+	body := buildMail(this.cfg.From, msg.Mails, msg.Subject, msg.Content)
+
+	c, err := this.dial()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if auth != nil {
+		if err = c.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err = c.Mail(this.cfg.From); err != nil {
+		return err
+	}
+	for _, to := range msg.Mails {
+		if err = c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(body); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// tls为true时使用SMTPS(一般是465端口)，否则服务端支持的话用STARTTLS
+func (this *SmtpChannel) dial() (*smtp.Client, error) {
+	dialer := &net.Dialer{Timeout: timeout(this.cfg)}
+	tlsConfig := &tls.Config{ServerName: this.host}
+
+	var conn net.Conn
+	var err error
+	if this.cfg.Tls {
+		conn, err = tls.DialWithDialer(dialer, "tcp", this.cfg.Addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", this.cfg.Addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// 整个会话的读写超时，避免服务端不响应时一直占用worker
+	if err = conn.SetDeadline(time.Now().Add(sessionTimeout(this.cfg))); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	c, err := smtp.NewClient(conn, this.host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !this.cfg.Tls {
+		if ok, _ := c.Extension("STARTTLS"); ok {
+			if err = c.StartTLS(tlsConfig); err != nil {
+				c.Close()
+				return nil, err
+			}
+		}
+	}
+	return c, nil
+}
+
+// 一次发送要经过多轮交互，按timeout的3倍计算
+func sessionTimeout(cfg *g.ChannelConfig) time.Duration {
+	return 3 * timeout(cfg)
+}
+
+func buildMail(from string, tos []string, subject, content string) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(tos, ","))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	buf.WriteString("\r\n")
+	buf.WriteString(content)
+	return buf.Bytes()
+}
@@ -0,0 +1,122 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package channel
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"text/template"
+
+	"github.com/open-falcon/falcon-plus/modules/alarm/g"
+)
+
+// template里可以使用Message的所有字段, 字符串用json函数转义, 如 {"endpoint":{{json .Event.Endpoint}}}
+var webhookFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		bs, err := json.Marshal(v)
+		return string(bs), err
+	},
+}
+
+// 没有配置template时的webhook body
+type webhookPayload struct {
+	Endpoint string `json:"endpoint"`
+	Status   string `json:"status"`
+	Subject  string `json:"subject"`
+}
+
+type WebhookChannel struct {
+	name   string
+	cfg    *g.ChannelConfig
+	tpl    *template.Template
+	client *http.Client
+}
+
+func NewWebhookChannel(name string, cfg *g.ChannelConfig) (*WebhookChannel, error) {
+	if cfg.Url == "" {
+		return nil, fmt.Errorf("url is required")
+	}
+	var tpl *template.Template
+	if cfg.Template != "" {
+		var err error
+		if tpl, err = template.New(name).Funcs(webhookFuncs).Parse(cfg.Template); err != nil {
+			return nil, err
+		}
+	}
+	return &WebhookChannel{
+		name:   name,
+		cfg:    cfg,
+		tpl:    tpl,
+		client: &http.Client{Timeout: timeout(cfg)},
+	}, nil
+}
+
+func (this *WebhookChannel) Name() string {
+	return this.name
+}
+
+func (this *WebhookChannel) Type() string {
+	return "webhook"
+}
+
+func (this *WebhookChannel) Send(msg *Message) error {
+	var body bytes.Buffer
+	if this.tpl == nil {
+		payload := webhookPayload{
+			Endpoint: msg.Event.Endpoint,
+			Status:   msg.Event.Status,
+			Subject:  msg.Subject,
+		}
+		if err := json.NewEncoder(&body).Encode(payload); err != nil {
+			return err
+		}
+	} else if err := this.tpl.Execute(&body, msg); err != nil {
+		return err
+	}
+
+	method := this.cfg.Method
+	if method == "" {
+		method = "POST"
+	}
+	return doRequest(this.client, method, this.cfg.Url, this.cfg.Headers, &body)
+}
+
+func doRequest(client *http.Client, method, url string, headers map[string]string, body io.Reader) error {
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	if req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	bs, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s %s, status:%d, resp:%s", method, url, resp.StatusCode, string(bs))
+	}
+	return nil
+}
@@ -16,10 +16,14 @@ package cron
 
 import (
 	"fmt"
+	"strings"
 
+	log "github.com/Sirupsen/logrus"
 	"github.com/open-falcon/falcon-plus/common/model"
 	"github.com/open-falcon/falcon-plus/common/utils"
+	"github.com/open-falcon/falcon-plus/modules/alarm/api"
 	"github.com/open-falcon/falcon-plus/modules/alarm/g"
+	eventmodel "github.com/open-falcon/falcon-plus/modules/alarm/model/event"
 )
 
 func BuildCommonSMSContent(event *model.Event) string {
@@ -80,13 +84,94 @@ func BuildCommonMailContent(event *model.Event) string {
 }
 
 func GenerateSmsContent(event *model.Event) string {
+	if content, ok := renderMessageTpl(event, "sms"); ok {
+		return content
+	}
 	return BuildCommonSMSContent(event)
 }
 
+func GenerateMailSubject(event *model.Event) string {
+	if content, ok := renderMessageTpl(event, "mail_subject"); ok {
+		return content
+	}
+	return GenerateSmsContent(event)
+}
+
 func GenerateMailContent(event *model.Event) string {
+	if content, ok := renderMessageTpl(event, "mail"); ok {
+		return content
+	}
 	return BuildCommonMailContent(event)
 }
 
 func GenerateIMContent(event *model.Event) string {
+	if content, ok := renderMessageTpl(event, "im"); ok {
+		return content
+	}
 	return BuildCommonIMContent(event)
 }
+
+// 使用action或者template上配置的消息模板，没有配置或者渲染失败时使用内置的格式
+func renderMessageTpl(event *model.Event, field string) (string, bool) {
+	mtpl := api.GetMessageTpl(event.ActionId(), event.TplId())
+	if mtpl == nil {
+		return "", false
+	}
+
+	var text string
+	switch field {
+	case "sms":
+		text = mtpl.Sms
+	case "im":
+		text = mtpl.IM
+	case "mail_subject":
+		text = mtpl.MailSubject
+	case "mail":
+		text = mtpl.Mail
+	}
+	if text == "" {
+		return "", false
+	}
+
+	var hostgroups []string
+	if strings.Contains(text, ".Hostgroups") {
+		hostgroups = api.HostGroupsOf(event.Endpoint)
+	}
+	content, err := model.RenderMessage(field, text, model.NewMessageData(event, hostgroups, g.Link(event)))
+	if err != nil {
+		log.Errorf("render %s of message template %d fail: %v", field, mtpl.ID, err)
+		return "", false
+	}
+	return content, true
+}
+
+func BuildEscalationSMSContent(ecase *eventmodel.EventCases, step int) string {
+	return fmt.Sprintf(
+		"[P%d][ESCALATION L%d][%s][][%s %s %s %s][O%d %s]",
+		ecase.Priority,
+		step,
+		ecase.Endpoint,
+		ecase.Note,
+		ecase.Func,
+		ecase.Metric,
+		ecase.Cond,
+		ecase.CurrentStep,
+		utils.UnixTsFormat(ecase.Timestamp.Unix()),
+	)
+}
+
+func BuildEscalationMailContent(ecase *eventmodel.EventCases, step int) string {
+	return fmt.Sprintf(
+		"ESCALATION L%d: unacknowledged since %s\r\nP%d\r\nEndpoint:%s\r\nMetric:%s\r\n%s: %s\r\nNote:%s\r\nMax:%d, Current:%d\r\n",
+		step,
+		utils.UnixTsFormat(ecase.Timestamp.Unix()),
+		ecase.Priority,
+		ecase.Endpoint,
+		ecase.Metric,
+		ecase.Func,
+		ecase.Cond,
+		ecase.Note,
+		ecase.MaxStep,
+		ecase.CurrentStep,
+	)
+}
@@ -15,13 +15,22 @@
 package cron
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	log "github.com/Sirupsen/logrus"
+	"io/ioutil"
+	"net/url"
 	"strings"
 	"time"
 
 	"github.com/open-falcon/falcon-plus/common/model"
 	"github.com/open-falcon/falcon-plus/modules/alarm/api"
+	"github.com/open-falcon/falcon-plus/modules/alarm/g"
+	amodel "github.com/open-falcon/falcon-plus/modules/alarm/model"
+	eventmodel "github.com/open-falcon/falcon-plus/modules/alarm/model/event"
 	"github.com/open-falcon/falcon-plus/modules/alarm/redi"
 	"github.com/toolkits/net/httplib"
 )
@@ -36,6 +45,7 @@ func HandleCallback(event *model.Event, action *api.Action) {
 	if teams != "" {
 		phones, mails, ims = api.ParseTeams(teams)
 		smsContent := GenerateSmsContent(event)
+		mailSubject := GenerateMailSubject(event)
 		mailContent := GenerateMailContent(event)
 		imContent := GenerateIMContent(event)
 		if action.BeforeCallbackSms == 1 {
@@ -44,7 +54,7 @@ func HandleCallback(event *model.Event, action *api.Action) {
 		}
 
 		if action.BeforeCallbackMail == 1 {
-			redi.WriteMail(mails, smsContent, mailContent)
+			redi.WriteMail(mails, mailSubject, mailContent)
 		}
 	}
 
@@ -68,6 +78,22 @@ func Callback(event *model.Event, action *api.Action) string {
 		return "callback url is blank"
 	}
 
+	task := buildCallbackTask(event, action)
+	resp, e := deliverCallback(task)
+
+	success := "success"
+	if e != nil {
+		log.Errorf("callback fail, action:%v, event:%s, error:%s", action, event.String(), e.Error())
+		success = fmt.Sprintf("fail:%s", e.Error())
+		retryCallback(task)
+	}
+	message := fmt.Sprintf("curl %s %s. resp: %s", action.Url, success, resp)
+	log.Debugf("callback to url:%s, event:%s, resp:%s", action.Url, event.String(), resp)
+
+	return message
+}
+
+func buildCallbackTask(event *model.Event, action *api.Action) *amodel.CallbackTask {
 	L := make([]string, 0)
 	if len(event.PushedTags) > 0 {
 		for k, v := range event.PushedTags {
@@ -80,28 +106,151 @@ func Callback(event *model.Event, action *api.Action) string {
 		tags = strings.Join(L, ",")
 	}
 
-	req := httplib.Get(action.Url).SetTimeout(3*time.Second, 20*time.Second)
+	task := &amodel.CallbackTask{
+		EventId:  event.Id,
+		ActionId: action.Id,
+		Url:      action.Url,
+	}
 
-	req.Param("endpoint", event.Endpoint)
-	req.Param("metric", event.Metric())
-	req.Param("status", event.Status)
-	req.Param("step", fmt.Sprintf("%d", event.CurrentStep))
-	req.Param("priority", fmt.Sprintf("%d", event.Priority()))
-	req.Param("time", event.FormattedTime())
-	req.Param("tpl_id", fmt.Sprintf("%d", event.TplId()))
-	req.Param("exp_id", fmt.Sprintf("%d", event.ExpressionId()))
-	req.Param("stra_id", fmt.Sprintf("%d", event.StrategyId()))
-	req.Param("tags", tags)
+	if g.Config().Callback.Json {
+		bs, _ := json.Marshal(map[string]interface{}{
+			"event_id": event.Id,
+			"endpoint": event.Endpoint,
+			"metric":   event.Metric(),
+			"status":   event.Status,
+			"step":     event.CurrentStep,
+			"priority": event.Priority(),
+			"time":     event.FormattedTime(),
+			"tpl_id":   event.TplId(),
+			"exp_id":   event.ExpressionId(),
+			"stra_id":  event.StrategyId(),
+			"tags":     event.PushedTags,
+		})
+		task.Method = "POST"
+		task.Body = string(bs)
+		return task
+	}
 
-	resp, e := req.String()
+	params := url.Values{}
+	params.Set("endpoint", event.Endpoint)
+	params.Set("metric", event.Metric())
+	params.Set("status", event.Status)
+	params.Set("step", fmt.Sprintf("%d", event.CurrentStep))
+	params.Set("priority", fmt.Sprintf("%d", event.Priority()))
+	params.Set("time", event.FormattedTime())
+	params.Set("tpl_id", fmt.Sprintf("%d", event.TplId()))
+	params.Set("exp_id", fmt.Sprintf("%d", event.ExpressionId()))
+	params.Set("stra_id", fmt.Sprintf("%d", event.StrategyId()))
+	params.Set("tags", tags)
+	task.Method = "GET"
+	task.Body = params.Encode()
+	return task
+}
 
-	success := "success"
-	if e != nil {
-		log.Errorf("callback fail, action:%v, event:%s, error:%s", action, event.String(), e.Error())
-		success = fmt.Sprintf("fail:%s", e.Error())
+// 发送一次callback，每次尝试都记录到callback_delivery
+func deliverCallback(task *amodel.CallbackTask) (string, error) {
+	task.Attempts++
+
+	var req *httplib.BeegoHttpRequest
+	if task.Method == "POST" {
+		req = httplib.Post(task.Url)
+		req.Header("Content-Type", "application/json")
+		req.Body(task.Body)
+	} else {
+		sep := "?"
+		if strings.Contains(task.Url, "?") {
+			sep = "&"
+		}
+		req = httplib.Get(task.Url + sep + task.Body)
 	}
-	message := fmt.Sprintf("curl %s %s. resp: %s", action.Url, success, resp)
-	log.Debugf("callback to url:%s, event:%s, resp:%s", action.Url, event.String(), resp)
+	req.SetTimeout(3*time.Second, 20*time.Second)
 
-	return message
+	if secret := g.Config().Callback.Secret; secret != "" {
+		ts := fmt.Sprintf("%d", time.Now().Unix())
+		req.Header("X-Falcon-Timestamp", ts)
+		req.Header("X-Falcon-Signature", "sha256="+SignCallback(secret, ts, task.Body))
+	}
+
+	var (
+		code int
+		resp string
+		err  error
+	)
+	r, err := req.Response()
+	if err == nil {
+		defer r.Body.Close()
+		code = r.StatusCode
+		bs, _ := ioutil.ReadAll(r.Body)
+		resp = string(bs)
+		if code < 200 || code >= 300 {
+			err = fmt.Errorf("status code %d", code)
+		}
+	}
+
+	eventmodel.InsertCallbackDelivery(&eventmodel.CallbackDelivery{
+		EventId:  task.EventId,
+		ActionId: task.ActionId,
+		Url:      task.Url,
+		Method:   task.Method,
+		Attempt:  task.Attempts,
+		RespCode: code,
+		Resp:     resp,
+		Err:      err,
+		Dead:     task.Attempts >= g.Config().Callback.MaxAttempts,
+	})
+	return resp, err
+}
+
+// 签名内容是timestamp + "." + body, 接收方可以用相同的secret校验, 并拒绝过旧的timestamp
+func SignCallback(secret, ts, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts + "." + body))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func retryCallback(task *amodel.CallbackTask) {
+	cfg := g.Config().Callback
+	if task.Attempts >= cfg.MaxAttempts {
+		log.Errorf("callback fail after %d attempts, move to dead letter queue, task:%v", task.Attempts, task)
+		redi.WriteDeadCallbackTask(task)
+		return
+	}
+
+	task.NextAt = time.Now().Unix() + callbackBackoff(cfg, task.Attempts)
+	redi.WriteCallbackTask(task)
+}
+
+// callbackBackoff 第attempts次失败之后等待的秒数，每次翻倍，不超过MaxBackoff
+func callbackBackoff(cfg *g.CallbackConfig, attempts int) int64 {
+	backoff := cfg.Backoff << uint(attempts-1)
+	if backoff > cfg.MaxBackoff || backoff <= 0 {
+		backoff = cfg.MaxBackoff
+	}
+	return backoff
+}
+
+// 定时从重试队列中取出到期的callback重新发送，最多concurrency个同时发送
+func ConsumeCallbackRetry() {
+	concurrency := g.Config().Callback.Concurrency
+	sema := make(chan struct{}, concurrency)
+	for {
+		tasks := redi.PopDueCallbackTask(time.Now().Unix(), concurrency)
+		if len(tasks) == 0 {
+			time.Sleep(time.Second)
+			continue
+		}
+
+		for _, task := range tasks {
+			sema <- struct{}{}
+			go func(task *amodel.CallbackTask) {
+				defer func() {
+					<-sema
+				}()
+				if _, err := deliverCallback(task); err != nil {
+					log.Warnf("retry callback fail, task:%v, error:%v", task, err)
+					retryCallback(task)
+				}
+			}(task)
+		}
+	}
 }
@@ -0,0 +1,129 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cron
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/open-falcon/falcon-plus/common/model"
+	"github.com/open-falcon/falcon-plus/modules/alarm/api"
+	"github.com/open-falcon/falcon-plus/modules/alarm/g"
+)
+
+func setCallbackJson(t *testing.T, enabled bool) {
+	f, err := ioutil.TempFile("", "alarm-cfg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	fmt.Fprintf(f, `{"callback": {"json": %v}}`, enabled)
+	f.Close()
+	g.ParseConfig(f.Name())
+}
+
+func TestSignCallback(t *testing.T) {
+	// 用python的hmac.new(b'falcon', b'1500000000.endpoint=web-01&status=PROBLEM', hashlib.sha256)计算
+	want := "efdf22a7cbf34b61500c7ce4a9fb061b9be91112e1cc59afa1e71fe3a6c6dd75"
+	if got := SignCallback("falcon", "1500000000", "endpoint=web-01&status=PROBLEM"); got != want {
+		t.Errorf("SignCallback = %s, want %s", got, want)
+	}
+	if SignCallback("falcon", "1500000001", "endpoint=web-01&status=PROBLEM") == want {
+		t.Errorf("signature should change with timestamp")
+	}
+	if SignCallback("other", "1500000000", "endpoint=web-01&status=PROBLEM") == want {
+		t.Errorf("signature should change with secret")
+	}
+}
+
+func TestBuildCallbackTask(t *testing.T) {
+	event := &model.Event{
+		Id:          "s_1_abc",
+		Endpoint:    "web-01",
+		Status:      "PROBLEM",
+		CurrentStep: 2,
+		EventTime:   1500000000,
+		PushedTags:  map[string]string{"mount": "/home"},
+		Strategy:    &model.Strategy{Id: 1, Metric: "df.bytes.used.percent", Priority: 1, Tpl: &model.Template{Id: 3}},
+	}
+	action := &api.Action{Id: 5, Url: "http://example.com/callback?token=x"}
+
+	setCallbackJson(t, false)
+	task := buildCallbackTask(event, action)
+	if task.EventId != event.Id || task.ActionId != 5 || task.Url != action.Url || task.Method != "GET" || task.Attempts != 0 {
+		t.Fatalf("bad task %+v", task)
+	}
+	params, err := url.ParseQuery(task.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"endpoint": "web-01",
+		"metric":   "df.bytes.used.percent",
+		"status":   "PROBLEM",
+		"step":     "2",
+		"priority": "1",
+		"time":     event.FormattedTime(),
+		"tpl_id":   "3",
+		"exp_id":   "0",
+		"stra_id":  "1",
+		"tags":     "mount:/home",
+	}
+	for k, v := range want {
+		if params.Get(k) != v {
+			t.Errorf("param %s = %q, want %q", k, params.Get(k), v)
+		}
+	}
+
+	setCallbackJson(t, true)
+	task = buildCallbackTask(event, action)
+	if task.Method != "POST" {
+		t.Fatalf("json callback should be POST, got %s", task.Method)
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal([]byte(task.Body), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body["event_id"] != "s_1_abc" || body["endpoint"] != "web-01" || body["step"] != 2.0 || body["stra_id"] != 1.0 {
+		t.Errorf("bad json body %s", task.Body)
+	}
+	if tags, ok := body["tags"].(map[string]interface{}); !ok || tags["mount"] != "/home" {
+		t.Errorf("bad json tags %s", task.Body)
+	}
+}
+
+func TestCallbackBackoff(t *testing.T) {
+	cfg := &g.CallbackConfig{Backoff: 10, MaxBackoff: 300}
+	tests := []struct {
+		attempts int
+		want     int64
+	}{
+		{1, 10},
+		{2, 20},
+		{3, 40},
+		{5, 160},
+		{6, 300},
+		{100, 300},
+	}
+	for _, tt := range tests {
+		if got := callbackBackoff(cfg, tt.attempts); got != tt.want {
+			t.Errorf("callbackBackoff(%d) = %d, want %d", tt.attempts, got, tt.want)
+		}
+	}
+}
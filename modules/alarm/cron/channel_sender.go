@@ -0,0 +1,90 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cron
+
+import (
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	cmodel "github.com/open-falcon/falcon-plus/common/model"
+	"github.com/open-falcon/falcon-plus/modules/alarm/api"
+	"github.com/open-falcon/falcon-plus/modules/alarm/channel"
+	"github.com/open-falcon/falcon-plus/modules/alarm/g"
+)
+
+type channelTask struct {
+	name string
+	msg  *channel.Message
+}
+
+// 发送到action配置的channel，channel不做报警合并
+// 只放入队列，不阻塞告警事件的处理
+func SendToChannels(event *cmodel.Event, action *api.Action) {
+	if action.Channels == "" {
+		return
+	}
+
+	names := []string{}
+	hasSmtp := false
+	for _, name := range strings.Split(action.Channels, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		ch, exists := channel.Get(name)
+		if !exists {
+			log.Errorf("channel %s of action %d is not configured", name, action.Id)
+			continue
+		}
+		if ch.Type() == "smtp" {
+			hasSmtp = true
+		}
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return
+	}
+
+	// msg会被多个goroutine同时读取，入队之后不能再修改
+	msg := &channel.Message{
+		Event:   event,
+		Subject: GenerateMailSubject(event),
+		Content: GenerateMailContent(event),
+		Link:    g.Link(event),
+	}
+	if hasSmtp {
+		_, msg.Mails, _ = api.ParseTeams(action.Uic)
+	}
+
+	for _, name := range names {
+		select {
+		case ChannelQueue <- &channelTask{name: name, msg: msg}:
+		default:
+			log.Errorf("channel queue is full, drop event:%s of channel %s", event.Id, name)
+		}
+	}
+}
+
+func ConsumeChannel() {
+	for task := range ChannelQueue {
+		ChannelWorkerChan <- 1
+		go func(task *channelTask) {
+			defer func() {
+				<-ChannelWorkerChan
+			}()
+			channel.Send(task.name, task.msg)
+		}(task)
+	}
+}
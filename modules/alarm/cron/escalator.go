@@ -0,0 +1,130 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cron
+
+import (
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	cmodel "github.com/open-falcon/falcon-plus/common/model"
+	"github.com/open-falcon/falcon-plus/common/utils"
+	"github.com/open-falcon/falcon-plus/modules/alarm/api"
+	eventmodel "github.com/open-falcon/falcon-plus/modules/alarm/model/event"
+	"github.com/open-falcon/falcon-plus/modules/alarm/redi"
+)
+
+// 告警产生后超过after_minutes分钟还没有被确认(ack)、处理或恢复，就通知下一级的uic
+func Escalate() {
+	for {
+		escalate()
+		time.Sleep(time.Minute)
+	}
+}
+
+func escalate() {
+	cases, err := eventmodel.GetUnackedEventCases()
+	if err != nil {
+		return
+	}
+
+	now := time.Now()
+	actions := make(map[int]*api.Action)
+	for i := range cases {
+		ecase := &cases[i]
+
+		action, exists := actions[ecase.ActionId]
+		if !exists {
+			action = api.GetAction(ecase.ActionId)
+			actions[ecase.ActionId] = action
+		}
+		if action == nil || len(action.Escalations) == 0 {
+			continue
+		}
+
+		due := dueEscalations(ecase, action.Escalations, now)
+		if len(due) == 0 {
+			continue
+		}
+		// 被屏蔽或抑制的告警不升级，也不推进step，屏蔽结束后还未处理的告警照常升级
+		if suppressed(eventOfCase(ecase)) {
+			continue
+		}
+		for _, e := range due {
+			notifyEscalation(ecase, e)
+		}
+		eventmodel.SetEscalationStep(ecase.Id, due[len(due)-1].Step)
+	}
+}
+
+// dueEscalations 返回已经到时间、还没有通知过的升级，escalations按step从小到大排列
+func dueEscalations(ecase *eventmodel.EventCases, escalations []*api.Escalation, now time.Time) []*api.Escalation {
+	// timestamp随每次更新变化, 升级按escalated_at计算; 升级前的老数据没有escalated_at
+	base := ecase.EscalatedAt
+	if base.IsZero() {
+		base = ecase.Timestamp
+	}
+	elapsed := now.Sub(base)
+
+	due := []*api.Escalation{}
+	for _, e := range escalations {
+		if e.Step <= ecase.EscalationStep {
+			continue
+		}
+		if elapsed < time.Duration(e.AfterMinutes)*time.Minute {
+			break
+		}
+		due = append(due, e)
+	}
+	return due
+}
+
+// eventOfCase 用于对未恢复的告警做屏蔽和抑制判断，event_cases中的metric是metric/tags的格式
+func eventOfCase(ecase *eventmodel.EventCases) *cmodel.Event {
+	event := &cmodel.Event{
+		Id:          ecase.Id,
+		Status:      ecase.Status,
+		Endpoint:    ecase.Endpoint,
+		CurrentStep: ecase.CurrentStep,
+		EventTime:   ecase.Timestamp.Unix(),
+	}
+	metric := ecase.Metric
+	if idx := strings.Index(ecase.Metric, "/"); idx > 0 {
+		metric = ecase.Metric[:idx]
+		_, event.PushedTags = utils.SplitTagsString(ecase.Metric[idx+1:])
+	}
+	if ecase.ExpressionId != 0 {
+		event.Expression = &cmodel.Expression{Id: ecase.ExpressionId, Metric: metric}
+	} else {
+		event.Strategy = &cmodel.Strategy{Id: ecase.StrategyId, Metric: metric}
+	}
+	return event
+}
+
+func notifyEscalation(ecase *eventmodel.EventCases, e *api.Escalation) {
+	log.Infof("escalate event case %s to step %d: %s", ecase.Id, e.Step, e.Uic)
+
+	phones, mails, ims := api.ParseTeams(e.Uic)
+	smsContent := BuildEscalationSMSContent(ecase, e.Step)
+	mailContent := BuildEscalationMailContent(ecase, e.Step)
+
+	// <=P2 才发送短信
+	if ecase.Priority < 3 {
+		redi.WriteSms(phones, smsContent)
+	}
+
+	redi.WriteIM(ims, smsContent)
+	redi.WriteMail(mails, smsContent, mailContent)
+}
@@ -0,0 +1,72 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cron
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/open-falcon/falcon-plus/modules/alarm/api"
+	eventmodel "github.com/open-falcon/falcon-plus/modules/alarm/model/event"
+)
+
+func TestDueEscalations(t *testing.T) {
+	start := time.Unix(1500000000, 0)
+	escalations := []*api.Escalation{
+		{Step: 1, AfterMinutes: 10, Uic: "ops"},
+		{Step: 2, AfterMinutes: 30, Uic: "leader"},
+		{Step: 3, AfterMinutes: 60, Uic: "director"},
+	}
+	tests := []struct {
+		ecase eventmodel.EventCases
+		now   time.Time
+		steps []int
+	}{
+		{eventmodel.EventCases{EscalatedAt: start}, start.Add(9 * time.Minute), []int{}},
+		{eventmodel.EventCases{EscalatedAt: start}, start.Add(10 * time.Minute), []int{1}},
+		// 一次到期多级时依次通知
+		{eventmodel.EventCases{EscalatedAt: start}, start.Add(45 * time.Minute), []int{1, 2}},
+		{eventmodel.EventCases{EscalatedAt: start}, start.Add(2 * time.Hour), []int{1, 2, 3}},
+		// 已经通知过的级别不再通知
+		{eventmodel.EventCases{EscalatedAt: start, EscalationStep: 1}, start.Add(45 * time.Minute), []int{2}},
+		{eventmodel.EventCases{EscalatedAt: start, EscalationStep: 3}, start.Add(2 * time.Hour), []int{}},
+		// 按escalated_at计算, 不受timestamp影响
+		{eventmodel.EventCases{EscalatedAt: start, Timestamp: start.Add(-time.Hour)}, start.Add(20 * time.Minute), []int{1}},
+		// 老数据没有escalated_at时按timestamp计算
+		{eventmodel.EventCases{Timestamp: start}, start.Add(35 * time.Minute), []int{1, 2}},
+	}
+	for i, tt := range tests {
+		due := dueEscalations(&tt.ecase, escalations, tt.now)
+		steps := []int{}
+		for _, e := range due {
+			steps = append(steps, e.Step)
+		}
+		if !reflect.DeepEqual(steps, tt.steps) {
+			t.Errorf("case %d: got steps %v, want %v", i, steps, tt.steps)
+		}
+	}
+}
+
+func TestEventOfCase(t *testing.T) {
+	event := eventOfCase(&eventmodel.EventCases{Id: "s_1_abc", Endpoint: "web-01", Metric: "df.bytes.used.percent/mount=/home", StrategyId: 1, Status: "PROBLEM"})
+	if event.StrategyId() != 1 || event.Metric() != "df.bytes.used.percent" || event.PushedTags["mount"] != "/home" || event.Endpoint != "web-01" {
+		t.Errorf("bad event of strategy case: %v", event)
+	}
+	event = eventOfCase(&eventmodel.EventCases{Id: "e_9_abc", Endpoint: "web-01", Metric: "cpu.idle", ExpressionId: 9})
+	if event.ExpressionId() != 9 || event.StrategyId() != 0 || event.Metric() != "cpu.idle" || len(event.PushedTags) != 0 {
+		t.Errorf("bad event of expression case: %v", event)
+	}
+}
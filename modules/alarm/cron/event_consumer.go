@@ -21,10 +21,25 @@ import (
 	cmodel "github.com/open-falcon/falcon-plus/common/model"
 	"github.com/open-falcon/falcon-plus/modules/alarm/api"
 	"github.com/open-falcon/falcon-plus/modules/alarm/g"
+	eventmodel "github.com/open-falcon/falcon-plus/modules/alarm/model/event"
 	"github.com/open-falcon/falcon-plus/modules/alarm/redi"
 )
 
+// 先判断抑制，源告警的状态要随每个event更新
+func suppressed(event *cmodel.Event) bool {
+	return Inhibitor.Inhibited(event) || Silencer.Silenced(event)
+}
+
 func consume(event *cmodel.Event, isHigh bool) {
+	// 被抑制或屏蔽的告警已经记录在event_cases中，只是不再发送通知
+	if suppressed(event) {
+		return
+	}
+	// 已确认的告警不再重复通知，恢复通知照常发送
+	if event.Status == "PROBLEM" && event.CurrentStep > 1 && eventmodel.IsAcknowledged(event.Id) {
+		return
+	}
+
 	actionId := event.ActionId()
 	if actionId <= 0 {
 		return
@@ -39,6 +54,8 @@ func consume(event *cmodel.Event, isHigh bool) {
 		HandleCallback(event, action)
 	}
 
+	SendToChannels(event, action)
+
 	if isHigh {
 		consumeHighEvents(event, action)
 	} else {
@@ -55,6 +72,7 @@ func consumeHighEvents(event *cmodel.Event, action *api.Action) {
 	phones, mails, ims := api.ParseTeams(action.Uic)
 
 	smsContent := GenerateSmsContent(event)
+	mailSubject := GenerateMailSubject(event)
 	mailContent := GenerateMailContent(event)
 	imContent := GenerateIMContent(event)
 
@@ -64,7 +82,7 @@ func consumeHighEvents(event *cmodel.Event, action *api.Action) {
 	}
 
 	redi.WriteIM(ims, imContent)
-	redi.WriteMail(mails, smsContent, mailContent)
+	redi.WriteMail(mails, mailSubject, mailContent)
 
 }
 
@@ -121,7 +139,7 @@ func ParseUserMail(event *cmodel.Event, action *api.Action) {
 	userMap := api.GetUsers(action.Uic)
 
 	metric := event.Metric()
-	subject := GenerateSmsContent(event)
+	subject := GenerateMailSubject(event)
 	content := GenerateMailContent(event)
 	status := event.Status
 	priority := event.Priority()
@@ -0,0 +1,260 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cron
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	cmodel "github.com/open-falcon/falcon-plus/common/model"
+	"github.com/open-falcon/falcon-plus/common/utils"
+	"github.com/open-falcon/falcon-plus/modules/alarm/api"
+	eventmodel "github.com/open-falcon/falcon-plus/modules/alarm/model/event"
+	"github.com/open-falcon/falcon-plus/modules/api/app/model/alarm"
+)
+
+// 处于PROBLEM状态、可能抑制其他告警的源告警
+type inhibitSource struct {
+	Id         string
+	Endpoint   string
+	Metric     string
+	Tags       map[string]string
+	StrategyId int
+}
+
+type inhibitRule struct {
+	*alarm.InhibitRule
+	sourceEndpoint *regexp.Regexp
+	sourceTags     map[string]string
+	targetEndpoint *regexp.Regexp
+	targetTags     map[string]string
+	equal          []string
+}
+
+type SafeInhibitor struct {
+	sync.RWMutex
+	Rules   []*inhibitRule
+	Sources map[string]*inhibitSource
+}
+
+var Inhibitor = &SafeInhibitor{Sources: make(map[string]*inhibitSource)}
+
+func SyncInhibitRules() {
+	for {
+		syncInhibitRules()
+		time.Sleep(time.Minute)
+	}
+}
+
+func syncInhibitRules() {
+	rules, err := api.CurlInhibitRules()
+	if err != nil {
+		return
+	}
+
+	compiled := make([]*inhibitRule, 0, len(rules))
+	for _, rule := range rules {
+		r, err := compileInhibitRule(rule)
+		if err != nil {
+			log.Errorf("compile inhibit rule %d fail: %v", rule.ID, err)
+			continue
+		}
+		compiled = append(compiled, r)
+	}
+
+	// 规则可能有变化，从数据库里重新加载源告警
+	sources := make(map[string]*inhibitSource)
+	cases, err := eventmodel.GetProblemEventCases()
+	if err != nil {
+		return
+	}
+	for _, c := range cases {
+		src := sourceOfEventCase(&c)
+		for _, r := range compiled {
+			if r.matchSource(src) {
+				sources[src.Id] = src
+				break
+			}
+		}
+	}
+
+	Inhibitor.Lock()
+	defer Inhibitor.Unlock()
+	Inhibitor.Rules = compiled
+	Inhibitor.Sources = sources
+}
+
+func compileInhibitRule(rule *alarm.InhibitRule) (r *inhibitRule, err error) {
+	r = &inhibitRule{InhibitRule: rule}
+	if r.sourceEndpoint, err = regexp.Compile(rule.SourceEndpoint); err != nil {
+		return
+	}
+	if r.targetEndpoint, err = regexp.Compile(rule.TargetEndpoint); err != nil {
+		return
+	}
+	if err, r.sourceTags = utils.SplitTagsString(rule.SourceTags); err != nil {
+		return
+	}
+	if err, r.targetTags = utils.SplitTagsString(rule.TargetTags); err != nil {
+		return
+	}
+	for _, key := range strings.Split(rule.Equal, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			r.equal = append(r.equal, key)
+		}
+	}
+	return
+}
+
+// event_cases中的metric是metric/tags的格式
+func sourceOfEventCase(c *eventmodel.EventCases) *inhibitSource {
+	src := &inhibitSource{
+		Id:         c.Id,
+		Endpoint:   c.Endpoint,
+		Metric:     c.Metric,
+		StrategyId: c.StrategyId,
+	}
+	if idx := strings.Index(c.Metric, "/"); idx > 0 {
+		src.Metric = c.Metric[:idx]
+		_, src.Tags = utils.SplitTagsString(c.Metric[idx+1:])
+	}
+	return src
+}
+
+func sourceOfEvent(event *cmodel.Event) *inhibitSource {
+	return &inhibitSource{
+		Id:         event.Id,
+		Endpoint:   event.Endpoint,
+		Metric:     event.Metric(),
+		Tags:       event.PushedTags,
+		StrategyId: event.StrategyId(),
+	}
+}
+
+func containsTags(tags map[string]string, subset map[string]string) bool {
+	for k, v := range subset {
+		if myVal, exists := tags[k]; !exists || myVal != v {
+			return false
+		}
+	}
+	return true
+}
+
+func (this *inhibitRule) matchSource(src *inhibitSource) bool {
+	if this.SourceStrategyId != 0 && int64(src.StrategyId) != this.SourceStrategyId {
+		return false
+	}
+	if this.SourceMetric != "" && src.Metric != this.SourceMetric {
+		return false
+	}
+	return this.sourceEndpoint.MatchString(src.Endpoint) && containsTags(src.Tags, this.sourceTags)
+}
+
+func (this *inhibitRule) matchTarget(target *inhibitSource, src *inhibitSource) bool {
+	if this.TargetMetric != "" && target.Metric != this.TargetMetric {
+		return false
+	}
+	if !this.targetEndpoint.MatchString(target.Endpoint) || !containsTags(target.Tags, this.targetTags) {
+		return false
+	}
+
+	for _, key := range this.equal {
+		switch key {
+		case "endpoint":
+			if target.Endpoint != src.Endpoint {
+				return false
+			}
+		case "hostgroup":
+			if !shareHostGroup(target.Endpoint, src.Endpoint) {
+				return false
+			}
+		default:
+			myVal, exists := target.Tags[key]
+			if srcVal, ok := src.Tags[key]; !exists || !ok || myVal != srcVal {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// shareHostGroup 在处理event的流程中调用, 只读缓存, 不等待api;
+// hostgroup还没有查到时认为不在同一个组, 宁可多发告警也不误抑制
+func shareHostGroup(endpoint1, endpoint2 string) bool {
+	if endpoint1 == endpoint2 {
+		return true
+	}
+
+	groups1, ok1 := api.CachedHostGroupsOf(endpoint1)
+	groups2, ok2 := api.CachedHostGroupsOf(endpoint2)
+	if !ok1 || !ok2 {
+		return false
+	}
+	groups := make(map[string]struct{})
+	for _, grp := range groups1 {
+		groups[grp] = struct{}{}
+	}
+	for _, grp := range groups2 {
+		if _, ok := groups[grp]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// 先根据event更新源告警，再判断event是否被抑制
+// 源告警本身不会被与之匹配的规则抑制
+func (this *SafeInhibitor) Inhibited(event *cmodel.Event) bool {
+	target := sourceOfEvent(event)
+
+	this.Lock()
+	isSource := false
+	for _, r := range this.Rules {
+		if r.matchSource(target) {
+			isSource = true
+			break
+		}
+	}
+	if isSource && event.Status == "PROBLEM" {
+		this.Sources[event.Id] = target
+	} else {
+		delete(this.Sources, event.Id)
+	}
+	rules := this.Rules
+	sources := make([]*inhibitSource, 0, len(this.Sources))
+	for _, src := range this.Sources {
+		sources = append(sources, src)
+	}
+	this.Unlock()
+
+	for _, r := range rules {
+		if r.matchSource(target) {
+			continue
+		}
+		for _, src := range sources {
+			if !r.matchSource(src) || !r.matchTarget(target, src) {
+				continue
+			}
+			log.Infof("event %s is inhibited by rule %d, source event: %s", event.Id, r.ID, src.Id)
+			return true
+		}
+	}
+
+	return false
+}
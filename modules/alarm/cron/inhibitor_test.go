@@ -0,0 +1,103 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cron
+
+import (
+	"testing"
+
+	"github.com/open-falcon/falcon-plus/modules/alarm/api"
+	"github.com/open-falcon/falcon-plus/modules/api/app/model/alarm"
+)
+
+func TestInhibitRuleMatchSource(t *testing.T) {
+	rule, err := compileInhibitRule(&alarm.InhibitRule{
+		SourceEndpoint:   "^switch-",
+		SourceMetric:     "net.port.status",
+		SourceTags:       "port=uplink",
+		SourceStrategyId: 7,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		src  *inhibitSource
+		want bool
+	}{
+		{&inhibitSource{Endpoint: "switch-01", Metric: "net.port.status", Tags: map[string]string{"port": "uplink", "idc": "bj"}, StrategyId: 7}, true},
+		{&inhibitSource{Endpoint: "web-01", Metric: "net.port.status", Tags: map[string]string{"port": "uplink"}, StrategyId: 7}, false},
+		{&inhibitSource{Endpoint: "switch-01", Metric: "cpu.idle", Tags: map[string]string{"port": "uplink"}, StrategyId: 7}, false},
+		{&inhibitSource{Endpoint: "switch-01", Metric: "net.port.status", Tags: map[string]string{"port": "eth0"}, StrategyId: 7}, false},
+		{&inhibitSource{Endpoint: "switch-01", Metric: "net.port.status", StrategyId: 7}, false},
+		{&inhibitSource{Endpoint: "switch-01", Metric: "net.port.status", Tags: map[string]string{"port": "uplink"}, StrategyId: 8}, false},
+	}
+	for i, tt := range tests {
+		if got := rule.matchSource(tt.src); got != tt.want {
+			t.Errorf("case %d: matchSource = %v, want %v", i, got, tt.want)
+		}
+	}
+
+	// 没有配置的条件不做限制
+	empty, err := compileInhibitRule(&alarm.InhibitRule{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !empty.matchSource(&inhibitSource{Endpoint: "web-01", Metric: "cpu.idle"}) {
+		t.Errorf("empty rule should match any source")
+	}
+
+	if _, err := compileInhibitRule(&alarm.InhibitRule{SourceEndpoint: "("}); err == nil {
+		t.Errorf("bad endpoint regexp should fail")
+	}
+	if _, err := compileInhibitRule(&alarm.InhibitRule{TargetTags: "a"}); err == nil {
+		t.Errorf("bad target tags should fail")
+	}
+}
+
+func TestInhibitRuleMatchTarget(t *testing.T) {
+	api.HostGroups.Set("web-01", []string{"web", "bj"})
+	api.HostGroups.Set("web-02", []string{"web"})
+	api.HostGroups.Set("db-01", []string{"db"})
+
+	src := &inhibitSource{Endpoint: "web-01", Metric: "agent.alive", Tags: map[string]string{"idc": "bj"}}
+	tests := []struct {
+		rule   alarm.InhibitRule
+		target *inhibitSource
+		want   bool
+	}{
+		{alarm.InhibitRule{TargetMetric: "cpu.idle"}, &inhibitSource{Endpoint: "web-02", Metric: "cpu.idle"}, true},
+		{alarm.InhibitRule{TargetMetric: "cpu.idle"}, &inhibitSource{Endpoint: "web-02", Metric: "mem.used"}, false},
+		{alarm.InhibitRule{TargetEndpoint: "^db-"}, &inhibitSource{Endpoint: "web-02", Metric: "cpu.idle"}, false},
+		{alarm.InhibitRule{TargetTags: "app=nginx"}, &inhibitSource{Endpoint: "web-02", Tags: map[string]string{"app": "nginx"}}, true},
+		{alarm.InhibitRule{TargetTags: "app=nginx"}, &inhibitSource{Endpoint: "web-02", Tags: map[string]string{"app": "php"}}, false},
+		{alarm.InhibitRule{Equal: "endpoint"}, &inhibitSource{Endpoint: "web-01", Metric: "cpu.idle"}, true},
+		{alarm.InhibitRule{Equal: "endpoint"}, &inhibitSource{Endpoint: "web-02", Metric: "cpu.idle"}, false},
+		{alarm.InhibitRule{Equal: "idc"}, &inhibitSource{Endpoint: "web-02", Tags: map[string]string{"idc": "bj"}}, true},
+		{alarm.InhibitRule{Equal: "idc"}, &inhibitSource{Endpoint: "web-02", Tags: map[string]string{"idc": "sh"}}, false},
+		{alarm.InhibitRule{Equal: "idc"}, &inhibitSource{Endpoint: "web-02"}, false},
+		{alarm.InhibitRule{Equal: " idc , endpoint "}, &inhibitSource{Endpoint: "web-01", Tags: map[string]string{"idc": "bj"}}, true},
+		{alarm.InhibitRule{Equal: "hostgroup"}, &inhibitSource{Endpoint: "web-02"}, true},
+		{alarm.InhibitRule{Equal: "hostgroup"}, &inhibitSource{Endpoint: "db-01"}, false},
+	}
+	for i, tt := range tests {
+		rule, err := compileInhibitRule(&tt.rule)
+		if err != nil {
+			t.Errorf("case %d: compile error %v", i, err)
+			continue
+		}
+		if got := rule.matchTarget(tt.target, src); got != tt.want {
+			t.Errorf("case %d: matchTarget = %v, want %v", i, got, tt.want)
+		}
+	}
+}
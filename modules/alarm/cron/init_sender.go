@@ -22,6 +22,10 @@ var (
 	IMWorkerChan   chan int
 	SmsWorkerChan  chan int
 	MailWorkerChan chan int
+	// 所有channel共用
+	ChannelWorkerChan chan int
+	// 等待发送到channel的通知
+	ChannelQueue chan *channelTask
 )
 
 func InitSenderWorker() {
@@ -29,4 +33,9 @@ func InitSenderWorker() {
 	IMWorkerChan = make(chan int, workerConfig.IM)
 	SmsWorkerChan = make(chan int, workerConfig.Sms)
 	MailWorkerChan = make(chan int, workerConfig.Mail)
+	if workerConfig.Channel <= 0 {
+		workerConfig.Channel = 10
+	}
+	ChannelWorkerChan = make(chan int, workerConfig.Channel)
+	ChannelQueue = make(chan *channelTask, workerConfig.Channel*100)
 }
@@ -0,0 +1,77 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cron
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	cmodel "github.com/open-falcon/falcon-plus/common/model"
+	"github.com/open-falcon/falcon-plus/modules/alarm/api"
+)
+
+type SafeSilencer struct {
+	sync.RWMutex
+	Matchers []*cmodel.SilenceMatcher
+}
+
+var Silencer = &SafeSilencer{}
+
+func SyncSilences() {
+	for {
+		syncSilences()
+		time.Sleep(30 * time.Second)
+	}
+}
+
+func syncSilences() {
+	silences, err := api.CurlSilences()
+	if err != nil {
+		return
+	}
+
+	matchers := make([]*cmodel.SilenceMatcher, 0, len(silences))
+	for _, s := range silences {
+		m, err := cmodel.NewSilenceMatcher(s)
+		if err != nil {
+			log.Errorf("compile silence %d fail: %v", s.Id, err)
+			continue
+		}
+		matchers = append(matchers, m)
+	}
+
+	Silencer.Lock()
+	Silencer.Matchers = matchers
+	Silencer.Unlock()
+}
+
+// 被屏蔽的event仍然入库，只是不发送通知
+func (this *SafeSilencer) Silenced(event *cmodel.Event) bool {
+	this.RLock()
+	defer this.RUnlock()
+
+	now := time.Now()
+	for _, m := range this.Matchers {
+		if !m.IsActive(now) {
+			continue
+		}
+		if m.Match(event, api.HostGroupsOf) {
+			log.Debugf("event %s is silenced by %s", event.Id, m.String())
+			return true
+		}
+	}
+	return false
+}
@@ -53,9 +53,48 @@ type FalconPortalConfig struct {
 }
 
 type WorkerConfig struct {
-	IM   int `json:"im"`
-	Sms  int `json:"sms"`
-	Mail int `json:"mail"`
+	IM      int `json:"im"`
+	Sms     int `json:"sms"`
+	Mail    int `json:"mail"`
+	Channel int `json:"channel"`
+}
+
+// 通知渠道, type: webhook, slack, smtp
+type ChannelConfig struct {
+	Type string `json:"type"`
+	// webhook, slack
+	Url      string            `json:"url"`
+	Method   string            `json:"method"`
+	Headers  map[string]string `json:"headers"`
+	Template string            `json:"template"`
+	Channel  string            `json:"channel"`
+	Username string            `json:"username"`
+	// smtp
+	Addr     string `json:"addr"`
+	User     string `json:"user"`
+	Password string `json:"password"`
+	From     string `json:"from"`
+	Tls      bool   `json:"tls"`
+	// 超时时间(毫秒)；失败后最多重试retry次，第一次重试前等待backoff毫秒，之后每次翻倍
+	Timeout int `json:"timeout"`
+	Retry   int `json:"retry"`
+	Backoff int `json:"backoff"`
+}
+
+// callback失败后放入retryQueue(redis有序集合)重试，第n次重试前等待backoff*2^(n-1)秒，最多maxBackoff秒
+// 重试时最多concurrency个callback同时发送
+// 一共尝试maxAttempts次仍然失败的放入deadLetterQueue
+// secret不为空时用HMAC-SHA256对请求签名，放在X-Falcon-Signature头里
+type CallbackConfig struct {
+	RetryQueue      string `json:"retryQueue"`
+	DeadLetterQueue string `json:"deadLetterQueue"`
+	DeadLetterSize  int    `json:"deadLetterSize"`
+	MaxAttempts     int    `json:"maxAttempts"`
+	Backoff         int64  `json:"backoff"`
+	MaxBackoff      int64  `json:"maxBackoff"`
+	Concurrency     int    `json:"concurrency"`
+	Secret          string `json:"secret"`
+	Json            bool   `json:"json"`
 }
 
 type HousekeeperConfig struct {
@@ -64,13 +103,15 @@ type HousekeeperConfig struct {
 }
 
 type GlobalConfig struct {
-	LogLevel     string              `json:"log_level"`
-	FalconPortal *FalconPortalConfig `json:"falcon_portal"`
-	Http         *HttpConfig         `json:"http"`
-	Redis        *RedisConfig        `json:"redis"`
-	Api          *ApiConfig          `json:"api"`
-	Worker       *WorkerConfig       `json:"worker"`
-	Housekeeper  *HousekeeperConfig  `json:"Housekeeper"`
+	LogLevel     string                    `json:"log_level"`
+	FalconPortal *FalconPortalConfig       `json:"falcon_portal"`
+	Http         *HttpConfig               `json:"http"`
+	Redis        *RedisConfig              `json:"redis"`
+	Api          *ApiConfig                `json:"api"`
+	Worker       *WorkerConfig             `json:"worker"`
+	Housekeeper  *HousekeeperConfig        `json:"Housekeeper"`
+	Channels     map[string]*ChannelConfig `json:"channels"`
+	Callback     *CallbackConfig           `json:"callback"`
 }
 
 var (
@@ -107,6 +148,31 @@ func ParseConfig(cfg string) {
 		log.Fatalln("parse config file:", cfg, "fail:", err)
 	}
 
+	if c.Callback == nil {
+		c.Callback = &CallbackConfig{}
+	}
+	if c.Callback.RetryQueue == "" {
+		c.Callback.RetryQueue = "/zset/callback/retry"
+	}
+	if c.Callback.DeadLetterQueue == "" {
+		c.Callback.DeadLetterQueue = "/queue/callback/dead"
+	}
+	if c.Callback.DeadLetterSize <= 0 {
+		c.Callback.DeadLetterSize = 10000
+	}
+	if c.Callback.MaxAttempts <= 0 {
+		c.Callback.MaxAttempts = 5
+	}
+	if c.Callback.Backoff <= 0 {
+		c.Callback.Backoff = 10
+	}
+	if c.Callback.MaxBackoff <= 0 {
+		c.Callback.MaxBackoff = 3600
+	}
+	if c.Callback.Concurrency <= 0 {
+		c.Callback.Concurrency = 10
+	}
+
 	configLock.Lock()
 	defer configLock.Unlock()
 	config = &c
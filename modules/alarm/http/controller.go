@@ -16,6 +16,7 @@ package http
 
 import (
 	"github.com/gin-gonic/gin"
+	"github.com/open-falcon/falcon-plus/modules/alarm/channel"
 	"github.com/open-falcon/falcon-plus/modules/alarm/g"
 	"github.com/toolkits/file"
 )
@@ -31,3 +32,7 @@ func Health(c *gin.Context) {
 func Workdir(c *gin.Context) {
 	c.String(200, file.SelfDir())
 }
+
+func ChannelCounter(c *gin.Context) {
+	c.JSON(200, channel.Stats())
+}
@@ -33,6 +33,7 @@ func Start() {
 	r.GET("/version", Version)
 	r.GET("/health", Health)
 	r.GET("/workdir", Workdir)
+	r.GET("/channel/counter", ChannelCounter)
 	r.Run(addr)
 
 	log.Println("http listening", addr)
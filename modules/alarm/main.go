@@ -22,6 +22,7 @@ import (
 	"syscall"
 
 	"github.com/gin-gonic/gin"
+	"github.com/open-falcon/falcon-plus/modules/alarm/channel"
 	"github.com/open-falcon/falcon-plus/modules/alarm/cron"
 	"github.com/open-falcon/falcon-plus/modules/alarm/g"
 	"github.com/open-falcon/falcon-plus/modules/alarm/http"
@@ -54,6 +55,7 @@ func main() {
 	g.InitRedisConnPool()
 	model.InitDatabase()
 	cron.InitSenderWorker()
+	channel.InitChannels()
 
 	go http.Start()
 	go cron.ReadHighEvent()
@@ -64,7 +66,12 @@ func main() {
 	go cron.ConsumeIM()
 	go cron.ConsumeSms()
 	go cron.ConsumeMail()
+	go cron.ConsumeChannel()
 	go cron.CleanExpiredEvent()
+	go cron.SyncInhibitRules()
+	go cron.SyncSilences()
+	go cron.Escalate()
+	go cron.ConsumeCallbackRetry()
 
 	sigs := make(chan os.Signal, 1)
 	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
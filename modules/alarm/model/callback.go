@@ -0,0 +1,43 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"fmt"
+)
+
+// 一次callback请求，失败后放入重试队列
+type CallbackTask struct {
+	EventId  string `json:"event_id"`
+	ActionId int    `json:"action_id"`
+	Url      string `json:"url"`
+	Method   string `json:"method"`
+	// GET时是query string，POST时是json
+	Body     string `json:"body"`
+	Attempts int    `json:"attempts"`
+	NextAt   int64  `json:"next_at"`
+}
+
+func (this *CallbackTask) String() string {
+	return fmt.Sprintf(
+		"<EventId:%s, ActionId:%d, %s %s, Attempts:%d, NextAt:%d>",
+		this.EventId,
+		this.ActionId,
+		this.Method,
+		this.Url,
+		this.Attempts,
+		this.NextAt,
+	)
+}
@@ -0,0 +1,83 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package event
+
+import (
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/astaxie/beego/orm"
+)
+
+type CallbackDelivery struct {
+	EventId  string
+	ActionId int
+	Url      string
+	Method   string
+	Attempt  int
+	RespCode int
+	Resp     string
+	Err      error
+	// 失败并且不会再重试
+	Dead bool
+}
+
+func InsertCallbackDelivery(d *CallbackDelivery) {
+	resp, err := d.Resp, d.Err
+	status, errMsg := "success", ""
+	if err != nil {
+		status, errMsg = "fail", err.Error()
+		if d.Dead {
+			status = "dead"
+		}
+	}
+	// resp和error字段都是VARCHAR(1024)
+	if len(resp) > 1024 {
+		resp = resp[:1024]
+	}
+	if len(errMsg) > 1024 {
+		errMsg = errMsg[:1024]
+	}
+
+	sqltemplete := `INSERT INTO callback_delivery (
+		event_caseId,
+		action_id,
+		url,
+		method,
+		attempt,
+		status,
+		resp_code,
+		resp,
+		error,
+		timestamp
+	) VALUES(?,?,?,?,?,?,?,?,?,?)`
+	q := orm.NewOrm()
+	_, e := q.Raw(
+		sqltemplete,
+		d.EventId,
+		d.ActionId,
+		d.Url,
+		d.Method,
+		d.Attempt,
+		status,
+		d.RespCode,
+		resp,
+		errMsg,
+		time.Now().Format(timeLayout),
+	).Exec()
+	if e != nil {
+		log.Errorf("insert callback delivery of %s fail, error:%v", d.EventId, e)
+	}
+}
@@ -25,21 +25,26 @@ type EventCases struct {
 	Metric   string `json:"metric"`
 	Func     string `json:"func"`
 	//leftValue + operator + rightValue
-	Cond          string    `json:"cond"`
-	Note          string    `json:"note"`
-	MaxStep       int       `json:"max_step"`
-	CurrentStep   int       `json:"current_step"`
-	Priority      int       `json:"priority"`
-	Status        string    `json:"status"`
-	Timestamp     time.Time `json:"start_at"`
-	UpdateAt      time.Time `json:"update_at"`
-	ProcessNote   int       `json:"process_note"`
-	ProcessStatus string    `json:"process_status"`
-	TplCreator    string    `json:"tpl_creator"`
-	ExpressionId  int       `json:"expression_id"`
-	StrategyId    int       `json:"strategy_id"`
-	TemplateId    int       `json:"template_id"`
-	Events        []*Events `json:"evevnts" orm:"reverse(many)"`
+	Cond           string    `json:"cond"`
+	Note           string    `json:"note"`
+	MaxStep        int       `json:"max_step"`
+	CurrentStep    int       `json:"current_step"`
+	Priority       int       `json:"priority"`
+	Status         string    `json:"status"`
+	Timestamp      time.Time `json:"start_at"`
+	UpdateAt       time.Time `json:"update_at"`
+	ProcessNote    int       `json:"process_note"`
+	ProcessStatus  string    `json:"process_status"`
+	TplCreator     string    `json:"tpl_creator"`
+	ExpressionId   int       `json:"expression_id"`
+	StrategyId     int       `json:"strategy_id"`
+	TemplateId     int       `json:"template_id"`
+	AckUser        string    `json:"ack_user"`
+	ActionId       int       `json:"action_id"`
+	EscalationStep int       `json:"escalation_step"`
+	// 升级的起始时间, 告警产生或重新触发时设置
+	EscalatedAt time.Time `json:"escalated_at"`
+	Events      []*Events `json:"evevnts" orm:"reverse(many)"`
 }
 
 type Events struct {
@@ -84,8 +84,10 @@ func InsertEvent(eve *coommonModel.Event) {
 					tpl_creator,
 					expression_id,
 					strategy_id,
-					template_id
-					) VALUES(?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)`
+					template_id,
+					action_id,
+					escalated_at
+					) VALUES(?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)`
 
 		tpl_creator := ""
 		if eve.Tpl() != nil {
@@ -112,7 +114,10 @@ func InsertEvent(eve *coommonModel.Event) {
 			eve.ExpressionId(),
 			eve.StrategyId(),
 			//template_id
-			eve.TplId()).Exec()
+			eve.TplId(),
+			eve.ActionId(),
+			//escalated_at
+			time.Unix(eve.EventTime, 0).Format(timeLayout)).Exec()
 
 	} else {
 		sqltemplete := `UPDATE event_cases SET
@@ -127,10 +132,19 @@ func InsertEvent(eve *coommonModel.Event) {
 				tpl_creator = ?,
 				expression_id = ?,
 				strategy_id = ?,
-				template_id = ?`
+				template_id = ?,
+				action_id = ?`
 		//reopen case
 		if event[0].ProcessStatus == "resolved" || event[0].ProcessStatus == "ignored" {
 			sqltemplete = fmt.Sprintf("%v ,process_status = '%s', process_note = %d", sqltemplete, "unresolved", 0)
+		} else if event[0].ProcessStatus == "acknowledged" && eve.CurrentStep == 1 && eve.Status == "PROBLEM" {
+			//确认只对当次告警有效，恢复后再次触发需要重新确认
+			sqltemplete = fmt.Sprintf("%v ,process_status = '%s', process_note = %d, ack_user = '', ack_at = NULL", sqltemplete, "unresolved", 0)
+		}
+		if eve.CurrentStep == 1 && eve.Status == "PROBLEM" {
+			//重新触发的告警从头开始升级
+			sqltemplete = fmt.Sprintf("%v ,escalation_step = 0, escalated_at = '%s'", sqltemplete,
+				time.Unix(eve.EventTime, 0).Format(timeLayout))
 		}
 
 		tpl_creator := ""
@@ -154,6 +168,7 @@ func InsertEvent(eve *coommonModel.Event) {
 				eve.ExpressionId(),
 				eve.StrategyId(),
 				eve.TplId(),
+				eve.ActionId(),
 				time.Unix(eve.EventTime, 0).Format(timeLayout),
 				eve.Id,
 			).Exec()
@@ -173,6 +188,7 @@ func InsertEvent(eve *coommonModel.Event) {
 				eve.ExpressionId(),
 				eve.StrategyId(),
 				eve.TplId(),
+				eve.ActionId(),
 				eve.Id,
 			).Exec()
 		}
@@ -182,6 +198,46 @@ func InsertEvent(eve *coommonModel.Event) {
 	insertEvent(q, eve)
 }
 
+func GetProblemEventCases() (cases []EventCases, err error) {
+	q := orm.NewOrm()
+	_, err = q.Raw("select * from event_cases where status = ?", "PROBLEM").QueryRows(&cases)
+	if err != nil {
+		log.Errorf("get problem event cases fail, error:%v", err)
+	}
+	return
+}
+
+// 已确认的告警不再重复通知
+func IsAcknowledged(id string) bool {
+	q := orm.NewOrm()
+	var status string
+	err := q.Raw("select process_status from event_cases where id = ?", id).QueryRow(&status)
+	if err != nil {
+		log.Errorf("get process status of event case %s fail, error:%v", id, err)
+		return false
+	}
+	return status == "acknowledged"
+}
+
+// 处于PROBLEM状态并且还没有人处理的告警
+func GetUnackedEventCases() (cases []EventCases, err error) {
+	q := orm.NewOrm()
+	_, err = q.Raw("select * from event_cases where status = ? and process_status = ? and action_id > 0",
+		"PROBLEM", "unresolved").QueryRows(&cases)
+	if err != nil {
+		log.Errorf("get unacked event cases fail, error:%v", err)
+	}
+	return
+}
+
+func SetEscalationStep(id string, step int) {
+	q := orm.NewOrm()
+	_, err := q.Raw("update event_cases set escalation_step = ? where id = ?", step, id).Exec()
+	if err != nil {
+		log.Errorf("set escalation step of event case %s fail, error:%v", id, err)
+	}
+}
+
 func counterGen(metric string, tags string) (mycounter string) {
 	mycounter = metric
 	if tags != "" {
@@ -0,0 +1,103 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redi
+
+import (
+	"encoding/json"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/garyburd/redigo/redis"
+	"github.com/open-falcon/falcon-plus/modules/alarm/g"
+	"github.com/open-falcon/falcon-plus/modules/alarm/model"
+)
+
+// 重试队列是以NextAt为score的有序集合
+func WriteCallbackTask(task *model.CallbackTask) {
+	queue := g.Config().Callback.RetryQueue
+	bs, err := json.Marshal(task)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	log.Debugf("write callback task to queue, task:%v, queue:%s", task, queue)
+	rc := g.RedisConnPool.Get()
+	defer rc.Close()
+	if _, err := rc.Do("ZADD", queue, task.NextAt, string(bs)); err != nil {
+		log.Error("ZADD redis", queue, "fail:", err)
+	}
+}
+
+// 超过最大重试次数的callback放入死信队列，只保留最近的deadLetterSize条
+func WriteDeadCallbackTask(task *model.CallbackTask) {
+	cfg := g.Config().Callback
+	writeCallbackTask(cfg.DeadLetterQueue, task)
+
+	rc := g.RedisConnPool.Get()
+	defer rc.Close()
+	if _, err := rc.Do("LTRIM", cfg.DeadLetterQueue, 0, cfg.DeadLetterSize-1); err != nil {
+		log.Error("LTRIM redis", cfg.DeadLetterQueue, "fail:", err)
+	}
+}
+
+func writeCallbackTask(queue string, task *model.CallbackTask) {
+	bs, err := json.Marshal(task)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	log.Debugf("write callback task to queue, task:%v, queue:%s", task, queue)
+	lpush(queue, string(bs))
+}
+
+// 取出最多limit个到期的callback，ZREM成功才算取到，多个alarm实例不会重复发送
+func PopDueCallbackTask(now int64, limit int) []*model.CallbackTask {
+	ret := []*model.CallbackTask{}
+	queue := g.Config().Callback.RetryQueue
+
+	rc := g.RedisConnPool.Get()
+	defer rc.Close()
+
+	replies, err := redis.Strings(rc.Do("ZRANGEBYSCORE", queue, "-inf", now, "LIMIT", 0, limit))
+	if err != nil {
+		if err != redis.ErrNil {
+			log.Error(err)
+		}
+		return ret
+	}
+
+	for _, reply := range replies {
+		removed, err := redis.Int(rc.Do("ZREM", queue, reply))
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+		if removed == 0 {
+			continue
+		}
+
+		var task model.CallbackTask
+		err = json.Unmarshal([]byte(reply), &task)
+		if err != nil {
+			log.Error(err, reply)
+			continue
+		}
+
+		ret = append(ret, &task)
+	}
+
+	return ret
+}
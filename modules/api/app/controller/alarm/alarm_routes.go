@@ -37,4 +37,13 @@ func Routes(r *gin.Engine) {
 	alarmapi.GET("/events", EventsGet)
 	alarmapi.POST("/event_note", AddNotesToAlarm)
 	alarmapi.GET("/event_note", GetNotesOfAlarm)
+	alarmapi.POST("/eventcase/:id/ack", AckEventCase)
+	alarmapi.POST("/eventcase/:id/unack", UnackEventCase)
+	alarmapi.POST("/eventcase/:id/resolve", ResolveEventCase)
+	alarmapi.GET("/eventcase/:id/callbacks", GetCallbackDeliveries)
+	alarmapi.GET("/inhibit_rules", GetInhibitRules)
+	alarmapi.GET("/inhibit_rule/:id", GetInhibitRule)
+	alarmapi.POST("/inhibit_rule", CreateInhibitRule)
+	alarmapi.PUT("/inhibit_rule", UpdateInhibitRule)
+	alarmapi.DELETE("/inhibit_rule/:id", DeleteInhibitRule)
 }
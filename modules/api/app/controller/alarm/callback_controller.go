@@ -0,0 +1,32 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alarm
+
+import (
+	"github.com/gin-gonic/gin"
+	h "github.com/open-falcon/falcon-plus/modules/api/app/helper"
+	alm "github.com/open-falcon/falcon-plus/modules/api/app/model/alarm"
+)
+
+// callback的发送记录, 按时间倒序
+func GetCallbackDeliveries(c *gin.Context) {
+	id := c.Params.ByName("id")
+	deliveries := []alm.CallbackDelivery{}
+	if dt := db.Alarm.Where("event_caseId = ?", id).Order("id DESC").Find(&deliveries); dt.Error != nil {
+		h.JSONR(c, badstatus, dt.Error)
+		return
+	}
+	h.JSONR(c, deliveries)
+}
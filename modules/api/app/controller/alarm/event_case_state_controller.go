@@ -0,0 +1,116 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alarm
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	h "github.com/open-falcon/falcon-plus/modules/api/app/helper"
+	alm "github.com/open-falcon/falcon-plus/modules/api/app/model/alarm"
+)
+
+// process_status of event_cases
+const (
+	CaseUnresolved   = "unresolved"
+	CaseAcknowledged = "acknowledged"
+	CaseResolved     = "resolved"
+)
+
+type APIChangeEventCaseStateInputs struct {
+	Note string `json:"note" form:"note"`
+}
+
+// 确认告警, 确认后alarm不再重复发送通知, 也不会再升级
+func AckEventCase(c *gin.Context) {
+	changeEventCaseState(c, CaseAcknowledged)
+}
+
+func UnackEventCase(c *gin.Context) {
+	changeEventCaseState(c, CaseUnresolved)
+}
+
+func ResolveEventCase(c *gin.Context) {
+	changeEventCaseState(c, CaseResolved)
+}
+
+func changeEventCaseState(c *gin.Context, status string) {
+	var inputs APIChangeEventCaseStateInputs
+	if err := c.Bind(&inputs); err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	id := c.Params.ByName("id")
+	ecase := alm.EventCases{}
+	if dt := db.Alarm.Where("id = ?", id).Find(&ecase); dt.Error != nil {
+		h.JSONR(c, badstatus, fmt.Sprintf("find event case got error:%v", dt.Error))
+		return
+	}
+	switch {
+	case status == CaseAcknowledged && ecase.ProcessStatus == CaseAcknowledged:
+		h.JSONR(c, badstatus, fmt.Sprintf("event case:%s is already acknowledged", id))
+		return
+	case status == CaseAcknowledged && ecase.Status != "PROBLEM":
+		h.JSONR(c, badstatus, fmt.Sprintf("event case:%s is not in PROBLEM status", id))
+		return
+	case status == CaseUnresolved && ecase.ProcessStatus != CaseAcknowledged:
+		h.JSONR(c, badstatus, fmt.Sprintf("event case:%s is not acknowledged", id))
+		return
+	case status == CaseResolved && ecase.ProcessStatus == CaseResolved:
+		h.JSONR(c, badstatus, fmt.Sprintf("event case:%s is already resolved", id))
+		return
+	}
+
+	user, _ := h.GetUser(c)
+	note := inputs.Note
+	if note == "" {
+		note = fmt.Sprintf("%s by %s", status, user.Name)
+	}
+	Anote := alm.EventNote{
+		UserId:      user.ID,
+		Note:        note,
+		Status:      status,
+		EventCaseId: id,
+	}
+	dt := db.Alarm.Begin()
+	if err := dt.Save(&Anote); err.Error != nil {
+		dt.Rollback()
+		h.JSONR(c, badstatus, err.Error)
+		return
+	}
+	ucase := map[string]interface{}{
+		"process_note":   Anote.ID,
+		"process_status": status,
+	}
+	switch status {
+	case CaseAcknowledged:
+		ucase["ack_user"] = user.Name
+		ucase["ack_at"] = time.Now()
+	case CaseUnresolved:
+		ucase["ack_user"] = ""
+		ucase["ack_at"] = nil
+	}
+	if db := dt.Table(ecase.TableName()).Where("id = ?", id).Updates(ucase); db.Error != nil {
+		dt.Rollback()
+		h.JSONR(c, badstatus, "update got error during update event_cases:"+db.Error.Error())
+		return
+	}
+	dt.Commit()
+	h.JSONR(c, map[string]string{
+		"id":      id,
+		"message": fmt.Sprintf("event case %s is %s", id, status),
+	})
+}
@@ -0,0 +1,192 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alarm
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	cutils "github.com/open-falcon/falcon-plus/common/utils"
+	h "github.com/open-falcon/falcon-plus/modules/api/app/helper"
+	alm "github.com/open-falcon/falcon-plus/modules/api/app/model/alarm"
+)
+
+type APIInhibitRuleInputs struct {
+	ID               int64  `json:"id" form:"id"`
+	Name             string `json:"name" form:"name" binding:"required"`
+	SourceEndpoint   string `json:"source_endpoint" form:"source_endpoint"`
+	SourceMetric     string `json:"source_metric" form:"source_metric"`
+	SourceTags       string `json:"source_tags" form:"source_tags"`
+	SourceStrategyId int64  `json:"source_strategy_id" form:"source_strategy_id"`
+	TargetEndpoint   string `json:"target_endpoint" form:"target_endpoint"`
+	TargetMetric     string `json:"target_metric" form:"target_metric"`
+	TargetTags       string `json:"target_tags" form:"target_tags"`
+	Equal            string `json:"equal" form:"equal"`
+	Note             string `json:"note" form:"note"`
+}
+
+func (s APIInhibitRuleInputs) CheckFormat() error {
+	if s.SourceEndpoint == "" && s.SourceMetric == "" && s.SourceStrategyId == 0 {
+		return errors.New("source_endpoint, source_metric OR source_strategy_id, You have to at least pick one on the request.")
+	}
+	if s.TargetEndpoint == "" && s.TargetMetric == "" && s.Equal == "" {
+		return errors.New("target_endpoint, target_metric OR equal, You have to at least pick one on the request.")
+	}
+	for _, exp := range []string{s.SourceEndpoint, s.TargetEndpoint} {
+		if _, err := regexp.Compile(exp); err != nil {
+			return fmt.Errorf("endpoint regexp %s is not vaild: %v", exp, err)
+		}
+	}
+	for _, tags := range []string{s.SourceTags, s.TargetTags} {
+		if err, _ := cutils.SplitTagsString(tags); err != nil {
+			return fmt.Errorf("tags %s is not vaild, please refer ex. k1=v1,k2=v2", tags)
+		}
+	}
+	if s.Equal != "" {
+		for _, key := range strings.Split(s.Equal, ",") {
+			if strings.TrimSpace(key) == "" {
+				return fmt.Errorf("equal %s is not vaild, please refer ex. endpoint,hostgroup,tagkey", s.Equal)
+			}
+		}
+	}
+	return nil
+}
+
+func GetInhibitRules(c *gin.Context) {
+	rules := []alm.InhibitRule{}
+	if dt := db.Alarm.Find(&rules); dt.Error != nil {
+		h.JSONR(c, badstatus, dt.Error)
+		return
+	}
+	h.JSONR(c, rules)
+}
+
+func GetInhibitRule(c *gin.Context) {
+	id, err := strconv.Atoi(c.Params.ByName("id"))
+	if err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	rule := alm.InhibitRule{ID: int64(id)}
+	if dt := db.Alarm.Find(&rule); dt.Error != nil {
+		h.JSONR(c, badstatus, dt.Error)
+		return
+	}
+	h.JSONR(c, rule)
+}
+
+func CreateInhibitRule(c *gin.Context) {
+	var inputs APIInhibitRuleInputs
+	if err := c.Bind(&inputs); err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	if err := inputs.CheckFormat(); err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	user, _ := h.GetUser(c)
+	now := time.Now()
+	rule := alm.InhibitRule{
+		Name:             inputs.Name,
+		SourceEndpoint:   inputs.SourceEndpoint,
+		SourceMetric:     inputs.SourceMetric,
+		SourceTags:       inputs.SourceTags,
+		SourceStrategyId: inputs.SourceStrategyId,
+		TargetEndpoint:   inputs.TargetEndpoint,
+		TargetMetric:     inputs.TargetMetric,
+		TargetTags:       inputs.TargetTags,
+		Equal:            inputs.Equal,
+		Note:             inputs.Note,
+		Creator:          user.Name,
+		CreateAt:         &now,
+	}
+	if dt := db.Alarm.Save(&rule); dt.Error != nil {
+		h.JSONR(c, expecstatus, dt.Error)
+		return
+	}
+	h.JSONR(c, rule)
+}
+
+func UpdateInhibitRule(c *gin.Context) {
+	var inputs APIInhibitRuleInputs
+	if err := c.Bind(&inputs); err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	if inputs.ID == 0 {
+		h.JSONR(c, badstatus, "id is missing")
+		return
+	}
+	if err := inputs.CheckFormat(); err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	rule := alm.InhibitRule{ID: inputs.ID}
+	if dt := db.Alarm.Find(&rule); dt.Error != nil {
+		h.JSONR(c, expecstatus, fmt.Sprintf("find inhibit rule got error:%v", dt.Error))
+		return
+	}
+	user, _ := h.GetUser(c)
+	if !user.IsAdmin() && rule.Creator != user.Name {
+		h.JSONR(c, badstatus, "You don't have permission!")
+		return
+	}
+	urule := map[string]interface{}{
+		"name":               inputs.Name,
+		"source_endpoint":    inputs.SourceEndpoint,
+		"source_metric":      inputs.SourceMetric,
+		"source_tags":        inputs.SourceTags,
+		"source_strategy_id": inputs.SourceStrategyId,
+		"target_endpoint":    inputs.TargetEndpoint,
+		"target_metric":      inputs.TargetMetric,
+		"target_tags":        inputs.TargetTags,
+		"equal":              inputs.Equal,
+		"note":               inputs.Note,
+	}
+	if dt := db.Alarm.Model(&rule).Where("id = ?", rule.ID).Updates(urule).Find(&rule); dt.Error != nil {
+		h.JSONR(c, expecstatus, dt.Error)
+		return
+	}
+	h.JSONR(c, rule)
+}
+
+func DeleteInhibitRule(c *gin.Context) {
+	id, err := strconv.Atoi(c.Params.ByName("id"))
+	if err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	rule := alm.InhibitRule{ID: int64(id)}
+	if dt := db.Alarm.Find(&rule); dt.Error != nil {
+		h.JSONR(c, expecstatus, fmt.Sprintf("find inhibit rule got error:%v", dt.Error))
+		return
+	}
+	user, _ := h.GetUser(c)
+	if !user.IsAdmin() && rule.Creator != user.Name {
+		h.JSONR(c, badstatus, "You don't have permission!")
+		return
+	}
+	if dt := db.Alarm.Delete(&rule); dt.Error != nil {
+		h.JSONR(c, badstatus, dt.Error)
+		return
+	}
+	h.JSONR(c, fmt.Sprintf("inhibit rule:%d has been deleted", id))
+}
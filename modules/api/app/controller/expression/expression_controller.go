@@ -23,6 +23,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/jinzhu/gorm"
+	cutils "github.com/open-falcon/falcon-plus/common/utils"
 	h "github.com/open-falcon/falcon-plus/modules/api/app/helper"
 	f "github.com/open-falcon/falcon-plus/modules/api/app/model/falcon_portal"
 )
@@ -114,6 +115,8 @@ func (this APICreateExrpessionInput) CheckFormat() (err error) {
 		err = errors.New("op's formating is not vaild")
 	case !validRightValue.MatchString(this.RightValue):
 		err = errors.New("right_value's formating is not vaild")
+	case !cutils.IsJudgeFuncValid(this.Func):
+		err = errors.New("func's formating is not vaild, please refer ex. avg(#3) percentile(#10,95)")
 	}
 	return
 }
@@ -198,6 +201,8 @@ func (this APIUpdateExrpessionInput) CheckFormat() (err error) {
 		err = errors.New("op's formating is not vaild")
 	case !validRightValue.MatchString(this.RightValue):
 		err = errors.New("right_value's formating is not vaild")
+	case !cutils.IsJudgeFuncValid(this.Func):
+		err = errors.New("func's formating is not vaild, please refer ex. avg(#3) percentile(#10,95)")
 	}
 	return
 }
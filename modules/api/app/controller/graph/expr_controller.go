@@ -0,0 +1,277 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	cmodel "github.com/open-falcon/falcon-plus/common/model"
+	cutils "github.com/open-falcon/falcon-plus/common/utils"
+	h "github.com/open-falcon/falcon-plus/modules/api/app/helper"
+	grh "github.com/open-falcon/falcon-plus/modules/api/graph"
+	"github.com/open-falcon/falcon-plus/modules/api/graph/expr"
+	"github.com/spf13/viper"
+)
+
+type APIGraphExprInputs struct {
+	Expr      string `json:"expr" form:"expr" binding:"required"`
+	StartTime int64  `json:"start_time" form:"start_time" binding:"required"`
+	EndTime   int64  `json:"end_time" form:"end_time" binding:"required"`
+	Step      int64  `json:"step" form:"step"`
+	ConsolFun string `json:"consol_fun" form:"consol_fun"`
+}
+
+type APIGraphExprSeries struct {
+	Name     string            `json:"name"`
+	Endpoint string            `json:"endpoint"`
+	Counter  string            `json:"counter"`
+	Tags     map[string]string `json:"tags"`
+	Step     int64             `json:"step"`
+	Values   []*cmodel.RRDData `json:"values"`
+}
+
+// QueryGraphExpr 计算表达式, 例如 sumSeries(tag.service=web, net.if.in.bytes) / 8,
+// 支持的函数: series、sumSeries、averageSeries、maxSeries、minSeries、countSeries、
+// groupBy(series, key[, agg])、topk(k, series[, by])、bottomk、rate、movingAverage(series, n|"5m")、alias,
+// 以及series和常数之间的+ - * /
+func QueryGraphExpr(c *gin.Context) {
+	inputs := APIGraphExprInputs{ConsolFun: "AVERAGE"}
+	if err := c.Bind(&inputs); err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	engine := &expr.Engine{
+		Source:      graphIndexSource{},
+		MaxSeries:   viperInt("graphs.max_query_series", 1000),
+		Concurrency: viperInt("graphs.query_concurrency", 20),
+	}
+	result, err := engine.Exec(&expr.Query{
+		Expr:      inputs.Expr,
+		Start:     inputs.StartTime,
+		End:       inputs.EndTime,
+		Step:      inputs.Step,
+		ConsolFun: inputs.ConsolFun,
+	})
+	if err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+
+	resp := make([]APIGraphExprSeries, len(result.Series))
+	for i, s := range result.Series {
+		values := make([]*cmodel.RRDData, len(s.Values))
+		for j, v := range s.Values {
+			values[j] = cmodel.NewRRDData(result.Grid.Ts(j), v)
+		}
+		resp[i] = APIGraphExprSeries{
+			Name:     s.Name,
+			Endpoint: s.Endpoint,
+			Counter:  s.Counter(),
+			Tags:     s.Tags,
+			Step:     result.Grid.Step,
+			Values:   values,
+		}
+	}
+	h.JSONR(c, resp)
+}
+
+func viperInt(key string, def int) int {
+	if v := viper.GetInt(key); v > 0 {
+		return v
+	}
+	return def
+}
+
+// graphIndexSource 从graph库的endpoint、endpoint_counter、tag_endpoint表中查找counter, 从graph查询数据
+type graphIndexSource struct{}
+
+type exprCounterRow struct {
+	ID       int64
+	Endpoint string
+	Counter  string
+	Step     int
+	Type     string
+}
+
+func likeEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// Find 能用sql表达的条件先在mysql中过滤, 所有条件最后再按tag的语义检查一遍
+func (graphIndexSource) Find(sel *expr.SelectorNode, limit int) ([]*expr.Ref, error) {
+	dt := db.Graph.Table("endpoint_counter as b").
+		Select("a.id, a.endpoint, b.counter, b.step, b.type").
+		Joins("join endpoint as a on a.id = b.endpoint_id")
+	metrics := []string{}
+	if sel.Metric != "" {
+		metrics = append(metrics, sel.Metric)
+	}
+	for _, m := range sel.Matchers {
+		switch m.Name {
+		case "endpoint":
+			switch m.Op {
+			case "=":
+				dt = dt.Where("a.endpoint = ?", m.Value)
+			case "!=":
+				dt = dt.Where("a.endpoint <> ?", m.Value)
+			case "=~":
+				dt = dt.Where("a.endpoint regexp ?", "^("+m.Value+")$")
+			}
+		case "metric":
+			switch m.Op {
+			case "=":
+				metrics = append(metrics, m.Value)
+			case "=~":
+				dt = dt.Where("b.counter regexp ?", "^("+m.Value+")(/|$)")
+			}
+		default:
+			if m.Op == "=" && m.Value != "" {
+				dt = dt.Where("a.id in (select endpoint_id from tag_endpoint where tag = ?)", m.Name+"="+m.Value)
+			}
+		}
+	}
+	for _, metric := range metrics {
+		dt = dt.Where("(b.counter = ? or b.counter like ?)", metric, likeEscape(metric)+"/%")
+	}
+	// 有些条件只能在查出来之后过滤, 多查一些
+	scanLimit := 0
+	if limit > 0 {
+		scanLimit = limit * 10
+		dt = dt.Limit(scanLimit + 1)
+	}
+	rows := []exprCounterRow{}
+	if dt = dt.Scan(&rows); dt.Error != nil {
+		return nil, dt.Error
+	}
+	if scanLimit > 0 && len(rows) > scanLimit {
+		return nil, fmt.Errorf("too many series match %s", sel)
+	}
+	if len(rows) == 0 {
+		return []*expr.Ref{}, nil
+	}
+
+	ids := []int64{}
+	seen := map[int64]bool{}
+	for _, r := range rows {
+		if !seen[r.ID] {
+			seen[r.ID] = true
+			ids = append(ids, r.ID)
+		}
+	}
+	endpointTags, err := loadEndpointTags(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	refs := []*expr.Ref{}
+	for _, r := range rows {
+		fields := strings.SplitN(r.Counter, "/", 2)
+		tags := map[string]string{}
+		if len(fields) == 2 {
+			if err, tags = cutils.SplitTagsString(fields[1]); err != nil {
+				continue
+			}
+		}
+		ref := &expr.Ref{
+			Endpoint:     r.Endpoint,
+			Counter:      r.Counter,
+			Metric:       fields[0],
+			Tags:         tags,
+			EndpointTags: endpointTags[r.ID],
+			Step:         r.Step,
+			DsType:       r.Type,
+		}
+		if sel.Matches(ref) {
+			refs = append(refs, ref)
+		}
+	}
+	return refs, nil
+}
+
+func loadEndpointTags(ids []int64) (map[int64]map[string]string, error) {
+	type tagRow struct {
+		EndpointID int64
+		Tag        string
+	}
+	rows := []tagRow{}
+	dt := db.Graph.Table("tag_endpoint").Select("endpoint_id, tag").Where("endpoint_id in (?)", ids).Scan(&rows)
+	if dt.Error != nil {
+		return nil, dt.Error
+	}
+	result := map[int64]map[string]string{}
+	for _, r := range rows {
+		kv := strings.SplitN(r.Tag, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		if result[r.EndpointID] == nil {
+			result[r.EndpointID] = map[string]string{}
+		}
+		result[r.EndpointID][kv[0]] = kv[1]
+	}
+	return result, nil
+}
+
+func (graphIndexSource) Fetch(ref *expr.Ref, cf string, start, end int64, step int) ([]*cmodel.RRDData, error) {
+	if step < ref.Step {
+		step = ref.Step
+	}
+	resp, err := grh.QueryOne(grh.GenQParam(ref.Endpoint, ref.Counter, cf, start, end, step))
+	if err != nil {
+		return nil, err
+	}
+	return resp.Values, nil
+}
+
+// graphTagSource 从graph的tag索引中查找counter, tag只匹配counter上的tag
+type graphTagSource struct {
+	graphIndexSource
+}
+
+// selectorMatchers 把selector转换成graph tag索引的查询条件
+func selectorMatchers(sel *expr.SelectorNode) []*cmodel.GraphMatcher {
+	matchers := []*cmodel.GraphMatcher{}
+	if sel.Metric != "" {
+		matchers = append(matchers, &cmodel.GraphMatcher{Name: "metric", Op: "=", Value: sel.Metric})
+	}
+	for _, m := range sel.Matchers {
+		matchers = append(matchers, &cmodel.GraphMatcher{Name: m.Name, Op: m.Op, Value: m.Value})
+	}
+	return matchers
+}
+
+func (graphTagSource) Find(sel *expr.SelectorNode, limit int) ([]*expr.Ref, error) {
+	resp, err := grh.Series(cmodel.GraphSeriesParam{Matchers: selectorMatchers(sel), Limit: limit})
+	if resp == nil {
+		return nil, err
+	}
+	if resp.Truncated {
+		return nil, fmt.Errorf("too many series match %s", sel)
+	}
+	refs := make([]*expr.Ref, 0, len(resp.Series))
+	for _, s := range resp.Series {
+		refs = append(refs, &expr.Ref{
+			Endpoint: s.Endpoint,
+			Counter:  s.Counter,
+			Metric:   s.Metric,
+			Tags:     s.Tags,
+			Step:     s.Step,
+			DsType:   s.DsType,
+		})
+	}
+	return refs, nil
+}
@@ -272,7 +272,7 @@ func GrafanaRender(c *gin.Context) {
 		}
 		for _, host := range hosts {
 			for _, c := range counterArr {
-				resp, err := fetchData(host, c, inputs.ConsolFun, inputs.From, inputs.Until, inputs.Step)
+				resp, err := fetchData(host, c, inputs.ConsolFun, inputs.From, inputs.Until, inputs.Step, int(inputs.MaxDataPoints))
 				if err != nil {
 					log.Debugf("query graph got error with: %v", inputs)
 				} else {
@@ -0,0 +1,485 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gin-gonic/gin"
+	cmodel "github.com/open-falcon/falcon-plus/common/model"
+	cutils "github.com/open-falcon/falcon-plus/common/utils"
+	h "github.com/open-falcon/falcon-plus/modules/api/app/helper"
+	grh "github.com/open-falcon/falcon-plus/modules/api/graph"
+	"github.com/open-falcon/falcon-plus/modules/api/graph/expr"
+)
+
+// Grafana JSON数据源(simple json / JSON API)的接口, 数据来自graph的tag索引
+
+type GrafanaJSONRange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// parse 时间格式为RFC3339
+func (this GrafanaJSONRange) parse() (from, to int64, err error) {
+	f, err := time.Parse(time.RFC3339Nano, this.From)
+	if err != nil {
+		return 0, 0, fmt.Errorf("bad range.from %q", this.From)
+	}
+	t, err := time.Parse(time.RFC3339Nano, this.To)
+	if err != nil {
+		return 0, 0, fmt.Errorf("bad range.to %q", this.To)
+	}
+	return f.Unix(), t.Unix(), nil
+}
+
+type GrafanaJSONFilter struct {
+	Key      string `json:"key"`
+	Operator string `json:"operator"`
+	Value    string `json:"value"`
+}
+
+type GrafanaJSONTarget struct {
+	Target string `json:"target"`
+	RefID  string `json:"refId"`
+	Type   string `json:"type"`
+}
+
+type APIGrafanaJSONQueryInputs struct {
+	Range         GrafanaJSONRange    `json:"range"`
+	IntervalMs    int64               `json:"intervalMs"`
+	MaxDataPoints int64               `json:"maxDataPoints"`
+	Targets       []GrafanaJSONTarget `json:"targets"`
+	AdhocFilters  []GrafanaJSONFilter `json:"adhocFilters"`
+}
+
+type GrafanaJSONTimeserie struct {
+	Target     string       `json:"target"`
+	RefID      string       `json:"refId,omitempty"`
+	Datapoints [][2]float64 `json:"datapoints"`
+}
+
+type GrafanaJSONColumn struct {
+	Text string `json:"text"`
+	Type string `json:"type"`
+}
+
+type GrafanaJSONTable struct {
+	Type    string              `json:"type"`
+	RefID   string              `json:"refId,omitempty"`
+	Columns []GrafanaJSONColumn `json:"columns"`
+	Rows    [][]interface{}     `json:"rows"`
+}
+
+// GrafanaJSONTest 数据源的连通性测试
+func GrafanaJSONTest(c *gin.Context) {
+	c.JSON(200, gin.H{"msg": "ok"})
+}
+
+type APIGrafanaJSONSearchInputs struct {
+	Target string `json:"target"`
+}
+
+// GrafanaJSONSearch target为空时返回所有metric, 为label名时返回这个label的取值,
+// 也可以带上过滤条件, 例如 endpoint{service=payment, metric=qps}
+func GrafanaJSONSearch(c *gin.Context) {
+	inputs := APIGrafanaJSONSearchInputs{}
+	if err := c.Bind(&inputs); err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	name, matchers, err := parseGrafanaSearchTarget(inputs.Target)
+	if err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	resp, err := grh.Labels(cmodel.GraphLabelParam{Name: name, Matchers: matchers, Limit: viperInt("graphs.max_query_series", 1000)})
+	if resp == nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	c.JSON(200, resp.Values)
+}
+
+func parseGrafanaSearchTarget(target string) (string, []*cmodel.GraphMatcher, error) {
+	target = strings.TrimSpace(target)
+	if target == "" {
+		return "metric", nil, nil
+	}
+	i := strings.Index(target, "{")
+	if i < 0 {
+		return target, nil, nil
+	}
+	if !strings.HasSuffix(target, "}") {
+		return "", nil, fmt.Errorf("bad target %q", target)
+	}
+	matchers := []*cmodel.GraphMatcher{}
+	for _, s := range strings.Split(target[i+1:len(target)-1], ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		m, err := cmodel.ParseGraphMatcher(s)
+		if err != nil {
+			return "", nil, err
+		}
+		matchers = append(matchers, m)
+	}
+	return strings.TrimSpace(target[:i]), matchers, nil
+}
+
+// GrafanaJSONQuery 每个target是一个表达式(见QueryGraphExpr), adhoc过滤条件追加到所有selector上
+func GrafanaJSONQuery(c *gin.Context) {
+	inputs := APIGrafanaJSONQueryInputs{}
+	if err := c.Bind(&inputs); err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	from, to, err := inputs.Range.parse()
+	if err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	filters := []*expr.Matcher{}
+	for _, f := range inputs.AdhocFilters {
+		m, err := expr.NewMatcher(f.Key, f.Operator, f.Value)
+		if err != nil {
+			h.JSONR(c, badstatus, err)
+			return
+		}
+		filters = append(filters, m)
+	}
+	step := inputs.IntervalMs / 1000
+	if inputs.MaxDataPoints > 0 {
+		if s := (to - from + inputs.MaxDataPoints - 1) / inputs.MaxDataPoints; s > step {
+			step = s
+		}
+	}
+
+	engine := &expr.Engine{
+		Source:      graphTagSource{},
+		MaxSeries:   viperInt("graphs.max_query_series", 1000),
+		Concurrency: viperInt("graphs.query_concurrency", 20),
+	}
+	output := []interface{}{}
+	for _, t := range inputs.Targets {
+		if strings.TrimSpace(t.Target) == "" {
+			continue
+		}
+		result, err := engine.Exec(&expr.Query{Expr: t.Target, Start: from, End: to, Step: step, Matchers: filters})
+		if err != nil {
+			h.JSONR(c, badstatus, fmt.Errorf("%s: %v", t.RefID, err))
+			return
+		}
+		if t.Type == "table" {
+			output = append(output, grafanaJSONTable(t.RefID, result))
+			continue
+		}
+		for _, s := range result.Series {
+			ts := GrafanaJSONTimeserie{Target: s.Name, RefID: t.RefID, Datapoints: [][2]float64{}}
+			for i, v := range s.Values {
+				if !math.IsNaN(v) {
+					ts.Datapoints = append(ts.Datapoints, [2]float64{v, float64(result.Grid.Ts(i) * 1000)})
+				}
+			}
+			output = append(output, ts)
+		}
+	}
+	c.JSON(200, output)
+}
+
+// grafanaJSONTable 每条series一行, 取最后一个有效值
+func grafanaJSONTable(refID string, result *expr.Result) GrafanaJSONTable {
+	table := GrafanaJSONTable{
+		Type:  "table",
+		RefID: refID,
+		Columns: []GrafanaJSONColumn{
+			{Text: "Time", Type: "time"},
+			{Text: "endpoint", Type: "string"},
+			{Text: "counter", Type: "string"},
+			{Text: "name", Type: "string"},
+			{Text: "value", Type: "number"},
+		},
+		Rows: [][]interface{}{},
+	}
+	for _, s := range result.Series {
+		for i := len(s.Values) - 1; i >= 0; i-- {
+			if !math.IsNaN(s.Values[i]) {
+				table.Rows = append(table.Rows, []interface{}{result.Grid.Ts(i) * 1000, s.Endpoint, s.Counter(), s.Name, s.Values[i]})
+				break
+			}
+		}
+	}
+	return table
+}
+
+type APIGrafanaJSONTagValuesInputs struct {
+	Key string `json:"key"`
+}
+
+func GrafanaJSONTagKeys(c *gin.Context) {
+	resp, err := grh.Labels(cmodel.GraphLabelParam{Limit: viperInt("graphs.max_query_series", 1000)})
+	if resp == nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	keys := make([]gin.H, len(resp.Values))
+	for i, v := range resp.Values {
+		keys[i] = gin.H{"type": "string", "text": v}
+	}
+	c.JSON(200, keys)
+}
+
+func GrafanaJSONTagValues(c *gin.Context) {
+	inputs := APIGrafanaJSONTagValuesInputs{}
+	if err := c.Bind(&inputs); err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	if inputs.Key == "" {
+		h.JSONR(c, badstatus, "key is missing")
+		return
+	}
+	resp, err := grh.Labels(cmodel.GraphLabelParam{Name: inputs.Key, Limit: viperInt("graphs.max_query_series", 1000)})
+	if resp == nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	values := make([]gin.H, len(resp.Values))
+	for i, v := range resp.Values {
+		values[i] = gin.H{"text": v}
+	}
+	c.JSON(200, values)
+}
+
+type GrafanaJSONAnnotation struct {
+	Name  string `json:"name"`
+	Query string `json:"query"`
+}
+
+type APIGrafanaJSONAnnotationsInputs struct {
+	Range      GrafanaJSONRange      `json:"range"`
+	Annotation GrafanaJSONAnnotation `json:"annotation"`
+}
+
+type GrafanaJSONAnnotationResp struct {
+	Annotation GrafanaJSONAnnotation `json:"annotation"`
+	Time       int64                 `json:"time"`
+	TimeEnd    int64                 `json:"timeEnd"`
+	IsRegion   bool                  `json:"isRegion"`
+	Title      string                `json:"title"`
+	Text       string                `json:"text"`
+	Tags       []string              `json:"tags"`
+}
+
+type grafanaAnnotationsByTime []GrafanaJSONAnnotationResp
+
+func (this grafanaAnnotationsByTime) Len() int           { return len(this) }
+func (this grafanaAnnotationsByTime) Swap(i, j int)      { this[i], this[j] = this[j], this[i] }
+func (this grafanaAnnotationsByTime) Less(i, j int) bool { return this[i].Time < this[j].Time }
+
+type grafanaEventRow struct {
+	Id          int64
+	EventCaseId string
+	Step        int
+	Cond        string
+	Status      int
+	Timestamp   time.Time
+	Endpoint    string
+	Metric      string
+	Note        string
+	Priority    int
+}
+
+const (
+	// 最多返回的匹配事件数
+	grafanaMaxAnnotationEvents = 5000
+	// 每批从数据库读取的事件数, 以及最多扫描的事件数
+	grafanaAnnotationBatch   = 1000
+	grafanaMaxAnnotationScan = 50000
+)
+
+// GrafanaJSONAnnotations 把告警事件转换成annotation, 同一个告警从PROBLEM到OK合并成一个区间;
+// annotation.query为逗号分隔的过滤条件, 可以使用endpoint、metric、priority和counter上的tag, 例如 endpoint=~"web.*", priority=~"0|1"
+// 匹配的事件超过上限时只返回前面的部分, 并在响应头X-Falcon-Truncated中标记
+func GrafanaJSONAnnotations(c *gin.Context) {
+	inputs := APIGrafanaJSONAnnotationsInputs{}
+	if err := c.Bind(&inputs); err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	from, to, err := inputs.Range.parse()
+	if err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	_, matchers, err := parseGrafanaSearchTarget("{" + inputs.Annotation.Query + "}")
+	if err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	filters := make([]*expr.Matcher, 0, len(matchers))
+	for _, m := range matchers {
+		f, err := expr.NewMatcher(m.Name, m.Op, m.Value)
+		if err != nil {
+			h.JSONR(c, badstatus, err)
+			return
+		}
+		filters = append(filters, f)
+	}
+
+	rows, truncated, err := scanGrafanaEvents(from, to, matchers, filters)
+	if err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	if truncated {
+		log.Warnf("grafana annotations between %d and %d with query %q are truncated at %d events", from, to, inputs.Annotation.Query, len(rows))
+		c.Header("X-Falcon-Truncated", "true")
+	}
+	c.JSON(200, grafanaAnnotations(rows, inputs.Annotation, from, to))
+}
+
+// scanGrafanaEvents 按(timestamp, id)分批读取事件并在内存中过滤, 直到匹配数达到上限或扫描完;
+// 精确匹配的endpoint和priority直接下推到SQL
+func scanGrafanaEvents(from, to int64, matchers []*cmodel.GraphMatcher, filters []*expr.Matcher) (rows []grafanaEventRow, truncated bool, err error) {
+	rows = []grafanaEventRow{}
+	var (
+		lastTs  time.Time
+		lastId  int64
+		scanned int
+	)
+	for {
+		dt := db.Alarm.Table("events as e").
+			Select("e.id, e.event_caseId as event_case_id, e.step, e.cond, e.status, e.timestamp, c.endpoint, c.metric, c.note, c.priority").
+			Joins("join event_cases as c on c.id = e.event_caseId").
+			Where("e.timestamp >= ? and e.timestamp <= ?", time.Unix(from, 0), time.Unix(to, 0))
+		for _, m := range matchers {
+			if m.Op != "=" {
+				continue
+			}
+			switch m.Name {
+			case "endpoint":
+				dt = dt.Where("c.endpoint = ?", m.Value)
+			case "priority":
+				if p, perr := strconv.Atoi(m.Value); perr == nil {
+					dt = dt.Where("c.priority = ?", p)
+				}
+			}
+		}
+		if scanned > 0 {
+			dt = dt.Where("e.timestamp > ? or (e.timestamp = ? and e.id > ?)", lastTs, lastTs, lastId)
+		}
+		batch := []grafanaEventRow{}
+		if dt = dt.Order("e.timestamp, e.id").Limit(grafanaAnnotationBatch).Scan(&batch); dt.Error != nil {
+			return nil, false, dt.Error
+		}
+		for i, r := range batch {
+			if !grafanaEventMatches(r, filters) {
+				continue
+			}
+			if len(rows) >= grafanaMaxAnnotationEvents {
+				return rows, true, nil
+			}
+			rows = append(rows, batch[i])
+		}
+		scanned += len(batch)
+		if len(batch) < grafanaAnnotationBatch {
+			return rows, false, nil
+		}
+		if scanned >= grafanaMaxAnnotationScan {
+			return rows, true, nil
+		}
+		lastTs, lastId = batch[len(batch)-1].Timestamp, batch[len(batch)-1].Id
+	}
+}
+
+// grafanaAnnotations rows需要按时间排序, events.status: 0为PROBLEM, 1为OK
+func grafanaAnnotations(rows []grafanaEventRow, annotation GrafanaJSONAnnotation, from, to int64) []GrafanaJSONAnnotationResp {
+	output := []GrafanaJSONAnnotationResp{}
+	open := map[string]int{}
+	for _, r := range rows {
+		ts := r.Timestamp.Unix() * 1000
+		if r.Status == 0 {
+			if _, ok := open[r.EventCaseId]; ok {
+				continue
+			}
+			open[r.EventCaseId] = len(output)
+			output = append(output, GrafanaJSONAnnotationResp{
+				Annotation: annotation,
+				Time:       ts,
+				TimeEnd:    to * 1000,
+				IsRegion:   true,
+				Title:      fmt.Sprintf("[P%d] %s %s", r.Priority, r.Endpoint, r.Metric),
+				Text:       fmt.Sprintf("%s<br>%s", r.Note, r.Cond),
+				Tags:       []string{"P" + strconv.Itoa(r.Priority), "PROBLEM", r.Endpoint, r.Metric},
+			})
+			continue
+		}
+		if i, ok := open[r.EventCaseId]; ok {
+			output[i].TimeEnd = ts
+			output[i].Tags[1] = "OK"
+			delete(open, r.EventCaseId)
+		} else {
+			// 在查询范围之前就已经开始的告警
+			output = append(output, GrafanaJSONAnnotationResp{
+				Annotation: annotation,
+				Time:       from * 1000,
+				TimeEnd:    ts,
+				IsRegion:   true,
+				Title:      fmt.Sprintf("[P%d] %s %s", r.Priority, r.Endpoint, r.Metric),
+				Text:       fmt.Sprintf("%s<br>%s", r.Note, r.Cond),
+				Tags:       []string{"P" + strconv.Itoa(r.Priority), "OK", r.Endpoint, r.Metric},
+			})
+		}
+	}
+	sort.Stable(grafanaAnnotationsByTime(output))
+	return output
+}
+
+func grafanaEventMatches(r grafanaEventRow, filters []*expr.Matcher) bool {
+	if len(filters) == 0 {
+		return true
+	}
+	metric, tags := r.Metric, map[string]string{}
+	if fields := strings.SplitN(r.Metric, "/", 2); len(fields) == 2 {
+		metric = fields[0]
+		if err, t := cutils.SplitTagsString(fields[1]); err == nil {
+			tags = t
+		}
+	}
+	for _, f := range filters {
+		var v string
+		switch f.Name {
+		case "endpoint":
+			v = r.Endpoint
+		case "metric":
+			v = metric
+		case "priority":
+			v = strconv.Itoa(r.Priority)
+		default:
+			v = tags[f.Name]
+		}
+		if !f.Matches(v) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,119 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/open-falcon/falcon-plus/modules/api/graph/expr"
+)
+
+func TestParseGrafanaSearchTarget(t *testing.T) {
+	cases := []struct {
+		target   string
+		name     string
+		matchers []string
+		err      bool
+	}{
+		{"", "metric", nil, false},
+		{" endpoint ", "endpoint", nil, false},
+		{`endpoint{service="payment", metric=~"qps.*"}`, "endpoint", []string{"service=payment", "metric=~qps.*"}, false},
+		{"{}", "", []string{}, false},
+		{"endpoint{service=payment", "", nil, true},
+		{"endpoint{service}", "", nil, true},
+	}
+	for _, c := range cases {
+		name, matchers, err := parseGrafanaSearchTarget(c.target)
+		if (err != nil) != c.err {
+			t.Errorf("%q: unexpected error %v", c.target, err)
+			continue
+		}
+		if c.err {
+			continue
+		}
+		if name != c.name {
+			t.Errorf("%q: expect name %q, got %q", c.target, c.name, name)
+		}
+		got := []string(nil)
+		if matchers != nil {
+			got = []string{}
+		}
+		for _, m := range matchers {
+			got = append(got, m.Name+m.Op+m.Value)
+		}
+		if !reflect.DeepEqual(got, c.matchers) {
+			t.Errorf("%q: expect matchers %v, got %v", c.target, c.matchers, got)
+		}
+	}
+}
+
+func TestGrafanaJSONTable(t *testing.T) {
+	result := &expr.Result{
+		Grid: expr.Grid{Start: 60, Step: 60, Count: 3},
+		Series: []*expr.Series{
+			{Name: "a", Endpoint: "web01", Metric: "qps", Tags: map[string]string{"k": "v"}, Values: []float64{1, 2, math.NaN()}},
+			{Name: "b", Endpoint: "web02", Metric: "qps", Values: []float64{math.NaN(), math.NaN(), math.NaN()}},
+			{Name: "c", Endpoint: "web03", Metric: "qps", Values: []float64{1, 2, 3}},
+		},
+	}
+	table := grafanaJSONTable("A", result)
+	if table.Type != "table" || table.RefID != "A" || len(table.Columns) != 5 {
+		t.Fatalf("bad table header %+v", table)
+	}
+	expect := [][]interface{}{
+		{int64(120000), "web01", "qps/k=v", "a", 2.0},
+		{int64(180000), "web03", "qps", "c", 3.0},
+	}
+	if !reflect.DeepEqual(table.Rows, expect) {
+		t.Errorf("expect rows %v, got %v", expect, table.Rows)
+	}
+}
+
+func TestGrafanaAnnotations(t *testing.T) {
+	ev := func(id string, status int, ts int64) grafanaEventRow {
+		return grafanaEventRow{EventCaseId: id, Status: status, Timestamp: time.Unix(ts, 0), Endpoint: "web01", Metric: "qps", Priority: 1}
+	}
+	rows := []grafanaEventRow{
+		// b在查询范围之前开始
+		ev("b", 1, 150),
+		ev("a", 0, 200),
+		// 重复的PROBLEM不产生新的区间
+		ev("a", 0, 260),
+		ev("a", 1, 300),
+		// c到查询结束还未恢复
+		ev("c", 0, 400),
+	}
+	output := grafanaAnnotations(rows, GrafanaJSONAnnotation{Name: "alarm"}, 100, 500)
+	expect := []struct {
+		time, timeEnd int64
+		status        string
+	}{
+		{100000, 150000, "OK"},
+		{200000, 300000, "OK"},
+		{400000, 500000, "PROBLEM"},
+	}
+	if len(output) != len(expect) {
+		t.Fatalf("expect %d annotations, got %+v", len(expect), output)
+	}
+	for i, e := range expect {
+		o := output[i]
+		if o.Time != e.time || o.TimeEnd != e.timeEnd || o.Tags[1] != e.status || !o.IsRegion || o.Annotation.Name != "alarm" {
+			t.Errorf("%d: expect %+v, got %+v", i, e, o)
+		}
+	}
+}
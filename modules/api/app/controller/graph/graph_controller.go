@@ -29,6 +29,7 @@ import (
 	m "github.com/open-falcon/falcon-plus/modules/api/app/model/graph"
 	"github.com/open-falcon/falcon-plus/modules/api/app/utils"
 	grh "github.com/open-falcon/falcon-plus/modules/api/graph"
+	"github.com/open-falcon/falcon-plus/modules/api/graph/expr"
 	tcache "github.com/toolkits/cache/localcache/timedcache"
 	"net/http"
 )
@@ -212,13 +213,17 @@ func EndpointCounterRegexpQuery(c *gin.Context) {
 	return
 }
 
+// hostnames和counters, 或者matchers(例如 "service=payment")二选一;
+// 指定step或max_points时graph会降采样, 所有曲线对齐到同一个时间轴上
 type APIQueryGraphDrawData struct {
-	HostNames []string `json:"hostnames" binding:"required"`
-	Counters  []string `json:"counters" binding:"required"`
+	HostNames []string `json:"hostnames"`
+	Counters  []string `json:"counters"`
+	Matchers  []string `json:"matchers"`
 	ConsolFun string   `json:"consol_fun" binding:"required"`
 	StartTime int64    `json:"start_time" binding:"required"`
 	EndTime   int64    `json:"end_time" binding:"required"`
 	Step      int      `json:"step"`
+	MaxPoints int      `json:"max_points"`
 }
 
 func QueryGraphDrawData(c *gin.Context) {
@@ -229,6 +234,36 @@ func QueryGraphDrawData(c *gin.Context) {
 		return
 	}
 	respData := []*cmodel.GraphQueryResponse{}
+	if len(inputs.Matchers) > 0 {
+		matchers, err := parseGraphMatchers(inputs.Matchers)
+		if err != nil {
+			h.JSONR(c, badstatus, err)
+			return
+		}
+		resp, err := grh.Series(cmodel.GraphSeriesParam{Matchers: matchers, Limit: viperInt("graphs.max_query_series", 1000)})
+		if resp == nil {
+			h.JSONR(c, badstatus, err)
+			return
+		}
+		if resp.Truncated {
+			h.JSONR(c, badstatus, "too many series, please add more matchers")
+			return
+		}
+		respData, failed, err := fetchSeriesData(resp.Series, inputs, viperInt("graphs.query_concurrency", 20))
+		if err != nil {
+			h.JSONR(c, expecstatus, fmt.Sprintf("query graph got error: %v", err))
+			return
+		}
+		if failed > 0 {
+			log.Warnf("query graph of %d/%d series failed", failed, len(resp.Series))
+		}
+		h.JSONR(c, alignDrawData(respData, inputs))
+		return
+	}
+	if len(inputs.HostNames) == 0 || len(inputs.Counters) == 0 {
+		h.JSONR(c, badstatus, "hostnames and counters, or matchers are required")
+		return
+	}
 	for _, host := range inputs.HostNames {
 		for _, counter := range inputs.Counters {
 			var step int
@@ -240,11 +275,68 @@ func QueryGraphDrawData(c *gin.Context) {
 					continue
 				}
 			}
-			data, _ := fetchData(host, counter, inputs.ConsolFun, inputs.StartTime, inputs.EndTime, step)
+			data, _ := fetchData(host, counter, inputs.ConsolFun, inputs.StartTime, inputs.EndTime, step, inputs.MaxPoints)
 			respData = append(respData, data)
 		}
 	}
-	h.JSONR(c, respData)
+	h.JSONR(c, alignDrawData(respData, inputs))
+}
+
+// 并发查询matchers匹配的曲线, 结果按series的顺序排列, 查询失败的曲线不返回, 全部失败时返回第一个错误
+func fetchSeriesData(series []*cmodel.GraphSeries, inputs APIQueryGraphDrawData, concurrency int) ([]*cmodel.GraphQueryResponse, int, error) {
+	results := make([]*cmodel.GraphQueryResponse, len(series))
+	failed, firstErr := expr.Parallel(len(series), concurrency, func(i int) error {
+		s := series[i]
+		step := s.Step
+		if inputs.Step > 0 {
+			step = inputs.Step
+		}
+		data, err := fetchData(s.Endpoint, s.Counter, inputs.ConsolFun, inputs.StartTime, inputs.EndTime, step, inputs.MaxPoints)
+		if err == nil && data == nil {
+			err = fmt.Errorf("empty response of %s/%s", s.Endpoint, s.Counter)
+		}
+		if err != nil {
+			return err
+		}
+		results[i] = data
+		return nil
+	})
+
+	if len(series) > 0 && failed == len(series) {
+		return nil, failed, firstErr
+	}
+	ret := make([]*cmodel.GraphQueryResponse, 0, len(series)-failed)
+	for _, data := range results {
+		if data != nil {
+			ret = append(ret, data)
+		}
+	}
+	return ret, failed, nil
+}
+
+// 指定了step或max_points时, 把上报周期不同的曲线合并到同一个时间轴, 间隔取各曲线中最大的
+func alignDrawData(respData []*cmodel.GraphQueryResponse, inputs APIQueryGraphDrawData) []*cmodel.GraphQueryResponse {
+	if inputs.Step <= 0 && inputs.MaxPoints <= 0 {
+		return respData
+	}
+	param := cmodel.GraphQueryParam{Start: inputs.StartTime, End: inputs.EndTime, Step: inputs.Step, MaxPoints: inputs.MaxPoints}
+	step := param.Resolution()
+	for _, data := range respData {
+		if data != nil && int64(data.Step) > step {
+			step = int64(data.Step)
+		}
+	}
+	if step <= 0 {
+		return respData
+	}
+	for _, data := range respData {
+		if data == nil {
+			continue
+		}
+		data.Values = cmodel.Downsample(data.Values, inputs.ConsolFun, inputs.StartTime, inputs.EndTime, step)
+		data.Step = int(step)
+	}
+	return respData
 }
 
 func QueryGraphLastPoint(c *gin.Context) {
@@ -434,8 +526,9 @@ func DeleteGraphCounter(c *gin.Context) {
 	})
 }
 
-func fetchData(hostname string, counter string, consolFun string, startTime int64, endTime int64, step int) (resp *cmodel.GraphQueryResponse, err error) {
+func fetchData(hostname string, counter string, consolFun string, startTime int64, endTime int64, step int, maxPoints int) (resp *cmodel.GraphQueryResponse, err error) {
 	qparm := grh.GenQParam(hostname, counter, consolFun, startTime, endTime, step)
+	qparm.MaxPoints = maxPoints
 	// log.Debugf("qparm: %v", qparm)
 	resp, err = grh.QueryOne(qparm)
 	if err != nil {
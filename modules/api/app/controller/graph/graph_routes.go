@@ -36,6 +36,11 @@ func Routes(r *gin.Engine) {
 	authapi.GET("/graph/endpoint_counter", EndpointCounterRegexpQuery)
 	authapi.POST("/graph/history", QueryGraphDrawData)
 	authapi.POST("/graph/lastpoint", QueryGraphLastPoint)
+	authapi.GET("/graph/expr", QueryGraphExpr)
+	authapi.POST("/graph/expr", QueryGraphExpr)
+	authapi.GET("/graph/series", GraphSeriesQuery)
+	authapi.GET("/graph/labels", GraphLabelsQuery)
+	authapi.GET("/graph/labels/:name/values", GraphLabelsQuery)
 	authapi.DELETE("/graph/endpoint", DeleteGraphEndpoint)
 	authapi.DELETE("/graph/counter", DeleteGraphCounter)
 
@@ -44,5 +49,23 @@ func Routes(r *gin.Engine) {
 	grfanaapi.GET("/v1/grafana/metrics/find", GrafanaMainQuery)
 	grfanaapi.POST("/v1/grafana/render", GrafanaRender)
 	grfanaapi.GET("/v1/grafana/render", GrafanaRender)
+	grfanaapi.GET("/v1/grafana/json", GrafanaJSONTest)
+	grfanaapi.POST("/v1/grafana/json/search", GrafanaJSONSearch)
+	grfanaapi.POST("/v1/grafana/json/query", GrafanaJSONQuery)
+	// annotation里是告警数据, 需要登录, 数据源要带上Apitoken头
+	grfanaapi.POST("/v1/grafana/json/annotations", utils.AuthSessionMidd, GrafanaJSONAnnotations)
+	grfanaapi.POST("/v1/grafana/json/tag-keys", GrafanaJSONTagKeys)
+	grfanaapi.POST("/v1/grafana/json/tag-values", GrafanaJSONTagValues)
+
+	// prometheus兼容的查询接口, 需要登录, 数据源要带上Apitoken头
+	authapi.GET("/query", PromQuery)
+	authapi.POST("/query", PromQuery)
+	authapi.GET("/query_range", PromQueryRange)
+	authapi.POST("/query_range", PromQueryRange)
+	authapi.GET("/series", PromSeries)
+	authapi.POST("/series", PromSeries)
+	authapi.GET("/labels", PromLabels)
+	authapi.POST("/labels", PromLabels)
+	authapi.GET("/label/:name/values", PromLabelValues)
 
 }
@@ -0,0 +1,342 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gin-gonic/gin"
+	cmodel "github.com/open-falcon/falcon-plus/common/model"
+	grh "github.com/open-falcon/falcon-plus/modules/api/graph"
+	"github.com/open-falcon/falcon-plus/modules/api/graph/expr"
+	"github.com/open-falcon/falcon-plus/modules/api/graph/promql"
+)
+
+// 和prometheus一样, 瞬时查询取5分钟内最后一个点
+const promLookback = 300
+
+// prometheus限制每条曲线最多11000个点
+const promMaxPoints = 11000
+
+type promResponse struct {
+	Status    string      `json:"status"`
+	Data      interface{} `json:"data,omitempty"`
+	ErrorType string      `json:"errorType,omitempty"`
+	Error     string      `json:"error,omitempty"`
+	Warnings  []string    `json:"warnings,omitempty"`
+}
+
+type promQueryData struct {
+	ResultType string      `json:"resultType"`
+	Result     interface{} `json:"result"`
+}
+
+type promSample struct {
+	Metric map[string]string `json:"metric"`
+	Value  [2]interface{}    `json:"value"`
+}
+
+type promRangeSeries struct {
+	Metric map[string]string `json:"metric"`
+	Values [][2]interface{}  `json:"values"`
+}
+
+func promOK(c *gin.Context, data interface{}, warnings []string) {
+	c.JSON(http.StatusOK, promResponse{Status: "success", Data: data, Warnings: warnings})
+}
+
+func promError(c *gin.Context, code int, errType string, err error) {
+	c.JSON(code, promResponse{Status: "error", ErrorType: errType, Error: err.Error()})
+}
+
+// promForm 参数可以在url中, 也可以是POST的表单
+func promForm(c *gin.Context) url.Values {
+	c.Request.ParseForm()
+	return c.Request.Form
+}
+
+// parsePromTime 时间可以是unix时间戳(秒, 可以带小数)或者RFC3339格式
+func parsePromTime(s string) (int64, error) {
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return int64(f), nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return 0, fmt.Errorf("cannot parse %q to a valid timestamp", s)
+	}
+	return t.Unix(), nil
+}
+
+// parsePromStep step可以是秒数或者5m这样的时长
+func parsePromStep(s string) (int64, error) {
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		if f < 1 {
+			return 0, fmt.Errorf("step must be at least 1s")
+		}
+		return int64(f), nil
+	}
+	d, err := promql.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("cannot parse %q to a valid duration", s)
+	}
+	if d < time.Second {
+		return 0, fmt.Errorf("step must be at least 1s")
+	}
+	return int64(d / time.Second), nil
+}
+
+func promValue(ts int64, v float64) [2]interface{} {
+	return [2]interface{}{ts, strconv.FormatFloat(v, 'f', -1, 64)}
+}
+
+// promLabels endpoint作为label, metric对应__name__, 空的tag不输出
+func promLabels(endpoint, metric string, tags map[string]string) map[string]string {
+	labels := map[string]string{}
+	if metric != "" {
+		labels["__name__"] = metric
+	}
+	if endpoint != "" {
+		labels["endpoint"] = endpoint
+	}
+	for k, v := range tags {
+		if v != "" {
+			labels[k] = v
+		}
+	}
+	return labels
+}
+
+func promWarnings(result *expr.Result) []string {
+	if result.Failed > 0 {
+		return []string{fmt.Sprintf("%d series failed to query from graph", result.Failed)}
+	}
+	return nil
+}
+
+func promEval(e *promql.Expr, start, end, step int64) (*expr.Result, error) {
+	engine := &expr.Engine{
+		Source:      graphTagSource{},
+		MaxSeries:   viperInt("graphs.max_query_series", 1000),
+		Concurrency: viperInt("graphs.query_concurrency", 20),
+	}
+	return engine.Eval(e.Node, &expr.Query{Start: start, End: end, Step: step})
+}
+
+// PromQuery prometheus的瞬时查询, 支持的PromQL见promql.Parse
+func PromQuery(c *gin.Context) {
+	form := promForm(c)
+	e, err := promql.Parse(form.Get("query"))
+	if err != nil {
+		promError(c, badstatus, "bad_data", err)
+		return
+	}
+	ts := time.Now().Unix()
+	if s := form.Get("time"); s != "" {
+		if ts, err = parsePromTime(s); err != nil {
+			promError(c, badstatus, "bad_data", err)
+			return
+		}
+	}
+	result, err := promEval(e, ts-promLookback-e.Range, ts, 0)
+	if err != nil {
+		promError(c, http.StatusUnprocessableEntity, "execution", err)
+		return
+	}
+
+	if e.Scalar {
+		v := math.NaN()
+		if len(result.Series) > 0 && len(result.Series[0].Values) > 0 {
+			v = result.Series[0].Values[len(result.Series[0].Values)-1]
+		}
+		promOK(c, promQueryData{ResultType: "scalar", Result: promValue(ts, v)}, nil)
+		return
+	}
+	samples := []promSample{}
+	for _, s := range result.Series {
+		for i := len(s.Values) - 1; i >= 0; i-- {
+			if !math.IsNaN(s.Values[i]) {
+				samples = append(samples, promSample{Metric: promLabels(s.Endpoint, s.Metric, s.Tags), Value: promValue(ts, s.Values[i])})
+				break
+			}
+		}
+	}
+	promOK(c, promQueryData{ResultType: "vector", Result: samples}, promWarnings(result))
+}
+
+// PromQueryRange prometheus的区间查询, 返回的点的时间戳是step的整数倍,
+// step比counter的上报周期小时按上报周期返回
+func PromQueryRange(c *gin.Context) {
+	form := promForm(c)
+	e, err := promql.Parse(form.Get("query"))
+	if err != nil {
+		promError(c, badstatus, "bad_data", err)
+		return
+	}
+	var start, end, step int64
+	for _, p := range []struct {
+		name  string
+		val   *int64
+		parse func(string) (int64, error)
+	}{{"start", &start, parsePromTime}, {"end", &end, parsePromTime}, {"step", &step, parsePromStep}} {
+		s := form.Get(p.name)
+		if s == "" {
+			promError(c, badstatus, "bad_data", fmt.Errorf("missing parameter %s", p.name))
+			return
+		}
+		if *p.val, err = p.parse(s); err != nil {
+			promError(c, badstatus, "bad_data", err)
+			return
+		}
+	}
+	if end < start {
+		promError(c, badstatus, "bad_data", fmt.Errorf("end timestamp must not be before start time"))
+		return
+	}
+	if (end-start)/step > promMaxPoints {
+		promError(c, badstatus, "bad_data", fmt.Errorf("exceeded maximum resolution of 11,000 points per timeseries. Try decreasing the query resolution (?step=XX)"))
+		return
+	}
+	// 向前多取一个step和range的数据, rate等函数在start处也有值
+	result, err := promEval(e, start-step-e.Range, end, step)
+	if err != nil {
+		promError(c, http.StatusUnprocessableEntity, "execution", err)
+		return
+	}
+
+	matrix := []promRangeSeries{}
+	for _, s := range result.Series {
+		rs := promRangeSeries{Metric: promLabels(s.Endpoint, s.Metric, s.Tags), Values: [][2]interface{}{}}
+		for i, v := range s.Values {
+			if ts := result.Grid.Ts(i); ts >= start && ts <= end && !math.IsNaN(v) {
+				rs.Values = append(rs.Values, promValue(ts, v))
+			}
+		}
+		if len(rs.Values) > 0 {
+			matrix = append(matrix, rs)
+		}
+	}
+	promOK(c, promQueryData{ResultType: "matrix", Result: matrix}, promWarnings(result))
+}
+
+func promMatchers(match string) ([]*cmodel.GraphMatcher, error) {
+	sel, err := promql.ParseSelector(match)
+	if err != nil {
+		return nil, err
+	}
+	return selectorMatchers(sel), nil
+}
+
+// PromSeries 按match[]查询series, graph的索引中没有时间信息, 忽略start和end
+func PromSeries(c *gin.Context) {
+	form := promForm(c)
+	matches := form["match[]"]
+	if len(matches) == 0 {
+		promError(c, badstatus, "bad_data", fmt.Errorf("no match[] parameter provided"))
+		return
+	}
+	limit := viperInt("graphs.max_query_series", 1000)
+	data := []map[string]string{}
+	warnings := []string{}
+	seen := map[string]bool{}
+	for _, match := range matches {
+		matchers, err := promMatchers(match)
+		if err != nil {
+			promError(c, badstatus, "bad_data", err)
+			return
+		}
+		resp, err := grh.Series(cmodel.GraphSeriesParam{Matchers: matchers, Limit: limit})
+		if resp == nil {
+			promError(c, http.StatusUnprocessableEntity, "execution", err)
+			return
+		}
+		if err != nil {
+			log.Warn("query series from graph fail:", err)
+			warnings = append(warnings, err.Error())
+		}
+		if resp.Truncated {
+			warnings = append(warnings, fmt.Sprintf("%s matches more than %d series, result truncated", match, limit))
+		}
+		for _, s := range resp.Series {
+			if key := s.Endpoint + "/" + s.Counter; !seen[key] {
+				seen[key] = true
+				data = append(data, promLabels(s.Endpoint, s.Metric, s.Tags))
+			}
+		}
+	}
+	promOK(c, data, warnings)
+}
+
+// PromLabels 查询label名, 可以用match[]过滤
+func PromLabels(c *gin.Context) {
+	promLabelQuery(c, "")
+}
+
+// PromLabelValues 查询label的取值, __name__对应metric
+func PromLabelValues(c *gin.Context) {
+	name := c.Param("name")
+	if name == "__name__" {
+		name = "metric"
+	}
+	promLabelQuery(c, name)
+}
+
+func promLabelQuery(c *gin.Context, name string) {
+	form := promForm(c)
+	params := []cmodel.GraphLabelParam{}
+	for _, match := range form["match[]"] {
+		matchers, err := promMatchers(match)
+		if err != nil {
+			promError(c, badstatus, "bad_data", err)
+			return
+		}
+		params = append(params, cmodel.GraphLabelParam{Name: name, Matchers: matchers})
+	}
+	if len(params) == 0 {
+		params = append(params, cmodel.GraphLabelParam{Name: name})
+	}
+
+	set := map[string]bool{}
+	warnings := []string{}
+	for _, para := range params {
+		resp, err := grh.Labels(para)
+		if resp == nil {
+			promError(c, http.StatusUnprocessableEntity, "execution", err)
+			return
+		}
+		if err != nil {
+			log.Warn("query labels from graph fail:", err)
+			warnings = append(warnings, err.Error())
+		}
+		for _, v := range resp.Values {
+			if name == "" && v == "metric" {
+				v = "__name__"
+			}
+			set[v] = true
+		}
+	}
+	values := make([]string, 0, len(set))
+	for v := range set {
+		values = append(values, v)
+	}
+	sort.Strings(values)
+	promOK(c, values, warnings)
+}
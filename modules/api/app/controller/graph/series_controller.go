@@ -0,0 +1,80 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"strconv"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gin-gonic/gin"
+	cmodel "github.com/open-falcon/falcon-plus/common/model"
+	h "github.com/open-falcon/falcon-plus/modules/api/app/helper"
+	grh "github.com/open-falcon/falcon-plus/modules/api/graph"
+)
+
+func parseGraphMatchers(ss []string) ([]*cmodel.GraphMatcher, error) {
+	matchers := make([]*cmodel.GraphMatcher, 0, len(ss))
+	for _, s := range ss {
+		m, err := cmodel.ParseGraphMatcher(s)
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, m)
+	}
+	return matchers, nil
+}
+
+func parseMatchQuery(c *gin.Context) (matchers []*cmodel.GraphMatcher, limit int, err error) {
+	if matchers, err = parseGraphMatchers(c.QueryArray("match")); err != nil {
+		return
+	}
+	limit, err = strconv.Atoi(c.DefaultQuery("limit", "500"))
+	return
+}
+
+// GraphSeriesQuery 按tag查询series, 例如 match=metric=qps&match=service=payment&match=endpoint=~"web.*"
+func GraphSeriesQuery(c *gin.Context) {
+	matchers, limit, err := parseMatchQuery(c)
+	if err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	resp, err := grh.Series(cmodel.GraphSeriesParam{Matchers: matchers, Limit: limit})
+	if err != nil {
+		if resp == nil {
+			h.JSONR(c, badstatus, err)
+			return
+		}
+		log.Warn("query series from graph fail:", err)
+	}
+	h.JSONR(c, resp)
+}
+
+func GraphLabelsQuery(c *gin.Context) {
+	matchers, limit, err := parseMatchQuery(c)
+	if err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	resp, err := grh.Labels(cmodel.GraphLabelParam{Name: c.Param("name"), Matchers: matchers, Limit: limit})
+	if err != nil {
+		if resp == nil {
+			h.JSONR(c, badstatus, err)
+			return
+		}
+		log.Warn("query labels from graph fail:", err)
+	}
+	h.JSONR(c, resp)
+}
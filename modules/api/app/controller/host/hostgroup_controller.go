@@ -28,12 +28,26 @@ import (
 	u "github.com/open-falcon/falcon-plus/modules/api/app/utils"
 )
 
+// hostname不为空时只返回这个机器所在的hostgroup, 机器不存在时返回空列表
 func GetHostGroups(c *gin.Context) {
 	var (
 		limit int
 		page  int
 		err   error
 	)
+	if hostname := c.DefaultQuery("hostname", ""); hostname != "" {
+		hosts := []f.Host{}
+		if dt := db.Falcon.Where("hostname = ?", hostname).Find(&hosts); dt.Error != nil {
+			h.JSONR(c, expecstatus, dt.Error)
+			return
+		}
+		grps := []f.HostGroup{}
+		if len(hosts) > 0 {
+			grps = hosts[0].RelatedGrp()
+		}
+		h.JSONR(c, grps)
+		return
+	}
 	pageTmp := c.DefaultQuery("page", "")
 	limitTmp := c.DefaultQuery("limit", "")
 	q := c.DefaultQuery("q", ".+")
@@ -0,0 +1,265 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package message_tpl
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	cmodel "github.com/open-falcon/falcon-plus/common/model"
+	h "github.com/open-falcon/falcon-plus/modules/api/app/helper"
+	f "github.com/open-falcon/falcon-plus/modules/api/app/model/falcon_portal"
+)
+
+type APIMessageTplInputs struct {
+	ID          int64  `json:"id" form:"id"`
+	ActionID    int64  `json:"action_id" form:"action_id"`
+	TplID       int64  `json:"tpl_id" form:"tpl_id"`
+	Sms         string `json:"sms" form:"sms"`
+	IM          string `json:"im" form:"im"`
+	MailSubject string `json:"mail_subject" form:"mail_subject"`
+	Mail        string `json:"mail" form:"mail"`
+}
+
+func (this APIMessageTplInputs) CheckFormat() (err error) {
+	switch {
+	case this.ActionID == 0 && this.TplID == 0:
+		err = errors.New("action_id OR tpl_id, You have to pick one on the request.")
+	case this.ActionID != 0 && this.TplID != 0:
+		err = errors.New("action_id and tpl_id can not be set at the same time")
+	case this.Sms == "" && this.IM == "" && this.MailSubject == "" && this.Mail == "":
+		err = errors.New("sms, im, mail_subject OR mail, You have to at least pick one on the request.")
+	}
+	if err != nil {
+		return
+	}
+	return this.checkTemplates()
+}
+
+func (this APIMessageTplInputs) checkTemplates() error {
+	for name, text := range this.templates() {
+		if _, err := cmodel.ParseMessageTemplate(name, text); err != nil {
+			return fmt.Errorf("%s is not vaild: %v", name, err)
+		}
+	}
+	return nil
+}
+
+func (this APIMessageTplInputs) templates() map[string]string {
+	return map[string]string{
+		"sms":          this.Sms,
+		"im":           this.IM,
+		"mail_subject": this.MailSubject,
+		"mail":         this.Mail,
+	}
+}
+
+func GetMessageTpls(c *gin.Context) {
+	mtpls := []f.MessageTpl{}
+	dt := db.Falcon.Order("id DESC")
+	if aid := c.DefaultQuery("action_id", ""); aid != "" {
+		dt = dt.Where("action_id = ?", aid)
+	}
+	if tid := c.DefaultQuery("tpl_id", ""); tid != "" {
+		dt = dt.Where("tpl_id = ?", tid)
+	}
+	if dt = dt.Find(&mtpls); dt.Error != nil {
+		h.JSONR(c, badstatus, dt.Error)
+		return
+	}
+	h.JSONR(c, mtpls)
+}
+
+func GetMessageTpl(c *gin.Context) {
+	id, err := strconv.Atoi(c.Params.ByName("id"))
+	if err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	mtpl := f.MessageTpl{ID: int64(id)}
+	if dt := db.Falcon.Find(&mtpl); dt.Error != nil {
+		h.JSONR(c, badstatus, dt.Error)
+		return
+	}
+	h.JSONR(c, mtpl)
+}
+
+// action上的模板优先于template上的模板, 没有时返回id为0的空模板
+func MatchMessageTpl(c *gin.Context) {
+	aid, _ := strconv.Atoi(c.DefaultQuery("action_id", "0"))
+	tid, _ := strconv.Atoi(c.DefaultQuery("tpl_id", "0"))
+	mtpls := []f.MessageTpl{}
+	if aid != 0 {
+		db.Falcon.Where("action_id = ?", aid).Limit(1).Find(&mtpls)
+	}
+	if len(mtpls) == 0 && tid != 0 {
+		db.Falcon.Where("tpl_id = ?", tid).Limit(1).Find(&mtpls)
+	}
+	if len(mtpls) == 0 {
+		h.JSONR(c, f.MessageTpl{})
+		return
+	}
+	h.JSONR(c, mtpls[0])
+}
+
+func CreateMessageTpl(c *gin.Context) {
+	var inputs APIMessageTplInputs
+	if err := c.Bind(&inputs); err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	if err := inputs.CheckFormat(); err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	var count int
+	db.Falcon.Model(f.MessageTpl{}).Where("action_id = ? AND tpl_id = ?", inputs.ActionID, inputs.TplID).Count(&count)
+	if count != 0 {
+		h.JSONR(c, badstatus, "message template of this action or template already exists")
+		return
+	}
+	user, _ := h.GetUser(c)
+	now := time.Now()
+	mtpl := f.MessageTpl{
+		ActionID:    inputs.ActionID,
+		TplID:       inputs.TplID,
+		Sms:         inputs.Sms,
+		IM:          inputs.IM,
+		MailSubject: inputs.MailSubject,
+		Mail:        inputs.Mail,
+		Creator:     user.Name,
+		CreateAt:    &now,
+	}
+	if dt := db.Falcon.Save(&mtpl); dt.Error != nil {
+		h.JSONR(c, expecstatus, dt.Error)
+		return
+	}
+	h.JSONR(c, mtpl)
+}
+
+func UpdateMessageTpl(c *gin.Context) {
+	var inputs APIMessageTplInputs
+	if err := c.Bind(&inputs); err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	if inputs.ID == 0 {
+		h.JSONR(c, badstatus, "id is missing")
+		return
+	}
+	mtpl := f.MessageTpl{ID: inputs.ID}
+	if dt := db.Falcon.Find(&mtpl); dt.Error != nil {
+		h.JSONR(c, expecstatus, fmt.Sprintf("find message template got error:%v", dt.Error))
+		return
+	}
+	// 绑定的action或template不能修改
+	inputs.ActionID = mtpl.ActionID
+	inputs.TplID = mtpl.TplID
+	if err := inputs.CheckFormat(); err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	user, _ := h.GetUser(c)
+	if !user.IsAdmin() && mtpl.Creator != user.Name {
+		h.JSONR(c, badstatus, "You don't have permission!")
+		return
+	}
+	umtpl := map[string]interface{}{
+		"sms":          inputs.Sms,
+		"im":           inputs.IM,
+		"mail_subject": inputs.MailSubject,
+		"mail":         inputs.Mail,
+	}
+	if dt := db.Falcon.Model(&mtpl).Where("id = ?", mtpl.ID).Updates(umtpl).Find(&mtpl); dt.Error != nil {
+		h.JSONR(c, expecstatus, dt.Error)
+		return
+	}
+	h.JSONR(c, mtpl)
+}
+
+func DeleteMessageTpl(c *gin.Context) {
+	id, err := strconv.Atoi(c.Params.ByName("id"))
+	if err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	mtpl := f.MessageTpl{ID: int64(id)}
+	if dt := db.Falcon.Find(&mtpl); dt.Error != nil {
+		h.JSONR(c, expecstatus, fmt.Sprintf("find message template got error:%v", dt.Error))
+		return
+	}
+	user, _ := h.GetUser(c)
+	if !user.IsAdmin() && mtpl.Creator != user.Name {
+		h.JSONR(c, badstatus, "You don't have permission!")
+		return
+	}
+	if dt := db.Falcon.Delete(&mtpl); dt.Error != nil {
+		h.JSONR(c, badstatus, dt.Error)
+		return
+	}
+	h.JSONR(c, fmt.Sprintf("message template:%d has been deleted", id))
+}
+
+type APIPreviewMessageTplInputs struct {
+	APIMessageTplInputs
+	// 使用历史告警渲染, 不填时使用示例告警
+	EventId string `json:"event_id" form:"event_id"`
+}
+
+func PreviewMessageTpl(c *gin.Context) {
+	var inputs APIPreviewMessageTplInputs
+	if err := c.Bind(&inputs); err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	if inputs.ID != 0 {
+		mtpl := f.MessageTpl{ID: inputs.ID}
+		if dt := db.Falcon.Find(&mtpl); dt.Error != nil {
+			h.JSONR(c, expecstatus, fmt.Sprintf("find message template got error:%v", dt.Error))
+			return
+		}
+		inputs.Sms = mtpl.Sms
+		inputs.IM = mtpl.IM
+		inputs.MailSubject = mtpl.MailSubject
+		inputs.Mail = mtpl.Mail
+	}
+
+	event := sampleEvent()
+	if inputs.EventId != "" {
+		var err error
+		if event, err = historyEvent(inputs.EventId); err != nil {
+			h.JSONR(c, badstatus, err)
+			return
+		}
+	}
+
+	data := cmodel.NewMessageData(event, hostgroupsOf(event.Endpoint), "")
+	output := map[string]string{}
+	for name, text := range inputs.templates() {
+		if text == "" {
+			continue
+		}
+		msg, err := cmodel.RenderMessage(name, text, data)
+		if err != nil {
+			h.JSONR(c, badstatus, fmt.Sprintf("render %s got error: %v", name, err))
+			return
+		}
+		output[name] = msg
+	}
+	h.JSONR(c, output)
+}
@@ -0,0 +1,137 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package message_tpl
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	cmodel "github.com/open-falcon/falcon-plus/common/model"
+	"github.com/open-falcon/falcon-plus/common/utils"
+	alm "github.com/open-falcon/falcon-plus/modules/api/app/model/alarm"
+	f "github.com/open-falcon/falcon-plus/modules/api/app/model/falcon_portal"
+)
+
+func sampleEvent() *cmodel.Event {
+	return &cmodel.Event{
+		Id:          "s_1_sample",
+		Endpoint:    "host01",
+		Status:      "PROBLEM",
+		LeftValue:   95.5,
+		CurrentStep: 1,
+		EventTime:   time.Now().Unix(),
+		PushedTags:  map[string]string{"mount": "/home"},
+		Strategy: &cmodel.Strategy{
+			Id:         1,
+			Metric:     "df.bytes.used.percent",
+			Tags:       map[string]string{"mount": "/home"},
+			Func:       "all(#3)",
+			Operator:   ">",
+			RightValue: 90,
+			MaxStep:    3,
+			Priority:   1,
+			Note:       "disk is almost full",
+			Tpl:        &cmodel.Template{Id: 1, Name: "sample", Creator: "root"},
+		},
+	}
+}
+
+// 用event_cases中的记录还原出event
+func historyEvent(id string) (*cmodel.Event, error) {
+	ecase := alm.EventCases{}
+	if dt := db.Alarm.Where("id = ?", id).Find(&ecase); dt.Error != nil {
+		return nil, fmt.Errorf("find event case %s got error: %v", id, dt.Error)
+	}
+
+	// metric是metric/tags的格式
+	metric, tags := ecase.Metric, map[string]string{}
+	if idx := strings.Index(ecase.Metric, "/"); idx > 0 {
+		metric = ecase.Metric[:idx]
+		_, tags = utils.SplitTagsString(ecase.Metric[idx+1:])
+	}
+
+	// cond是leftValue operator rightValue的格式
+	var leftValue, rightValue float64
+	var operator string
+	if fields := strings.Fields(ecase.Cond); len(fields) == 3 {
+		leftValue, _ = strconv.ParseFloat(fields[0], 64)
+		operator = fields[1]
+		rightValue, _ = strconv.ParseFloat(fields[2], 64)
+	}
+
+	event := &cmodel.Event{
+		Id:          ecase.ID,
+		Endpoint:    ecase.Endpoint,
+		Status:      ecase.Status,
+		LeftValue:   leftValue,
+		CurrentStep: ecase.CurrentStep,
+		PushedTags:  tags,
+	}
+	if ecase.Timestamp != nil {
+		event.EventTime = ecase.Timestamp.Unix()
+	}
+	if ecase.UpdateAt != nil {
+		event.EventTime = ecase.UpdateAt.Unix()
+	}
+
+	if ecase.ExpressionId != 0 {
+		event.Expression = &cmodel.Expression{
+			Id:         int(ecase.ExpressionId),
+			Metric:     metric,
+			Tags:       tags,
+			Func:       ecase.Func,
+			Operator:   operator,
+			RightValue: rightValue,
+			MaxStep:    ecase.MaxStep,
+			Priority:   ecase.Priority,
+			Note:       ecase.Note,
+		}
+		return event, nil
+	}
+
+	tpl := &cmodel.Template{Id: int(ecase.TemplateId), Creator: ecase.TplCreator}
+	ftpl := f.Template{}
+	if dt := db.Falcon.Where("id = ?", ecase.TemplateId).Find(&ftpl); dt.Error == nil {
+		tpl.Name = ftpl.Name
+		tpl.ActionId = int(ftpl.ActionID)
+	}
+	event.Strategy = &cmodel.Strategy{
+		Id:         int(ecase.StrategyId),
+		Metric:     metric,
+		Tags:       tags,
+		Func:       ecase.Func,
+		Operator:   operator,
+		RightValue: rightValue,
+		MaxStep:    ecase.MaxStep,
+		Priority:   ecase.Priority,
+		Note:       ecase.Note,
+		Tpl:        tpl,
+	}
+	return event, nil
+}
+
+func hostgroupsOf(endpoint string) []string {
+	host := f.Host{}
+	if dt := db.Falcon.Where("hostname = ?", endpoint).Find(&host); dt.Error != nil {
+		return []string{}
+	}
+	grps := []string{}
+	for _, grp := range host.RelatedGrp() {
+		grps = append(grps, grp.Name)
+	}
+	return grps
+}
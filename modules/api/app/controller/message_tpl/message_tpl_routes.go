@@ -0,0 +1,43 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package message_tpl
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/open-falcon/falcon-plus/modules/api/app/utils"
+	"github.com/open-falcon/falcon-plus/modules/api/config"
+)
+
+var db config.DBPool
+
+const badstatus = http.StatusBadRequest
+const expecstatus = http.StatusExpectationFailed
+
+func Routes(r *gin.Engine) {
+	db = config.Con()
+	mtplr := r.Group("/api/v1/message_tpl")
+	mtplr.Use(utils.AuthSessionMidd)
+	mtplr.GET("", GetMessageTpls)
+	mtplr.GET("/:id", GetMessageTpl)
+	mtplr.POST("", CreateMessageTpl)
+	mtplr.PUT("", UpdateMessageTpl)
+	mtplr.DELETE("/:id", DeleteMessageTpl)
+	mtplr.POST("/preview", PreviewMessageTpl)
+
+	// alarm根据action和template查找生效的消息模板
+	r.GET("/api/v1/message_tpl_match", utils.AuthSessionMidd, MatchMessageTpl)
+}
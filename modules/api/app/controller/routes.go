@@ -24,7 +24,9 @@ import (
 	"github.com/open-falcon/falcon-plus/modules/api/app/controller/expression"
 	"github.com/open-falcon/falcon-plus/modules/api/app/controller/graph"
 	"github.com/open-falcon/falcon-plus/modules/api/app/controller/host"
+	"github.com/open-falcon/falcon-plus/modules/api/app/controller/message_tpl"
 	"github.com/open-falcon/falcon-plus/modules/api/app/controller/mockcfg"
+	"github.com/open-falcon/falcon-plus/modules/api/app/controller/silence"
 	"github.com/open-falcon/falcon-plus/modules/api/app/controller/strategy"
 	"github.com/open-falcon/falcon-plus/modules/api/app/controller/template"
 	"github.com/open-falcon/falcon-plus/modules/api/app/controller/uic"
@@ -46,5 +48,7 @@ func StartGin(port string, r *gin.Engine) {
 	dashboard_graph.Routes(r)
 	dashboard_screen.Routes(r)
 	alarm.Routes(r)
+	silence.Routes(r)
+	message_tpl.Routes(r)
 	r.Run(port)
 }
@@ -0,0 +1,269 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package silence
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	cutils "github.com/open-falcon/falcon-plus/common/utils"
+	h "github.com/open-falcon/falcon-plus/modules/api/app/helper"
+	alm "github.com/open-falcon/falcon-plus/modules/api/app/model/alarm"
+)
+
+type APISilenceInputs struct {
+	ID           int64  `json:"id" form:"id"`
+	Endpoint     string `json:"endpoint" form:"endpoint"`
+	Metric       string `json:"metric" form:"metric"`
+	Tags         string `json:"tags" form:"tags"`
+	StrategyId   int64  `json:"strategy_id" form:"strategy_id"`
+	ExpressionId int64  `json:"expression_id" form:"expression_id"`
+	Hostgroup    string `json:"hostgroup" form:"hostgroup"`
+	Comment      string `json:"comment" form:"comment" binding:"required"`
+	StartAt      int64  `json:"start_at" form:"start_at" binding:"required"`
+	EndAt        int64  `json:"end_at" form:"end_at" binding:"required"`
+}
+
+func (this APISilenceInputs) CheckFormat() (err error) {
+	switch {
+	case this.Endpoint == "" && this.Metric == "" && this.Tags == "" &&
+		this.StrategyId == 0 && this.ExpressionId == 0 && this.Hostgroup == "":
+		err = errors.New("endpoint, metric, tags, strategy_id, expression_id OR hostgroup, You have to at least pick one on the request.")
+	case this.EndAt <= this.StartAt:
+		err = errors.New("end_at should be after start_at")
+	}
+	if err != nil {
+		return
+	}
+	if _, rerr := regexp.Compile(this.Endpoint); rerr != nil {
+		err = fmt.Errorf("endpoint regexp %s is not vaild: %v", this.Endpoint, rerr)
+		return
+	}
+	if terr, _ := cutils.SplitTagsString(this.Tags); terr != nil {
+		err = fmt.Errorf("tags %s is not vaild, please refer ex. k1=v1,k2=v2", this.Tags)
+	}
+	return
+}
+
+// 记录屏蔽规则的变更，失败不影响操作本身
+func writeSilenceLog(silence alm.Silence, action string, user string) {
+	content, _ := json.Marshal(silence)
+	now := time.Now()
+	slog := alm.SilenceLog{
+		SilenceId: silence.ID,
+		Action:    action,
+		User:      user,
+		Content:   string(content),
+		Timestamp: &now,
+	}
+	if dt := db.Alarm.Save(&slog); dt.Error != nil {
+		log.Errorf("save silence log of %d got error: %v", silence.ID, dt.Error)
+	}
+}
+
+// active=true 只返回当前生效的屏蔽规则
+func GetSilences(c *gin.Context) {
+	var (
+		limit int
+		page  int
+		err   error
+	)
+	pageTmp := c.DefaultQuery("page", "")
+	limitTmp := c.DefaultQuery("limit", "")
+	page, limit, err = h.PageParser(pageTmp, limitTmp)
+	if err != nil {
+		h.JSONR(c, badstatus, err.Error())
+		return
+	}
+	var dt *gorm.DB
+	silences := []alm.Silence{}
+	dt = db.Alarm.Order("id DESC")
+	if c.DefaultQuery("active", "") == "true" {
+		now := time.Now()
+		dt = dt.Where("start_at <= ? AND end_at > ?", now, now)
+	}
+	if limit != -1 && page != -1 {
+		dt = dt.Offset(page).Limit(limit)
+	}
+	if dt = dt.Find(&silences); dt.Error != nil {
+		h.JSONR(c, badstatus, dt.Error)
+		return
+	}
+	h.JSONR(c, silences)
+}
+
+func GetSilence(c *gin.Context) {
+	id, err := strconv.Atoi(c.Params.ByName("id"))
+	if err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	silence := alm.Silence{ID: int64(id)}
+	if dt := db.Alarm.Find(&silence); dt.Error != nil {
+		h.JSONR(c, badstatus, dt.Error)
+		return
+	}
+	h.JSONR(c, silence)
+}
+
+func GetSilenceLogs(c *gin.Context) {
+	id, err := strconv.Atoi(c.Params.ByName("id"))
+	if err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	logs := []alm.SilenceLog{}
+	if dt := db.Alarm.Where("silence_id = ?", id).Order("id DESC").Find(&logs); dt.Error != nil {
+		h.JSONR(c, badstatus, dt.Error)
+		return
+	}
+	h.JSONR(c, logs)
+}
+
+func CreateSilence(c *gin.Context) {
+	var inputs APISilenceInputs
+	if err := c.Bind(&inputs); err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	if err := inputs.CheckFormat(); err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	user, _ := h.GetUser(c)
+	silence := alm.Silence{
+		Endpoint:     inputs.Endpoint,
+		Metric:       inputs.Metric,
+		Tags:         inputs.Tags,
+		StrategyId:   inputs.StrategyId,
+		ExpressionId: inputs.ExpressionId,
+		Hostgroup:    inputs.Hostgroup,
+		Creator:      user.Name,
+		Comment:      inputs.Comment,
+		StartAt:      time.Unix(inputs.StartAt, 0),
+		EndAt:        time.Unix(inputs.EndAt, 0),
+		CreateAt:     time.Now(),
+	}
+	if dt := db.Alarm.Save(&silence); dt.Error != nil {
+		h.JSONR(c, expecstatus, dt.Error)
+		return
+	}
+	writeSilenceLog(silence, "create", user.Name)
+	h.JSONR(c, silence)
+}
+
+func UpdateSilence(c *gin.Context) {
+	var inputs APISilenceInputs
+	if err := c.Bind(&inputs); err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	if inputs.ID == 0 {
+		h.JSONR(c, badstatus, "id is missing")
+		return
+	}
+	if err := inputs.CheckFormat(); err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	silence := alm.Silence{ID: inputs.ID}
+	if dt := db.Alarm.Find(&silence); dt.Error != nil {
+		h.JSONR(c, expecstatus, fmt.Sprintf("find silence got error:%v", dt.Error))
+		return
+	}
+	user, _ := h.GetUser(c)
+	if !user.IsAdmin() && silence.Creator != user.Name {
+		h.JSONR(c, badstatus, "You don't have permission!")
+		return
+	}
+	usilence := map[string]interface{}{
+		"endpoint":      inputs.Endpoint,
+		"metric":        inputs.Metric,
+		"tags":          inputs.Tags,
+		"strategy_id":   inputs.StrategyId,
+		"expression_id": inputs.ExpressionId,
+		"hostgroup":     inputs.Hostgroup,
+		"comment":       inputs.Comment,
+		"start_at":      time.Unix(inputs.StartAt, 0),
+		"end_at":        time.Unix(inputs.EndAt, 0),
+	}
+	if dt := db.Alarm.Model(&silence).Where("id = ?", silence.ID).Updates(usilence).Find(&silence); dt.Error != nil {
+		h.JSONR(c, expecstatus, dt.Error)
+		return
+	}
+	writeSilenceLog(silence, "update", user.Name)
+	h.JSONR(c, silence)
+}
+
+// 提前结束屏蔽
+func ExpireSilence(c *gin.Context) {
+	id, err := strconv.Atoi(c.Params.ByName("id"))
+	if err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	silence := alm.Silence{ID: int64(id)}
+	if dt := db.Alarm.Find(&silence); dt.Error != nil {
+		h.JSONR(c, expecstatus, fmt.Sprintf("find silence got error:%v", dt.Error))
+		return
+	}
+	user, _ := h.GetUser(c)
+	if !user.IsAdmin() && silence.Creator != user.Name {
+		h.JSONR(c, badstatus, "You don't have permission!")
+		return
+	}
+	now := time.Now()
+	if !silence.EndAt.After(now) {
+		h.JSONR(c, badstatus, fmt.Sprintf("silence:%d is already expired", id))
+		return
+	}
+	if dt := db.Alarm.Model(&silence).Where("id = ?", silence.ID).Update("end_at", now).Find(&silence); dt.Error != nil {
+		h.JSONR(c, expecstatus, dt.Error)
+		return
+	}
+	writeSilenceLog(silence, "expire", user.Name)
+	h.JSONR(c, silence)
+}
+
+func DeleteSilence(c *gin.Context) {
+	id, err := strconv.Atoi(c.Params.ByName("id"))
+	if err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	silence := alm.Silence{ID: int64(id)}
+	if dt := db.Alarm.Find(&silence); dt.Error != nil {
+		h.JSONR(c, expecstatus, fmt.Sprintf("find silence got error:%v", dt.Error))
+		return
+	}
+	user, _ := h.GetUser(c)
+	if !user.IsAdmin() && silence.Creator != user.Name {
+		h.JSONR(c, badstatus, "You don't have permission!")
+		return
+	}
+	if dt := db.Alarm.Delete(&silence); dt.Error != nil {
+		h.JSONR(c, badstatus, dt.Error)
+		return
+	}
+	writeSilenceLog(silence, "delete", user.Name)
+	h.JSONR(c, fmt.Sprintf("silence:%d has been deleted", id))
+}
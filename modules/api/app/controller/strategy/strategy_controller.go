@@ -24,6 +24,7 @@ import (
 	"io/ioutil"
 
 	"github.com/gin-gonic/gin"
+	cutils "github.com/open-falcon/falcon-plus/common/utils"
 	h "github.com/open-falcon/falcon-plus/modules/api/app/helper"
 	f "github.com/open-falcon/falcon-plus/modules/api/app/model/falcon_portal"
 	"github.com/spf13/viper"
@@ -73,6 +74,8 @@ func (this APICreateStrategyInput) CheckFormat() (err error) {
 		err = errors.New("op's formating is not vaild")
 	case !validRightValue.MatchString(this.RightValue):
 		err = errors.New("right_value's formating is not vaild")
+	case !cutils.IsJudgeFuncValid(this.Func):
+		err = errors.New("func's formating is not vaild, please refer ex. avg(#3) percentile(#10,95)")
 	case !validTime.MatchString(this.RunBegin) && this.RunBegin != "":
 		err = errors.New("run_begin's formating is not vaild, please refer ex. 00:00")
 	case !validTime.MatchString(this.RunEnd) && this.RunEnd != "":
@@ -156,6 +159,8 @@ func (this APIUpdateStrategyInput) CheckFormat() (err error) {
 		err = errors.New("op's formating is not vaild")
 	case !validRightValue.MatchString(this.RightValue):
 		err = errors.New("right_value's formating is not vaild")
+	case !cutils.IsJudgeFuncValid(this.Func):
+		err = errors.New("func's formating is not vaild, please refer ex. avg(#3) percentile(#10,95)")
 	case !validTime.MatchString(this.RunBegin) && this.RunBegin != "":
 		err = errors.New("run_begin's formating is not vaild, please refer ex. 00:00")
 	case !validTime.MatchString(this.RunEnd) && this.RunEnd != "":
@@ -302,6 +302,7 @@ type APICreateActionToTmplateInput struct {
 	BeforeCallbackMail int    `json:"before_callback_mail" binding:"exists"`
 	AfterCallbackMail  int    `json:"after_callback_mail" binding:"exists"`
 	TplId              int64  `json:"tpl_id" binding:"required"`
+	Channels           string `json:"channels"`
 }
 
 func CreateActionToTmplate(c *gin.Context) {
@@ -319,6 +320,7 @@ func CreateActionToTmplate(c *gin.Context) {
 		BeforeCallbackMail: inputs.BeforeCallbackMail,
 		AfterCallbackMail:  inputs.AfterCallbackMail,
 		AfterCallbackSMS:   inputs.AfterCallbackSMS,
+		Channels:           inputs.Channels,
 	}
 	tx := db.Falcon.Begin()
 	if dt := tx.Table("action").Save(&action); dt.Error != nil {
@@ -356,6 +358,7 @@ type APIUpdateActionToTmplateInput struct {
 	AfterCallbackSMS   int    `json:"after_callback_sms" binding:"exists"`
 	BeforeCallbackMail int    `json:"before_callback_mail" binding:"exists"`
 	AfterCallbackMail  int    `json:"after_callback_mail" binding:"exists"`
+	Channels           string `json:"channels"`
 }
 
 func UpdateActionToTmplate(c *gin.Context) {
@@ -381,6 +384,7 @@ func UpdateActionToTmplate(c *gin.Context) {
 		"BeforeCallbackMail": inputs.BeforeCallbackMail,
 		"AfterCallbackMail":  inputs.AfterCallbackMail,
 		"AfterCallbackSMS":   inputs.AfterCallbackSMS,
+		"Channels":           inputs.Channels,
 	}
 	dt := tx.Model(&action).Where("id = ?", inputs.ID).Update(uaction)
 	if dt.Error != nil {
@@ -408,5 +412,82 @@ func GetActionByID(c *gin.Context) {
 		return
 	}
 
-	h.JSONR(c, act)
+	escalations := []f.ActionEscalation{}
+	if dt := db.Falcon.Where("action_id = ?", act_id).Order("step").Find(&escalations); dt.Error != nil {
+		h.JSONR(c, badstatus, dt.Error)
+		return
+	}
+
+	h.JSONR(c, APIGetActionOutput{Action: act, Escalations: escalations})
+}
+
+type APIGetActionOutput struct {
+	f.Action
+	Escalations []f.ActionEscalation `json:"escalations"`
+}
+
+type APIEscalationInput struct {
+	AfterMinutes int    `json:"after_minutes" binding:"required"`
+	UIC          string `json:"uic" binding:"required"`
+}
+
+type APISetActionEscalationsInput struct {
+	Escalations []APIEscalationInput `json:"escalations" binding:"exists"`
+}
+
+func (this APISetActionEscalationsInput) CheckFormat() error {
+	last := 0
+	for i, e := range this.Escalations {
+		if e.AfterMinutes <= last {
+			return fmt.Errorf("escalation %d: after_minutes should be greater than %d", i+1, last)
+		}
+		last = e.AfterMinutes
+	}
+	return nil
+}
+
+// 整体替换action的升级策略, 按after_minutes升序, 第一级之前由action.uic接收告警
+func SetActionEscalations(c *gin.Context) {
+	act_id, err := strconv.Atoi(c.Param("act_id"))
+	if err != nil {
+		h.JSONR(c, badstatus, "invalid action id")
+		return
+	}
+	var inputs APISetActionEscalationsInput
+	if err := c.BindJSON(&inputs); err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	if err := inputs.CheckFormat(); err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+
+	var action f.Action
+	tx := db.Falcon.Begin()
+	if dt := tx.Find(&action, act_id); dt.Error != nil {
+		h.JSONR(c, badstatus, dt.Error)
+		tx.Rollback()
+		return
+	}
+	if dt := tx.Where("action_id = ?", act_id).Delete(f.ActionEscalation{}); dt.Error != nil {
+		h.JSONR(c, badstatus, dt.Error)
+		tx.Rollback()
+		return
+	}
+	for i, e := range inputs.Escalations {
+		escalation := f.ActionEscalation{
+			ActionID:     int64(act_id),
+			Step:         i + 1,
+			AfterMinutes: e.AfterMinutes,
+			UIC:          e.UIC,
+		}
+		if dt := tx.Save(&escalation); dt.Error != nil {
+			h.JSONR(c, badstatus, dt.Error)
+			tx.Rollback()
+			return
+		}
+	}
+	tx.Commit()
+	h.JSONR(c, fmt.Sprintf("action: %d has %d escalations now", act_id, len(inputs.Escalations)))
 }
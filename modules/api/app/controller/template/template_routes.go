@@ -41,6 +41,7 @@ func Routes(r *gin.Engine) {
 
 	actr := r.Group("/api/v1/action")
 	actr.GET("/:act_id", GetActionByID)
+	actr.PUT("/:act_id/escalations", utils.AuthSessionMidd, SetActionEscalations)
 
 	//simple list for ajax use
 	tmpr2 := r.Group("/api/v1/template_simple")
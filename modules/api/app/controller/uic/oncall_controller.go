@@ -0,0 +1,374 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package uic
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	h "github.com/open-falcon/falcon-plus/modules/api/app/helper"
+	"github.com/open-falcon/falcon-plus/modules/api/app/model/uic"
+)
+
+type APIGetOncallOutput struct {
+	Team      uic.Team   `json:"team"`
+	Timestamp int64      `json:"timestamp"`
+	Scheduled bool       `json:"scheduled"`
+	Override  bool       `json:"override"`
+	Users     []uic.User `json:"users"`
+}
+
+// 查询某个时刻的值班人, 没有设置值班表的team返回全部成员
+func oncallOf(c *gin.Context, team uic.Team) {
+	ts := time.Now().Unix()
+	if tsStr := c.DefaultQuery("ts", ""); tsStr != "" {
+		var err error
+		ts, err = strconv.ParseInt(tsStr, 10, 64)
+		if err != nil {
+			h.JSONR(c, badstatus, "ts is not vaild")
+			return
+		}
+	}
+	resp := APIGetOncallOutput{Team: team, Timestamp: ts, Users: []uic.User{}}
+
+	var schedule uic.OncallSchedule
+	dt := db.Uic.Where("team_id = ?", team.ID).Find(&schedule)
+	if dt.Error != nil && !dt.RecordNotFound() {
+		h.JSONR(c, badstatus, dt.Error)
+		return
+	}
+	if dt.RecordNotFound() {
+		var uidarr []uic.RelTeamUser
+		if dt = db.Uic.Where("tid = ?", team.ID).Find(&uidarr); dt.Error != nil {
+			h.JSONR(c, badstatus, dt.Error)
+			return
+		}
+		if len(uidarr) != 0 {
+			uids := []int64{}
+			for _, v := range uidarr {
+				uids = append(uids, v.Uid)
+			}
+			db.Uic.Where("id IN (?)", uids).Find(&resp.Users)
+		}
+		h.JSONR(c, resp)
+		return
+	}
+
+	var overrides []uic.OncallOverride
+	if dt = db.Uic.Where("schedule_id = ? AND start_at <= ? AND end_at > ?", schedule.ID, ts, ts).Find(&overrides); dt.Error != nil {
+		h.JSONR(c, badstatus, dt.Error)
+		return
+	}
+	uid, override, err := schedule.OncallAt(time.Unix(ts, 0), overrides)
+	if err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	resp.Scheduled = true
+	resp.Override = override
+	user := uic.User{ID: uid}
+	if dt = db.Uic.Find(&user); dt.Error != nil {
+		h.JSONR(c, badstatus, fmt.Sprintf("oncall user %d not found: %v", uid, dt.Error))
+		return
+	}
+	resp.Users = append(resp.Users, user)
+	h.JSONR(c, resp)
+}
+
+func GetOncall(c *gin.Context) {
+	team, err := findTeam(c)
+	if err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	oncallOf(c, team)
+}
+
+func GetOncallByTeamName(c *gin.Context) {
+	name := c.Params.ByName("team_name")
+	if name == "" {
+		h.JSONR(c, badstatus, "team name is missing")
+		return
+	}
+	var team uic.Team
+	if dt := db.Uic.Table("team").Where(&uic.Team{Name: name}).Find(&team); dt.Error != nil {
+		h.JSONR(c, badstatus, dt.Error)
+		return
+	}
+	oncallOf(c, team)
+}
+
+func findTeam(c *gin.Context) (team uic.Team, err error) {
+	teamID, err := strconv.Atoi(c.Params.ByName("team_id"))
+	if err != nil || teamID == 0 {
+		err = errors.New("team_id is not vaild")
+		return
+	}
+	team = uic.Team{ID: int64(teamID)}
+	if dt := db.Uic.Find(&team); dt.Error != nil {
+		err = dt.Error
+	}
+	return
+}
+
+// admin, team的创建者和成员可以修改值班表
+func findEditableTeam(c *gin.Context) (team uic.Team, user uic.User, err error) {
+	teamID, err := strconv.Atoi(c.Params.ByName("team_id"))
+	if err != nil || teamID == 0 {
+		err = errors.New("team_id is not vaild")
+		return
+	}
+	u, err := h.GetUser(c)
+	if err != nil {
+		return
+	}
+	user = u
+	dt := db.Uic
+	if user.IsAdmin() {
+		dt = dt.Table("team").Where("id = ?", teamID)
+	} else {
+		dt = dt.Raw(
+			`select a.* from team as a, rel_team_user as b 
+			where a.id = b.tid AND a.id = ? AND b.uid = ? 
+			UNION select * from team where creator = ? AND id = ?`,
+			teamID, user.ID, user.ID, teamID)
+	}
+	if dt = dt.Find(&team); dt.Error != nil {
+		err = errors.New("You don't have permission or team not found")
+	}
+	return
+}
+
+func GetOncallSchedule(c *gin.Context) {
+	team, err := findTeam(c)
+	if err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	var schedule uic.OncallSchedule
+	if dt := db.Uic.Where("team_id = ?", team.ID).Find(&schedule); dt.Error != nil {
+		h.JSONR(c, badstatus, dt.Error)
+		return
+	}
+	h.JSONR(c, schedule)
+}
+
+type APISetOncallScheduleInput struct {
+	Rotation  string  `json:"rotation" form:"rotation" binding:"required"`
+	Handoff   string  `json:"handoff" form:"handoff"`
+	Timezone  string  `json:"timezone" form:"timezone"`
+	StartDate string  `json:"start_date" form:"start_date" binding:"required"`
+	UserIDs   []int64 `json:"users" form:"users" binding:"required"`
+}
+
+func SetOncallSchedule(c *gin.Context) {
+	var inputs APISetOncallScheduleInput
+	if err := c.Bind(&inputs); err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	team, user, err := findEditableTeam(c)
+	if err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	if inputs.Handoff == "" {
+		inputs.Handoff = "09:00"
+	}
+	if inputs.Timezone == "" {
+		inputs.Timezone = "UTC"
+	}
+	uids := ""
+	for i, uid := range inputs.UserIDs {
+		if i == 0 {
+			uids = fmt.Sprintf("%d", uid)
+		} else {
+			uids = fmt.Sprintf("%s,%d", uids, uid)
+		}
+	}
+	schedule := uic.OncallSchedule{
+		TeamID:    team.ID,
+		Rotation:  inputs.Rotation,
+		Handoff:   inputs.Handoff,
+		Timezone:  inputs.Timezone,
+		StartDate: inputs.StartDate,
+		Users:     uids,
+		Creator:   user.ID,
+	}
+	if err := schedule.Validate(); err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	var cnt int
+	db.Uic.Table("user").Where("id IN (?)", inputs.UserIDs).Count(&cnt)
+	if cnt != len(inputs.UserIDs) {
+		h.JSONR(c, badstatus, "some of users not found")
+		return
+	}
+
+	var old uic.OncallSchedule
+	db.Uic.Where("team_id = ?", team.ID).Find(&old)
+	if old.ID != 0 {
+		schedule.ID = old.ID
+		dt := db.Uic.Model(&old).Updates(map[string]interface{}{
+			"rotation":   schedule.Rotation,
+			"handoff":    schedule.Handoff,
+			"timezone":   schedule.Timezone,
+			"start_date": schedule.StartDate,
+			"users":      schedule.Users,
+		})
+		if dt.Error != nil {
+			h.JSONR(c, badstatus, dt.Error)
+			return
+		}
+	} else if dt := db.Uic.Create(&schedule); dt.Error != nil {
+		h.JSONR(c, badstatus, dt.Error)
+		return
+	}
+	h.JSONR(c, schedule)
+}
+
+func DeleteOncallSchedule(c *gin.Context) {
+	team, _, err := findEditableTeam(c)
+	if err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	var schedule uic.OncallSchedule
+	if dt := db.Uic.Where("team_id = ?", team.ID).Find(&schedule); dt.Error != nil {
+		h.JSONR(c, badstatus, dt.Error)
+		return
+	}
+	tx := db.Uic.Begin()
+	if dt := tx.Where("schedule_id = ?", schedule.ID).Delete(uic.OncallOverride{}); dt.Error != nil {
+		tx.Rollback()
+		h.JSONR(c, badstatus, dt.Error)
+		return
+	}
+	if dt := tx.Delete(&schedule); dt.Error != nil {
+		tx.Rollback()
+		h.JSONR(c, badstatus, dt.Error)
+		return
+	}
+	tx.Commit()
+	h.JSONR(c, fmt.Sprintf("oncall schedule of team %s is deleted", team.Name))
+}
+
+// 默认只返回未过期的替班
+func GetOncallOverrides(c *gin.Context) {
+	team, err := findTeam(c)
+	if err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	var schedule uic.OncallSchedule
+	if dt := db.Uic.Where("team_id = ?", team.ID).Find(&schedule); dt.Error != nil {
+		h.JSONR(c, badstatus, dt.Error)
+		return
+	}
+	overrides := []uic.OncallOverride{}
+	dt := db.Uic.Where("schedule_id = ?", schedule.ID)
+	if c.DefaultQuery("all", "false") != "true" {
+		dt = dt.Where("end_at > ?", time.Now().Unix())
+	}
+	if dt = dt.Order("start_at").Find(&overrides); dt.Error != nil {
+		h.JSONR(c, badstatus, dt.Error)
+		return
+	}
+	h.JSONR(c, overrides)
+}
+
+type APICreateOncallOverrideInput struct {
+	UserID  int64 `json:"user_id" form:"user_id" binding:"required"`
+	StartAt int64 `json:"start_at" form:"start_at" binding:"required"`
+	EndAt   int64 `json:"end_at" form:"end_at" binding:"required"`
+}
+
+func (this APICreateOncallOverrideInput) CheckFormat() error {
+	if this.EndAt <= this.StartAt {
+		return errors.New("end_at should be greater than start_at")
+	}
+	return nil
+}
+
+func CreateOncallOverride(c *gin.Context) {
+	var inputs APICreateOncallOverrideInput
+	if err := c.Bind(&inputs); err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	if err := inputs.CheckFormat(); err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	team, user, err := findEditableTeam(c)
+	if err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	var schedule uic.OncallSchedule
+	if dt := db.Uic.Where("team_id = ?", team.ID).Find(&schedule); dt.Error != nil {
+		h.JSONR(c, badstatus, fmt.Sprintf("team %s has no oncall schedule: %v", team.Name, dt.Error))
+		return
+	}
+	substitute := uic.User{ID: inputs.UserID}
+	if dt := db.Uic.Find(&substitute); dt.Error != nil {
+		h.JSONR(c, badstatus, fmt.Sprintf("user %d not found", inputs.UserID))
+		return
+	}
+	override := uic.OncallOverride{
+		ScheduleID: schedule.ID,
+		UserID:     inputs.UserID,
+		StartAt:    inputs.StartAt,
+		EndAt:      inputs.EndAt,
+		Creator:    user.ID,
+	}
+	if dt := db.Uic.Create(&override); dt.Error != nil {
+		h.JSONR(c, badstatus, dt.Error)
+		return
+	}
+	h.JSONR(c, override)
+}
+
+func DeleteOncallOverride(c *gin.Context) {
+	id, err := strconv.Atoi(c.Params.ByName("id"))
+	if err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	team, _, err := findEditableTeam(c)
+	if err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	var schedule uic.OncallSchedule
+	if dt := db.Uic.Where("team_id = ?", team.ID).Find(&schedule); dt.Error != nil {
+		h.JSONR(c, badstatus, dt.Error)
+		return
+	}
+	dt := db.Uic.Where("id = ? AND schedule_id = ?", id, schedule.ID).Delete(uic.OncallOverride{})
+	if dt.Error != nil {
+		h.JSONR(c, badstatus, dt.Error)
+		return
+	}
+	if dt.RowsAffected == 0 {
+		h.JSONR(c, badstatus, fmt.Sprintf("override %d not found", id))
+		return
+	}
+	h.JSONR(c, fmt.Sprintf("override %d is deleted", id))
+}
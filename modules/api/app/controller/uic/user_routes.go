@@ -62,4 +62,16 @@ func Routes(r *gin.Engine) {
 	authapi_team.POST("/team", CreateTeam)
 	authapi_team.PUT("/team", UpdateTeam)
 	authapi_team.DELETE("/team/:team_id", DeleteTeam)
+
+	//oncall
+	oncall := r.Group("/api/v1/oncall")
+	oncall.Use(utils.AuthSessionMidd)
+	oncall.GET("/team/:team_id", GetOncall)
+	oncall.GET("/team_name/:team_name", GetOncallByTeamName)
+	oncall.GET("/team/:team_id/schedule", GetOncallSchedule)
+	oncall.PUT("/team/:team_id/schedule", SetOncallSchedule)
+	oncall.DELETE("/team/:team_id/schedule", DeleteOncallSchedule)
+	oncall.GET("/team/:team_id/overrides", GetOncallOverrides)
+	oncall.POST("/team/:team_id/overrides", CreateOncallOverride)
+	oncall.DELETE("/team/:team_id/override/:id", DeleteOncallOverride)
 }
@@ -0,0 +1,54 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alarm
+
+import (
+	"time"
+)
+
+// +--------------+------------------+------+-----+-------------------+----------------+
+// | Field        | Type             | Null | Key | Default           | Extra          |
+// +--------------+------------------+------+-----+-------------------+----------------+
+// | id           | int(10) unsigned | NO   | PRI | NULL              | auto_increment |
+// | event_caseId | varchar(50)      | NO   | MUL | NULL              |                |
+// | action_id    | int(10) unsigned | NO   |     | 0                 |                |
+// | url          | varchar(255)     | NO   |     |                   |                |
+// | method       | varchar(10)      | NO   |     |                   |                |
+// | attempt      | int(10) unsigned | NO   |     | 0                 |                |
+// | status       | varchar(20)      | NO   |     |                   |                |
+// | resp_code    | int(11)          | NO   |     | 0                 |                |
+// | resp         | varchar(1024)    | NO   |     |                   |                |
+// | error        | varchar(1024)    | NO   |     |                   |                |
+// | timestamp    | timestamp        | NO   |     | CURRENT_TIMESTAMP |                |
+// +--------------+------------------+------+-----+-------------------+----------------+
+
+// status: success, fail, dead
+type CallbackDelivery struct {
+	ID          int64      `json:"id" gorm:"column:id"`
+	EventCaseId string     `json:"event_caseId" gorm:"column:event_caseId"`
+	ActionId    int64      `json:"action_id" gorm:"column:action_id"`
+	Url         string     `json:"url" gorm:"column:url"`
+	Method      string     `json:"method" gorm:"column:method"`
+	Attempt     int        `json:"attempt" gorm:"column:attempt"`
+	Status      string     `json:"status" gorm:"column:status"`
+	RespCode    int        `json:"resp_code" gorm:"column:resp_code"`
+	Resp        string     `json:"resp" gorm:"column:resp"`
+	Error       string     `json:"error" gorm:"column:error"`
+	Timestamp   *time.Time `json:"timestamp" gorm:"column:timestamp"`
+}
+
+func (this CallbackDelivery) TableName() string {
+	return "callback_delivery"
+}
@@ -0,0 +1,60 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alarm
+
+import (
+	"time"
+)
+
+// +--------------------+------------------+------+-----+---------+----------------+
+// | Field              | Type             | Null | Key | Default | Extra          |
+// +--------------------+------------------+------+-----+---------+----------------+
+// | id                 | int(10) unsigned | NO   | PRI | NULL    | auto_increment |
+// | name               | varchar(255)     | NO   |     |         |                |
+// | source_endpoint    | varchar(255)     | NO   |     |         |                |
+// | source_metric      | varchar(128)     | NO   |     |         |                |
+// | source_tags        | varchar(255)     | NO   |     |         |                |
+// | source_strategy_id | int(10) unsigned | NO   |     | 0       |                |
+// | target_endpoint    | varchar(255)     | NO   |     |         |                |
+// | target_metric      | varchar(128)     | NO   |     |         |                |
+// | target_tags        | varchar(255)     | NO   |     |         |                |
+// | equal              | varchar(255)     | NO   |     |         |                |
+// | note               | varchar(500)     | NO   |     |         |                |
+// | creator            | varchar(64)      | NO   |     |         |                |
+// | t_create           | datetime         | NO   |     | NULL    |                |
+// +--------------------+------------------+------+-----+---------+----------------+
+
+// source_endpoint and target_endpoint are regexps, *_tags are in k1=v1,k2=v2 format.
+// equal is a comma separated list of endpoint, hostgroup or tag keys which must
+// be the same between the source event and the target event.
+type InhibitRule struct {
+	ID               int64      `json:"id" gorm:"column:id"`
+	Name             string     `json:"name" gorm:"column:name"`
+	SourceEndpoint   string     `json:"source_endpoint" gorm:"column:source_endpoint"`
+	SourceMetric     string     `json:"source_metric" gorm:"column:source_metric"`
+	SourceTags       string     `json:"source_tags" gorm:"column:source_tags"`
+	SourceStrategyId int64      `json:"source_strategy_id" gorm:"column:source_strategy_id"`
+	TargetEndpoint   string     `json:"target_endpoint" gorm:"column:target_endpoint"`
+	TargetMetric     string     `json:"target_metric" gorm:"column:target_metric"`
+	TargetTags       string     `json:"target_tags" gorm:"column:target_tags"`
+	Equal            string     `json:"equal" gorm:"column:equal"`
+	Note             string     `json:"note" gorm:"column:note"`
+	Creator          string     `json:"creator" gorm:"column:creator"`
+	CreateAt         *time.Time `json:"create_at" gorm:"column:t_create"`
+}
+
+func (this InhibitRule) TableName() string {
+	return "inhibit_rule"
+}
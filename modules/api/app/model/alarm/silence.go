@@ -0,0 +1,80 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alarm
+
+import (
+	"time"
+)
+
+// +---------------+------------------+------+-----+---------+----------------+
+// | Field         | Type             | Null | Key | Default | Extra          |
+// +---------------+------------------+------+-----+---------+----------------+
+// | id            | int(10) unsigned | NO   | PRI | NULL    | auto_increment |
+// | endpoint      | varchar(255)     | NO   |     |         |                |
+// | metric        | varchar(128)     | NO   |     |         |                |
+// | tags          | varchar(255)     | NO   |     |         |                |
+// | strategy_id   | int(10) unsigned | NO   |     | 0       |                |
+// | expression_id | int(10) unsigned | NO   |     | 0       |                |
+// | hostgroup     | varchar(255)     | NO   |     |         |                |
+// | creator       | varchar(64)      | NO   |     |         |                |
+// | comment       | varchar(500)     | NO   |     |         |                |
+// | start_at      | datetime         | NO   |     | NULL    |                |
+// | end_at        | datetime         | NO   | MUL | NULL    |                |
+// | t_create      | datetime         | NO   |     | NULL    |                |
+// +---------------+------------------+------+-----+---------+----------------+
+
+type Silence struct {
+	ID           int64     `json:"id" gorm:"column:id"`
+	Endpoint     string    `json:"endpoint" gorm:"column:endpoint"`
+	Metric       string    `json:"metric" gorm:"column:metric"`
+	Tags         string    `json:"tags" gorm:"column:tags"`
+	StrategyId   int64     `json:"strategy_id" gorm:"column:strategy_id"`
+	ExpressionId int64     `json:"expression_id" gorm:"column:expression_id"`
+	Hostgroup    string    `json:"hostgroup" gorm:"column:hostgroup"`
+	Creator      string    `json:"creator" gorm:"column:creator"`
+	Comment      string    `json:"comment" gorm:"column:comment"`
+	StartAt      time.Time `json:"start_at" gorm:"column:start_at"`
+	EndAt        time.Time `json:"end_at" gorm:"column:end_at"`
+	CreateAt     time.Time `json:"create_at" gorm:"column:t_create"`
+}
+
+func (this Silence) TableName() string {
+	return "silence"
+}
+
+// +------------+------------------+------+-----+-------------------+----------------+
+// | Field      | Type             | Null | Key | Default           | Extra          |
+// +------------+------------------+------+-----+-------------------+----------------+
+// | id         | int(10) unsigned | NO   | PRI | NULL              | auto_increment |
+// | silence_id | int(10) unsigned | NO   | MUL | NULL              |                |
+// | action     | varchar(20)      | NO   |     | NULL              |                |
+// | user       | varchar(64)      | NO   |     |                   |                |
+// | content    | varchar(2048)    | NO   |     |                   |                |
+// | timestamp  | timestamp        | NO   |     | CURRENT_TIMESTAMP |                |
+// +------------+------------------+------+-----+-------------------+----------------+
+
+// action: create, update, expire, delete
+type SilenceLog struct {
+	ID        int64      `json:"id" gorm:"column:id"`
+	SilenceId int64      `json:"silence_id" gorm:"column:silence_id"`
+	Action    string     `json:"action" gorm:"column:action"`
+	User      string     `json:"user" gorm:"column:user"`
+	Content   string     `json:"content" gorm:"column:content"`
+	Timestamp *time.Time `json:"timestamp" gorm:"column:timestamp"`
+}
+
+func (this SilenceLog) TableName() string {
+	return "silence_log"
+}
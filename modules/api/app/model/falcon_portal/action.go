@@ -23,6 +23,7 @@ package falcon_portal
 // | before_callback_mail | tinyint(4)       | NO   |     | 0       |                |
 // | after_callback_sms   | tinyint(4)       | NO   |     | 0       |                |
 // | after_callback_mail  | tinyint(4)       | NO   |     | 0  		  |								 |
+// | channels             | varchar(255)     | NO   |     |         |                |
 ////////////////////////////////////////////////////////////////////////////////////
 type Action struct {
 	ID                 int64  `json:"id" gorm:"column:id"`
@@ -33,6 +34,7 @@ type Action struct {
 	BeforeCallbackMail int    `json:"before_callback_mail" orm:"column:before_callback_mail"`
 	AfterCallbackSMS   int    `json:"after_callback_sms" orm:"column:after_callback_sms"`
 	AfterCallbackMail  int    `json:"after_callback_mail" orm:"column:after_callback_mail"`
+	Channels           string `json:"channels" gorm:"column:channels"`
 }
 
 func (this Action) TableName() string {
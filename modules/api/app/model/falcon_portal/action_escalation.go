@@ -0,0 +1,37 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package falcon_portal
+
+// +---------------+------------------+------+-----+---------+----------------+
+// | Field         | Type             | Null | Key | Default | Extra          |
+// +---------------+------------------+------+-----+---------+----------------+
+// | id            | int(10) unsigned | NO   | PRI | NULL    | auto_increment |
+// | action_id     | int(10) unsigned | NO   | MUL | NULL    |                |
+// | step          | int(10) unsigned | NO   |     | NULL    |                |
+// | after_minutes | int(10) unsigned | NO   |     | NULL    |                |
+// | uic           | varchar(255)     | NO   |     |         |                |
+// +---------------+------------------+------+-----+---------+----------------+
+
+type ActionEscalation struct {
+	ID           int64  `json:"id" gorm:"column:id"`
+	ActionID     int64  `json:"action_id" gorm:"column:action_id"`
+	Step         int    `json:"step" gorm:"column:step"`
+	AfterMinutes int    `json:"after_minutes" gorm:"column:after_minutes"`
+	UIC          string `json:"uic" gorm:"column:uic"`
+}
+
+func (this ActionEscalation) TableName() string {
+	return "action_escalation"
+}
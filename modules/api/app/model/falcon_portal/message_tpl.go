@@ -0,0 +1,49 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package falcon_portal
+
+import (
+	"time"
+)
+
+// +--------------+------------------+------+-----+---------+----------------+
+// | Field        | Type             | Null | Key | Default | Extra          |
+// +--------------+------------------+------+-----+---------+----------------+
+// | id           | int(10) unsigned | NO   | PRI | NULL    | auto_increment |
+// | action_id    | int(10) unsigned | NO   | MUL | 0       |                |
+// | tpl_id       | int(10) unsigned | NO   | MUL | 0       |                |
+// | sms          | varchar(1024)    | NO   |     |         |                |
+// | im           | varchar(1024)    | NO   |     |         |                |
+// | mail_subject | varchar(1024)    | NO   |     |         |                |
+// | mail         | text             | NO   |     | NULL    |                |
+// | creator      | varchar(64)      | NO   |     |         |                |
+// | t_create     | datetime         | NO   |     | NULL    |                |
+// +--------------+------------------+------+-----+---------+----------------+
+
+type MessageTpl struct {
+	ID          int64      `json:"id" gorm:"column:id"`
+	ActionID    int64      `json:"action_id" gorm:"column:action_id"`
+	TplID       int64      `json:"tpl_id" gorm:"column:tpl_id"`
+	Sms         string     `json:"sms" gorm:"column:sms"`
+	IM          string     `json:"im" gorm:"column:im"`
+	MailSubject string     `json:"mail_subject" gorm:"column:mail_subject"`
+	Mail        string     `json:"mail" gorm:"column:mail"`
+	Creator     string     `json:"creator" gorm:"column:creator"`
+	CreateAt    *time.Time `json:"create_at" gorm:"column:t_create"`
+}
+
+func (this MessageTpl) TableName() string {
+	return "message_tpl"
+}
@@ -0,0 +1,146 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package uic
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// rotation: daily, weekly
+// 从start_date的handoff时刻(timezone时区)开始, users按顺序轮流值班, 每人一天或者一周
+type OncallSchedule struct {
+	ID        int64  `json:"id" gorm:"column:id"`
+	TeamID    int64  `json:"team_id" gorm:"column:team_id"`
+	Rotation  string `json:"rotation" gorm:"column:rotation"`
+	Handoff   string `json:"handoff" gorm:"column:handoff"`
+	Timezone  string `json:"timezone" gorm:"column:timezone"`
+	StartDate string `json:"start_date" gorm:"column:start_date"`
+	Users     string `json:"users" gorm:"column:users"`
+	Creator   int64  `json:"creator" gorm:"column:creator"`
+}
+
+func (this OncallSchedule) TableName() string {
+	return "oncall_schedule"
+}
+
+// 临时替班, 覆盖[start_at, end_at)内的轮值, 时间为unix秒
+type OncallOverride struct {
+	ID         int64 `json:"id" gorm:"column:id"`
+	ScheduleID int64 `json:"schedule_id" gorm:"column:schedule_id"`
+	UserID     int64 `json:"user_id" gorm:"column:user_id"`
+	StartAt    int64 `json:"start_at" gorm:"column:start_at"`
+	EndAt      int64 `json:"end_at" gorm:"column:end_at"`
+	Creator    int64 `json:"creator" gorm:"column:creator"`
+}
+
+func (this OncallOverride) TableName() string {
+	return "oncall_override"
+}
+
+func (this OncallSchedule) Validate() error {
+	if this.Rotation != "daily" && this.Rotation != "weekly" {
+		return errors.New("rotation only accept daily or weekly")
+	}
+	if _, _, err := this.handoff(); err != nil {
+		return err
+	}
+	loc, err := time.LoadLocation(this.Timezone)
+	if err != nil {
+		return fmt.Errorf("timezone %s is not vaild", this.Timezone)
+	}
+	if _, err := time.ParseInLocation("2006-01-02", this.StartDate, loc); err != nil {
+		return fmt.Errorf("start_date %s is not vaild, please refer ex. 2017-01-02", this.StartDate)
+	}
+	uids, err := this.UserIDs()
+	if err != nil {
+		return err
+	}
+	if len(uids) == 0 {
+		return errors.New("users is empty")
+	}
+	return nil
+}
+
+func (this OncallSchedule) UserIDs() ([]int64, error) {
+	uids := []int64{}
+	for _, s := range strings.Split(this.Users, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		uid, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("user id %s is not vaild", s)
+		}
+		uids = append(uids, uid)
+	}
+	return uids, nil
+}
+
+func (this OncallSchedule) handoff() (hour int, minute int, err error) {
+	t, err := time.Parse("15:04", this.Handoff)
+	if err != nil {
+		err = fmt.Errorf("handoff %s is not vaild, please refer ex. 09:00", this.Handoff)
+		return
+	}
+	return t.Hour(), t.Minute(), nil
+}
+
+// t时刻轮值的用户, 不考虑替班; 在start_date之前由第一个人值班
+func (this OncallSchedule) RotationAt(t time.Time) (int64, error) {
+	if err := this.Validate(); err != nil {
+		return 0, err
+	}
+	uids, _ := this.UserIDs()
+	loc, _ := time.LoadLocation(this.Timezone)
+	start, _ := time.ParseInLocation("2006-01-02", this.StartDate, loc)
+	hour, minute, _ := this.handoff()
+
+	// 交接之前算前一天的班, 按日历天数计算以避免夏令时的影响
+	lt := t.In(loc)
+	day := time.Date(lt.Year(), lt.Month(), lt.Day(), 0, 0, 0, 0, time.UTC)
+	if lt.Hour()*60+lt.Minute() < hour*60+minute {
+		day = day.AddDate(0, 0, -1)
+	}
+	days := int(day.Sub(time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)).Hours() / 24)
+	if days < 0 {
+		return uids[0], nil
+	}
+
+	period := 1
+	if this.Rotation == "weekly" {
+		period = 7
+	}
+	return uids[(days/period)%len(uids)], nil
+}
+
+// t时刻值班的用户, 替班优先, 多个替班重叠时后创建的优先
+func (this OncallSchedule) OncallAt(t time.Time, overrides []OncallOverride) (uid int64, overridden bool, err error) {
+	var latest *OncallOverride
+	for i, o := range overrides {
+		if t.Unix() >= o.StartAt && t.Unix() < o.EndAt && (latest == nil || o.ID > latest.ID) {
+			latest = &overrides[i]
+		}
+	}
+	if latest != nil {
+		return latest.UserID, true, nil
+	}
+	uid, err = this.RotationAt(t)
+	return
+}
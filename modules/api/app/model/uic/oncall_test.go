@@ -0,0 +1,84 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package uic
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOncallAt(t *testing.T) {
+	daily := OncallSchedule{Rotation: "daily", Handoff: "09:00", Timezone: "Asia/Shanghai", StartDate: "2017-01-02", Users: "1,2,3"}
+	weekly := OncallSchedule{Rotation: "weekly", Handoff: "10:30", Timezone: "America/New_York", StartDate: "2017-03-06", Users: "4,5"}
+	overrides := []OncallOverride{
+		{ID: 1, UserID: 7, StartAt: time.Date(2017, 1, 3, 0, 0, 0, 0, time.UTC).Unix(), EndAt: time.Date(2017, 1, 4, 0, 0, 0, 0, time.UTC).Unix()},
+		{ID: 2, UserID: 8, StartAt: time.Date(2017, 1, 3, 12, 0, 0, 0, time.UTC).Unix(), EndAt: time.Date(2017, 1, 3, 13, 0, 0, 0, time.UTC).Unix()},
+	}
+
+	tests := []struct {
+		schedule   OncallSchedule
+		at         time.Time
+		expected   int64
+		overridden bool
+	}{
+		// 2017-01-02 09:00 +08:00 = 01:00 UTC
+		{daily, time.Date(2017, 1, 2, 1, 0, 0, 0, time.UTC), 1, false},
+		{daily, time.Date(2017, 1, 2, 0, 59, 0, 0, time.UTC), 1, false},
+		{daily, time.Date(2017, 1, 4, 2, 0, 0, 0, time.UTC), 3, false},
+		{daily, time.Date(2017, 1, 5, 0, 30, 0, 0, time.UTC), 3, false},
+		{daily, time.Date(2017, 1, 5, 1, 30, 0, 0, time.UTC), 1, false},
+		{daily, time.Date(2016, 12, 1, 0, 0, 0, 0, time.UTC), 1, false},
+		{daily, time.Date(2017, 1, 3, 6, 0, 0, 0, time.UTC), 7, true},
+		{daily, time.Date(2017, 1, 3, 12, 30, 0, 0, time.UTC), 8, true},
+		// 夏令时从2017-03-12开始, 交接时刻仍然是当地时间10:30
+		{weekly, time.Date(2017, 3, 13, 14, 29, 0, 0, time.UTC), 4, false},
+		{weekly, time.Date(2017, 3, 13, 14, 30, 0, 0, time.UTC), 5, false},
+		{weekly, time.Date(2017, 3, 27, 15, 0, 0, 0, time.UTC), 5, false},
+	}
+	for _, tt := range tests {
+		var os []OncallOverride
+		if tt.schedule.Rotation == "daily" {
+			os = overrides
+		}
+		uid, overridden, err := tt.schedule.OncallAt(tt.at, os)
+		if err != nil {
+			t.Errorf("OncallAt(%v) error: %v", tt.at, err)
+			continue
+		}
+		if uid != tt.expected || overridden != tt.overridden {
+			t.Errorf("%s OncallAt(%v) = %d, %v, expected %d, %v", tt.schedule.Rotation, tt.at, uid, overridden, tt.expected, tt.overridden)
+		}
+	}
+}
+
+func TestOncallScheduleValidate(t *testing.T) {
+	tests := []struct {
+		schedule OncallSchedule
+		ok       bool
+	}{
+		{OncallSchedule{Rotation: "daily", Handoff: "09:00", Timezone: "UTC", StartDate: "2017-01-02", Users: "1"}, true},
+		{OncallSchedule{Rotation: "monthly", Handoff: "09:00", Timezone: "UTC", StartDate: "2017-01-02", Users: "1"}, false},
+		{OncallSchedule{Rotation: "daily", Handoff: "9am", Timezone: "UTC", StartDate: "2017-01-02", Users: "1"}, false},
+		{OncallSchedule{Rotation: "daily", Handoff: "09:00", Timezone: "Mars/Base", StartDate: "2017-01-02", Users: "1"}, false},
+		{OncallSchedule{Rotation: "daily", Handoff: "09:00", Timezone: "UTC", StartDate: "2017/01/02", Users: "1"}, false},
+		{OncallSchedule{Rotation: "daily", Handoff: "09:00", Timezone: "UTC", StartDate: "2017-01-02", Users: ""}, false},
+		{OncallSchedule{Rotation: "daily", Handoff: "09:00", Timezone: "UTC", StartDate: "2017-01-02", Users: "1,a"}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.schedule.Validate(); (err == nil) != tt.ok {
+			t.Errorf("Validate(%+v) error: %v, expected ok:%v", tt.schedule, err, tt.ok)
+		}
+	}
+}
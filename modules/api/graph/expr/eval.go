@@ -0,0 +1,412 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expr
+
+import (
+	"fmt"
+	"math"
+	"sync"
+
+	cmodel "github.com/open-falcon/falcon-plus/common/model"
+)
+
+// Ref 索引中的一个counter
+type Ref struct {
+	Endpoint     string
+	Counter      string
+	Metric       string
+	Tags         map[string]string
+	EndpointTags map[string]string
+	Step         int
+	// rrd的类型: GAUGE|COUNTER|DERIVE, COUNTER和DERIVE存的已经是每秒的速率
+	DsType string
+}
+
+// Matches 判断counter是否满足selector的所有条件
+func (sel *SelectorNode) Matches(r *Ref) bool {
+	if sel.Metric != "" && r.Metric != sel.Metric {
+		return false
+	}
+	for _, m := range sel.Matchers {
+		if !m.Matches(label(m.Name, r.Endpoint, r.Metric, r.Tags, r.EndpointTags)) {
+			return false
+		}
+	}
+	return true
+}
+
+// Source 提供series的查找和原始数据的查询
+type Source interface {
+	// Find 返回selector匹配的所有counter, limit大于0时超过limit条可以直接返回错误
+	Find(sel *SelectorNode, limit int) ([]*Ref, error)
+	// Fetch 查询原始数据, step大于counter的周期时可以返回降采样到step的数据
+	Fetch(ref *Ref, cf string, start, end int64, step int) ([]*cmodel.RRDData, error)
+}
+
+type Query struct {
+	Expr      string
+	Start     int64
+	End       int64
+	Step      int64
+	ConsolFun string
+	// 追加到每个selector的过滤条件
+	Matchers []*Matcher
+}
+
+type Result struct {
+	Grid   Grid
+	Series []*Series
+	// 查询失败的counter数
+	Failed int
+}
+
+type Engine struct {
+	Source      Source
+	MaxSeries   int
+	Concurrency int
+}
+
+// Exec 解析并计算表达式: 先查找所有selector匹配的counter, 并发查询原始数据,
+// 再按请求的step和数据实际的间隔中最大的一个对齐, 最后在对齐的数据上计算
+func (e *Engine) Exec(q *Query) (*Result, error) {
+	root, err := Parse(q.Expr)
+	if err != nil {
+		return nil, err
+	}
+	return e.Eval(root, q)
+}
+
+// Eval 计算已经解析好的语法树, 忽略q.Expr; 其他查询语言可以翻译成语法树之后用它计算
+func (e *Engine) Eval(root Node, q *Query) (*Result, error) {
+	if q.End <= q.Start {
+		return nil, fmt.Errorf("end must be greater than start")
+	}
+	cf := q.ConsolFun
+	if cf == "" {
+		cf = "AVERAGE"
+	}
+
+	selectors := []*SelectorNode{}
+	if err := collectSelectors(root, &selectors); err != nil {
+		return nil, err
+	}
+	for _, sel := range selectors {
+		sel.Matchers = append(sel.Matchers, q.Matchers...)
+	}
+	refs := make([][]*Ref, len(selectors))
+	total := 0
+	for i, sel := range selectors {
+		var err error
+		if refs[i], err = e.Source.Find(sel, e.MaxSeries); err != nil {
+			return nil, err
+		}
+		total += len(refs[i])
+		if e.MaxSeries > 0 && total > e.MaxSeries {
+			return nil, fmt.Errorf("too many series, limit is %d", e.MaxSeries)
+		}
+	}
+
+	points, failed, err := e.fetch(refs, cf, q.Start, q.End, int(q.Step))
+	if err != nil {
+		return nil, err
+	}
+
+	step := q.Step
+	for i := range refs {
+		for j, ref := range refs[i] {
+			if s := int64(ref.Step); s > step {
+				step = s
+			}
+			if s := resolution(points[i][j]); s > step {
+				step = s
+			}
+		}
+	}
+	if step <= 0 {
+		step = 60
+	}
+	ev := &evaluator{grid: newGrid(q.Start, q.End, step), data: map[*SelectorNode][]*Series{}}
+	for i, sel := range selectors {
+		ss := make([]*Series, 0, len(refs[i]))
+		for j, ref := range refs[i] {
+			ss = append(ss, &Series{
+				Name:         ref.Endpoint + "/" + ref.Counter,
+				Endpoint:     ref.Endpoint,
+				Metric:       ref.Metric,
+				Tags:         ref.Tags,
+				EndpointTags: ref.EndpointTags,
+				DsType:       ref.DsType,
+				Values:       ev.grid.align(points[i][j]),
+			})
+		}
+		ev.data[sel] = ss
+	}
+
+	v, err := ev.eval(root)
+	if err != nil {
+		return nil, err
+	}
+	result := &Result{Grid: ev.grid, Failed: failed}
+	switch v := v.(type) {
+	case float64:
+		s := &Series{Name: root.String(), Values: make([]float64, ev.grid.Count)}
+		for i := range s.Values {
+			s.Values[i] = v
+		}
+		result.Series = []*Series{s}
+	case []*Series:
+		result.Series = v
+	}
+	return result, nil
+}
+
+type fetchTask struct {
+	i, j int
+}
+
+// fetch 并发查询所有counter, 单个counter失败时只计数, 全部失败时返回第一个错误
+func (e *Engine) fetch(refs [][]*Ref, cf string, start, end int64, step int) ([][][]*cmodel.RRDData, int, error) {
+	points := make([][][]*cmodel.RRDData, len(refs))
+	tasks := []fetchTask{}
+	for i := range refs {
+		points[i] = make([][]*cmodel.RRDData, len(refs[i]))
+		for j := range refs[i] {
+			tasks = append(tasks, fetchTask{i, j})
+		}
+	}
+
+	failed, err := Parallel(len(tasks), e.Concurrency, func(k int) error {
+		t := tasks[k]
+		data, err := e.Source.Fetch(refs[t.i][t.j], cf, start, end, step)
+		if err != nil {
+			return err
+		}
+		points[t.i][t.j] = data
+		return nil
+	})
+	if len(tasks) > 0 && failed == len(tasks) {
+		return nil, failed, err
+	}
+	return points, failed, nil
+}
+
+// Parallel 最多concurrency个goroutine并发执行fn(0)...fn(n-1), 返回失败的个数和第一个错误
+func Parallel(n, concurrency int, fn func(i int) error) (int, error) {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	if n < concurrency {
+		concurrency = n
+	}
+
+	var (
+		wg       sync.WaitGroup
+		lock     sync.Mutex
+		failed   int
+		firstErr error
+	)
+	tasks := make(chan int)
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range tasks {
+				if err := fn(i); err != nil {
+					lock.Lock()
+					failed++
+					if firstErr == nil {
+						firstErr = err
+					}
+					lock.Unlock()
+				}
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		tasks <- i
+	}
+	close(tasks)
+	wg.Wait()
+	return failed, firstErr
+}
+
+func collectSelectors(n Node, out *[]*SelectorNode) error {
+	switch n := n.(type) {
+	case *SelectorNode:
+		if n.Metric == "" {
+			hasMetric := false
+			for _, m := range n.Matchers {
+				if m.Name == "metric" {
+					hasMetric = true
+				}
+			}
+			if !hasMetric {
+				return fmt.Errorf("selector %s needs a metric", n)
+			}
+		}
+		*out = append(*out, n)
+	case *CallNode:
+		if _, ok := functions[n.Func]; !ok {
+			return fmt.Errorf("unknown function %s", n.Func)
+		}
+		for _, a := range n.Args {
+			if err := collectSelectors(a, out); err != nil {
+				return err
+			}
+		}
+	case *BinaryNode:
+		if err := collectSelectors(n.LHS, out); err != nil {
+			return err
+		}
+		return collectSelectors(n.RHS, out)
+	}
+	return nil
+}
+
+type evaluator struct {
+	grid Grid
+	data map[*SelectorNode][]*Series
+}
+
+// eval 返回float64或者[]*Series
+func (ev *evaluator) eval(n Node) (interface{}, error) {
+	switch n := n.(type) {
+	case *NumberNode:
+		return n.Val, nil
+	case *StringNode:
+		return nil, fmt.Errorf("unexpected string %s", n)
+	case *SelectorNode:
+		return ev.data[n], nil
+	case *CallNode:
+		return functions[n.Func](ev, n.Args)
+	case *BinaryNode:
+		lhs, err := ev.eval(n.LHS)
+		if err != nil {
+			return nil, err
+		}
+		rhs, err := ev.eval(n.RHS)
+		if err != nil {
+			return nil, err
+		}
+		return ev.binary(n.Op, lhs, rhs), nil
+	}
+	return nil, fmt.Errorf("unknown node %T", n)
+}
+
+func (ev *evaluator) seriesArg(n Node) ([]*Series, error) {
+	v, err := ev.eval(n)
+	if err != nil {
+		return nil, err
+	}
+	ss, ok := v.([]*Series)
+	if !ok {
+		return nil, fmt.Errorf("expected series but got %s", n)
+	}
+	return ss, nil
+}
+
+func (ev *evaluator) numberArg(n Node) (float64, error) {
+	v, err := ev.eval(n)
+	if err != nil {
+		return 0, err
+	}
+	f, ok := v.(float64)
+	if !ok {
+		return 0, fmt.Errorf("expected number but got %s", n)
+	}
+	return f, nil
+}
+
+// stringArg 字符串参数也可以不加引号, 这时按metric解析成了selector
+func (ev *evaluator) stringArg(n Node) (string, error) {
+	switch n := n.(type) {
+	case *StringNode:
+		return n.Val, nil
+	case *SelectorNode:
+		if n.Metric != "" {
+			return n.Metric, nil
+		}
+	}
+	return "", fmt.Errorf("expected string but got %s", n)
+}
+
+// binary 两组series运算时, 一边只有一条series则和另一边的每条运算, 否则按endpoint和tag配对
+func (ev *evaluator) binary(op string, lhs, rhs interface{}) interface{} {
+	switch l := lhs.(type) {
+	case float64:
+		switch r := rhs.(type) {
+		case float64:
+			return binaryOp(op, l, r)
+		case []*Series:
+			result := make([]*Series, len(r))
+			for i, s := range r {
+				result[i] = ev.apply(op, nil, s, l, formatNumber(l)+" "+op+" "+s.Name, s)
+			}
+			return result
+		}
+	case []*Series:
+		switch r := rhs.(type) {
+		case float64:
+			result := make([]*Series, len(l))
+			for i, s := range l {
+				result[i] = ev.apply(op, s, nil, r, s.Name+" "+op+" "+formatNumber(r), s)
+			}
+			return result
+		case []*Series:
+			result := []*Series{}
+			switch {
+			case len(r) == 1:
+				for _, s := range l {
+					result = append(result, ev.apply(op, s, r[0], 0, s.Name+" "+op+" "+r[0].Name, s))
+				}
+			case len(l) == 1:
+				for _, s := range r {
+					result = append(result, ev.apply(op, l[0], s, 0, l[0].Name+" "+op+" "+s.Name, s))
+				}
+			default:
+				byKey := map[string]*Series{}
+				for _, s := range r {
+					byKey[s.key()] = s
+				}
+				for _, s := range l {
+					if m, ok := byKey[s.key()]; ok {
+						result = append(result, ev.apply(op, s, m, 0, s.Name+" "+op+" "+m.Name, s))
+					}
+				}
+			}
+			return result
+		}
+	}
+	return math.NaN()
+}
+
+// apply 计算一对series, 或者series和常数(对应的series为nil)
+func (ev *evaluator) apply(op string, l, r *Series, scalar float64, name string, meta *Series) *Series {
+	out := meta.copyMeta(name, ev.grid.Count)
+	for i := range out.Values {
+		a, b := scalar, scalar
+		if l != nil {
+			a = l.Values[i]
+		}
+		if r != nil {
+			b = r.Values[i]
+		}
+		out.Values[i] = binaryOp(op, a, b)
+	}
+	if l != nil && r != nil && l.Metric != r.Metric {
+		out.Metric = ""
+	}
+	return out
+}
@@ -0,0 +1,219 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expr
+
+import (
+	"fmt"
+	"math"
+	"sync/atomic"
+	"testing"
+
+	cmodel "github.com/open-falcon/falcon-plus/common/model"
+)
+
+type fakeSource struct {
+	refs []*Ref
+	data map[string][]*cmodel.RRDData
+}
+
+func (f *fakeSource) Find(sel *SelectorNode, limit int) ([]*Ref, error) {
+	result := []*Ref{}
+	for _, r := range f.refs {
+		if sel.Matches(r) {
+			result = append(result, r)
+		}
+	}
+	return result, nil
+}
+
+func (f *fakeSource) Fetch(ref *Ref, cf string, start, end int64, step int) ([]*cmodel.RRDData, error) {
+	data, ok := f.data[ref.Endpoint+"/"+ref.Counter]
+	if !ok {
+		return nil, fmt.Errorf("no data")
+	}
+	return data, nil
+}
+
+func points(start, step int64, vs ...float64) []*cmodel.RRDData {
+	result := make([]*cmodel.RRDData, len(vs))
+	for i, v := range vs {
+		result[i] = cmodel.NewRRDData(start+int64(i)*step, v)
+	}
+	return result
+}
+
+func newFakeSource() *fakeSource {
+	web := map[string]string{"service": "web"}
+	db := map[string]string{"service": "db"}
+	f := &fakeSource{
+		refs: []*Ref{
+			{Endpoint: "web1", Metric: "net.if.in.bytes", Tags: map[string]string{"iface": "eth0"}, EndpointTags: web, Step: 60},
+			{Endpoint: "web2", Metric: "net.if.in.bytes", Tags: map[string]string{"iface": "eth0"}, EndpointTags: web, Step: 60},
+			{Endpoint: "db1", Metric: "net.if.in.bytes", Tags: map[string]string{"iface": "eth0"}, EndpointTags: db, Step: 60},
+			{Endpoint: "web1", Metric: "cpu.busy", EndpointTags: web, Step: 60},
+			{Endpoint: "web2", Metric: "cpu.busy", EndpointTags: web, Step: 60},
+			{Endpoint: "web1", Metric: "req.total", Step: 60},
+			{Endpoint: "web1", Metric: "disk.used", Step: 300},
+			{Endpoint: "web1", Metric: "net.if.out.bytes", Step: 60, DsType: "COUNTER"},
+			{Endpoint: "web1", Metric: "disk.io.read", Step: 60, DsType: "DERIVE"},
+		},
+		data: map[string][]*cmodel.RRDData{
+			"web1/net.if.in.bytes/iface=eth0": points(60, 60, 80, 160, 240, 320),
+			"web2/net.if.in.bytes/iface=eth0": points(60, 60, 8, 16, math.NaN(), 32),
+			"db1/net.if.in.bytes/iface=eth0":  points(60, 60, 800, 800, 800, 800),
+			"web1/cpu.busy":                   points(60, 60, 10, 20, 30, 40),
+			"web2/cpu.busy":                   points(60, 60, 50, 60, 70, 80),
+			"web1/req.total":                  points(60, 60, 600, 1200, 60, 660),
+			"web1/disk.used":                  points(300, 300, 1, 2),
+			"web1/net.if.out.bytes":           points(60, 60, 5, 7, math.NaN(), 3),
+			"web1/disk.io.read":               points(60, 60, 1, 2, 3, 4),
+		},
+	}
+	for _, r := range f.refs {
+		r.Counter = counterString(r.Metric, r.Tags)
+	}
+	return f
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"sumSeries(tag.service=web, net.if.in.bytes) / 8", `sumSeries(series(tag.service="web", net.if.in.bytes)) / 8`},
+		{"topk(5, rate(series(endpoint=~\"web-.*\", metric=cpu.busy)))", `topk(5, rate(series(endpoint=~"web-.*", metric="cpu.busy")))`},
+		{"-a + b * 2 - 3", `-1 * a + b * 2 - 3`},
+		{"(a + b) * 2", `a + b * 2`},
+		{"groupBy(tag.service!='x', cpu.busy, service, \"max\")", `groupBy(series(tag.service!="x", cpu.busy), series(tag.service!="x", service), "max")`},
+		{"movingAverage(10.0.0.1, '5m')", `movingAverage(10.0.0.1, "5m")`},
+	}
+	for _, tt := range tests {
+		n, err := Parse(tt.expr)
+		if err != nil {
+			t.Errorf("Parse(%q) error: %v", tt.expr, err)
+			continue
+		}
+		if n.String() != tt.want {
+			t.Errorf("Parse(%q) = %s, want %s", tt.expr, n, tt.want)
+		}
+	}
+
+	bad := []string{"", "a +", "sumSeries(a", "endpoint=web1", "sumSeries(foo=bar, a)", "a !", "'abc", "f(a=~\"(\", b)"}
+	for _, expr := range bad {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("Parse(%q) should fail", expr)
+		}
+	}
+}
+
+func TestExec(t *testing.T) {
+	nan := math.NaN()
+	tests := []struct {
+		expr  string
+		step  int64
+		names []string
+		want  [][]float64
+	}{
+		{"sumSeries(tag.service=web, net.if.in.bytes) / 8", 0,
+			[]string{`sumSeries(series(tag.service="web", net.if.in.bytes)) / 8`},
+			[][]float64{{11, 22, 30, 44}}},
+		{"topk(1, cpu.busy)", 0, []string{"web2/cpu.busy"}, [][]float64{{50, 60, 70, 80}}},
+		{"bottomk(1, cpu.busy, last)", 0, []string{"web1/cpu.busy"}, [][]float64{{10, 20, 30, 40}}},
+		{"groupBy(net.if.in.bytes, service, max)", 0,
+			[]string{"service=web", "service=db"},
+			[][]float64{{80, 160, 240, 320}, {800, 800, 800, 800}}},
+		{"groupBy(net.if.in.bytes, 'service,iface', max)", 0,
+			[]string{"service=web,iface=eth0", "service=db,iface=eth0"},
+			[][]float64{{80, 160, 240, 320}, {800, 800, 800, 800}}},
+		{"rate(req.total)", 0, []string{"rate(web1/req.total)"}, [][]float64{{nan, 10, nan, 10}}},
+		// COUNTER、DERIVE存的已经是速率
+		{"rate(net.if.out.bytes)", 0, []string{"rate(web1/net.if.out.bytes)"}, [][]float64{{5, 7, nan, 3}}},
+		{"rate(disk.io.read)", 0, []string{"rate(web1/disk.io.read)"}, [][]float64{{1, 2, 3, 4}}},
+		{"movingAverage(cpu.busy, 2)", 0,
+			[]string{"movingAverage(web1/cpu.busy, 2)", "movingAverage(web2/cpu.busy, 2)"},
+			[][]float64{{10, 15, 25, 35}, {50, 55, 65, 75}}},
+		{"groupBy(cpu.busy, endpoint) / groupBy(net.if.in.bytes, endpoint) * 100", 0,
+			[]string{"endpoint=web1 / endpoint=web1 * 100", "endpoint=web2 / endpoint=web2 * 100"},
+			[][]float64{{12.5, 12.5, 12.5, 12.5}, {625, 375, nan, 250}}},
+		{"alias(cpu.busy - 10, 'busy')", 0, []string{"busy", "busy"}, [][]float64{{0, 10, 20, 30}, {40, 50, 60, 70}}},
+		{"sumSeries(cpu.busy)", 120, []string{"sumSeries(cpu.busy)"}, [][]float64{{70, 110}}},
+		{"disk.used + 1", 0, []string{"web1/disk.used + 1"}, [][]float64{{2}}},
+		{"1 + 2", 0, []string{"1 + 2"}, [][]float64{{3, 3, 3, 3}}},
+		{"sumSeries(no.such.metric)", 0, []string{}, [][]float64{}},
+	}
+	e := &Engine{Source: newFakeSource(), MaxSeries: 10, Concurrency: 2}
+	for _, tt := range tests {
+		r, err := e.Exec(&Query{Expr: tt.expr, Start: 60, End: 240, Step: tt.step})
+		if err != nil {
+			t.Errorf("Exec(%q) error: %v", tt.expr, err)
+			continue
+		}
+		if len(r.Series) != len(tt.want) {
+			t.Errorf("Exec(%q) got %d series, want %d", tt.expr, len(r.Series), len(tt.want))
+			continue
+		}
+		for i, s := range r.Series {
+			if s.Name != tt.names[i] {
+				t.Errorf("Exec(%q) series %d name %q, want %q", tt.expr, i, s.Name, tt.names[i])
+			}
+			if !sameValues(s.Values, tt.want[i]) {
+				t.Errorf("Exec(%q) series %d = %v, want %v", tt.expr, i, s.Values, tt.want[i])
+			}
+		}
+	}
+
+	errs := []string{"series(tag.service=web)", "unknown(cpu.busy)", "topk(cpu.busy, 1)", "groupBy(cpu.busy, service, median)", "sumSeries(net.if.in.bytes, cpu.busy, req.total, disk.used, cpu.busy, cpu.busy, cpu.busy)"}
+	for _, expr := range errs {
+		if _, err := e.Exec(&Query{Expr: expr, Start: 60, End: 240}); err == nil {
+			t.Errorf("Exec(%q) should fail", expr)
+		}
+	}
+}
+
+func TestParallel(t *testing.T) {
+	for _, concurrency := range []int{0, 1, 3, 100} {
+		done := make([]int32, 10)
+		failed, err := Parallel(len(done), concurrency, func(i int) error {
+			atomic.AddInt32(&done[i], 1)
+			if i%4 == 1 {
+				return fmt.Errorf("fail %d", i)
+			}
+			return nil
+		})
+		if failed != 3 || err == nil {
+			t.Errorf("concurrency %d: failed %d, error %v", concurrency, failed, err)
+		}
+		for i, n := range done {
+			if n != 1 {
+				t.Errorf("concurrency %d: task %d run %d times", concurrency, i, n)
+			}
+		}
+	}
+	if failed, err := Parallel(0, 2, nil); failed != 0 || err != nil {
+		t.Errorf("no task: failed %d, error %v", failed, err)
+	}
+}
+
+func sameValues(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if math.IsNaN(a[i]) != math.IsNaN(b[i]) || !math.IsNaN(a[i]) && math.Abs(a[i]-b[i]) > 1e-9 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,443 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expr
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type function func(ev *evaluator, args []Node) ([]*Series, error)
+
+// functions 在init中注册, 避免和evaluator之间的初始化循环
+var functions map[string]function
+
+func init() {
+	functions = map[string]function{
+		"series":        seriesFunc,
+		"sumSeries":     aggregateFunc("sumSeries", "sum"),
+		"averageSeries": aggregateFunc("averageSeries", "avg"),
+		"avgSeries":     aggregateFunc("avgSeries", "avg"),
+		"maxSeries":     aggregateFunc("maxSeries", "max"),
+		"minSeries":     aggregateFunc("minSeries", "min"),
+		"countSeries":   aggregateFunc("countSeries", "count"),
+		"groupBy":       groupByFunc,
+		"topk":          topkFunc(false),
+		"bottomk":       topkFunc(true),
+		"rate":          rateFunc,
+		"movingAverage": movingAverageFunc,
+		"alias":         aliasFunc,
+	}
+}
+
+// reducers 忽略NaN, 全部是NaN时返回NaN
+var reducers = map[string]func([]float64) float64{
+	"sum": func(vs []float64) float64 {
+		r, n := 0.0, 0
+		for _, v := range vs {
+			if !math.IsNaN(v) {
+				r += v
+				n++
+			}
+		}
+		if n == 0 {
+			return math.NaN()
+		}
+		return r
+	},
+	"avg": func(vs []float64) float64 {
+		r, n := 0.0, 0
+		for _, v := range vs {
+			if !math.IsNaN(v) {
+				r += v
+				n++
+			}
+		}
+		if n == 0 {
+			return math.NaN()
+		}
+		return r / float64(n)
+	},
+	"max": func(vs []float64) float64 {
+		r := math.NaN()
+		for _, v := range vs {
+			if !math.IsNaN(v) && (math.IsNaN(r) || v > r) {
+				r = v
+			}
+		}
+		return r
+	},
+	"min": func(vs []float64) float64 {
+		r := math.NaN()
+		for _, v := range vs {
+			if !math.IsNaN(v) && (math.IsNaN(r) || v < r) {
+				r = v
+			}
+		}
+		return r
+	},
+	"count": func(vs []float64) float64 {
+		n := 0
+		for _, v := range vs {
+			if !math.IsNaN(v) {
+				n++
+			}
+		}
+		return float64(n)
+	},
+	"last": func(vs []float64) float64 {
+		for i := len(vs) - 1; i >= 0; i-- {
+			if !math.IsNaN(vs[i]) {
+				return vs[i]
+			}
+		}
+		return math.NaN()
+	},
+}
+
+func reducer(name string) (func([]float64) float64, error) {
+	r, ok := reducers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown aggregation %q", name)
+	}
+	return r, nil
+}
+
+func checkArgs(name string, args []Node, min, max int) error {
+	if len(args) < min || len(args) > max {
+		if min == max {
+			return fmt.Errorf("%s expects %d arguments, got %d", name, min, len(args))
+		}
+		return fmt.Errorf("%s expects %d to %d arguments, got %d", name, min, max, len(args))
+	}
+	return nil
+}
+
+func seriesFunc(ev *evaluator, args []Node) ([]*Series, error) {
+	result := []*Series{}
+	for _, a := range args {
+		ss, err := ev.seriesArg(a)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, ss...)
+	}
+	return result, nil
+}
+
+// aggregate 把多条series合并成一条, 保留所有series共同的endpoint、metric和tag
+func aggregate(name string, ss []*Series, reduce func([]float64) float64, n int) *Series {
+	out := ss[0].copyMeta(name, n)
+	out.Tags = map[string]string{}
+	for k, v := range ss[0].Tags {
+		out.Tags[k] = v
+	}
+	out.EndpointTags = nil
+	for _, s := range ss[1:] {
+		if s.Endpoint != out.Endpoint {
+			out.Endpoint = ""
+		}
+		if s.Metric != out.Metric {
+			out.Metric = ""
+		}
+		for k, v := range out.Tags {
+			if s.Tags[k] != v {
+				delete(out.Tags, k)
+			}
+		}
+	}
+	buf := make([]float64, len(ss))
+	for i := 0; i < n; i++ {
+		for j, s := range ss {
+			buf[j] = s.Values[i]
+		}
+		out.Values[i] = reduce(buf)
+	}
+	return out
+}
+
+func aggregateFunc(name, agg string) function {
+	return func(ev *evaluator, args []Node) ([]*Series, error) {
+		ss, err := seriesFunc(ev, args)
+		if err != nil {
+			return nil, err
+		}
+		if len(ss) == 0 {
+			return ss, nil
+		}
+		return []*Series{aggregate((&CallNode{Func: name, Args: args}).String(), ss, reducers[agg], ev.grid.Count)}, nil
+	}
+}
+
+// groupBy(series, key[, agg]) 按endpoint或者tag分组聚合, 默认求和; key可以是逗号分隔的多个label
+func groupByFunc(ev *evaluator, args []Node) ([]*Series, error) {
+	if err := checkArgs("groupBy", args, 2, 3); err != nil {
+		return nil, err
+	}
+	ss, err := ev.seriesArg(args[0])
+	if err != nil {
+		return nil, err
+	}
+	key, err := ev.stringArg(args[1])
+	if err != nil {
+		return nil, err
+	}
+	agg := "sum"
+	if len(args) == 3 {
+		if agg, err = ev.stringArg(args[2]); err != nil {
+			return nil, err
+		}
+	}
+	reduce, err := reducer(agg)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := strings.Split(key, ",")
+	for i := range keys {
+		keys[i] = strings.TrimSpace(keys[i])
+	}
+	groups := map[string][]*Series{}
+	order := []string{}
+	for _, s := range ss {
+		parts := make([]string, len(keys))
+		for i, k := range keys {
+			parts[i] = k + "=" + s.Label(k)
+		}
+		g := strings.Join(parts, ",")
+		if _, ok := groups[g]; !ok {
+			order = append(order, g)
+		}
+		groups[g] = append(groups[g], s)
+	}
+	result := make([]*Series, 0, len(order))
+	for _, g := range order {
+		// 分组之后只保留分组的label, 方便和其他分组的结果做运算
+		first := groups[g][0]
+		s := aggregate(g, groups[g], reduce, ev.grid.Count)
+		s.Endpoint = ""
+		s.Tags = map[string]string{}
+		for _, k := range keys {
+			v := first.Label(k)
+			switch k {
+			case "endpoint":
+				s.Endpoint = v
+			case "metric":
+				s.Metric = v
+			default:
+				s.Tags[k] = v
+			}
+		}
+		result = append(result, s)
+	}
+	return result, nil
+}
+
+// topk(k, series[, by]) 按整个时间段上的avg、max、min、last或sum取前k条
+func topkFunc(bottom bool) function {
+	name := "topk"
+	if bottom {
+		name = "bottomk"
+	}
+	return func(ev *evaluator, args []Node) ([]*Series, error) {
+		if err := checkArgs(name, args, 2, 3); err != nil {
+			return nil, err
+		}
+		k, err := ev.numberArg(args[0])
+		if err != nil {
+			return nil, err
+		}
+		ss, err := ev.seriesArg(args[1])
+		if err != nil {
+			return nil, err
+		}
+		by := "avg"
+		if len(args) == 3 {
+			if by, err = ev.stringArg(args[2]); err != nil {
+				return nil, err
+			}
+		}
+		reduce, err := reducer(by)
+		if err != nil {
+			return nil, err
+		}
+
+		scores := make(map[*Series]float64, len(ss))
+		for _, s := range ss {
+			scores[s] = reduce(s.Values)
+		}
+		sorted := append([]*Series{}, ss...)
+		sort.Stable(&seriesByScore{sorted, scores, bottom})
+		if n := int(k); n >= 0 && n < len(sorted) {
+			sorted = sorted[:n]
+		}
+		return sorted, nil
+	}
+}
+
+// seriesByScore topk按分数从大到小排序(bottomk从小到大), NaN排在最后
+type seriesByScore struct {
+	ss     []*Series
+	scores map[*Series]float64
+	bottom bool
+}
+
+func (s *seriesByScore) Len() int      { return len(s.ss) }
+func (s *seriesByScore) Swap(i, j int) { s.ss[i], s.ss[j] = s.ss[j], s.ss[i] }
+func (s *seriesByScore) Less(i, j int) bool {
+	a, b := s.scores[s.ss[i]], s.scores[s.ss[j]]
+	if math.IsNaN(b) {
+		return !math.IsNaN(a)
+	}
+	if math.IsNaN(a) {
+		return false
+	}
+	if s.bottom {
+		return a < b
+	}
+	return a > b
+}
+
+// rate 每秒的增量, 计数器回绕时为NaN; COUNTER和DERIVE类型的数据本身就是速率, 原样返回
+func rateFunc(ev *evaluator, args []Node) ([]*Series, error) {
+	if err := checkArgs("rate", args, 1, 1); err != nil {
+		return nil, err
+	}
+	ss, err := ev.seriesArg(args[0])
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*Series, len(ss))
+	for i, s := range ss {
+		out := s.copyMeta("rate("+s.Name+")", len(s.Values))
+		if s.isRate() {
+			copy(out.Values, s.Values)
+			result[i] = out
+			continue
+		}
+		prev := -1
+		for j, v := range s.Values {
+			out.Values[j] = math.NaN()
+			if math.IsNaN(v) {
+				continue
+			}
+			if prev >= 0 && v >= s.Values[prev] {
+				out.Values[j] = (v - s.Values[prev]) / float64(int64(j-prev)*ev.grid.Step)
+			}
+			prev = j
+		}
+		result[i] = out
+	}
+	return result, nil
+}
+
+// movingAverage(series, window) window为点数, 或者"5m"这样的时长
+func movingAverageFunc(ev *evaluator, args []Node) ([]*Series, error) {
+	if err := checkArgs("movingAverage", args, 2, 2); err != nil {
+		return nil, err
+	}
+	ss, err := ev.seriesArg(args[0])
+	if err != nil {
+		return nil, err
+	}
+	var window int
+	if str, ok := args[1].(*StringNode); ok {
+		d, err := time.ParseDuration(str.Val)
+		if err != nil {
+			return nil, fmt.Errorf("bad window %q: %v", str.Val, err)
+		}
+		window = int((int64(d/time.Second) + ev.grid.Step - 1) / ev.grid.Step)
+	} else {
+		n, err := ev.numberArg(args[1])
+		if err != nil {
+			return nil, err
+		}
+		window = int(n)
+	}
+	if window < 1 {
+		return nil, fmt.Errorf("movingAverage window must be positive")
+	}
+
+	result := make([]*Series, len(ss))
+	for i, s := range ss {
+		out := s.copyMeta("movingAverage("+s.Name+", "+args[1].String()+")", len(s.Values))
+		sum, n := 0.0, 0
+		for j, v := range s.Values {
+			if !math.IsNaN(v) {
+				sum += v
+				n++
+			}
+			if j >= window {
+				if old := s.Values[j-window]; !math.IsNaN(old) {
+					sum -= old
+					n--
+				}
+			}
+			if n == 0 {
+				out.Values[j] = math.NaN()
+			} else {
+				out.Values[j] = sum / float64(n)
+			}
+		}
+		result[i] = out
+	}
+	return result, nil
+}
+
+func aliasFunc(ev *evaluator, args []Node) ([]*Series, error) {
+	if err := checkArgs("alias", args, 2, 2); err != nil {
+		return nil, err
+	}
+	ss, err := ev.seriesArg(args[0])
+	if err != nil {
+		return nil, err
+	}
+	name, err := ev.stringArg(args[1])
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*Series, len(ss))
+	for i, s := range ss {
+		out := *s
+		out.Name = name
+		result[i] = &out
+	}
+	return result, nil
+}
+
+func binaryOp(op string, a, b float64) float64 {
+	switch op {
+	case "+":
+		return a + b
+	case "-":
+		return a - b
+	case "*":
+		return a * b
+	case "/":
+		if b == 0 {
+			return math.NaN()
+		}
+		return a / b
+	}
+	return math.NaN()
+}
+
+func formatNumber(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,153 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expr
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+)
+
+type tokenType int
+
+const (
+	tEOF tokenType = iota
+	tIdent
+	tNumber
+	tString
+	tLParen
+	tRParen
+	tComma
+	tAdd
+	tSub
+	tMul
+	tDiv
+	tEq
+	tNeq
+	tRe
+	tNre
+)
+
+type token struct {
+	typ tokenType
+	val string
+	pos int
+}
+
+func (t token) String() string {
+	if t.typ == tEOF {
+		return "end of expression"
+	}
+	return fmt.Sprintf("%q", t.val)
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || c == '.' || c == ':' ||
+		(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// lex 把表达式切分成token; 标识符不能包含'-', 需要时使用字符串
+func lex(s string) ([]token, error) {
+	tokens := []token{}
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, token{tLParen, "(", i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{tRParen, ")", i})
+			i++
+		case c == ',':
+			tokens = append(tokens, token{tComma, ",", i})
+			i++
+		case c == '+':
+			tokens = append(tokens, token{tAdd, "+", i})
+			i++
+		case c == '-':
+			tokens = append(tokens, token{tSub, "-", i})
+			i++
+		case c == '*':
+			tokens = append(tokens, token{tMul, "*", i})
+			i++
+		case c == '/':
+			tokens = append(tokens, token{tDiv, "/", i})
+			i++
+		case c == '=':
+			if i+1 < len(s) && s[i+1] == '~' {
+				tokens = append(tokens, token{tRe, "=~", i})
+				i += 2
+			} else {
+				tokens = append(tokens, token{tEq, "=", i})
+				i++
+			}
+		case c == '!':
+			if i+1 < len(s) && s[i+1] == '=' {
+				tokens = append(tokens, token{tNeq, "!=", i})
+			} else if i+1 < len(s) && s[i+1] == '~' {
+				tokens = append(tokens, token{tNre, "!~", i})
+			} else {
+				return nil, fmt.Errorf("unexpected character '!' at %d", i)
+			}
+			i += 2
+		case c == '"' || c == '\'':
+			val, n, err := lexString(s[i:])
+			if err != nil {
+				return nil, fmt.Errorf("%v at %d", err, i)
+			}
+			tokens = append(tokens, token{tString, val, i})
+			i += n
+		case isIdentChar(c):
+			j := i
+			for j < len(s) && isIdentChar(s[j]) {
+				j++
+			}
+			word := s[i:j]
+			typ := tIdent
+			if c >= '0' && c <= '9' || c == '.' {
+				if _, err := strconv.ParseFloat(word, 64); err == nil {
+					typ = tNumber
+				}
+			}
+			tokens = append(tokens, token{typ, word, i})
+			i = j
+		default:
+			return nil, fmt.Errorf("unexpected character %q at %d", c, i)
+		}
+	}
+	tokens = append(tokens, token{tEOF, "", len(s)})
+	return tokens, nil
+}
+
+// lexString 读取一个单引号或双引号字符串, 只转义引号和反斜杠本身, 其他反斜杠原样保留, 方便书写正则
+func lexString(s string) (string, int, error) {
+	quote := s[0]
+	var b bytes.Buffer
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s) && (s[i+1] == quote || s[i+1] == '\\'):
+			b.WriteByte(s[i+1])
+			i++
+		case c == quote:
+			return b.String(), i + 1, nil
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string")
+}
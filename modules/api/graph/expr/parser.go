@@ -0,0 +1,352 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expr
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Node 是表达式语法树的节点
+type Node interface {
+	String() string
+}
+
+type NumberNode struct {
+	Val float64
+}
+
+type StringNode struct {
+	Val string
+}
+
+// SelectorNode 选择一组series, 由metric名和过滤条件组成
+type SelectorNode struct {
+	Metric   string
+	Matchers []*Matcher
+}
+
+type CallNode struct {
+	Func string
+	Args []Node
+}
+
+type BinaryNode struct {
+	Op  string
+	LHS Node
+	RHS Node
+}
+
+func (n *NumberNode) String() string {
+	return strconv.FormatFloat(n.Val, 'g', -1, 64)
+}
+
+func (n *StringNode) String() string {
+	return strconv.Quote(n.Val)
+}
+
+func (n *SelectorNode) String() string {
+	parts := []string{}
+	for _, m := range n.Matchers {
+		parts = append(parts, m.String())
+	}
+	if n.Metric != "" {
+		if len(parts) == 0 {
+			return n.Metric
+		}
+		parts = append(parts, n.Metric)
+	}
+	return "series(" + strings.Join(parts, ", ") + ")"
+}
+
+func (n *CallNode) String() string {
+	args := make([]string, len(n.Args))
+	for i, a := range n.Args {
+		args[i] = a.String()
+	}
+	return n.Func + "(" + strings.Join(args, ", ") + ")"
+}
+
+func (n *BinaryNode) String() string {
+	return n.LHS.String() + " " + n.Op + " " + n.RHS.String()
+}
+
+// Matcher 过滤条件, Name为endpoint、metric或者tag的key
+type Matcher struct {
+	Name  string
+	Op    string
+	Value string
+	re    *regexp.Regexp
+}
+
+func NewMatcher(name, op, value string) (*Matcher, error) {
+	m := &Matcher{Name: name, Op: op, Value: value}
+	switch op {
+	case "=", "!=":
+	case "=~", "!~":
+		re, err := regexp.Compile("^(?:" + value + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("bad regexp %q: %v", value, err)
+		}
+		m.re = re
+	default:
+		return nil, fmt.Errorf("unknown match operator %s", op)
+	}
+	return m, nil
+}
+
+// Matches 判断v是否满足条件, 不存在的tag当作空字符串
+func (m *Matcher) Matches(v string) bool {
+	switch m.Op {
+	case "=":
+		return v == m.Value
+	case "!=":
+		return v != m.Value
+	case "=~":
+		return m.re.MatchString(v)
+	case "!~":
+		return !m.re.MatchString(v)
+	}
+	return false
+}
+
+func (m *Matcher) String() string {
+	name := m.Name
+	if name != "endpoint" && name != "metric" {
+		name = "tag." + name
+	}
+	return name + m.Op + strconv.Quote(m.Value)
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+// Parse 解析表达式, 语法:
+//
+//	expr     = term {("+"|"-") term}
+//	term     = unary {("*"|"/") unary}
+//	unary    = "-" unary | primary
+//	primary  = NUMBER | STRING | "(" expr ")" | IDENT "(" [arg {"," arg}] ")" | IDENT
+//	arg      = expr | filter
+//	filter   = ("endpoint"|"metric"|"tag."KEY) ("="|"!="|"=~"|"!~") (IDENT|NUMBER|STRING)
+//
+// 单独的IDENT表示一个metric, 函数参数中的filter作用于同一个函数的所有metric参数;
+// 没有metric参数时, 所有filter组成一个selector, 这时必须包含metric过滤条件
+func Parse(s string) (Node, error) {
+	tokens, err := lex(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	n, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.typ != tEOF {
+		return nil, fmt.Errorf("unexpected %s at %d", t, t.pos)
+	}
+	return n, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.typ != tEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) expect(typ tokenType, what string) (token, error) {
+	t := p.next()
+	if t.typ != typ {
+		return t, fmt.Errorf("expected %s but got %s at %d", what, t, t.pos)
+	}
+	return t, nil
+}
+
+func (p *parser) expr() (Node, error) {
+	lhs, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t.typ != tAdd && t.typ != tSub {
+			return lhs, nil
+		}
+		p.next()
+		rhs, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		lhs = &BinaryNode{Op: t.val, LHS: lhs, RHS: rhs}
+	}
+}
+
+func (p *parser) term() (Node, error) {
+	lhs, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t.typ != tMul && t.typ != tDiv {
+			return lhs, nil
+		}
+		p.next()
+		rhs, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		lhs = &BinaryNode{Op: t.val, LHS: lhs, RHS: rhs}
+	}
+}
+
+func (p *parser) unary() (Node, error) {
+	if p.peek().typ == tSub {
+		p.next()
+		n, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		if num, ok := n.(*NumberNode); ok {
+			return &NumberNode{Val: -num.Val}, nil
+		}
+		return &BinaryNode{Op: "*", LHS: &NumberNode{Val: -1}, RHS: n}, nil
+	}
+	return p.primary()
+}
+
+func (p *parser) primary() (Node, error) {
+	t := p.next()
+	switch t.typ {
+	case tNumber:
+		v, err := strconv.ParseFloat(t.val, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad number %s at %d", t, t.pos)
+		}
+		return &NumberNode{Val: v}, nil
+	case tString:
+		return &StringNode{Val: t.val}, nil
+	case tLParen:
+		n, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(tRParen, "')'"); err != nil {
+			return nil, err
+		}
+		return n, nil
+	case tIdent:
+		switch p.peek().typ {
+		case tLParen:
+			p.next()
+			return p.call(t.val)
+		case tEq, tNeq, tRe, tNre:
+			return nil, fmt.Errorf("filter %s is only allowed as a function argument, at %d", t.val, t.pos)
+		}
+		return &SelectorNode{Metric: t.val}, nil
+	}
+	return nil, fmt.Errorf("unexpected %s at %d", t, t.pos)
+}
+
+func (p *parser) isFilter() bool {
+	if p.peek().typ != tIdent {
+		return false
+	}
+	switch p.tokens[p.pos+1].typ {
+	case tEq, tNeq, tRe, tNre:
+		return true
+	}
+	return false
+}
+
+func (p *parser) filter() (*Matcher, error) {
+	name := p.next()
+	op := p.next()
+	val := p.next()
+	if val.typ != tIdent && val.typ != tNumber && val.typ != tString {
+		return nil, fmt.Errorf("expected filter value but got %s at %d", val, val.pos)
+	}
+	label := name.val
+	if strings.HasPrefix(label, "tag.") && len(label) > 4 {
+		label = label[4:]
+	} else if label != "endpoint" && label != "metric" {
+		return nil, fmt.Errorf("unknown filter %s at %d, use endpoint, metric or tag.<key>", name.val, name.pos)
+	}
+	return NewMatcher(label, op.val, val.val)
+}
+
+func (p *parser) call(name string) (Node, error) {
+	n := &CallNode{Func: name}
+	var filters []*Matcher
+	filterAt := -1
+	if p.peek().typ != tRParen {
+		for {
+			if p.isFilter() {
+				m, err := p.filter()
+				if err != nil {
+					return nil, err
+				}
+				if filterAt < 0 {
+					filterAt = len(n.Args)
+				}
+				filters = append(filters, m)
+			} else {
+				a, err := p.expr()
+				if err != nil {
+					return nil, err
+				}
+				n.Args = append(n.Args, a)
+			}
+			if p.peek().typ != tComma {
+				break
+			}
+			p.next()
+		}
+	}
+	if _, err := p.expect(tRParen, "')' or ','"); err != nil {
+		return nil, err
+	}
+	if len(filters) == 0 {
+		return n, nil
+	}
+
+	bound := false
+	for _, a := range n.Args {
+		if sel, ok := a.(*SelectorNode); ok {
+			sel.Matchers = append(sel.Matchers, filters...)
+			bound = true
+		}
+	}
+	if !bound {
+		sel := &SelectorNode{Matchers: filters}
+		if name == "series" && len(n.Args) == 0 {
+			return sel, nil
+		}
+		args := append([]Node{}, n.Args[:filterAt]...)
+		args = append(args, sel)
+		n.Args = append(args, n.Args[filterAt:]...)
+	}
+	return n, nil
+}
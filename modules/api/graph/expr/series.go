@@ -0,0 +1,175 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expr
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	cmodel "github.com/open-falcon/falcon-plus/common/model"
+)
+
+// Series 对齐到统一时间网格上的一条曲线, Values[i]对应时间戳Start+i*Step
+type Series struct {
+	Name     string
+	Endpoint string
+	Metric   string
+	Tags     map[string]string
+	// endpoint上的tag, 只用于过滤和分组
+	EndpointTags map[string]string
+	DsType       string
+	Values       []float64
+}
+
+func (s *Series) Label(name string) string {
+	return label(name, s.Endpoint, s.Metric, s.Tags, s.EndpointTags)
+}
+
+// label 按endpoint、metric、counter的tag、endpoint的tag的顺序查找
+func label(name, endpoint, metric string, tags, endpointTags map[string]string) string {
+	switch name {
+	case "endpoint":
+		return endpoint
+	case "metric":
+		return metric
+	}
+	if v, ok := tags[name]; ok {
+		return v
+	}
+	return endpointTags[name]
+}
+
+// Counter 返回metric/tags格式的counter, 聚合之后的series没有counter
+func (s *Series) Counter() string {
+	if s.Metric == "" {
+		return ""
+	}
+	return counterString(s.Metric, s.Tags)
+}
+
+// key 用于两组series做运算时按endpoint和tag配对
+func (s *Series) key() string {
+	return s.Endpoint + "/" + sortedTags(s.Tags)
+}
+
+func (s *Series) copyMeta(name string, n int) *Series {
+	return &Series{
+		Name:         name,
+		Endpoint:     s.Endpoint,
+		Metric:       s.Metric,
+		Tags:         s.Tags,
+		EndpointTags: s.EndpointTags,
+		DsType:       s.DsType,
+		Values:       make([]float64, n),
+	}
+}
+
+// isRate COUNTER和DERIVE类型的rrd在写入时已经换算成了每秒的速率
+func (s *Series) isRate() bool {
+	return s.DsType == "COUNTER" || s.DsType == "DERIVE"
+}
+
+func sortedTags(tags map[string]string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = k + "=" + tags[k]
+	}
+	return strings.Join(parts, ",")
+}
+
+func counterString(metric string, tags map[string]string) string {
+	if len(tags) == 0 {
+		return metric
+	}
+	return metric + "/" + sortedTags(tags)
+}
+
+// Grid 查询结果的时间网格
+type Grid struct {
+	Start int64
+	Step  int64
+	Count int
+}
+
+// newGrid 时间戳按step向上对齐, rrd的每个点表示(ts-step, ts]区间的值
+func newGrid(start, end, step int64) Grid {
+	first := ceilStep(start, step)
+	last := ceilStep(end, step)
+	if last < first {
+		last = first
+	}
+	return Grid{Start: first, Step: step, Count: int((last-first)/step) + 1}
+}
+
+func ceilStep(ts, step int64) int64 {
+	if r := ts % step; r != 0 {
+		ts += step - r
+	}
+	return ts
+}
+
+func (g Grid) Ts(i int) int64 {
+	return g.Start + int64(i)*g.Step
+}
+
+// align 把原始数据按网格聚合, 落在同一个格子中的点取平均值
+func (g Grid) align(points []*cmodel.RRDData) []float64 {
+	values := make([]float64, g.Count)
+	counts := make([]int, g.Count)
+	for _, p := range points {
+		if p == nil || math.IsNaN(float64(p.Value)) {
+			continue
+		}
+		v := float64(p.Value)
+		i := int((ceilStep(p.Timestamp, g.Step) - g.Start) / g.Step)
+		if i < 0 || i >= g.Count {
+			continue
+		}
+		values[i] += v
+		counts[i]++
+	}
+	for i := range values {
+		if counts[i] == 0 {
+			values[i] = math.NaN()
+		} else {
+			values[i] /= float64(counts[i])
+		}
+	}
+	return values
+}
+
+// resolution 原始数据实际的时间间隔, graph在长时间范围的查询中会返回归档之后的数据
+func resolution(points []*cmodel.RRDData) int64 {
+	var res int64
+	for i := 1; i < len(points); i++ {
+		if points[i] == nil || points[i-1] == nil {
+			continue
+		}
+		d := points[i].Timestamp - points[i-1].Timestamp
+		if d > 0 && (res == 0 || d < res) {
+			res = d
+		}
+	}
+	return res
+}
@@ -0,0 +1,169 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package promql
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type tokenType int
+
+const (
+	tEOF tokenType = iota
+	tIdent
+	tNumber
+	tString
+	tDuration
+	tLParen
+	tRParen
+	tLBrace
+	tRBrace
+	tComma
+	tAdd
+	tSub
+	tMul
+	tDiv
+	tEq
+	tNeq
+	tRe
+	tNre
+)
+
+type token struct {
+	typ tokenType
+	val string
+	pos int
+}
+
+func (t token) String() string {
+	if t.typ == tEOF {
+		return "end of query"
+	}
+	return fmt.Sprintf("%q", t.val)
+}
+
+var punctTypes = map[byte]tokenType{
+	'(': tLParen, ')': tRParen, '{': tLBrace, '}': tRBrace, ',': tComma,
+	'+': tAdd, '-': tSub, '*': tMul, '/': tDiv,
+}
+
+// metric名中允许出现'.', falcon的metric大多是cpu.idle这样的格式
+func isIdentChar(c byte) bool {
+	return c == '_' || c == '.' || c == ':' ||
+		(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+func lex(s string) ([]token, error) {
+	tokens := []token{}
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '#':
+			for i < len(s) && s[i] != '\n' {
+				i++
+			}
+		case punctTypes[c] != tEOF:
+			tokens = append(tokens, token{punctTypes[c], string(c), i})
+			i++
+		case c == '[':
+			j := strings.IndexByte(s[i:], ']')
+			if j < 0 {
+				return nil, fmt.Errorf("unterminated range at %d", i)
+			}
+			if strings.Contains(s[i+1:i+j], ":") {
+				return nil, fmt.Errorf("subquery is not supported at %d", i)
+			}
+			tokens = append(tokens, token{tDuration, strings.TrimSpace(s[i+1 : i+j]), i})
+			i += j + 1
+		case c == '=':
+			if i+1 < len(s) && s[i+1] == '~' {
+				tokens = append(tokens, token{tRe, "=~", i})
+				i += 2
+			} else if i+1 < len(s) && s[i+1] == '=' {
+				return nil, fmt.Errorf("comparison operator == is not supported at %d", i)
+			} else {
+				tokens = append(tokens, token{tEq, "=", i})
+				i++
+			}
+		case c == '!':
+			if i+1 < len(s) && s[i+1] == '=' {
+				tokens = append(tokens, token{tNeq, "!=", i})
+			} else if i+1 < len(s) && s[i+1] == '~' {
+				tokens = append(tokens, token{tNre, "!~", i})
+			} else {
+				return nil, fmt.Errorf("unexpected character '!' at %d", i)
+			}
+			i += 2
+		case c == '"' || c == '\'' || c == '`':
+			val, n, err := lexString(s[i:])
+			if err != nil {
+				return nil, fmt.Errorf("%v at %d", err, i)
+			}
+			tokens = append(tokens, token{tString, val, i})
+			i += n
+		case isIdentChar(c):
+			j := i
+			for j < len(s) && isIdentChar(s[j]) {
+				j++
+			}
+			word := s[i:j]
+			typ := tIdent
+			if c >= '0' && c <= '9' || c == '.' {
+				if _, err := strconv.ParseFloat(word, 64); err != nil {
+					return nil, fmt.Errorf("bad number %q at %d", word, i)
+				}
+				typ = tNumber
+			}
+			tokens = append(tokens, token{typ, word, i})
+			i = j
+		case strings.IndexByte("<>%^", c) >= 0:
+			return nil, fmt.Errorf("operator %q is not supported at %d", c, i)
+		default:
+			return nil, fmt.Errorf("unexpected character %q at %d", c, i)
+		}
+	}
+	tokens = append(tokens, token{tEOF, "", len(s)})
+	return tokens, nil
+}
+
+// lexString 和PromQL一样, 单引号和双引号字符串按go的规则转义, 反引号字符串不转义
+func lexString(s string) (string, int, error) {
+	quote := s[0]
+	if quote == '`' {
+		j := strings.IndexByte(s[1:], '`')
+		if j < 0 {
+			return "", 0, fmt.Errorf("unterminated raw string")
+		}
+		return s[1 : j+1], j + 2, nil
+	}
+	var b bytes.Buffer
+	for rest := s[1:]; len(rest) > 0; {
+		if rest[0] == quote {
+			return b.String(), len(s) - len(rest) + 1, nil
+		}
+		r, _, tail, err := strconv.UnquoteChar(rest, quote)
+		if err != nil {
+			return "", 0, fmt.Errorf("bad escape in string")
+		}
+		b.WriteRune(r)
+		rest = tail
+	}
+	return "", 0, fmt.Errorf("unterminated string")
+}
@@ -0,0 +1,444 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package promql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/open-falcon/falcon-plus/modules/api/graph/expr"
+)
+
+// Expr 翻译成expr语法树的PromQL查询
+type Expr struct {
+	Node expr.Node
+	// 查询中最长的range, 单位为秒, 计算时需要向前多取这么长的数据
+	Range int64
+	// 不包含selector的查询, 结果是标量
+	Scalar bool
+}
+
+// aggregations PromQL的聚合对应的expr函数, by分组时使用groupBy
+var aggregations = map[string]string{
+	"sum":     "sumSeries",
+	"avg":     "averageSeries",
+	"min":     "minSeries",
+	"max":     "maxSeries",
+	"count":   "countSeries",
+	"topk":    "topk",
+	"bottomk": "bottomk",
+}
+
+var unsupported = map[string]bool{
+	"without": true, "offset": true, "bool": true, "on": true, "ignoring": true, "group_left": true, "group_right": true,
+}
+
+type parser struct {
+	tokens    []token
+	pos       int
+	maxRange  int64
+	selectors int
+}
+
+// Parse 解析PromQL的一个子集并翻译成expr的语法树, 语法:
+//
+//	expr      = term {("+"|"-") term}
+//	term      = unary {("*"|"/") unary}
+//	unary     = ["-"] primary
+//	primary   = NUMBER | "(" expr ")" | aggregate | call | selector
+//	aggregate = ("sum"|"avg"|"min"|"max"|"count") [grouping] "(" expr ")" [grouping]
+//	          | ("topk"|"bottomk") "(" NUMBER "," expr ")"
+//	grouping  = "by" "(" [LABEL {"," LABEL}] ")"
+//	call      = ("rate"|"irate"|"increase") "(" selector "[" DURATION "]" ")"
+//	selector  = METRIC ["{" matchers "}"] | "{" matchers "}"
+//
+// endpoint当作普通的label, __name__对应metric; rate(x[5m])翻译成movingAverage(rate(x), "300s"),
+// 不支持without、offset、on/ignoring、比较运算和子查询
+func Parse(s string) (*Expr, error) {
+	tokens, err := lex(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	n, err := p.additive()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.typ != tEOF {
+		return nil, fmt.Errorf("unexpected %s at %d", t, t.pos)
+	}
+	return &Expr{Node: n, Range: p.maxRange, Scalar: p.selectors == 0}, nil
+}
+
+// ParseSelector 解析series、labels接口的match[]参数, 只能是一个selector
+func ParseSelector(s string) (*expr.SelectorNode, error) {
+	e, err := Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	sel, ok := e.Node.(*expr.SelectorNode)
+	if !ok {
+		return nil, fmt.Errorf("%q is not a series selector", s)
+	}
+	return sel, nil
+}
+
+// ParseDuration 解析PromQL的时长, 例如5m、1h30m、1d, 单位支持ms、s、m、h、d、w、y
+func ParseDuration(s string) (time.Duration, error) {
+	units := map[string]time.Duration{
+		"ms": time.Millisecond, "s": time.Second, "m": time.Minute, "h": time.Hour,
+		"d": 24 * time.Hour, "w": 7 * 24 * time.Hour, "y": 365 * 24 * time.Hour,
+	}
+	if s == "" {
+		return 0, fmt.Errorf("empty duration")
+	}
+	var d time.Duration
+	for rest := s; len(rest) > 0; {
+		i := 0
+		for i < len(rest) && rest[i] >= '0' && rest[i] <= '9' {
+			i++
+		}
+		j := i
+		for j < len(rest) && (rest[j] < '0' || rest[j] > '9') {
+			j++
+		}
+		u, ok := units[rest[i:j]]
+		if i == 0 || !ok {
+			return 0, fmt.Errorf("bad duration %q", s)
+		}
+		n, err := strconv.ParseInt(rest[:i], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("bad duration %q", s)
+		}
+		d += time.Duration(n) * u
+		rest = rest[j:]
+	}
+	return d, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.typ != tEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) expect(typ tokenType, what string) error {
+	if t := p.next(); t.typ != typ {
+		return fmt.Errorf("expected %s but got %s at %d", what, t, t.pos)
+	}
+	return nil
+}
+
+// checkUnsupported 对不支持的关键字给出明确的错误, 而不是当作metric名
+func (p *parser) checkUnsupported() error {
+	if t := p.peek(); t.typ == tIdent && unsupported[t.val] {
+		return fmt.Errorf("%s is not supported at %d", t.val, t.pos)
+	}
+	return nil
+}
+
+func (p *parser) additive() (expr.Node, error) {
+	lhs, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t.typ != tAdd && t.typ != tSub {
+			return lhs, nil
+		}
+		p.next()
+		if err := p.checkUnsupported(); err != nil {
+			return nil, err
+		}
+		rhs, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		lhs = &expr.BinaryNode{Op: t.val, LHS: lhs, RHS: rhs}
+	}
+}
+
+func (p *parser) term() (expr.Node, error) {
+	lhs, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t.typ != tMul && t.typ != tDiv {
+			return lhs, nil
+		}
+		p.next()
+		if err := p.checkUnsupported(); err != nil {
+			return nil, err
+		}
+		rhs, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		lhs = &expr.BinaryNode{Op: t.val, LHS: lhs, RHS: rhs}
+	}
+}
+
+func (p *parser) unary() (expr.Node, error) {
+	if p.peek().typ == tAdd {
+		p.next()
+		return p.unary()
+	}
+	if p.peek().typ == tSub {
+		p.next()
+		n, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		if num, ok := n.(*expr.NumberNode); ok {
+			return &expr.NumberNode{Val: -num.Val}, nil
+		}
+		return &expr.BinaryNode{Op: "*", LHS: &expr.NumberNode{Val: -1}, RHS: n}, nil
+	}
+	n, rng, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	if rng > 0 {
+		return nil, fmt.Errorf("range vector %s can only be used in rate, irate or increase", n)
+	}
+	return n, nil
+}
+
+// primary 返回的range大于0时是range vector
+func (p *parser) primary() (expr.Node, int64, error) {
+	t := p.next()
+	switch t.typ {
+	case tNumber:
+		v, _ := strconv.ParseFloat(t.val, 64)
+		return &expr.NumberNode{Val: v}, 0, nil
+	case tLParen:
+		n, err := p.additive()
+		if err != nil {
+			return nil, 0, err
+		}
+		if err := p.expect(tRParen, "\")\""); err != nil {
+			return nil, 0, err
+		}
+		return n, 0, nil
+	case tLBrace:
+		p.pos--
+		return p.selector("")
+	case tIdent:
+		next := p.peek()
+		if _, ok := aggregations[t.val]; ok && (next.typ == tLParen || next.typ == tIdent && (next.val == "by" || next.val == "without")) {
+			n, err := p.aggregate(t)
+			return n, 0, err
+		}
+		if next.typ == tLParen {
+			n, err := p.call(t)
+			return n, 0, err
+		}
+		if unsupported[t.val] {
+			return nil, 0, fmt.Errorf("%s is not supported at %d", t.val, t.pos)
+		}
+		return p.selector(t.val)
+	}
+	return nil, 0, fmt.Errorf("unexpected %s at %d", t, t.pos)
+}
+
+func (p *parser) selector(metric string) (expr.Node, int64, error) {
+	sel := &expr.SelectorNode{Metric: metric}
+	if p.peek().typ == tLBrace {
+		p.next()
+		for p.peek().typ != tRBrace {
+			name, op, val := p.next(), p.next(), p.next()
+			if name.typ != tIdent {
+				return nil, 0, fmt.Errorf("expected label name but got %s at %d", name, name.pos)
+			}
+			if op.typ != tEq && op.typ != tNeq && op.typ != tRe && op.typ != tNre {
+				return nil, 0, fmt.Errorf("expected match operator but got %s at %d", op, op.pos)
+			}
+			if val.typ != tString {
+				return nil, 0, fmt.Errorf("expected label value string but got %s at %d", val, val.pos)
+			}
+			label := name.val
+			if label == "__name__" {
+				label = "metric"
+			}
+			if label == "metric" && op.typ == tEq && sel.Metric == "" {
+				sel.Metric = val.val
+			} else {
+				m, err := expr.NewMatcher(label, op.val, val.val)
+				if err != nil {
+					return nil, 0, err
+				}
+				sel.Matchers = append(sel.Matchers, m)
+			}
+			if p.peek().typ == tComma {
+				p.next()
+			} else if t := p.peek(); t.typ != tRBrace {
+				return nil, 0, fmt.Errorf("expected \",\" or \"}\" but got %s at %d", t, t.pos)
+			}
+		}
+		p.next()
+	}
+	if sel.Metric == "" && len(sel.Matchers) == 0 {
+		return nil, 0, fmt.Errorf("vector selector must contain at least one matcher")
+	}
+	p.selectors++
+
+	var rng int64
+	if t := p.peek(); t.typ == tDuration {
+		p.next()
+		d, err := ParseDuration(t.val)
+		if err != nil {
+			return nil, 0, err
+		}
+		if rng = int64(d / time.Second); rng < 1 {
+			return nil, 0, fmt.Errorf("range must be at least 1s at %d", t.pos)
+		}
+		if rng > p.maxRange {
+			p.maxRange = rng
+		}
+	}
+	if err := p.checkUnsupported(); err != nil {
+		return nil, 0, err
+	}
+	return sel, rng, nil
+}
+
+func (p *parser) grouping() ([]string, error) {
+	if err := p.checkUnsupported(); err != nil {
+		return nil, err
+	}
+	if t := p.next(); t.val != "by" {
+		return nil, fmt.Errorf("expected \"by\" but got %s at %d", t, t.pos)
+	}
+	if err := p.expect(tLParen, "\"(\""); err != nil {
+		return nil, err
+	}
+	labels := []string{}
+	for p.peek().typ != tRParen {
+		t := p.next()
+		if t.typ != tIdent {
+			return nil, fmt.Errorf("expected label name but got %s at %d", t, t.pos)
+		}
+		if t.val == "__name__" {
+			t.val = "metric"
+		}
+		labels = append(labels, t.val)
+		if p.peek().typ == tComma {
+			p.next()
+		} else if t := p.peek(); t.typ != tRParen {
+			return nil, fmt.Errorf("expected \",\" or \")\" but got %s at %d", t, t.pos)
+		}
+	}
+	p.next()
+	return labels, nil
+}
+
+// aggregate sum by (a, b) (x)翻译成groupBy(x, "a,b", "sum"), 没有by时翻译成sumSeries(x)
+func (p *parser) aggregate(name token) (expr.Node, error) {
+	var (
+		by    []string
+		err   error
+		args  []expr.Node
+		isTop = name.val == "topk" || name.val == "bottomk"
+	)
+	if p.peek().typ == tIdent {
+		if by, err = p.grouping(); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.expect(tLParen, "\"(\""); err != nil {
+		return nil, err
+	}
+	if isTop {
+		k, err := p.additive()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := k.(*expr.NumberNode); !ok {
+			return nil, fmt.Errorf("%s expects a number as the first parameter", name.val)
+		}
+		if err := p.expect(tComma, "\",\""); err != nil {
+			return nil, err
+		}
+		args = append(args, k)
+	}
+	arg, err := p.additive()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(tRParen, "\")\""); err != nil {
+		return nil, err
+	}
+	args = append(args, arg)
+	if t := p.peek(); by == nil && t.typ == tIdent && (t.val == "by" || t.val == "without") {
+		if by, err = p.grouping(); err != nil {
+			return nil, err
+		}
+	}
+
+	if isTop {
+		if len(by) > 0 {
+			return nil, fmt.Errorf("%s by is not supported", name.val)
+		}
+		return &expr.CallNode{Func: name.val, Args: args}, nil
+	}
+	if len(by) == 0 {
+		return &expr.CallNode{Func: aggregations[name.val], Args: args}, nil
+	}
+	return &expr.CallNode{Func: "groupBy", Args: []expr.Node{
+		arg, &expr.StringNode{Val: strings.Join(by, ",")}, &expr.StringNode{Val: name.val},
+	}}, nil
+}
+
+// call rate、increase按range做滑动平均, irate直接用相邻两个点;
+// COUNTER和DERIVE类型的数据已经是速率(见expr的rate), rate就是range内的平均值, increase为平均值乘以range
+func (p *parser) call(name token) (expr.Node, error) {
+	switch name.val {
+	case "rate", "irate", "increase":
+	default:
+		return nil, fmt.Errorf("function %s is not supported at %d", name.val, name.pos)
+	}
+	p.next()
+	arg, rng, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	if rng == 0 {
+		return nil, fmt.Errorf("expected range vector in call to function %s", name.val)
+	}
+	if err := p.expect(tRParen, "\")\""); err != nil {
+		return nil, err
+	}
+
+	rate := &expr.CallNode{Func: "rate", Args: []expr.Node{arg}}
+	if name.val == "irate" {
+		return rate, nil
+	}
+	avg := &expr.CallNode{Func: "movingAverage", Args: []expr.Node{rate, &expr.StringNode{Val: fmt.Sprintf("%ds", rng)}}}
+	if name.val == "increase" {
+		return &expr.BinaryNode{Op: "*", LHS: avg, RHS: &expr.NumberNode{Val: float64(rng)}}, nil
+	}
+	return avg, nil
+}
@@ -0,0 +1,170 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package promql
+
+import (
+	"math"
+	"testing"
+
+	cmodel "github.com/open-falcon/falcon-plus/common/model"
+	"github.com/open-falcon/falcon-plus/modules/api/graph/expr"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+		rng   int64
+	}{
+		{"cpu.idle", "cpu.idle", 0},
+		{`cpu.idle{endpoint="web1", service=~'pay.*',}`, `series(endpoint="web1", tag.service=~"pay.*", cpu.idle)`, 0},
+		{`{__name__="cpu.idle", __name__!~"x"}`, `series(metric!~"x", cpu.idle)`, 0},
+		{"sum by (service) (rate(net.if.in.bytes[5m]))", `groupBy(movingAverage(rate(net.if.in.bytes), "300s"), "service", "sum")`, 300},
+		{"avg(cpu.idle) by (endpoint, idc)", `groupBy(cpu.idle, "endpoint,idc", "avg")`, 0},
+		{"max by () (cpu.idle)", "maxSeries(cpu.idle)", 0},
+		{"topk(3, cpu.busy)", "topk(3, cpu.busy)", 0},
+		{"sum(cpu.busy) / count(cpu.busy) * 100", "sumSeries(cpu.busy) / countSeries(cpu.busy) * 100", 0},
+		{"-cpu.busy + -1", "-1 * cpu.busy + -1", 0},
+		{"increase(req.total[1h]) - irate(req.total[1m])", `movingAverage(rate(req.total), "3600s") * 3600 - rate(req.total)`, 3600},
+	}
+	for _, tt := range tests {
+		e, err := Parse(tt.query)
+		if err != nil {
+			t.Errorf("Parse(%q) error: %v", tt.query, err)
+			continue
+		}
+		if got := e.Node.String(); got != tt.want || e.Range != tt.rng {
+			t.Errorf("Parse(%q) = %s, range %d, want %s, range %d", tt.query, got, e.Range, tt.want, tt.rng)
+		}
+		if e.Scalar {
+			t.Errorf("Parse(%q) should not be scalar", tt.query)
+		}
+	}
+	if e, err := Parse("(1 + 2) * 3"); err != nil || !e.Scalar {
+		t.Errorf("Parse(\"(1 + 2) * 3\") should be scalar, err %v", err)
+	}
+
+	bad := []string{"", "rate(x)", "x[5m]", "sum without (a) (x)", "x offset 5m", "x > 1", "{}", "abs(x)",
+		"topk by (a) (1, x)", "x{a=1}", "x[5m:1m]", "x + on (a) y", "sum(x", `x{a="\q"}`}
+	for _, q := range bad {
+		if _, err := Parse(q); err == nil {
+			t.Errorf("Parse(%q) should fail", q)
+		}
+	}
+
+	for s, want := range map[string]float64{"5m": 300, "1h30m": 5400, "1d": 86400, "2w": 1209600} {
+		if d, err := ParseDuration(s); err != nil || d.Seconds() != want {
+			t.Errorf("ParseDuration(%q) = %v, %v", s, d, err)
+		}
+	}
+}
+
+type fakeSource map[string][]*cmodel.RRDData
+
+func (f fakeSource) Find(sel *expr.SelectorNode, limit int) ([]*expr.Ref, error) {
+	refs := []*expr.Ref{}
+	for key := range f {
+		r := &expr.Ref{Endpoint: key, Counter: "req.total", Metric: "req.total", Step: 60}
+		if sel.Matches(r) {
+			refs = append(refs, r)
+		}
+	}
+	return refs, nil
+}
+
+func (f fakeSource) Fetch(ref *expr.Ref, cf string, start, end int64, step int) ([]*cmodel.RRDData, error) {
+	return f[ref.Endpoint], nil
+}
+
+func TestEval(t *testing.T) {
+	points := func(vs ...float64) []*cmodel.RRDData {
+		result := make([]*cmodel.RRDData, len(vs))
+		for i, v := range vs {
+			result[i] = cmodel.NewRRDData(int64(60*(i+1)), v)
+		}
+		return result
+	}
+	src := fakeSource{
+		"web1": points(0, 60, 120, 180, 240),
+		"web2": points(0, 120, 240, 360, 600),
+	}
+	e, err := Parse(`sum(rate(req.total{endpoint=~"web.*"}[2m])) * 2`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := (&expr.Engine{Source: src}).Eval(e.Node, &expr.Query{Start: 60, End: 300})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []float64{math.NaN(), 6, 6, 6, 8}
+	if len(r.Series) != 1 || len(r.Series[0].Values) != len(want) {
+		t.Fatalf("got %d series", len(r.Series))
+	}
+	for i, v := range r.Series[0].Values {
+		if math.IsNaN(v) != math.IsNaN(want[i]) || !math.IsNaN(v) && v != want[i] {
+			t.Errorf("point %d = %v, want %v", i, v, want[i])
+		}
+	}
+}
+
+// typedSource 所有counter都是同一种DsType
+type typedSource struct {
+	fakeSource
+	dsType string
+}
+
+func (f typedSource) Find(sel *expr.SelectorNode, limit int) ([]*expr.Ref, error) {
+	refs, err := f.fakeSource.Find(sel, limit)
+	for _, r := range refs {
+		r.DsType = f.dsType
+	}
+	return refs, err
+}
+
+func TestEvalRateDsType(t *testing.T) {
+	data := []*cmodel.RRDData{}
+	for i, v := range []float64{1, 2, 3, 4, 5} {
+		data = append(data, cmodel.NewRRDData(int64(60*(i+1)), v))
+	}
+	tests := []struct {
+		query string
+		want  []float64
+	}{
+		{"irate(req.total[1m])", []float64{1, 2, 3, 4, 5}},
+		{"rate(req.total[2m])", []float64{1, 1.5, 2.5, 3.5, 4.5}},
+		{"increase(req.total[2m])", []float64{120, 180, 300, 420, 540}},
+	}
+	for _, dsType := range []string{"COUNTER", "DERIVE"} {
+		src := typedSource{fakeSource{"web1": data}, dsType}
+		for _, tt := range tests {
+			e, err := Parse(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r, err := (&expr.Engine{Source: src}).Eval(e.Node, &expr.Query{Start: 60, End: 300})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(r.Series) != 1 || len(r.Series[0].Values) != len(tt.want) {
+				t.Fatalf("%s %s: got %d series", dsType, tt.query, len(r.Series))
+			}
+			for i, v := range r.Series[0].Values {
+				if v != tt.want[i] {
+					t.Errorf("%s %s: point %d = %v, want %v", dsType, tt.query, i, v, tt.want[i])
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	cmodel "github.com/open-falcon/falcon-plus/common/model"
+	rpcpool "github.com/toolkits/conn_pool/rpc_conn_pool"
+)
+
+// callAddr 调用指定graph节点上的rpc方法
+func callAddr(addr string, method string, args interface{}, reply interface{}) error {
+	pool, found := GraphConnPools.Get(addr)
+	if !found {
+		return fmt.Errorf("%s, addr not found", addr)
+	}
+	conn, err := pool.Fetch()
+	if err != nil {
+		return err
+	}
+	rpcConn := conn.(*rpcpool.RpcClient)
+	if rpcConn.Closed() {
+		pool.ForceClose(conn)
+		return errors.New("conn closed")
+	}
+
+	ch := make(chan error, 1)
+	go func() {
+		ch <- rpcConn.Call(method, args, reply)
+	}()
+	select {
+	case <-time.After(time.Duration(callTimeout) * time.Millisecond):
+		pool.ForceClose(conn)
+		return fmt.Errorf("%s, call timeout. proc: %s", addr, pool.Proc())
+	case err := <-ch:
+		if err != nil {
+			pool.ForceClose(conn)
+			return fmt.Errorf("%s, call failed, err %v. proc: %s", addr, err, pool.Proc())
+		}
+		pool.Release(conn)
+		return nil
+	}
+}
+
+// callAll 并发调用所有graph节点, newReply为每个节点创建一个返回值, 有节点失败时返回最后一个错误
+func callAll(method string, args interface{}, newReply func() interface{}) ([]interface{}, error) {
+	addrs := map[string]bool{}
+	for _, addr := range clusterMap {
+		addrs[addr] = true
+	}
+	var (
+		wg      sync.WaitGroup
+		lock    sync.Mutex
+		replies []interface{}
+		lastErr error
+	)
+	for addr := range addrs {
+		wg.Add(1)
+		go func(addr string) {
+			defer wg.Done()
+			reply := newReply()
+			err := callAddr(addr, method, args, reply)
+			lock.Lock()
+			defer lock.Unlock()
+			if err != nil {
+				lastErr = err
+				return
+			}
+			replies = append(replies, reply)
+		}(addr)
+	}
+	wg.Wait()
+	return replies, lastErr
+}
+
+// Series 从所有graph节点的tag索引中查询series, 迁移期间同一个series可能同时在两个节点上
+func Series(para cmodel.GraphSeriesParam) (*cmodel.GraphSeriesResp, error) {
+	replies, err := callAll("Graph.Series", para, func() interface{} { return &cmodel.GraphSeriesResp{} })
+	if len(replies) == 0 && err != nil {
+		return nil, err
+	}
+	resp := &cmodel.GraphSeriesResp{Series: []*cmodel.GraphSeries{}}
+	seen := map[string]bool{}
+	for _, r := range replies {
+		r := r.(*cmodel.GraphSeriesResp)
+		resp.Truncated = resp.Truncated || r.Truncated
+		for _, s := range r.Series {
+			pk := s.Endpoint + "/" + s.Counter
+			if !seen[pk] {
+				seen[pk] = true
+				resp.Series = append(resp.Series, s)
+			}
+		}
+	}
+	sort.Sort(cmodel.GraphSeriesSlice(resp.Series))
+	if para.Limit > 0 && len(resp.Series) > para.Limit {
+		resp.Series, resp.Truncated = resp.Series[:para.Limit], true
+	}
+	return resp, err
+}
+
+// Labels 合并所有graph节点上的label名或者label的取值
+func Labels(para cmodel.GraphLabelParam) (*cmodel.GraphLabelResp, error) {
+	replies, err := callAll("Graph.Labels", para, func() interface{} { return &cmodel.GraphLabelResp{} })
+	if len(replies) == 0 && err != nil {
+		return nil, err
+	}
+	resp := &cmodel.GraphLabelResp{Values: []string{}}
+	seen := map[string]bool{}
+	for _, r := range replies {
+		r := r.(*cmodel.GraphLabelResp)
+		resp.Truncated = resp.Truncated || r.Truncated
+		for _, v := range r.Values {
+			if !seen[v] {
+				seen[v] = true
+				resp.Values = append(resp.Values, v)
+			}
+		}
+	}
+	sort.Strings(resp.Values)
+	if para.Limit > 0 && len(resp.Values) > para.Limit {
+		resp.Values, resp.Truncated = resp.Values[:para.Limit], true
+	}
+	return resp, err
+}
@@ -46,6 +46,9 @@ func (this *Graph) GetRrd(key string, rrdfile *g.File) (err error) {
 	}
 
 	rrdfile.Body, err = rrdtool.ReadFile(rrdfile.Filename)
+	if err == nil {
+		rrdfile.Md5 = cutils.Md5(string(rrdfile.Body))
+	}
 	return
 }
 
@@ -126,6 +129,9 @@ func (this *Graph) Query(param cmodel.GraphQueryParam, resp *cmodel.GraphQueryRe
 	var (
 		datas      []*cmodel.RRDData
 		datas_size int
+		res        int64
+		fetchStep  int
+		fetchCF    string
 	)
 
 	// statistics
@@ -154,35 +160,57 @@ func (this *Graph) Query(param cmodel.GraphQueryParam, resp *cmodel.GraphQueryRe
 	key := g.FormRrdCacheKey(md5, dsType, step)
 	filename := g.RrdFileName(cfg.RRD.Storage, md5, dsType, step)
 
+	// 请求的间隔比上报周期大时, 选择合适的归档取数, 最后再降采样到请求的间隔
+	// 按文件中实际的归档选择, 修改策略之后没有relayout的文件和策略不一致
+	_, policy := rrdtool.RetentionForCounter(param.Counter)
+	rras := rrdtool.FileRRA(filename, policy)
+	res = param.Resolution()
+	fetchStep, fetchCF = step, param.ConsolFun
+	if res > int64(step) {
+		fetchStep, fetchCF = rrdtool.ChooseRRA(rras, step, param.ConsolFun, start_ts, res)
+	}
+
 	// read cached items
 	items, flag := store.GraphItems.FetchAll(key)
 	items_size := len(items)
 
-	if cfg.Migrate.Enabled && flag&g.GRAPH_F_MISS != 0 {
-		node, _ := rrdtool.Consistent.Get(param.Endpoint + "/" + param.Counter)
+	var migrateCh chan *rrdtool.Net_task_t
+	if g.Migrating() && flag&g.GRAPH_F_MISS != 0 {
+		migrateCh, _ = rrdtool.MigrateTaskChan(param.Endpoint + "/" + param.Counter)
+	}
+	if migrateCh != nil {
 		done := make(chan error, 1)
-		res := &cmodel.GraphAccurateQueryResponse{}
-		rrdtool.Net_task_ch[node] <- &rrdtool.Net_task_t{
+		reply := &cmodel.GraphAccurateQueryResponse{}
+		rparam := param
+		rparam.Step, rparam.MaxPoints = fetchStep, 0
+		migrateCh <- &rrdtool.Net_task_t{
 			Method: rrdtool.NET_TASK_M_QUERY,
 			Done:   done,
-			Args:   param,
-			Reply:  res,
+			Args:   rparam,
+			Reply:  reply,
 		}
 		<-done
 		// fetch data from remote
-		datas = res.Values
+		datas = reply.Values
 		datas_size = len(datas)
 	} else {
 		// read data from rrd file
 		// 从RRD中获取数据不包含起始时间点
 		// 例: start_ts=1484651400,step=60,则第一个数据时间为1484651460)
-		datas, _ = rrdtool.Fetch(filename, param.ConsolFun, start_ts-int64(step), end_ts, step)
+		datas, _ = rrdtool.Fetch(filename, fetchCF, start_ts-int64(fetchStep), end_ts, fetchStep)
 		datas_size = len(datas)
 	}
 
 	nowTs := time.Now().Unix()
 	lastUpTs := nowTs - nowTs%int64(step)
-	rra1StartTs := lastUpTs - int64(rrdtool.RRA1PointCnt*step)
+	rra1StartTs := lastUpTs - int64(rrdtool.RawPointCnt(rras)*step)
+
+	// 从归档取数时, 把缓存中还没有落盘的数据按归档的间隔合并之后补到末尾
+	if fetchStep != step {
+		resp.Values = mergeConsolidated(datas, cachedRRDData(items, dsType, step, start_ts, end_ts),
+			fetchCF, start_ts, end_ts, int64(fetchStep))
+		goto _RETURN_OK
+	}
 
 	// consolidated, do not merge
 	if start_ts < rra1StartTs {
@@ -198,48 +226,7 @@ func (this *Graph) Query(param cmodel.GraphQueryParam, resp *cmodel.GraphQueryRe
 
 	// merge
 	{
-		// fmt cached items
-		var val cmodel.JsonFloat
-		cache := make([]*cmodel.RRDData, 0)
-
-		ts := items[0].Timestamp
-		itemEndTs := items[items_size-1].Timestamp
-		itemIdx := 0
-		if dsType == g.DERIVE || dsType == g.COUNTER {
-			for ts < itemEndTs {
-				if itemIdx < items_size-1 && ts == items[itemIdx].Timestamp &&
-					ts == items[itemIdx+1].Timestamp-int64(step) {
-					val = cmodel.JsonFloat(items[itemIdx+1].Value-items[itemIdx].Value) / cmodel.JsonFloat(step)
-					if val < 0 {
-						val = cmodel.JsonFloat(math.NaN())
-					}
-					itemIdx++
-				} else {
-					// missing
-					val = cmodel.JsonFloat(math.NaN())
-				}
-
-				if ts >= start_ts && ts <= end_ts {
-					cache = append(cache, &cmodel.RRDData{Timestamp: ts, Value: val})
-				}
-				ts = ts + int64(step)
-			}
-		} else if dsType == g.GAUGE {
-			for ts <= itemEndTs {
-				if itemIdx < items_size && ts == items[itemIdx].Timestamp {
-					val = cmodel.JsonFloat(items[itemIdx].Value)
-					itemIdx++
-				} else {
-					// missing
-					val = cmodel.JsonFloat(math.NaN())
-				}
-
-				if ts >= start_ts && ts <= end_ts {
-					cache = append(cache, &cmodel.RRDData{Timestamp: ts, Value: val})
-				}
-				ts = ts + int64(step)
-			}
-		}
+		cache := cachedRRDData(items, dsType, step, start_ts, end_ts)
 		cache_size := len(cache)
 
 		// do merging
@@ -292,7 +279,7 @@ func (this *Graph) Query(param cmodel.GraphQueryParam, resp *cmodel.GraphQueryRe
 		}
 		ret := make([]*cmodel.RRDData, ret_size, ret_size)
 		mergedIdx := 0
-		ts = start_ts
+		ts := start_ts
 		for i := 0; i < ret_size; i++ {
 			if mergedIdx < mergedSize && ts == merged[mergedIdx].Timestamp {
 				ret[i] = merged[mergedIdx]
@@ -306,11 +293,93 @@ func (this *Graph) Query(param cmodel.GraphQueryParam, resp *cmodel.GraphQueryRe
 	}
 
 _RETURN_OK:
+	if res > int64(step) {
+		resp.Values = cmodel.Downsample(resp.Values, param.ConsolFun, param.Start, param.End, res)
+		resp.Step = int(res)
+	}
 	// statistics
 	proc.GraphQueryItemCnt.IncrBy(int64(len(resp.Values)))
 	return nil
 }
 
+// 把缓存中的数据整理成每个step一个点, 只保留[start_ts, end_ts]之间的点; COUNTER和DERIVE计算速率
+func cachedRRDData(items []*cmodel.GraphItem, dsType string, step int, start_ts, end_ts int64) []*cmodel.RRDData {
+	var val cmodel.JsonFloat
+	cache := make([]*cmodel.RRDData, 0)
+	items_size := len(items)
+	if items_size < 1 {
+		return cache
+	}
+
+	ts := items[0].Timestamp
+	itemEndTs := items[items_size-1].Timestamp
+	itemIdx := 0
+	if dsType == g.DERIVE || dsType == g.COUNTER {
+		for ts < itemEndTs {
+			if itemIdx < items_size-1 && ts == items[itemIdx].Timestamp &&
+				ts == items[itemIdx+1].Timestamp-int64(step) {
+				val = cmodel.JsonFloat(items[itemIdx+1].Value-items[itemIdx].Value) / cmodel.JsonFloat(step)
+				if val < 0 {
+					val = cmodel.JsonFloat(math.NaN())
+				}
+				itemIdx++
+			} else {
+				// missing
+				val = cmodel.JsonFloat(math.NaN())
+			}
+
+			if ts >= start_ts && ts <= end_ts {
+				cache = append(cache, &cmodel.RRDData{Timestamp: ts, Value: val})
+			}
+			ts = ts + int64(step)
+		}
+	} else if dsType == g.GAUGE {
+		for ts <= itemEndTs {
+			if itemIdx < items_size && ts == items[itemIdx].Timestamp {
+				val = cmodel.JsonFloat(items[itemIdx].Value)
+				itemIdx++
+			} else {
+				// missing
+				val = cmodel.JsonFloat(math.NaN())
+			}
+
+			if ts >= start_ts && ts <= end_ts {
+				cache = append(cache, &cmodel.RRDData{Timestamp: ts, Value: val})
+			}
+			ts = ts + int64(step)
+		}
+	}
+	return cache
+}
+
+// datas是按fetchStep合并的归档数据, 缓存数据按相同的间隔和cf合并之后, 填充datas中为NaN的点, 并追加到datas之后
+func mergeConsolidated(datas, cache []*cmodel.RRDData, cf string, start_ts, end_ts, fetchStep int64) []*cmodel.RRDData {
+	if len(cache) == 0 {
+		return datas
+	}
+	idx := make(map[int64]int, len(datas))
+	var lastTs int64
+	for i, d := range datas {
+		idx[d.Timestamp] = i
+		if d.Timestamp > lastTs {
+			lastTs = d.Timestamp
+		}
+	}
+	for _, c := range cmodel.Downsample(cache, cf, start_ts, end_ts, fetchStep) {
+		if math.IsNaN(float64(c.Value)) {
+			continue
+		}
+		if i, exists := idx[c.Timestamp]; exists {
+			if math.IsNaN(float64(datas[i].Value)) {
+				datas[i] = c
+			}
+		} else if c.Timestamp > lastTs {
+			datas = append(datas, c)
+		}
+	}
+	return datas
+}
+
 //从内存索引、MySQL中删除counter，并从磁盘上删除对应rrd文件
 func (this *Graph) Delete(params []*cmodel.GraphDeleteParam, resp *cmodel.GraphDeleteResp) error {
 	resp = &cmodel.GraphDeleteResp{}
@@ -0,0 +1,49 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	cmodel "github.com/open-falcon/falcon-plus/common/model"
+	"github.com/open-falcon/falcon-plus/modules/graph/g"
+)
+
+func TestMergeConsolidated(t *testing.T) {
+	nan := cmodel.JsonFloat(math.NaN())
+	// 归档中最后一个点还没有数据
+	datas := []*cmodel.RRDData{
+		{Timestamp: 300, Value: 1},
+		{Timestamp: 600, Value: 2},
+		{Timestamp: 900, Value: nan},
+	}
+	items := []*cmodel.GraphItem{}
+	for ts := int64(540); ts <= 1380; ts += 60 {
+		items = append(items, &cmodel.GraphItem{Timestamp: ts, Value: float64(ts / 60)})
+	}
+	cache := cachedRRDData(items, g.GAUGE, 60, 0, 1500)
+
+	got := []string{}
+	for _, d := range mergeConsolidated(datas, cache, "AVERAGE", 0, 1500, 300) {
+		got = append(got, fmt.Sprintf("%d:%v", d.Timestamp, d.Value))
+	}
+	// 已经有数据的点不覆盖, 900的点由(600, 900]的缓存数据合并, 之后的点追加到末尾
+	expected := "[300:1 600:2 900:13 1200:18 1500:22]"
+	if fmt.Sprint(got) != expected {
+		t.Errorf("merged = %v, expected %s", got, expected)
+	}
+}
@@ -12,17 +12,18 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-package sender
+package api
 
 import (
-	cutils "github.com/open-falcon/falcon-plus/common/utils"
-	"github.com/open-falcon/falcon-plus/modules/transfer/g"
-	rings "github.com/toolkits/consistent/rings"
+	"github.com/open-falcon/falcon-plus/modules/graph/rrdtool"
 )
 
-func initNodeRings() {
-	cfg := g.Config()
-
-	JudgeNodeRing = rings.NewConsistentHashNodesRing(int32(cfg.Judge.Replicas), cutils.KeysOfMap(cfg.Judge.Cluster))
-	GraphNodeRing = rings.NewConsistentHashNodesRing(int32(cfg.Graph.Replicas), cutils.KeysOfMap(cfg.Graph.Cluster))
+// 扩容时由其他graph节点或者http接口调用, 只处理本节点
+func (this *Graph) Rebalance(req rrdtool.RebalanceRequest, resp *rrdtool.RebalanceStatus) error {
+	st, err := rrdtool.Rebalance(req.Action, req.Plan)
+	if err != nil {
+		return err
+	}
+	*resp = *st
+	return nil
 }
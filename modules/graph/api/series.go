@@ -0,0 +1,34 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	cmodel "github.com/open-falcon/falcon-plus/common/model"
+	"github.com/open-falcon/falcon-plus/modules/graph/index"
+	"github.com/open-falcon/falcon-plus/modules/graph/proc"
+)
+
+// 按label条件查询本节点上的series
+func (this *Graph) Series(param cmodel.GraphSeriesParam, resp *cmodel.GraphSeriesResp) (err error) {
+	proc.GraphSeriesCnt.Incr()
+	resp.Series, resp.Truncated, err = index.TagIndex.Series(param.Matchers, param.Limit)
+	return
+}
+
+func (this *Graph) Labels(param cmodel.GraphLabelParam, resp *cmodel.GraphLabelResp) (err error) {
+	proc.GraphSeriesCnt.Incr()
+	resp.Values, resp.Truncated, err = index.TagIndex.Labels(param.Name, param.Matchers, param.Limit)
+	return
+}
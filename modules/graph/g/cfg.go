@@ -16,6 +16,7 @@ package g
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
 	"sync/atomic"
 	"unsafe"
@@ -26,6 +27,7 @@ import (
 type File struct {
 	Filename string
 	Body     []byte
+	Md5      string // Body的md5, 用于迁移时校验
 }
 
 type HttpConfig struct {
@@ -39,7 +41,9 @@ type RpcConfig struct {
 }
 
 type RRDConfig struct {
-	Storage string `json:"storage"`
+	Storage         string `json:"storage"`
+	Engine          string `json:"engine"`          //rrd或者tsdb, 默认为rrd
+	CompactInterval int    `json:"compactInterval"` //tsdb合并数据文件的周期, 单位秒
 }
 
 type DBConfig struct {
@@ -47,6 +51,26 @@ type DBConfig struct {
 	MaxIdle int    `json:"maxIdle"`
 }
 
+type RebalanceConfig struct {
+	Concurrency int `json:"concurrency"` //并发拷贝的rrd文件数
+	RateLimit   int `json:"rateLimit"`   //单位KB/s, 0表示不限速
+}
+
+// 归档策略: 每个点包含steps个step, 存rows个点, 对cf中的每个函数各存一份
+type RRAConfig struct {
+	CF    []string `json:"cf"`
+	Steps int      `json:"steps"`
+	Rows  int      `json:"rows"`
+}
+
+// 按metric和tags匹配的归档策略, 按顺序匹配第一个, 都不匹配时使用默认策略
+type RetentionPolicy struct {
+	Name   string            `json:"name"`
+	Metric string            `json:"metric"` //正则, 需要完整匹配, 为空表示匹配所有metric
+	Tags   map[string]string `json:"tags"`   //tag的值为正则, 需要完整匹配
+	RRA    []*RRAConfig      `json:"rra"`
+}
+
 type GlobalConfig struct {
 	Pid         string      `json:"pid"`
 	Debug       bool        `json:"debug"`
@@ -61,17 +85,33 @@ type GlobalConfig struct {
 		Replicas    int               `json:"replicas"`
 		Cluster     map[string]string `json:"cluster"`
 	} `json:"migrate"`
+	Rebalance *RebalanceConfig   `json:"rebalance"`
+	Retention []*RetentionPolicy `json:"retention"`
 }
 
 var (
-	ConfigFile string
-	ptr        unsafe.Pointer
+	ConfigFile  string
+	ptr         unsafe.Pointer
+	rebalancing int32
 )
 
 func Config() *GlobalConfig {
 	return (*GlobalConfig)(atomic.LoadPointer(&ptr))
 }
 
+// 手动配置了migrate或者正在rebalance时, 本地没有rrd文件的counter从原来的节点获取
+func Migrating() bool {
+	return Config().Migrate.Enabled || atomic.LoadInt32(&rebalancing) == 1
+}
+
+func SetRebalancing(on bool) {
+	if on {
+		atomic.StoreInt32(&rebalancing, 1)
+	} else {
+		atomic.StoreInt32(&rebalancing, 0)
+	}
+}
+
 func ParseConfig(cfg string) {
 	if cfg == "" {
 		log.Fatalln("config file not specified: use -c $filename")
@@ -83,23 +123,62 @@ func ParseConfig(cfg string) {
 
 	ConfigFile = cfg
 
+	c, err := loadConfig(cfg)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	// set config
+	atomic.StorePointer(&ptr, unsafe.Pointer(c))
+
+	log.Println("g.ParseConfig ok, file", cfg)
+}
+
+// 重新读取配置文件, check返回错误时保留原来的配置
+func ReloadConfig(check func(*GlobalConfig) error) error {
+	c, err := loadConfig(ConfigFile)
+	if err != nil {
+		return err
+	}
+	if err := check(c); err != nil {
+		return err
+	}
+	atomic.StorePointer(&ptr, unsafe.Pointer(c))
+	log.Println("g.ReloadConfig ok, file", ConfigFile)
+	return nil
+}
+
+func loadConfig(cfg string) (*GlobalConfig, error) {
 	configContent, err := file.ToTrimString(cfg)
 	if err != nil {
-		log.Fatalln("read config file", cfg, "error:", err.Error())
+		return nil, fmt.Errorf("read config file %s error: %v", cfg, err)
 	}
 
 	var c GlobalConfig
 	err = json.Unmarshal([]byte(configContent), &c)
 	if err != nil {
-		log.Fatalln("parse config file", cfg, "error:", err.Error())
+		return nil, fmt.Errorf("parse config file %s error: %v", cfg, err)
 	}
 
 	if c.Migrate.Enabled && len(c.Migrate.Cluster) == 0 {
 		c.Migrate.Enabled = false
 	}
 
-	// set config
-	atomic.StorePointer(&ptr, unsafe.Pointer(&c))
+	if c.RRD.Engine == "" {
+		c.RRD.Engine = "rrd"
+	}
+	if c.RRD.Engine != "rrd" && c.RRD.Engine != "tsdb" {
+		return nil, fmt.Errorf("parse config file %s error: unknown rrd engine %s", cfg, c.RRD.Engine)
+	}
+	if c.RRD.CompactInterval <= 0 {
+		c.RRD.CompactInterval = 3600
+	}
 
-	log.Println("g.ParseConfig ok, file", cfg)
+	if c.Rebalance == nil {
+		c.Rebalance = &RebalanceConfig{}
+	}
+	if c.Rebalance.Concurrency <= 0 {
+		c.Rebalance.Concurrency = 2
+	}
+	return &c, nil
 }
@@ -16,6 +16,7 @@ package g
 
 import (
 	"fmt"
+	"os"
 	"strconv"
 	"strings"
 	"unicode"
@@ -29,10 +30,11 @@ func RrdFileName(baseDir string, md5 string, dsType string, step int) string {
 	return fmt.Sprintf("%s/%s/%s_%s_%d.rrd", baseDir, md5[0:2], md5, dsType, step)
 }
 
-// rrd文件是否存在
-func IsRrdFileExist(filename string) bool {
-	return file.IsExist(filename)
-}
+// rrd文件是否存在和删除rrd文件, 使用其他存储引擎时由rrdtool.Start替换
+var (
+	IsRrdFileExist = file.IsExist
+	RemoveRrdFile  = os.Remove
+)
 
 // 生成rrd缓存数据的key
 func FormRrdCacheKey(md5 string, dsType string, step int) string {
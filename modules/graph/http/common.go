@@ -16,6 +16,7 @@ package http
 
 import (
 	"github.com/open-falcon/falcon-plus/modules/graph/g"
+	"github.com/open-falcon/falcon-plus/modules/graph/rrdtool"
 	"github.com/open-falcon/falcon-plus/modules/graph/store"
 	"github.com/toolkits/file"
 
@@ -47,7 +48,14 @@ func configCommonRoutes() {
 	})
 
 	router.POST("/api/v2/config/reload", func(c *gin.Context) {
-		g.ParseConfig(g.ConfigFile)
+		// 归档策略有错误时不替换配置
+		err := g.ReloadConfig(func(cfg *g.GlobalConfig) error {
+			return rrdtool.LoadRetention(cfg.Retention)
+		})
+		if err != nil {
+			JSONR(c, 400, gin.H{"msg": "config not reloaded: " + err.Error()})
+			return
+		}
 		JSONR(c, 200, gin.H{"msg": "ok"})
 	})
 
@@ -40,6 +40,9 @@ func init() {
 	configCommonRoutes()
 	configProcRoutes()
 	configIndexRoutes()
+	configRebalanceRoutes()
+	configRetentionRoutes()
+	configSeriesRoutes()
 	Close_chan = make(chan int, 1)
 	Close_done_chan = make(chan int, 1)
 
@@ -0,0 +1,62 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/open-falcon/falcon-plus/modules/graph/rrdtool"
+)
+
+// 扩容迁移, fanout=1时发送给新集群中的所有节点
+func configRebalanceRoutes() {
+	router.POST("/api/v2/rebalance/start", func(c *gin.Context) {
+		plan := &rrdtool.RebalancePlan{}
+		if err := c.BindJSON(plan); err != nil {
+			JSONR(c, 400, err)
+			return
+		}
+		rebalanceResp(c, "start", plan)
+	})
+
+	for _, action := range []string{"pause", "resume", "stop"} {
+		action := action
+		router.POST("/api/v2/rebalance/"+action, func(c *gin.Context) {
+			rebalanceResp(c, action, nil)
+		})
+	}
+
+	router.GET("/api/v2/rebalance/status", func(c *gin.Context) {
+		rebalanceResp(c, "status", nil)
+	})
+}
+
+func rebalanceResp(c *gin.Context, action string, plan *rrdtool.RebalancePlan) {
+	if c.Query("fanout") == "1" {
+		ret, err := rrdtool.FanoutRebalance(action, plan)
+		if err != nil {
+			JSONR(c, 400, err)
+			return
+		}
+		JSONR(c, 200, ret)
+		return
+	}
+
+	st, err := rrdtool.Rebalance(action, plan)
+	if err != nil {
+		JSONR(c, 400, err)
+		return
+	}
+	JSONR(c, 200, st)
+}
@@ -0,0 +1,66 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/open-falcon/falcon-plus/modules/graph/g"
+	"github.com/open-falcon/falcon-plus/modules/graph/rrdtool"
+)
+
+func configRetentionRoutes() {
+	// 不指定counter时返回所有的归档策略
+	router.GET("/api/v2/retention", func(c *gin.Context) {
+		endpoint, counter := c.Query("endpoint"), c.Query("counter")
+		if endpoint == "" || counter == "" {
+			JSONR(c, 200, gin.H{"default": rrdtool.DefaultRRA, "policies": g.Config().Retention})
+			return
+		}
+		ret, err := rrdtool.RetentionInfo(endpoint, counter)
+		if err != nil {
+			JSONR(c, 400, err)
+			return
+		}
+		JSONR(c, 200, ret)
+	})
+
+	// 把已有的rrd文件转换成当前的归档策略
+	router.POST("/api/v2/retention/relayout", func(c *gin.Context) {
+		req := &rrdtool.RelayoutRequest{}
+		if err := c.BindJSON(req); err != nil {
+			JSONR(c, 400, err)
+			return
+		}
+		st, err := rrdtool.Relayout(req)
+		if err != nil {
+			JSONR(c, 400, err)
+			return
+		}
+		JSONR(c, 200, st)
+	})
+
+	router.GET("/api/v2/retention/relayout", func(c *gin.Context) {
+		JSONR(c, 200, rrdtool.GetRelayoutStatus())
+	})
+
+	router.POST("/api/v2/retention/relayout/stop", func(c *gin.Context) {
+		st, err := rrdtool.StopRelayout()
+		if err != nil {
+			JSONR(c, 400, err)
+			return
+		}
+		JSONR(c, 200, st)
+	})
+}
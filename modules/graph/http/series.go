@@ -0,0 +1,71 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	cmodel "github.com/open-falcon/falcon-plus/common/model"
+	"github.com/open-falcon/falcon-plus/modules/graph/index"
+)
+
+// parseMatchers 每个match参数是一个条件, 例如 match=metric=cpu.idle&match=service=~"web|api"
+func parseMatchers(c *gin.Context) ([]*cmodel.GraphMatcher, int, error) {
+	matchers := []*cmodel.GraphMatcher{}
+	for _, s := range c.QueryArray("match") {
+		m, err := cmodel.ParseGraphMatcher(s)
+		if err != nil {
+			return nil, 0, err
+		}
+		matchers = append(matchers, m)
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "0"))
+	if err != nil {
+		return nil, 0, err
+	}
+	return matchers, limit, nil
+}
+
+func configSeriesRoutes() {
+	router.GET("/api/v2/series", func(c *gin.Context) {
+		matchers, limit, err := parseMatchers(c)
+		if err != nil {
+			JSONR(c, 400, err)
+			return
+		}
+		series, truncated, err := index.TagIndex.Series(matchers, limit)
+		if err != nil {
+			JSONR(c, 400, err)
+			return
+		}
+		JSONR(c, 200, cmodel.GraphSeriesResp{Series: series, Truncated: truncated})
+	})
+
+	// 不指定name时返回label名
+	router.GET("/api/v2/labels", func(c *gin.Context) {
+		matchers, limit, err := parseMatchers(c)
+		if err != nil {
+			JSONR(c, 400, err)
+			return
+		}
+		values, truncated, err := index.TagIndex.Labels(c.Query("name"), matchers, limit)
+		if err != nil {
+			JSONR(c, 400, err)
+			return
+		}
+		JSONR(c, 200, cmodel.GraphLabelResp{Values: values, Truncated: truncated})
+	})
+}
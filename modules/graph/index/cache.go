@@ -155,6 +155,7 @@ func startCacheProcUpdateTask() {
 		proc.UnIndexedItemCacheCnt.SetCnt(int64(unIndexedItemCache.Size()))
 		proc.EndpointCacheCnt.SetCnt(int64(dbEndpointCache.Size()))
 		proc.CounterCacheCnt.SetCnt(int64(dbEndpointCounterCache.Size()))
+		proc.TagIndexSeriesCnt.SetCnt(int64(TagIndex.Size()))
 	}
 }
 
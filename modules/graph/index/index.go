@@ -20,12 +20,12 @@ import (
 	cmodel "github.com/open-falcon/falcon-plus/common/model"
 	"github.com/open-falcon/falcon-plus/modules/graph/g"
 	"github.com/open-falcon/falcon-plus/modules/graph/store"
-	"github.com/toolkits/file"
 )
 
 // 初始化索引功能模块
 func Start() {
 	InitCache()
+	go loadTagIndex()
 	go StartIndexUpdateIncrTask()
 	log.Debug("index.Start ok")
 }
@@ -36,6 +36,8 @@ func ReceiveItem(item *cmodel.GraphItem, md5 string) {
 		return
 	}
 
+	TagIndex.Add(md5, item)
+
 	uuid := item.UUID()
 
 	// 已上报过的数据
@@ -65,6 +67,7 @@ func RemoveItem(item *cmodel.GraphItem) {
 	md5 := item.Checksum()
 	IndexedItemCache.Remove(md5)
 	unIndexedItemCache.Remove(md5)
+	TagIndex.Remove(md5)
 
 	//discard data of memory
 	checksum := item.Checksum()
@@ -73,6 +76,6 @@ func RemoveItem(item *cmodel.GraphItem) {
 	log.Debugf("discard data of item:%v, size:%d", item, len(poped_items))
 
 	rrdFileName := g.RrdFileName(g.Config().RRD.Storage, md5, item.DsType, item.Step)
-	file.Remove(rrdFileName)
+	g.RemoveRrdFile(rrdFileName)
 	log.Debug("remove rrdfile:", rrdFileName)
 }
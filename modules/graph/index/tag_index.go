@@ -0,0 +1,450 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package index
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+
+	cmodel "github.com/open-falcon/falcon-plus/common/model"
+	cutils "github.com/open-falcon/falcon-plus/common/utils"
+	"github.com/open-falcon/falcon-plus/modules/graph/g"
+)
+
+// 内存中的倒排索引, label(endpoint、metric、tag的key) -> value -> series id列表
+var TagIndex = NewTagIndexBase()
+
+type tagSeries struct {
+	endpoint string
+	counter  string
+	metric   string
+	tags     map[string]string
+	dsType   string
+	step     int
+}
+
+func (this *tagSeries) label(name string) string {
+	switch name {
+	case "endpoint":
+		return this.endpoint
+	case "metric":
+		return this.metric
+	}
+	return this.tags[name]
+}
+
+func (this *tagSeries) labels() map[string]string {
+	labels := map[string]string{"endpoint": this.endpoint, "metric": this.metric}
+	for k, v := range this.tags {
+		if k != "endpoint" && k != "metric" {
+			labels[k] = v
+		}
+	}
+	return labels
+}
+
+type TagIndexBase struct {
+	sync.RWMutex
+	nextID uint32
+	ids    map[string]uint32
+	series map[uint32]*tagSeries
+	// 每个列表按id升序, id只增不减, 新的series直接追加到末尾
+	postings map[string]map[string][]uint32
+}
+
+func NewTagIndexBase() *TagIndexBase {
+	return &TagIndexBase{
+		ids:      make(map[string]uint32),
+		series:   make(map[uint32]*tagSeries),
+		postings: make(map[string]map[string][]uint32),
+	}
+}
+
+// Add 每条上报的数据都会调用, 已经存在并且dsType、step没有变化时只加读锁
+func (this *TagIndexBase) Add(md5 string, item *cmodel.GraphItem) {
+	this.RLock()
+	id, found := this.ids[md5]
+	unchanged := found && this.series[id].dsType == item.DsType && this.series[id].step == item.Step
+	this.RUnlock()
+	if unchanged {
+		return
+	}
+
+	this.Lock()
+	defer this.Unlock()
+	if id, found := this.ids[md5]; found {
+		s := this.series[id]
+		s.dsType, s.step = item.DsType, item.Step
+		return
+	}
+	tags := make(map[string]string, len(item.Tags))
+	for k, v := range item.Tags {
+		tags[k] = v
+	}
+	s := &tagSeries{
+		endpoint: item.Endpoint,
+		counter:  cutils.Counter(item.Metric, item.Tags),
+		metric:   item.Metric,
+		tags:     tags,
+		dsType:   item.DsType,
+		step:     item.Step,
+	}
+	this.nextID++
+	id = this.nextID
+	this.ids[md5] = id
+	this.series[id] = s
+	for k, v := range s.labels() {
+		values, ok := this.postings[k]
+		if !ok {
+			values = make(map[string][]uint32)
+			this.postings[k] = values
+		}
+		values[v] = append(values[v], id)
+	}
+}
+
+func (this *TagIndexBase) Remove(md5 string) {
+	this.Lock()
+	defer this.Unlock()
+	id, found := this.ids[md5]
+	if !found {
+		return
+	}
+	s := this.series[id]
+	delete(this.ids, md5)
+	delete(this.series, id)
+	for k, v := range s.labels() {
+		values := this.postings[k]
+		list := values[v]
+		i := sort.Search(len(list), func(i int) bool { return list[i] >= id })
+		if i < len(list) && list[i] == id {
+			list = append(list[:i], list[i+1:]...)
+		}
+		if len(list) == 0 {
+			delete(values, v)
+			if len(values) == 0 {
+				delete(this.postings, k)
+			}
+		} else {
+			values[v] = list
+		}
+	}
+}
+
+func (this *TagIndexBase) Size() int {
+	this.RLock()
+	defer this.RUnlock()
+	return len(this.series)
+}
+
+type tagMatcher struct {
+	*cmodel.GraphMatcher
+	re *regexp.Regexp
+}
+
+func (this *tagMatcher) matches(v string) bool {
+	switch this.Op {
+	case "=":
+		return v == this.Value
+	case "!=":
+		return v != this.Value
+	case "=~":
+		return this.re.MatchString(v)
+	case "!~":
+		return !this.re.MatchString(v)
+	}
+	return false
+}
+
+// compileMatchers 不存在的label当作空字符串, 至少需要一个不匹配空字符串的条件, 避免遍历所有series
+func compileMatchers(matchers []*cmodel.GraphMatcher) ([]*tagMatcher, error) {
+	result := make([]*tagMatcher, 0, len(matchers))
+	selective := false
+	for _, m := range matchers {
+		tm := &tagMatcher{GraphMatcher: m}
+		switch m.Op {
+		case "=", "!=":
+		case "=~", "!~":
+			re, err := regexp.Compile("^(?:" + m.Value + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("bad regexp %q: %v", m.Value, err)
+			}
+			tm.re = re
+		default:
+			return nil, fmt.Errorf("unknown match operator %q", m.Op)
+		}
+		if !tm.matches("") {
+			selective = true
+		}
+		result = append(result, tm)
+	}
+	if !selective {
+		return nil, fmt.Errorf("at least one matcher must not match empty string")
+	}
+	return result, nil
+}
+
+// lookup 返回满足条件的series id, 需要持有读锁
+func (this *TagIndexBase) lookup(matchers []*tagMatcher) []uint32 {
+	var (
+		result []uint32
+		first  = true
+	)
+	// 先求不匹配空字符串的条件的交集, 再从中排除其他条件不满足的
+	for _, m := range matchers {
+		if m.matches("") {
+			continue
+		}
+		var ids []uint32
+		values := this.postings[m.Name]
+		if m.Op == "=" {
+			ids = values[m.Value]
+		} else {
+			lists := [][]uint32{}
+			for v, list := range values {
+				if m.matches(v) {
+					lists = append(lists, list)
+				}
+			}
+			ids = unionPostings(lists)
+		}
+		if first {
+			result = ids
+			first = false
+		} else {
+			result = intersectPostings(result, ids)
+		}
+		if len(result) == 0 {
+			return nil
+		}
+	}
+	for _, m := range matchers {
+		if !m.matches("") {
+			continue
+		}
+		lists := [][]uint32{}
+		for v, list := range this.postings[m.Name] {
+			if !m.matches(v) {
+				lists = append(lists, list)
+			}
+		}
+		result = subtractPostings(result, unionPostings(lists))
+	}
+	return result
+}
+
+// Series 查询满足条件的series, 按endpoint、counter排序, 超过limit时截断
+func (this *TagIndexBase) Series(matchers []*cmodel.GraphMatcher, limit int) ([]*cmodel.GraphSeries, bool, error) {
+	tms, err := compileMatchers(matchers)
+	if err != nil {
+		return nil, false, err
+	}
+	this.RLock()
+	ids := this.lookup(tms)
+	result := make([]*cmodel.GraphSeries, 0, len(ids))
+	for _, id := range ids {
+		s := this.series[id]
+		tags := make(map[string]string, len(s.tags))
+		for k, v := range s.tags {
+			tags[k] = v
+		}
+		result = append(result, &cmodel.GraphSeries{
+			Endpoint: s.endpoint,
+			Counter:  s.counter,
+			Metric:   s.metric,
+			Tags:     tags,
+			DsType:   s.dsType,
+			Step:     s.step,
+		})
+	}
+	this.RUnlock()
+
+	sort.Sort(cmodel.GraphSeriesSlice(result))
+	truncated := false
+	if limit > 0 && len(result) > limit {
+		result, truncated = result[:limit], true
+	}
+	return result, truncated, nil
+}
+
+// Labels name为空时返回label名, 否则返回这个label的所有取值; 没有条件时不需要遍历series
+func (this *TagIndexBase) Labels(name string, matchers []*cmodel.GraphMatcher, limit int) ([]string, bool, error) {
+	var tms []*tagMatcher
+	if len(matchers) > 0 {
+		var err error
+		if tms, err = compileMatchers(matchers); err != nil {
+			return nil, false, err
+		}
+	}
+
+	set := map[string]bool{}
+	this.RLock()
+	if tms == nil {
+		if name == "" {
+			for k := range this.postings {
+				set[k] = true
+			}
+		} else {
+			for v := range this.postings[name] {
+				set[v] = true
+			}
+		}
+	} else {
+		for _, id := range this.lookup(tms) {
+			s := this.series[id]
+			if name == "" {
+				for k := range s.labels() {
+					set[k] = true
+				}
+			} else if v := s.label(name); v != "" {
+				set[v] = true
+			}
+		}
+	}
+	this.RUnlock()
+
+	result := make([]string, 0, len(set))
+	for v := range set {
+		result = append(result, v)
+	}
+	sort.Strings(result)
+	truncated := false
+	if limit > 0 && len(result) > limit {
+		result, truncated = result[:limit], true
+	}
+	return result, truncated, nil
+}
+
+func intersectPostings(a, b []uint32) []uint32 {
+	result := []uint32{}
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			result = append(result, a[i])
+			i++
+			j++
+		}
+	}
+	return result
+}
+
+func subtractPostings(a, b []uint32) []uint32 {
+	if len(b) == 0 {
+		return a
+	}
+	result := []uint32{}
+	j := 0
+	for _, id := range a {
+		for j < len(b) && b[j] < id {
+			j++
+		}
+		if j < len(b) && b[j] == id {
+			continue
+		}
+		result = append(result, id)
+	}
+	return result
+}
+
+type postingList []uint32
+
+func (this postingList) Len() int           { return len(this) }
+func (this postingList) Swap(i, j int)      { this[i], this[j] = this[j], this[i] }
+func (this postingList) Less(i, j int) bool { return this[i] < this[j] }
+
+func unionPostings(lists [][]uint32) []uint32 {
+	switch len(lists) {
+	case 0:
+		return nil
+	case 1:
+		return lists[0]
+	}
+	n := 0
+	for _, l := range lists {
+		n += len(l)
+	}
+	result := make([]uint32, 0, n)
+	for _, l := range lists {
+		result = append(result, l...)
+	}
+	sort.Sort(postingList(result))
+	// 同一个label的不同取值之间没有重复的id, 这里只是以防万一
+	k := 0
+	for i, id := range result {
+		if i == 0 || id != result[k-1] {
+			result[k] = id
+			k++
+		}
+	}
+	return result[:k]
+}
+
+const tagIndexLoadBatch = 10000
+
+// loadTagIndex 启动时从endpoint_counter表加载本节点上已经有数据文件的counter, 之后由上报的数据增量更新
+func loadTagIndex() {
+	var (
+		cursor int64
+		loaded int
+	)
+	storage := g.Config().RRD.Storage
+	for {
+		rows, err := g.DB.Query(`SELECT a.id, b.endpoint, a.counter, a.type, a.step FROM endpoint_counter a
+			JOIN endpoint b ON a.endpoint_id = b.id WHERE a.id > ? ORDER BY a.id LIMIT ?`, cursor, tagIndexLoadBatch)
+		if err != nil {
+			log.Errorf("load tag index fail, cursor:%d, error:%v", cursor, err)
+			return
+		}
+		n := 0
+		for rows.Next() {
+			var (
+				endpoint, counter, dsType string
+				step                      int
+			)
+			if err := rows.Scan(&cursor, &endpoint, &counter, &dsType, &step); err != nil {
+				log.Errorf("load tag index fail, cursor:%d, error:%v", cursor, err)
+				break
+			}
+			n++
+			item := &cmodel.GraphItem{Endpoint: endpoint, DsType: dsType, Step: step}
+			fields := strings.SplitN(counter, "/", 2)
+			item.Metric = fields[0]
+			if len(fields) == 2 {
+				if err, item.Tags = cutils.SplitTagsString(fields[1]); err != nil {
+					continue
+				}
+			}
+			md5 := item.Checksum()
+			if g.IsRrdFileExist(g.RrdFileName(storage, md5, dsType, step)) {
+				TagIndex.Add(md5, item)
+				loaded++
+			}
+		}
+		rows.Close()
+		if n < tagIndexLoadBatch {
+			break
+		}
+	}
+	log.Infof("load tag index done, %d series", loaded)
+}
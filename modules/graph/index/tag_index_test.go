@@ -0,0 +1,102 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package index
+
+import (
+	"reflect"
+	"testing"
+
+	cmodel "github.com/open-falcon/falcon-plus/common/model"
+)
+
+func TestTagIndex(t *testing.T) {
+	idx := NewTagIndexBase()
+	items := []*cmodel.GraphItem{
+		{Endpoint: "web1", Metric: "cpu.idle", DsType: "GAUGE", Step: 60},
+		{Endpoint: "web2", Metric: "cpu.idle", DsType: "GAUGE", Step: 60},
+		{Endpoint: "web1", Metric: "qps", Tags: map[string]string{"service": "payment", "api": "/pay"}, DsType: "GAUGE", Step: 60},
+		{Endpoint: "web2", Metric: "qps", Tags: map[string]string{"service": "payment", "api": "/refund"}, DsType: "GAUGE", Step: 60},
+		{Endpoint: "db1", Metric: "qps", Tags: map[string]string{"service": "order"}, DsType: "COUNTER", Step: 30},
+		{Endpoint: "db1", Metric: "disk.used", DsType: "GAUGE", Step: 60},
+	}
+	for _, item := range items {
+		idx.Add(item.Checksum(), item)
+		idx.Add(item.Checksum(), item)
+	}
+	if idx.Size() != len(items) {
+		t.Fatalf("size %d, want %d", idx.Size(), len(items))
+	}
+
+	m := func(s string) *cmodel.GraphMatcher {
+		r, err := cmodel.ParseGraphMatcher(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+	tests := []struct {
+		matchers []*cmodel.GraphMatcher
+		want     []string
+	}{
+		{[]*cmodel.GraphMatcher{m("service=payment")}, []string{"web1/qps/api=/pay,service=payment", "web2/qps/api=/refund,service=payment"}},
+		{[]*cmodel.GraphMatcher{m("metric=qps"), m("service!=payment")}, []string{"db1/qps/service=order"}},
+		{[]*cmodel.GraphMatcher{m(`endpoint=~"web.*"`), m("metric=cpu.idle")}, []string{"web1/cpu.idle", "web2/cpu.idle"}},
+		{[]*cmodel.GraphMatcher{m("metric=~qps|disk.used"), m(`api!~"/re.*"`)}, []string{"db1/disk.used", "db1/qps/service=order", "web1/qps/api=/pay,service=payment"}},
+		{[]*cmodel.GraphMatcher{m("metric=qps"), m("service=~.+"), m("endpoint!=web1")}, []string{"db1/qps/service=order", "web2/qps/api=/refund,service=payment"}},
+		{[]*cmodel.GraphMatcher{m("metric=qps"), m("service=")}, []string{}},
+		{[]*cmodel.GraphMatcher{m("metric=none")}, []string{}},
+	}
+	for _, tt := range tests {
+		series, _, err := idx.Series(tt.matchers, 0)
+		if err != nil {
+			t.Errorf("Series(%v) error: %v", tt.matchers, err)
+			continue
+		}
+		got := []string{}
+		for _, s := range series {
+			got = append(got, s.Endpoint+"/"+s.Counter)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Series(%v) = %v, want %v", tt.matchers, got, tt.want)
+		}
+	}
+
+	if _, _, err := idx.Series([]*cmodel.GraphMatcher{m("service!=payment")}, 0); err == nil {
+		t.Errorf("matchers matching empty string should fail")
+	}
+	if series, truncated, _ := idx.Series([]*cmodel.GraphMatcher{m("metric=qps")}, 2); len(series) != 2 || !truncated {
+		t.Errorf("limit not applied: %d %v", len(series), truncated)
+	}
+
+	labels, _, _ := idx.Labels("", nil, 0)
+	if want := []string{"api", "endpoint", "metric", "service"}; !reflect.DeepEqual(labels, want) {
+		t.Errorf("Labels() = %v, want %v", labels, want)
+	}
+	values, _, _ := idx.Labels("endpoint", []*cmodel.GraphMatcher{m("service=~pay.*")}, 0)
+	if want := []string{"web1", "web2"}; !reflect.DeepEqual(values, want) {
+		t.Errorf("Labels(endpoint) = %v, want %v", values, want)
+	}
+
+	for _, item := range items[2:5] {
+		idx.Remove(item.Checksum())
+	}
+	labels, _, _ = idx.Labels("", nil, 0)
+	if want := []string{"endpoint", "metric"}; !reflect.DeepEqual(labels, want) {
+		t.Errorf("Labels() after remove = %v, want %v", labels, want)
+	}
+	if series, _, _ := idx.Series([]*cmodel.GraphMatcher{m("endpoint=db1")}, 0); len(series) != 1 || series[0].Counter != "disk.used" {
+		t.Errorf("Series(endpoint=db1) after remove = %v", series)
+	}
+}
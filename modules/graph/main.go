@@ -69,6 +69,7 @@ func main() {
 	cfg := flag.String("c", "cfg.json", "specify config file")
 	version := flag.Bool("v", false, "show version")
 	versionGit := flag.Bool("vg", false, "show version and git commit log")
+	convert := flag.Bool("convert", false, "import rrd files into tsdb storage and exit")
 	flag.Parse()
 
 	if *version {
@@ -90,6 +91,13 @@ func main() {
 		gin.SetMode(gin.ReleaseMode)
 	}
 
+	if *convert {
+		if err := rrdtool.ConvertToTsdb(); err != nil {
+			log.Fatalln("convert fail:", err)
+		}
+		os.Exit(0)
+	}
+
 	// init db
 	g.InitDB()
 	// rrdtool before api for disable loopback connection
@@ -48,6 +48,7 @@ var (
 	UnIndexedItemCacheCnt = nproc.NewSCounterBase("UnIndexedItemCacheCnt")
 	EndpointCacheCnt      = nproc.NewSCounterBase("EndpointCacheCnt")
 	CounterCacheCnt       = nproc.NewSCounterBase("CounterCacheCnt")
+	TagIndexSeriesCnt     = nproc.NewSCounterBase("TagIndexSeriesCnt")
 )
 
 // Rpc
@@ -63,6 +64,7 @@ var (
 	GraphLastCnt      = nproc.NewSCounterQps("GraphLastCnt")
 	GraphLastRawCnt   = nproc.NewSCounterQps("GraphLastRawCnt")
 	GraphLoadDbCnt    = nproc.NewSCounterQps("GraphLoadDbCnt") // load sth from db when query/info, tmp
+	GraphSeriesCnt    = nproc.NewSCounterQps("GraphSeriesCnt")
 )
 
 func GetAll() []interface{} {
@@ -78,6 +80,7 @@ func GetAll() []interface{} {
 	ret = append(ret, GraphLastCnt.Get())
 	ret = append(ret, GraphLastRawCnt.Get())
 	ret = append(ret, GraphLoadDbCnt.Get())
+	ret = append(ret, GraphSeriesCnt.Get())
 
 	// index update all
 	ret = append(ret, IndexUpdateAll.Get())
@@ -104,6 +107,7 @@ func GetAll() []interface{} {
 	ret = append(ret, UnIndexedItemCacheCnt.Get())
 	ret = append(ret, EndpointCacheCnt.Get())
 	ret = append(ret, CounterCacheCnt.Get())
+	ret = append(ret, TagIndexSeriesCnt.Get())
 
 	return ret
 }
@@ -0,0 +1,147 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rrdtool
+
+import (
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/open-falcon/falcon-plus/modules/graph/g"
+	"github.com/open-falcon/falcon-plus/modules/graph/tsdb"
+)
+
+// 把rrd.storage下的rrd文件导入到tsdb, 需要在graph停止时执行.
+// 保留rrd文件原来的归档策略, tsdb中已经存在的counter跳过
+func ConvertToTsdb() error {
+	cfg := g.Config()
+	dir := tsdbDir(cfg.RRD.Storage)
+	db, err := tsdb.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var total, converted, failed int
+	err = filepath.Walk(cfg.RRD.Storage, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path == dir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(path, ".rrd") {
+			return nil
+		}
+
+		total++
+		if ok, err := convertFile(db, path); err != nil {
+			failed++
+			log.Printf("convert %s fail: %v", path, err)
+		} else if ok {
+			converted++
+		}
+		if total%10000 == 0 {
+			log.Printf("convert rrd files, total: %d, converted: %d, failed: %d", total, converted, failed)
+		}
+		return nil
+	})
+	log.Printf("convert done, total: %d, converted: %d, failed: %d", total, converted, failed)
+	return err
+}
+
+func convertFile(db *tsdb.DB, filename string) (bool, error) {
+	key := tsdbKey(filename)
+	if db.Exists(key) {
+		return false, nil
+	}
+	l, err := readLayout(filename)
+	if err != nil {
+		return false, err
+	}
+
+	step := int64(l.Step)
+	end := l.LastTs - l.LastTs%step
+	raw := []tsdb.Point{}
+	tiers := make(map[int][]tsdb.TierPoint)
+	for _, rra := range l.RRA {
+		res := int64(rra.Steps) * step
+		e := end - end%res
+		start := e - int64(rra.Rows)*res
+
+		// 没有对应cf的归档时使用归档中的第一个cf
+		values := make(map[string]map[int64]float64)
+		for _, cf := range []string{"AVERAGE", "MAX", "MIN", "LAST"} {
+			fcf := rra.CF[0]
+			for _, c := range rra.CF {
+				if c == cf {
+					fcf = c
+				}
+			}
+			datas, err := fetch(filename, fcf, start, e, int(res))
+			if err != nil {
+				return false, err
+			}
+			values[cf] = make(map[int64]float64)
+			for _, d := range datas {
+				if d.Timestamp%res == 0 && d.Timestamp <= e && !math.IsNaN(float64(d.Value)) {
+					values[cf][d.Timestamp] = float64(d.Value)
+				}
+			}
+		}
+
+		for ts := start + res; ts <= e; ts += res {
+			avg, ok := values["AVERAGE"][ts]
+			if !ok {
+				continue
+			}
+			if rra.Steps == 1 {
+				raw = append(raw, tsdb.Point{Ts: ts, Value: avg})
+				continue
+			}
+			tp := tsdb.TierPoint{Ts: ts, Avg: avg, Max: avg, Min: avg, Last: avg}
+			if v, ok := values["MAX"][ts]; ok {
+				tp.Max = v
+			}
+			if v, ok := values["MIN"][ts]; ok {
+				tp.Min = v
+			}
+			if v, ok := values["LAST"][ts]; ok {
+				tp.Last = v
+			}
+			tiers[rra.Steps] = append(tiers[rra.Steps], tp)
+		}
+	}
+
+	last, err := strconv.ParseFloat(l.LastDs, 64)
+	if err != nil {
+		last = math.NaN()
+	}
+	meta := &tsdb.Meta{
+		DsType:    l.DsType,
+		Step:      l.Step,
+		Heartbeat: l.Heartbeat,
+		Min:       l.Min,
+		Max:       l.Max,
+		Tiers:     tiersOf(l.RRA),
+	}
+	return true, db.Load(key, meta, raw, tiers, l.LastTs, last)
+}
@@ -21,6 +21,8 @@ import (
 	"net"
 	"net/rpc"
 	"os"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -61,14 +63,19 @@ const (
 	STAT_SIZE
 )
 
+// Consistent和Net_task_ch由migrateLock保护, rebalance开始时会按原来的集群重建
 var (
 	Consistent       *consistent.Consistent
 	Net_task_ch      map[string]chan *Net_task_t
-	clients          map[string][]*rpc.Client
+	clients          map[string][]*rpc.Client // addr -> clients
 	flushrrd_timeout int32
 	stat_cnt         [STAT_SIZE]uint64
+	migrateLock      = new(sync.RWMutex)
 )
 
+// addr -> 任务队列
+var addrTaskCh = make(map[string]chan *Net_task_t)
+
 func init() {
 	Consistent = consistent.New()
 	Net_task_ch = make(map[string]chan *Net_task_t)
@@ -104,26 +111,55 @@ func dial(address string, timeout time.Duration) (*rpc.Client, error) {
 }
 
 func migrate_start(cfg *g.GlobalConfig) {
-	var err error
-	var i int
 	if cfg.Migrate.Enabled {
-		Consistent.NumberOfReplicas = cfg.Migrate.Replicas
-
-		nodes := cutils.KeysOfMap(cfg.Migrate.Cluster)
-		for _, node := range nodes {
-			addr := cfg.Migrate.Cluster[node]
-			Consistent.Add(node)
-			Net_task_ch[node] = make(chan *Net_task_t, 16)
-			clients[node] = make([]*rpc.Client, cfg.Migrate.Concurrency)
-
-			for i = 0; i < cfg.Migrate.Concurrency; i++ {
-				if clients[node][i], err = dial(addr, time.Second); err != nil {
-					log.Fatalf("node:%s addr:%s err:%s\n", node, addr, err)
+		if err := setupMigrate(cfg.Migrate.Replicas, cfg.Migrate.Cluster, cfg.Migrate.Concurrency); err != nil {
+			log.Fatalln(err)
+		}
+	}
+}
+
+// 按原来的集群重建一致性哈希环, 同一个地址的worker在多次调用之间复用
+func setupMigrate(replicas int, cluster map[string]string, concurrency int) error {
+	migrateLock.Lock()
+	defer migrateLock.Unlock()
+
+	ring := consistent.New()
+	ring.NumberOfReplicas = replicas
+	taskCh := make(map[string]chan *Net_task_t)
+	for _, node := range cutils.KeysOfMap(cluster) {
+		addr := cluster[node]
+		ring.Add(node)
+		if _, exists := clients[addr]; !exists {
+			cs := make([]*rpc.Client, concurrency)
+			for i := 0; i < concurrency; i++ {
+				var err error
+				if cs[i], err = dial(addr, time.Second); err != nil {
+					return fmt.Errorf("node:%s addr:%s err:%s", node, addr, err)
 				}
-				go net_task_worker(i, Net_task_ch[node], &clients[node][i], addr)
 			}
+			ch := make(chan *Net_task_t, 16)
+			for i := range cs {
+				go net_task_worker(i, ch, &cs[i], addr)
+			}
+			clients[addr] = cs
+			addrTaskCh[addr] = ch
 		}
+		taskCh[node] = addrTaskCh[addr]
 	}
+	Consistent = ring
+	Net_task_ch = taskCh
+	return nil
+}
+
+// pk在原来的集群中所属节点的任务队列
+func MigrateTaskChan(pk string) (chan *Net_task_t, error) {
+	migrateLock.RLock()
+	defer migrateLock.RUnlock()
+	node, err := Consistent.Get(pk)
+	if err != nil {
+		return nil, err
+	}
+	return Net_task_ch[node], nil
 }
 
 func net_task_worker(idx int, ch chan *Net_task_t, client **rpc.Client, addr string) {
@@ -159,7 +195,7 @@ func net_task_worker(idx int, ch chan *Net_task_t, client **rpc.Client, addr str
 					}
 				} else {
 					if err = fetch_rrd(client, task.Key, addr); err != nil {
-						if os.IsNotExist(err) {
+						if isNotExist(err) {
 							pfc.Meter("migrate.scprrd.null", 1)
 							//文件不存在时，直接将缓存数据刷入本地
 							atomic.AddUint64(&stat_cnt[FETCH_S_ISNOTEXIST], 1)
@@ -185,6 +221,15 @@ func net_task_worker(idx int, ch chan *Net_task_t, client **rpc.Client, addr str
 	}
 }
 
+// 原节点上rrd文件不存在, rpc返回的错误不再是*os.PathError, 只能根据错误信息判断
+func isNotExist(err error) bool {
+	if os.IsNotExist(err) {
+		return true
+	}
+	_, ok := err.(rpc.ServerError)
+	return ok && strings.Contains(err.Error(), "no such file or directory")
+}
+
 // TODO addr to node
 func reconnection(client **rpc.Client, addr string) {
 	pfc.Meter("migrate.reconnection."+addr, 1)
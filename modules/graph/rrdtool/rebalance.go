@@ -0,0 +1,536 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rrdtool
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/rpc"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/toolkits/consistent"
+
+	cutils "github.com/open-falcon/falcon-plus/common/utils"
+	"github.com/open-falcon/falcon-plus/modules/graph/g"
+	"github.com/open-falcon/falcon-plus/modules/graph/store"
+)
+
+// graph集群扩容(或缩容)时的数据迁移:
+//  1. 每个节点遍历endpoint_counter表, 找出在新集群中属于本节点、在原集群中属于其他节点的counter,
+//     通过Graph.GetRrd从原节点拷贝rrd文件, 校验md5之后写入本地, 本地已经存在的文件跳过
+//  2. 迁移期间按原集群开启migrate, 新收到数据但本地还没有rrd文件的counter从原节点获取, 和原来的migrate相同
+//
+// 迁移进度定期保存在rrd.storage/rebalance.json中, 重启之后继续
+const (
+	REBALANCE_S_IDLE    = "idle"
+	REBALANCE_S_RUNNING = "running"
+	REBALANCE_S_PAUSED  = "paused"
+	REBALANCE_S_DONE    = "done"
+	REBALANCE_S_STOPPED = "stopped"
+
+	REBALANCE_PAGE_SIZE  = 1000
+	REBALANCE_MAX_ERRORS = 20
+)
+
+type RebalancePlan struct {
+	Self        string            `json:"self"` // 本节点在新集群中的名字, 同时发送给所有节点时自动填写
+	Replicas    int               `json:"replicas"`
+	OldCluster  map[string]string `json:"old_cluster"` // node -> rpc地址
+	NewCluster  map[string]string `json:"new_cluster"`
+	Concurrency int               `json:"concurrency"`
+	RateLimit   int               `json:"rate_limit"` // 单位KB/s
+}
+
+func (this *RebalancePlan) check() error {
+	if this.Replicas <= 0 {
+		return fmt.Errorf("replicas should be positive")
+	}
+	if len(this.OldCluster) == 0 || len(this.NewCluster) == 0 {
+		return fmt.Errorf("old_cluster and new_cluster are required")
+	}
+	if _, exists := this.NewCluster[this.Self]; !exists {
+		return fmt.Errorf("self %q is not in new_cluster", this.Self)
+	}
+	return nil
+}
+
+type RebalanceStatus struct {
+	State      string         `json:"state"`
+	Plan       *RebalancePlan `json:"plan"`
+	Total      int64          `json:"total"`  // endpoint_counter的总行数
+	Cursor     int64          `json:"cursor"` // 已经处理完的endpoint_counter.id
+	Scanned    int64          `json:"scanned"`
+	Moved      int64          `json:"moved"`   // 需要迁移到本节点的counter数
+	Copied     int64          `json:"copied"`  // 拷贝成功
+	Skipped    int64          `json:"skipped"` // 本地已经存在
+	Missing    int64          `json:"missing"` // 原节点上不存在
+	Failed     int64          `json:"failed"`
+	Bytes      int64          `json:"bytes"`
+	StartedAt  int64          `json:"started_at"`
+	UpdatedAt  int64          `json:"updated_at"`
+	FinishedAt int64          `json:"finished_at"`
+	Errors     []string       `json:"errors"` // 最近的错误
+}
+
+type RebalanceRequest struct {
+	Action string // start, pause, resume, stop, status
+	Plan   *RebalancePlan
+}
+
+var (
+	rebalanceLock   = new(sync.Mutex)
+	rebalanceStatus = &RebalanceStatus{State: REBALANCE_S_IDLE, Errors: []string{}}
+	rebalanceStop   chan struct{}
+)
+
+func rebalanceFile() string {
+	return filepath.Join(g.Config().RRD.Storage, "rebalance.json")
+}
+
+// 调用时持有rebalanceLock
+func saveRebalanceStatus() {
+	rebalanceStatus.UpdatedAt = time.Now().Unix()
+	bs, err := json.Marshal(rebalanceStatus)
+	if err == nil {
+		err = ioutil.WriteFile(rebalanceFile(), bs, 0644)
+	}
+	if err != nil {
+		log.Println("save rebalance status fail:", err)
+	}
+}
+
+func rebalanceError(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	log.Println("rebalance:", msg)
+	rebalanceStatus.Errors = append(rebalanceStatus.Errors, time.Now().Format("2006-01-02 15:04:05 ")+msg)
+	if len(rebalanceStatus.Errors) > REBALANCE_MAX_ERRORS {
+		rebalanceStatus.Errors = rebalanceStatus.Errors[1:]
+	}
+}
+
+// 启动时恢复没有完成的迁移
+func resumeRebalance() {
+	bs, err := ioutil.ReadFile(rebalanceFile())
+	if err != nil {
+		return
+	}
+	st := &RebalanceStatus{}
+	if err := json.Unmarshal(bs, st); err != nil {
+		log.Println("load rebalance status fail:", err)
+		return
+	}
+	if st.State != REBALANCE_S_RUNNING && st.State != REBALANCE_S_PAUSED {
+		rebalanceStatus = st
+		return
+	}
+	if err := startRebalance(st); err != nil {
+		log.Println("resume rebalance fail:", err)
+	}
+}
+
+func startRebalance(st *RebalanceStatus) error {
+	cfg := g.Config()
+	if cfg.Migrate.Enabled {
+		return fmt.Errorf("migrate is enabled in config")
+	}
+	plan := st.Plan
+	if plan.Concurrency <= 0 {
+		plan.Concurrency = cfg.Rebalance.Concurrency
+	}
+	if plan.RateLimit <= 0 {
+		plan.RateLimit = cfg.Rebalance.RateLimit
+	}
+	if err := setupMigrate(plan.Replicas, plan.OldCluster, plan.Concurrency); err != nil {
+		return err
+	}
+	g.SetRebalancing(true)
+
+	rebalanceStatus = st
+	rebalanceStop = make(chan struct{})
+	saveRebalanceStatus()
+	go runRebalance(plan, rebalanceStop)
+	log.Printf("rebalance %s, self: %s, cursor: %d", st.State, plan.Self, st.Cursor)
+	return nil
+}
+
+func Rebalance(action string, plan *RebalancePlan) (*RebalanceStatus, error) {
+	rebalanceLock.Lock()
+	defer rebalanceLock.Unlock()
+
+	state := rebalanceStatus.State
+	switch action {
+	case "start":
+		if state == REBALANCE_S_RUNNING || state == REBALANCE_S_PAUSED {
+			return nil, fmt.Errorf("rebalance is %s", state)
+		}
+		if plan == nil {
+			return nil, fmt.Errorf("plan is required")
+		}
+		if err := plan.check(); err != nil {
+			return nil, err
+		}
+		st := &RebalanceStatus{State: REBALANCE_S_RUNNING, Plan: plan, StartedAt: time.Now().Unix(), Errors: []string{}}
+		if err := g.DB.QueryRow("SELECT COUNT(*) FROM endpoint_counter").Scan(&st.Total); err != nil {
+			return nil, err
+		}
+		if err := startRebalance(st); err != nil {
+			return nil, err
+		}
+	case "pause":
+		if state != REBALANCE_S_RUNNING {
+			return nil, fmt.Errorf("rebalance is %s", state)
+		}
+		rebalanceStatus.State = REBALANCE_S_PAUSED
+		saveRebalanceStatus()
+	case "resume":
+		if state != REBALANCE_S_PAUSED {
+			return nil, fmt.Errorf("rebalance is %s", state)
+		}
+		rebalanceStatus.State = REBALANCE_S_RUNNING
+		saveRebalanceStatus()
+	case "stop":
+		if state != REBALANCE_S_RUNNING && state != REBALANCE_S_PAUSED {
+			return nil, fmt.Errorf("rebalance is %s", state)
+		}
+		close(rebalanceStop)
+		rebalanceStatus.State = REBALANCE_S_STOPPED
+		rebalanceStatus.FinishedAt = time.Now().Unix()
+		g.SetRebalancing(false)
+		saveRebalanceStatus()
+	case "status":
+	default:
+		return nil, fmt.Errorf("unknown action %s", action)
+	}
+
+	st := *rebalanceStatus
+	st.Errors = append([]string{}, rebalanceStatus.Errors...)
+	return &st, nil
+}
+
+// 返回pk在原集群中所属的节点, 不需要迁移到self时返回空字符串
+func movedFrom(oldRing, newRing *consistent.Consistent, self string, pk string) string {
+	if node, err := newRing.Get(pk); err != nil || node != self {
+		return ""
+	}
+	node, err := oldRing.Get(pk)
+	if err != nil || node == self {
+		return ""
+	}
+	return node
+}
+
+func newRing(replicas int, cluster map[string]string) *consistent.Consistent {
+	ring := consistent.New()
+	ring.NumberOfReplicas = replicas
+	for _, node := range cutils.KeysOfMap(cluster) {
+		ring.Add(node)
+	}
+	return ring
+}
+
+type counterRow struct {
+	id       int64
+	endpoint string
+	counter  string
+	dsType   string
+	step     int
+}
+
+// 按id分页读取endpoint_counter
+func queryCounters(cursor int64, limit int) ([]*counterRow, error) {
+	rows, err := g.DB.Query(`SELECT ec.id, e.endpoint, ec.counter, ec.type, ec.step FROM endpoint_counter ec
+		JOIN endpoint e ON ec.endpoint_id = e.id WHERE ec.id > ? ORDER BY ec.id LIMIT ?`, cursor, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ret := []*counterRow{}
+	for rows.Next() {
+		row := &counterRow{}
+		if err := rows.Scan(&row.id, &row.endpoint, &row.counter, &row.dsType, &row.step); err != nil {
+			return nil, err
+		}
+		ret = append(ret, row)
+	}
+	return ret, rows.Err()
+}
+
+type rebalanceTask struct {
+	key  string
+	node string
+	addr string
+	done *sync.WaitGroup
+}
+
+// 按页遍历endpoint_counter, 一页全部处理完之后才保存进度
+func runRebalance(plan *RebalancePlan, stop chan struct{}) {
+	oldRing, newRing := newRing(plan.Replicas, plan.OldCluster), newRing(plan.Replicas, plan.NewCluster)
+	limiter := newRateLimiter(int64(plan.RateLimit) * 1024)
+	tasks := make(chan *rebalanceTask)
+	defer close(tasks)
+	for i := 0; i < plan.Concurrency; i++ {
+		go rebalanceWorker(tasks, limiter, stop)
+	}
+
+	for {
+		if stopped(stop) {
+			return
+		}
+
+		rebalanceLock.Lock()
+		state, cursor := rebalanceStatus.State, rebalanceStatus.Cursor
+		rebalanceLock.Unlock()
+		if state == REBALANCE_S_PAUSED {
+			time.Sleep(time.Second)
+			continue
+		}
+
+		rows, err := queryCounters(cursor, REBALANCE_PAGE_SIZE)
+		if err != nil {
+			rebalanceLock.Lock()
+			rebalanceError("query endpoint_counter fail: %v", err)
+			rebalanceLock.Unlock()
+			time.Sleep(10 * time.Second)
+			continue
+		}
+
+		var (
+			scanned, moved int64
+			wg             sync.WaitGroup
+		)
+		for _, row := range rows {
+			if stopped(stop) {
+				break
+			}
+			cursor = row.id
+			scanned++
+			pk := row.endpoint + "/" + row.counter
+			node := movedFrom(oldRing, newRing, plan.Self, pk)
+			if node == "" {
+				continue
+			}
+			moved++
+			wg.Add(1)
+			tasks <- &rebalanceTask{
+				key:  g.FormRrdCacheKey(cutils.Md5(pk), row.dsType, row.step),
+				node: node,
+				addr: plan.OldCluster[node],
+				done: &wg,
+			}
+		}
+		wg.Wait()
+
+		rebalanceLock.Lock()
+		if stopped(stop) {
+			rebalanceLock.Unlock()
+			return
+		}
+		rebalanceStatus.Cursor = cursor
+		rebalanceStatus.Scanned += scanned
+		rebalanceStatus.Moved += moved
+		if scanned == 0 {
+			rebalanceStatus.State = REBALANCE_S_DONE
+			rebalanceStatus.FinishedAt = time.Now().Unix()
+			g.SetRebalancing(false)
+			log.Printf("rebalance done, moved: %d, copied: %d, skipped: %d, missing: %d, failed: %d",
+				rebalanceStatus.Moved, rebalanceStatus.Copied, rebalanceStatus.Skipped, rebalanceStatus.Missing, rebalanceStatus.Failed)
+		}
+		saveRebalanceStatus()
+		rebalanceLock.Unlock()
+		if scanned == 0 {
+			return
+		}
+	}
+}
+
+// stop在持有rebalanceLock时关闭, 加锁之后再检查, 已经停止的迁移不会修改之后新启动的迁移的计数
+func stopped(stop chan struct{}) bool {
+	select {
+	case <-stop:
+		return true
+	default:
+		return false
+	}
+}
+
+func rebalanceWorker(tasks chan *rebalanceTask, limiter *rateLimiter, stop chan struct{}) {
+	clients := make(map[string]*rpc.Client)
+	defer func() {
+		for _, client := range clients {
+			client.Close()
+		}
+	}()
+
+	for task := range tasks {
+		if stopped(stop) {
+			task.done.Done()
+			continue
+		}
+		n, err := copyRrd(clients, task, limiter)
+
+		rebalanceLock.Lock()
+		if stopped(stop) {
+			rebalanceLock.Unlock()
+			task.done.Done()
+			continue
+		}
+		switch {
+		case err == errRrdExists:
+			rebalanceStatus.Skipped++
+		case err != nil && isNotExist(err):
+			rebalanceStatus.Missing++
+		case err != nil:
+			rebalanceStatus.Failed++
+			rebalanceError("copy %s from %s fail: %v", task.key, task.node, err)
+		default:
+			rebalanceStatus.Copied++
+			rebalanceStatus.Bytes += int64(n)
+		}
+		rebalanceLock.Unlock()
+		task.done.Done()
+	}
+}
+
+var errRrdExists = fmt.Errorf("rrd file exists")
+
+func copyRrd(clients map[string]*rpc.Client, task *rebalanceTask, limiter *rateLimiter) (int, error) {
+	cfg := g.Config()
+	md5, dsType, step, err := g.SplitRrdCacheKey(task.key)
+	if err != nil {
+		return 0, err
+	}
+	filename := g.RrdFileName(cfg.RRD.Storage, md5, dsType, step)
+	if g.IsRrdFileExist(filename) {
+		return 0, errRrdExists
+	}
+
+	client := clients[task.addr]
+	if client == nil {
+		if client, err = dial(task.addr, time.Second); err != nil {
+			return 0, err
+		}
+		clients[task.addr] = client
+	}
+	var rrdfile g.File
+	err = rpc_call(client, "Graph.GetRrd", task.key, &rrdfile, time.Duration(cfg.CallTimeout)*time.Millisecond)
+	if err != nil {
+		if _, ok := err.(rpc.ServerError); !ok {
+			client.Close()
+			delete(clients, task.addr)
+		}
+		return 0, err
+	}
+	if rrdfile.Md5 != "" && cutils.Md5(string(rrdfile.Body)) != rrdfile.Md5 {
+		return 0, fmt.Errorf("checksum mismatch")
+	}
+	limiter.wait(len(rrdfile.Body))
+
+	// 拷贝期间可能已经通过migrate获取到了
+	if g.IsRrdFileExist(filename) {
+		return 0, errRrdExists
+	}
+	done := make(chan error, 1)
+	io_task_chan <- &io_task_t{
+		method: IO_TASK_M_WRITE,
+		args:   &g.File{Filename: filename, Body: rrdfile.Body},
+		done:   done,
+	}
+	if err = <-done; err != nil {
+		if os.IsExist(err) {
+			return 0, errRrdExists
+		}
+		return 0, err
+	}
+	body, err := ReadFile(filename)
+	if err != nil {
+		return 0, err
+	}
+	if cutils.Md5(string(body)) != cutils.Md5(string(rrdfile.Body)) {
+		g.RemoveRrdFile(filename)
+		return 0, fmt.Errorf("checksum mismatch after write")
+	}
+
+	// 文件已经存在, 缓存的数据可以直接写入
+	if flag, err := store.GraphItems.GetFlag(task.key); err == nil && flag&g.GRAPH_F_MISS != 0 {
+		store.GraphItems.SetFlag(task.key, flag&^g.GRAPH_F_MISS)
+	}
+	return len(rrdfile.Body), nil
+}
+
+// 按字节数限速, 所有worker共用
+type rateLimiter struct {
+	sync.Mutex
+	rate int64 // bytes/s, 0表示不限速
+	next time.Time
+}
+
+func newRateLimiter(rate int64) *rateLimiter {
+	return &rateLimiter{rate: rate}
+}
+
+func (this *rateLimiter) wait(n int) {
+	if this.rate <= 0 {
+		return
+	}
+	this.Lock()
+	now := time.Now()
+	if this.next.Before(now) {
+		this.next = now
+	}
+	d := this.next.Sub(now)
+	this.next = this.next.Add(time.Duration(int64(n) * int64(time.Second) / this.rate))
+	this.Unlock()
+	time.Sleep(d)
+}
+
+// 把请求发送给新集群中的所有节点(包括本节点), 每个节点只迁移属于自己的counter.
+// 没有plan时使用本节点正在进行的迁移的集群
+func FanoutRebalance(action string, plan *RebalancePlan) (map[string]interface{}, error) {
+	if plan == nil {
+		rebalanceLock.Lock()
+		plan = rebalanceStatus.Plan
+		rebalanceLock.Unlock()
+		if plan == nil {
+			return nil, fmt.Errorf("plan is required")
+		}
+	}
+
+	ret := make(map[string]interface{})
+	timeout := time.Duration(g.Config().CallTimeout) * time.Millisecond
+	for node, addr := range plan.NewCluster {
+		p := *plan
+		p.Self = node
+		client, err := dial(addr, time.Second)
+		if err != nil {
+			ret[node] = err.Error()
+			continue
+		}
+		st := &RebalanceStatus{}
+		err = rpc_call(client, "Graph.Rebalance", RebalanceRequest{Action: action, Plan: &p}, st, timeout)
+		client.Close()
+		if err != nil {
+			ret[node] = err.Error()
+		} else {
+			ret[node] = st
+		}
+	}
+	return ret, nil
+}
@@ -0,0 +1,212 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rrdtool
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/rpc"
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/open-falcon/falcon-plus/modules/graph/g"
+)
+
+// setStorage 用临时目录作为rrd.storage, 返回之后需要删除
+func setStorage(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "graph-rrd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := ioutil.TempFile("", "graph-cfg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	fmt.Fprintf(f, `{"rrd": {"storage": %q}, "callTimeout": 1000}`, dir)
+	f.Close()
+	g.ParseConfig(f.Name())
+	return dir
+}
+
+func TestMovedFrom(t *testing.T) {
+	old := map[string]string{"a": "", "b": ""}
+	cur := map[string]string{"a": "", "b": "", "c": ""}
+	oldRing, newRing := newRing(100, old), newRing(100, cur)
+
+	moved := 0
+	for i := 0; i < 1000; i++ {
+		pk := fmt.Sprintf("host%d/cpu.idle", i)
+		from := movedFrom(oldRing, newRing, "c", pk)
+		node, _ := newRing.Get(pk)
+		prev, _ := oldRing.Get(pk)
+		switch {
+		case node != "c" && from != "":
+			t.Errorf("%s belongs to %s, moved from %s", pk, node, from)
+		case node == "c" && from != prev:
+			t.Errorf("%s moved from %s, expected %s", pk, from, prev)
+		}
+		if from != "" {
+			moved++
+		}
+		// 原来就在本节点上的不需要迁移
+		if from := movedFrom(oldRing, newRing, "a", pk); from != "" {
+			t.Errorf("%s: self a is in old cluster, moved from %s", pk, from)
+		}
+		// 集群没有变化
+		if from := movedFrom(oldRing, oldRing, prev, pk); from != "" {
+			t.Errorf("%s: same cluster, moved from %s", pk, from)
+		}
+	}
+	if moved == 0 || moved == 1000 {
+		t.Errorf("moved %d of 1000 counters", moved)
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	start := time.Now()
+	unlimited := newRateLimiter(0)
+	for i := 0; i < 100; i++ {
+		unlimited.wait(1 << 20)
+	}
+	if d := time.Since(start); d > 50*time.Millisecond {
+		t.Errorf("unlimited wait took %v", d)
+	}
+
+	// 10KB/s, 第一次不等待, 之后每1KB等待100ms
+	limiter := newRateLimiter(10 * 1024)
+	start = time.Now()
+	for i := 0; i < 3; i++ {
+		limiter.wait(1024)
+	}
+	if d := time.Since(start); d < 190*time.Millisecond || d > time.Second {
+		t.Errorf("3KB at 10KB/s took %v, expected 200ms", d)
+	}
+}
+
+func TestIsNotExist(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected bool
+	}{
+		{os.ErrNotExist, true},
+		{&os.PathError{Op: "open", Path: "/data/a.rrd", Err: syscall.ENOENT}, true},
+		{rpc.ServerError("open /data/a.rrd: no such file or directory"), true},
+		{rpc.ServerError("connection is shut down"), false},
+		{errors.New("open /data/a.rrd: no such file or directory"), false},
+		{os.ErrPermission, false},
+	}
+	for _, tt := range tests {
+		if got := isNotExist(tt.err); got != tt.expected {
+			t.Errorf("isNotExist(%v) = %v, expected %v", tt.err, got, tt.expected)
+		}
+	}
+}
+
+func TestRebalanceState(t *testing.T) {
+	dir := setStorage(t)
+	defer os.RemoveAll(dir)
+	defer func() {
+		rebalanceStatus = &RebalanceStatus{State: REBALANCE_S_IDLE, Errors: []string{}}
+		g.SetRebalancing(false)
+	}()
+
+	plan := &RebalancePlan{Self: "a", Replicas: 100, OldCluster: map[string]string{"a": ""}, NewCluster: map[string]string{"a": "", "b": ""}}
+	stop := make(chan struct{})
+	rebalanceStatus = &RebalanceStatus{State: REBALANCE_S_RUNNING, Plan: plan, Errors: []string{}}
+	rebalanceStop = stop
+	g.SetRebalancing(true)
+
+	tests := []struct {
+		action string
+		state  string // 为空表示返回错误
+	}{
+		{"start", ""},
+		{"resume", ""},
+		{"pause", REBALANCE_S_PAUSED},
+		{"pause", ""},
+		{"start", ""},
+		{"status", REBALANCE_S_PAUSED},
+		{"resume", REBALANCE_S_RUNNING},
+		{"stop", REBALANCE_S_STOPPED},
+		{"stop", ""},
+		{"pause", ""},
+		{"resume", ""},
+		{"status", REBALANCE_S_STOPPED},
+		{"unknown", ""},
+	}
+	for i, tt := range tests {
+		st, err := Rebalance(tt.action, plan)
+		switch {
+		case tt.state == "" && err == nil:
+			t.Errorf("%d %s: expected error, got state %s", i, tt.action, st.State)
+		case tt.state != "" && err != nil:
+			t.Errorf("%d %s: %v", i, tt.action, err)
+		case tt.state != "" && st.State != tt.state:
+			t.Errorf("%d %s: state %s, expected %s", i, tt.action, st.State, tt.state)
+		}
+	}
+
+	if !stopped(stop) {
+		t.Errorf("stop channel is not closed")
+	}
+	if g.Migrating() {
+		t.Errorf("still migrating after stop")
+	}
+	if rebalanceStatus.FinishedAt == 0 {
+		t.Errorf("finished_at is not set")
+	}
+	if _, err := os.Stat(rebalanceFile()); err != nil {
+		t.Errorf("status is not saved: %v", err)
+	}
+
+	// 停止之后可以重新开始, 缺少plan或者plan不合法时返回错误
+	if _, err := Rebalance("start", nil); err == nil {
+		t.Errorf("start without plan: expected error")
+	}
+	if _, err := Rebalance("start", &RebalancePlan{Self: "c", Replicas: 100, OldCluster: plan.OldCluster, NewCluster: plan.NewCluster}); err == nil {
+		t.Errorf("start with self not in new_cluster: expected error")
+	}
+}
+
+func TestRebalanceWorkerStopped(t *testing.T) {
+	rebalanceStatus = &RebalanceStatus{State: REBALANCE_S_RUNNING, Errors: []string{}}
+	defer func() {
+		rebalanceStatus = &RebalanceStatus{State: REBALANCE_S_IDLE, Errors: []string{}}
+	}()
+
+	stop := make(chan struct{})
+	close(stop)
+	tasks := make(chan *rebalanceTask)
+	go rebalanceWorker(tasks, newRateLimiter(0), stop)
+
+	// 已经停止的迁移的任务直接完成, 不修改计数
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		tasks <- &rebalanceTask{key: "bad key", node: "a", addr: "127.0.0.1:0", done: &wg}
+	}
+	close(tasks)
+	wg.Wait()
+
+	st := rebalanceStatus
+	if st.Copied+st.Skipped+st.Missing+st.Failed != 0 || len(st.Errors) != 0 {
+		t.Errorf("stopped worker changed status: %+v", st)
+	}
+}
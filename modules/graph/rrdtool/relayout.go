@@ -0,0 +1,438 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rrdtool
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	cmodel "github.com/open-falcon/falcon-plus/common/model"
+	cutils "github.com/open-falcon/falcon-plus/common/utils"
+	"github.com/open-falcon/rrdlite"
+
+	"github.com/open-falcon/falcon-plus/modules/graph/g"
+	"github.com/open-falcon/falcon-plus/modules/graph/index"
+)
+
+// 修改归档策略之后, 把已有的rrd文件转换成新的策略:
+// 在临时文件中按新策略重建rrd, 把旧文件中各个归档的数据(优先使用AVERAGE)按step展开后重新写入,
+// 最后在io worker中补上重建期间写入旧文件的数据, 再替换旧文件.
+// 超出原来最细粒度归档范围的数据只有合并之后的值, 重建之后MAX/MIN也由这些值计算
+const (
+	RELAYOUT_S_IDLE    = "idle"
+	RELAYOUT_S_RUNNING = "running"
+	RELAYOUT_S_DONE    = "done"
+	RELAYOUT_S_STOPPED = "stopped"
+
+	RELAYOUT_BATCH_SIZE = 1000
+)
+
+type RelayoutRequest struct {
+	Endpoint string `json:"endpoint"` // endpoint和counter都不为空时只转换这一个counter
+	Counter  string `json:"counter"`
+	Policy   string `json:"policy"` // 只转换匹配这个策略的counter, 为空表示所有
+	DryRun   bool   `json:"dry_run"`
+}
+
+type RelayoutStatus struct {
+	State      string           `json:"state"`
+	Request    *RelayoutRequest `json:"request"`
+	Cursor     int64            `json:"cursor"`
+	Scanned    int64            `json:"scanned"`
+	Matched    int64            `json:"matched"`   // 本地存在并且匹配policy的rrd文件
+	Changed    int64            `json:"changed"`   // 已经转换(dry_run时为需要转换)
+	Unchanged  int64            `json:"unchanged"` // 和策略相同, 不需要转换
+	Failed     int64            `json:"failed"`
+	StartedAt  int64            `json:"started_at"`
+	FinishedAt int64            `json:"finished_at"`
+	Errors     []string         `json:"errors"`
+}
+
+type info_t struct {
+	filename string
+	layout   *rrdLayout
+}
+
+type relayout_t struct {
+	filename string
+	tmpfile  string
+	cf       string
+	replay   *replayer
+}
+
+var (
+	relayoutLock   = new(sync.Mutex)
+	relayoutStatus = &RelayoutStatus{State: RELAYOUT_S_IDLE, Errors: []string{}}
+	relayoutStop   chan struct{}
+)
+
+func ReadLayout(filename string) (*rrdLayout, error) {
+	done := make(chan error, 1)
+	task := &io_task_t{
+		method: IO_TASK_M_INFO,
+		args:   &info_t{filename: filename},
+		done:   done,
+	}
+	io_task_chan <- task
+	err := <-done
+	return task.args.(*info_t).layout, err
+}
+
+// 把按res合并的数据展开成每个step一个点, 写入临时文件
+type replayer struct {
+	filename string
+	dsType   string
+	step     int64
+	last     int64   // 最后写入的时间
+	acc      float64 // COUNTER和DERIVE需要写入累计值
+	items    []*cmodel.GraphItem
+}
+
+// 一个点对应(ts-res, ts]这段时间, 只写入limit之前的数据
+func (this *replayer) add(ts int64, val float64, res int64, limit int64) error {
+	if math.IsNaN(val) || math.IsInf(val, 0) {
+		return nil
+	}
+	for t := ts - res + this.step; t <= ts && t <= limit; t += this.step {
+		if t <= this.last {
+			continue
+		}
+		v := val
+		switch this.dsType {
+		case g.COUNTER, g.DERIVE:
+			this.acc += val * float64(this.step)
+			v = this.acc
+		case "ABSOLUTE":
+			v = val * float64(this.step)
+		}
+		this.items = append(this.items, &cmodel.GraphItem{Timestamp: t, Value: v, DsType: this.dsType})
+		this.last = t
+		if len(this.items) >= RELAYOUT_BATCH_SIZE {
+			if err := this.flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (this *replayer) flush() error {
+	if len(this.items) == 0 {
+		return nil
+	}
+	err := update(this.filename, this.items)
+	this.items = this.items[:0]
+	return err
+}
+
+// COUNTER和DERIVE写入的是累计值, 最后一个点之前要空出来, 用于恢复原文件的last_ds
+func (this *replayer) limit(lastTs int64) int64 {
+	if this.dsType == g.COUNTER || this.dsType == g.DERIVE {
+		return lastTs - 2
+	}
+	return lastTs
+}
+
+// 在io worker中执行, 补上重建期间写入旧文件的数据, 然后替换旧文件
+func commitRelayout(args *relayout_t) (err error) {
+	defer func() {
+		if err != nil {
+			os.Remove(args.tmpfile)
+		}
+	}()
+
+	l, err := readLayout(args.filename)
+	if err != nil {
+		return err
+	}
+	r := args.replay
+	limit := r.limit(l.LastTs)
+	if l.LastTs > r.last {
+		datas, err := fetch(args.filename, args.cf, r.last, l.LastTs, int(r.step))
+		if err != nil {
+			return err
+		}
+		for _, d := range datas {
+			if err = r.add(d.Timestamp, float64(d.Value), r.step, limit); err != nil {
+				return err
+			}
+		}
+	}
+	if err = r.flush(); err != nil {
+		return err
+	}
+
+	// 先写入U, 再写入原文件的last_ds, 之后写入的数据才能和原文件一样计算速率
+	if limit != l.LastTs && r.last < l.LastTs-1 && l.LastDs != "" {
+		u := rrdlite.NewUpdater(args.tmpfile)
+		u.Cache(l.LastTs-1, "U")
+		u.Cache(l.LastTs, l.LastDs)
+		if err = u.Update(); err != nil {
+			return err
+		}
+	}
+	return os.Rename(args.tmpfile, args.filename)
+}
+
+// 把rrd文件转换成rras的归档策略, 返回是否需要转换
+func relayoutFile(filename string, rras []*g.RRAConfig, dryRun bool) (bool, error) {
+	l, err := ReadLayout(filename)
+	if err != nil {
+		return false, err
+	}
+	if sameRRA(l.RRA, rras) {
+		return false, nil
+	}
+	if dryRun {
+		return true, nil
+	}
+	if s, ok := storage.(*tsdbStorage); ok {
+		// 在下次合并时生效
+		return true, s.db.SetTiers(tsdbKey(filename), tiersOf(rras))
+	}
+
+	// 优先使用AVERAGE, 从细到粗
+	cf := l.RRA[0].CF[0]
+	olds := []*g.RRAConfig{}
+	for _, rra := range l.RRA {
+		for _, c := range rra.CF {
+			if c == "AVERAGE" {
+				cf = c
+			}
+		}
+	}
+	for _, rra := range l.RRA {
+		for _, c := range rra.CF {
+			if c == cf {
+				olds = append(olds, rra)
+			}
+		}
+	}
+	sort.Sort(rraSlice(olds))
+
+	step := int64(l.Step)
+	end := l.LastTs - l.LastTs%step
+	begin := end - int64(retentionSteps(rras))*step
+	tmpfile := filename + ".relayout"
+	nl := *l
+	nl.RRA = rras
+	if err := createFile(tmpfile, time.Unix(begin-step, 0), &nl); err != nil {
+		return true, err
+	}
+
+	r := &replayer{filename: tmpfile, dsType: l.DsType, step: step, last: begin - step}
+	err = func() error {
+		// 每个归档只取比它细的归档没有覆盖的部分, 从粗到细写入
+		limit := r.limit(l.LastTs)
+		for i := len(olds) - 1; i >= 0; i-- {
+			res := int64(olds[i].Steps) * step
+			start := end - int64(olds[i].Steps*olds[i].Rows)*step
+			stop := end
+			if i > 0 {
+				stop = end - int64(olds[i-1].Steps*olds[i-1].Rows)*step
+			}
+			if start < begin {
+				start = begin - begin%res
+			}
+			if stop <= start {
+				continue
+			}
+			datas, err := Fetch(filename, cf, start, stop, int(res))
+			if err != nil {
+				return err
+			}
+			if len(datas) >= 2 {
+				res = datas[1].Timestamp - datas[0].Timestamp
+			}
+			segLimit := stop
+			if segLimit > limit {
+				segLimit = limit
+			}
+			for _, d := range datas {
+				if err := r.add(d.Timestamp, float64(d.Value), res, segLimit); err != nil {
+					return err
+				}
+			}
+		}
+		return r.flush()
+	}()
+	if err != nil {
+		os.Remove(tmpfile)
+		return true, err
+	}
+
+	done := make(chan error, 1)
+	io_task_chan <- &io_task_t{
+		method: IO_TASK_M_RELAYOUT,
+		args:   &relayout_t{filename: filename, tmpfile: tmpfile, cf: cf, replay: r},
+		done:   done,
+	}
+	return true, <-done
+}
+
+// 返回counter使用的归档策略和rrd文件中的归档
+func RetentionInfo(endpoint, counter string) (map[string]interface{}, error) {
+	name, rras := RetentionForCounter(counter)
+	ret := map[string]interface{}{"policy": name, "rra": rras}
+
+	dsType, step, exists := index.GetTypeAndStep(endpoint, counter)
+	if !exists {
+		return ret, nil
+	}
+	filename := g.RrdFileName(g.Config().RRD.Storage, cutils.Md5(endpoint+"/"+counter), dsType, step)
+	if !g.IsRrdFileExist(filename) {
+		return ret, nil
+	}
+	l, err := ReadLayout(filename)
+	if err != nil {
+		return nil, err
+	}
+	ret["file"] = l
+	ret["changed"] = !sameRRA(l.RRA, rras)
+	return ret, nil
+}
+
+func relayoutCounter(req *RelayoutRequest, endpoint, counter, dsType string, step int) {
+	name, rras := RetentionForCounter(counter)
+	if req.Policy != "" && req.Policy != name {
+		return
+	}
+	filename := g.RrdFileName(g.Config().RRD.Storage, cutils.Md5(endpoint+"/"+counter), dsType, step)
+	if !g.IsRrdFileExist(filename) {
+		return
+	}
+	changed, err := relayoutFile(filename, rras, req.DryRun)
+	if changed && err == nil && !req.DryRun {
+		forgetFileRRA(filename)
+	}
+
+	relayoutLock.Lock()
+	defer relayoutLock.Unlock()
+	relayoutStatus.Matched++
+	switch {
+	case err != nil:
+		relayoutStatus.Failed++
+		msg := fmt.Sprintf("relayout %s/%s fail: %v", endpoint, counter, err)
+		log.Println(msg)
+		relayoutStatus.Errors = append(relayoutStatus.Errors, time.Now().Format("2006-01-02 15:04:05 ")+msg)
+		if len(relayoutStatus.Errors) > REBALANCE_MAX_ERRORS {
+			relayoutStatus.Errors = relayoutStatus.Errors[1:]
+		}
+	case changed:
+		relayoutStatus.Changed++
+	default:
+		relayoutStatus.Unchanged++
+	}
+}
+
+func runRelayout(req *RelayoutRequest, stop chan struct{}) {
+	var cursor int64
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		rows, err := queryCounters(cursor, REBALANCE_PAGE_SIZE)
+		if err != nil {
+			log.Println("relayout: query endpoint_counter fail:", err)
+			time.Sleep(10 * time.Second)
+			continue
+		}
+		for _, row := range rows {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			relayoutCounter(req, row.endpoint, row.counter, row.dsType, row.step)
+			cursor = row.id
+			relayoutLock.Lock()
+			relayoutStatus.Cursor = cursor
+			relayoutStatus.Scanned++
+			relayoutLock.Unlock()
+		}
+
+		if len(rows) == 0 {
+			relayoutLock.Lock()
+			relayoutStatus.State = RELAYOUT_S_DONE
+			relayoutStatus.FinishedAt = time.Now().Unix()
+			log.Printf("relayout done, matched: %d, changed: %d, unchanged: %d, failed: %d",
+				relayoutStatus.Matched, relayoutStatus.Changed, relayoutStatus.Unchanged, relayoutStatus.Failed)
+			relayoutLock.Unlock()
+			return
+		}
+	}
+}
+
+// 指定了endpoint和counter时同步转换, 否则在后台遍历所有counter
+func Relayout(req *RelayoutRequest) (*RelayoutStatus, error) {
+	relayoutLock.Lock()
+	if relayoutStatus.State == RELAYOUT_S_RUNNING {
+		relayoutLock.Unlock()
+		return nil, fmt.Errorf("relayout is running")
+	}
+	if req.Policy != "" {
+		if _, exists := retentionNames()[req.Policy]; !exists {
+			relayoutLock.Unlock()
+			return nil, fmt.Errorf("unknown retention policy %s", req.Policy)
+		}
+	}
+	relayoutStatus = &RelayoutStatus{State: RELAYOUT_S_RUNNING, Request: req, StartedAt: time.Now().Unix(), Errors: []string{}}
+	relayoutStop = make(chan struct{})
+	relayoutLock.Unlock()
+
+	if req.Endpoint == "" || req.Counter == "" {
+		go runRelayout(req, relayoutStop)
+		return GetRelayoutStatus(), nil
+	}
+
+	if dsType, step, exists := index.GetTypeAndStep(req.Endpoint, req.Counter); exists {
+		relayoutCounter(req, req.Endpoint, req.Counter, dsType, step)
+	}
+	relayoutLock.Lock()
+	relayoutStatus.Scanned = 1
+	relayoutStatus.State = RELAYOUT_S_DONE
+	relayoutStatus.FinishedAt = time.Now().Unix()
+	relayoutLock.Unlock()
+	return GetRelayoutStatus(), nil
+}
+
+func StopRelayout() (*RelayoutStatus, error) {
+	relayoutLock.Lock()
+	if relayoutStatus.State != RELAYOUT_S_RUNNING {
+		relayoutLock.Unlock()
+		return nil, fmt.Errorf("relayout is %s", relayoutStatus.State)
+	}
+	close(relayoutStop)
+	relayoutStatus.State = RELAYOUT_S_STOPPED
+	relayoutStatus.FinishedAt = time.Now().Unix()
+	relayoutLock.Unlock()
+	return GetRelayoutStatus(), nil
+}
+
+func GetRelayoutStatus() *RelayoutStatus {
+	relayoutLock.Lock()
+	defer relayoutLock.Unlock()
+	st := *relayoutStatus
+	st.Errors = append([]string{}, relayoutStatus.Errors...)
+	return &st
+}
@@ -0,0 +1,387 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rrdtool
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	cutils "github.com/open-falcon/falcon-plus/common/utils"
+	"github.com/open-falcon/rrdlite"
+
+	"github.com/open-falcon/falcon-plus/modules/graph/g"
+)
+
+const DEFAULT_RETENTION = "default"
+
+// 默认的归档策略
+var DefaultRRA = []*g.RRAConfig{
+	// 1分钟一个点存 12小时
+	{CF: []string{"AVERAGE"}, Steps: 1, Rows: RRA1PointCnt},
+	// 5m一个点存2d
+	{CF: []string{"AVERAGE", "MAX", "MIN"}, Steps: 5, Rows: RRA5PointCnt},
+	// 20m一个点存7d
+	{CF: []string{"AVERAGE", "MAX", "MIN"}, Steps: 20, Rows: RRA20PointCnt},
+	// 3小时一个点存3个月
+	{CF: []string{"AVERAGE", "MAX", "MIN"}, Steps: 180, Rows: RRA180PointCnt},
+	// 12小时一个点存1year
+	{CF: []string{"AVERAGE", "MAX", "MIN"}, Steps: 720, Rows: RRA720PointCnt},
+}
+
+type retention struct {
+	name   string
+	metric *regexp.Regexp
+	tags   map[string]*regexp.Regexp
+	rra    []*g.RRAConfig
+}
+
+func (this *retention) match(metric string, tags map[string]string) bool {
+	if this.metric != nil && !this.metric.MatchString(metric) {
+		return false
+	}
+	for k, re := range this.tags {
+		v, exists := tags[k]
+		if !exists || !re.MatchString(v) {
+			return false
+		}
+	}
+	return true
+}
+
+var retentions atomic.Value // []*retention
+
+func compileRetention(p *g.RetentionPolicy) (*retention, error) {
+	if p.Name == "" || p.Name == DEFAULT_RETENTION {
+		return nil, fmt.Errorf("bad retention name %q", p.Name)
+	}
+	if err := checkRRA(p.RRA); err != nil {
+		return nil, fmt.Errorf("retention %s: %v", p.Name, err)
+	}
+
+	r := &retention{name: p.Name, tags: make(map[string]*regexp.Regexp), rra: p.RRA}
+	var err error
+	if p.Metric != "" {
+		if r.metric, err = regexp.Compile("^(?:" + p.Metric + ")$"); err != nil {
+			return nil, fmt.Errorf("retention %s: %v", p.Name, err)
+		}
+	}
+	for k, v := range p.Tags {
+		if r.tags[k], err = regexp.Compile("^(?:" + v + ")$"); err != nil {
+			return nil, fmt.Errorf("retention %s: %v", p.Name, err)
+		}
+	}
+	return r, nil
+}
+
+func checkRRA(rras []*g.RRAConfig) error {
+	if len(rras) == 0 {
+		return fmt.Errorf("rra is empty")
+	}
+	for _, rra := range rras {
+		if rra.Steps <= 0 || rra.Rows <= 0 || len(rra.CF) == 0 {
+			return fmt.Errorf("bad rra %+v", *rra)
+		}
+		for _, cf := range rra.CF {
+			if cf != "AVERAGE" && cf != "MAX" && cf != "MIN" && cf != "LAST" {
+				return fmt.Errorf("bad cf %s", cf)
+			}
+		}
+	}
+	return nil
+}
+
+// 编译配置中的归档策略, 出错时保留原来的策略
+func LoadRetention(policies []*g.RetentionPolicy) error {
+	rs := make([]*retention, 0, len(policies))
+	names := make(map[string]bool)
+	for _, p := range policies {
+		r, err := compileRetention(p)
+		if err != nil {
+			return err
+		}
+		if names[r.name] {
+			return fmt.Errorf("duplicate retention name %s", r.name)
+		}
+		names[r.name] = true
+		rs = append(rs, r)
+	}
+	retentions.Store(rs)
+	return nil
+}
+
+// 返回metric和tags对应的归档策略
+func RetentionFor(metric string, tags map[string]string) (string, []*g.RRAConfig) {
+	rs, _ := retentions.Load().([]*retention)
+	for _, r := range rs {
+		if r.match(metric, tags) {
+			return r.name, r.rra
+		}
+	}
+	return DEFAULT_RETENTION, DefaultRRA
+}
+
+func retentionNames() map[string]bool {
+	names := map[string]bool{DEFAULT_RETENTION: true}
+	rs, _ := retentions.Load().([]*retention)
+	for _, r := range rs {
+		names[r.name] = true
+	}
+	return names
+}
+
+// counter的格式为metric或者metric/tags
+func RetentionForCounter(counter string) (string, []*g.RRAConfig) {
+	metric, tags := counter, map[string]string{}
+	if idx := strings.Index(counter, "/"); idx >= 0 {
+		metric = counter[:idx]
+		tags = cutils.DictedTagstring(counter[idx+1:])
+	}
+	return RetentionFor(metric, tags)
+}
+
+const (
+	fileRRACacheTTL  = 600
+	fileRRACacheSize = 100000
+)
+
+type fileRRA struct {
+	rra []*g.RRAConfig
+	ts  int64
+}
+
+// 数据文件 -> 文件中实际的归档, 修改策略之后没有relayout的文件和策略不一致
+var (
+	fileRRALock  = new(sync.RWMutex)
+	fileRRACache = make(map[string]*fileRRA)
+)
+
+// 返回数据文件中的归档, 文件不存在或者读取失败时返回policy
+func FileRRA(filename string, policy []*g.RRAConfig) []*g.RRAConfig {
+	now := time.Now().Unix()
+	fileRRALock.RLock()
+	c, exists := fileRRACache[filename]
+	fileRRALock.RUnlock()
+	if exists && now-c.ts < fileRRACacheTTL {
+		return c.rra
+	}
+
+	if !g.IsRrdFileExist(filename) {
+		return policy
+	}
+	l, err := ReadLayout(filename)
+	if err != nil || len(l.RRA) == 0 {
+		return policy
+	}
+
+	fileRRALock.Lock()
+	defer fileRRALock.Unlock()
+	if len(fileRRACache) >= fileRRACacheSize {
+		for k, v := range fileRRACache {
+			if now-v.ts >= fileRRACacheTTL {
+				delete(fileRRACache, k)
+			}
+		}
+		if len(fileRRACache) >= fileRRACacheSize {
+			fileRRACache = make(map[string]*fileRRA)
+		}
+	}
+	fileRRACache[filename] = &fileRRA{rra: l.RRA, ts: now}
+	return l.RRA
+}
+
+func forgetFileRRA(filename string) {
+	fileRRALock.Lock()
+	defer fileRRALock.Unlock()
+	delete(fileRRACache, filename)
+}
+
+// 没有合并(steps为1)的点数, 查询时在这个范围内才和缓存中的数据合并
+func RawPointCnt(rras []*g.RRAConfig) int {
+	n := 0
+	for _, rra := range rras {
+		if rra.Steps == 1 && rra.Rows > n {
+			n = rra.Rows
+		}
+	}
+	return n
+}
+
+// 为降采样查询选择归档: 间隔不超过res且保留时间能覆盖start的最粗的归档; 没有时选能覆盖start的最细的归档,
+// 都覆盖不了时选保留时间最长的. 返回归档的间隔和取数用的cf, 归档没有cf时用AVERAGE
+func ChooseRRA(rras []*g.RRAConfig, step int, cf string, start, res int64) (int, string) {
+	lastUpTs := time.Now().Unix()
+	lastUpTs -= lastUpTs % int64(step)
+	var best, finest, longest *g.RRAConfig
+	for _, rra := range rras {
+		if longest == nil || rra.Steps*rra.Rows > longest.Steps*longest.Rows {
+			longest = rra
+		}
+		if lastUpTs-int64(rra.Steps*rra.Rows*step) > start {
+			continue
+		}
+		if finest == nil || rra.Steps < finest.Steps || (rra.Steps == finest.Steps && hasCF(rra, cf)) {
+			finest = rra
+		}
+		if int64(rra.Steps*step) > res {
+			continue
+		}
+		if best == nil || rra.Steps > best.Steps || (rra.Steps == best.Steps && hasCF(rra, cf)) {
+			best = rra
+		}
+	}
+	if best == nil {
+		best = finest
+	}
+	if best == nil {
+		best = longest
+	}
+	if best == nil {
+		return step, cf
+	}
+	if !hasCF(best, cf) {
+		cf = "AVERAGE"
+	}
+	return best.Steps * step, cf
+}
+
+func hasCF(rra *g.RRAConfig, cf string) bool {
+	for _, c := range rra.CF {
+		if c == cf {
+			return true
+		}
+	}
+	return false
+}
+
+// 归档策略覆盖的最长时间, 单位为step
+func retentionSteps(rras []*g.RRAConfig) int {
+	n := 0
+	for _, rra := range rras {
+		if rra.Steps*rra.Rows > n {
+			n = rra.Steps * rra.Rows
+		}
+	}
+	return n
+}
+
+type rrdLayout struct {
+	DsType    string         `json:"dstype"`
+	Step      int            `json:"step"`
+	Heartbeat int            `json:"heartbeat"`
+	Min       string         `json:"min"`
+	Max       string         `json:"max"`
+	LastTs    int64          `json:"last_update"`
+	LastDs    string         `json:"-"`
+	RRA       []*g.RRAConfig `json:"rra"`
+}
+
+func infoFloat(v interface{}) string {
+	f, ok := v.(float64)
+	if !ok || math.IsNaN(f) {
+		return "U"
+	}
+	return fmt.Sprintf("%v", f)
+}
+
+// 读取rrd文件的DS和归档策略, 相同pdp_per_row和rows的RRA合并成一个RRAConfig
+func readLayout(filename string) (*rrdLayout, error) {
+	info, err := rrdlite.Info(filename)
+	if err != nil {
+		return nil, err
+	}
+	l := &rrdLayout{}
+	step, _ := info["step"].(uint)
+	last, _ := info["last_update"].(uint)
+	l.Step, l.LastTs = int(step), int64(last)
+	if m, ok := info["ds.type"].(map[string]interface{}); ok {
+		l.DsType, _ = m["metric"].(string)
+	}
+	if m, ok := info["ds.minimal_heartbeat"].(map[string]interface{}); ok {
+		hb, _ := m["metric"].(uint)
+		l.Heartbeat = int(hb)
+	}
+	if m, ok := info["ds.last_ds"].(map[string]interface{}); ok {
+		l.LastDs, _ = m["metric"].(string)
+	}
+	l.Min, l.Max = "U", "U"
+	if m, ok := info["ds.min"].(map[string]interface{}); ok {
+		l.Min = infoFloat(m["metric"])
+	}
+	if m, ok := info["ds.max"].(map[string]interface{}); ok {
+		l.Max = infoFloat(m["metric"])
+	}
+	if l.DsType == "" || l.Step == 0 {
+		return nil, fmt.Errorf("bad rrd file %s", filename)
+	}
+
+	cfs, _ := info["rra.cf"].([]interface{})
+	rows, _ := info["rra.rows"].([]interface{})
+	pdps, _ := info["rra.pdp_per_row"].([]interface{})
+	for i := range cfs {
+		if i >= len(rows) || i >= len(pdps) {
+			break
+		}
+		cf, _ := cfs[i].(string)
+		r, _ := rows[i].(uint)
+		p, _ := pdps[i].(uint)
+		var rra *g.RRAConfig
+		for _, x := range l.RRA {
+			if x.Steps == int(p) && x.Rows == int(r) {
+				rra = x
+				break
+			}
+		}
+		if rra == nil {
+			rra = &g.RRAConfig{Steps: int(p), Rows: int(r)}
+			l.RRA = append(l.RRA, rra)
+		}
+		rra.CF = append(rra.CF, cf)
+	}
+	return l, nil
+}
+
+// 按steps从细到粗排序
+type rraSlice []*g.RRAConfig
+
+func (this rraSlice) Len() int           { return len(this) }
+func (this rraSlice) Swap(i, j int)      { this[i], this[j] = this[j], this[i] }
+func (this rraSlice) Less(i, j int) bool { return this[i].Steps < this[j].Steps }
+
+func sameRRA(a, b []*g.RRAConfig) bool {
+	key := func(rras []*g.RRAConfig) map[string]bool {
+		m := make(map[string]bool)
+		for _, rra := range rras {
+			for _, cf := range rra.CF {
+				m[fmt.Sprintf("%s:%d:%d", cf, rra.Steps, rra.Rows)] = true
+			}
+		}
+		return m
+	}
+	ka, kb := key(a), key(b)
+	if len(ka) != len(kb) {
+		return false
+	}
+	for k := range ka {
+		if !kb[k] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,338 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rrdtool
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	cmodel "github.com/open-falcon/falcon-plus/common/model"
+	"github.com/open-falcon/falcon-plus/modules/graph/g"
+)
+
+func TestCompileRetention(t *testing.T) {
+	rra := []*g.RRAConfig{{CF: []string{"AVERAGE", "MAX"}, Steps: 1, Rows: 100}}
+	tests := []struct {
+		policy *g.RetentionPolicy
+		ok     bool
+	}{
+		{&g.RetentionPolicy{Name: "disk", Metric: "disk\\..*", RRA: rra}, true},
+		{&g.RetentionPolicy{Name: "web", Tags: map[string]string{"app": "web.*"}, RRA: rra}, true},
+		{&g.RetentionPolicy{Name: "", RRA: rra}, false},
+		{&g.RetentionPolicy{Name: DEFAULT_RETENTION, RRA: rra}, false},
+		{&g.RetentionPolicy{Name: "empty"}, false},
+		{&g.RetentionPolicy{Name: "steps", RRA: []*g.RRAConfig{{CF: []string{"AVERAGE"}, Steps: 0, Rows: 100}}}, false},
+		{&g.RetentionPolicy{Name: "rows", RRA: []*g.RRAConfig{{CF: []string{"AVERAGE"}, Steps: 1}}}, false},
+		{&g.RetentionPolicy{Name: "nocf", RRA: []*g.RRAConfig{{Steps: 1, Rows: 100}}}, false},
+		{&g.RetentionPolicy{Name: "cf", RRA: []*g.RRAConfig{{CF: []string{"SUM"}, Steps: 1, Rows: 100}}}, false},
+		{&g.RetentionPolicy{Name: "metric", Metric: "disk.(", RRA: rra}, false},
+		{&g.RetentionPolicy{Name: "tags", Tags: map[string]string{"app": "[web"}, RRA: rra}, false},
+	}
+	for _, tt := range tests {
+		_, err := compileRetention(tt.policy)
+		if (err == nil) != tt.ok {
+			t.Errorf("compileRetention(%s): error %v, expected ok %v", tt.policy.Name, err, tt.ok)
+		}
+	}
+}
+
+func TestRetentionMatch(t *testing.T) {
+	r, err := compileRetention(&g.RetentionPolicy{
+		Name:   "disk",
+		Metric: "disk\\.(used|free)",
+		Tags:   map[string]string{"mount": "/|/data.*"},
+		RRA:    DefaultRRA,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		metric   string
+		tags     map[string]string
+		expected bool
+	}{
+		{"disk.used", map[string]string{"mount": "/"}, true},
+		{"disk.free", map[string]string{"mount": "/data1", "fstype": "ext4"}, true},
+		// metric和tag的值都要完整匹配
+		{"disk.used.percent", map[string]string{"mount": "/"}, false},
+		{"sys.disk.used", map[string]string{"mount": "/"}, false},
+		{"disk.used", map[string]string{"mount": "/home"}, false},
+		{"disk.used", map[string]string{"mount": "/home/data"}, false},
+		// 缺少tag
+		{"disk.used", map[string]string{}, false},
+		{"disk.used", map[string]string{"path": "/"}, false},
+	}
+	for _, tt := range tests {
+		if got := r.match(tt.metric, tt.tags); got != tt.expected {
+			t.Errorf("match(%s, %v) = %v, expected %v", tt.metric, tt.tags, got, tt.expected)
+		}
+	}
+
+	// 没有metric和tags时匹配所有
+	all, err := compileRetention(&g.RetentionPolicy{Name: "all", RRA: DefaultRRA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !all.match("cpu.idle", nil) {
+		t.Errorf("empty policy does not match cpu.idle")
+	}
+}
+
+func TestLoadRetention(t *testing.T) {
+	defer LoadRetention(nil)
+
+	short := []*g.RRAConfig{{CF: []string{"AVERAGE"}, Steps: 1, Rows: 60}}
+	policies := []*g.RetentionPolicy{
+		{Name: "short", Metric: "tmp\\..*", RRA: short},
+		{Name: "web", Tags: map[string]string{"app": "web"}, RRA: DefaultRRA},
+	}
+	if err := LoadRetention(policies); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]string{
+		"tmp.count":            "short",
+		"tmp.count/app=web":    "short", // 按顺序匹配第一个
+		"cpu.idle/app=web,b=1": "web",
+		"cpu.idle/app=db":      DEFAULT_RETENTION,
+		"cpu.idle":             DEFAULT_RETENTION,
+	}
+	for counter, expected := range tests {
+		if name, _ := RetentionForCounter(counter); name != expected {
+			t.Errorf("RetentionForCounter(%s) = %s, expected %s", counter, name, expected)
+		}
+	}
+
+	// 出错时保留原来的策略
+	dup := append(policies, &g.RetentionPolicy{Name: "short", RRA: short})
+	if err := LoadRetention(dup); err == nil {
+		t.Errorf("duplicate name: expected error")
+	}
+	if name, _ := RetentionForCounter("tmp.count"); name != "short" {
+		t.Errorf("policy changed after bad reload: %s", name)
+	}
+}
+
+func TestRawPointCnt(t *testing.T) {
+	tests := []struct {
+		rras     []*g.RRAConfig
+		expected int
+	}{
+		{DefaultRRA, RRA1PointCnt},
+		{[]*g.RRAConfig{{CF: []string{"AVERAGE"}, Steps: 5, Rows: 100}}, 0},
+		{[]*g.RRAConfig{{CF: []string{"AVERAGE"}, Steps: 1, Rows: 100}, {CF: []string{"MAX"}, Steps: 1, Rows: 200}}, 200},
+		{nil, 0},
+	}
+	for i, tt := range tests {
+		if got := RawPointCnt(tt.rras); got != tt.expected {
+			t.Errorf("case %d: RawPointCnt = %d, expected %d", i, got, tt.expected)
+		}
+	}
+}
+
+func TestSameRRA(t *testing.T) {
+	a := []*g.RRAConfig{{CF: []string{"AVERAGE"}, Steps: 1, Rows: 100}, {CF: []string{"AVERAGE", "MAX"}, Steps: 5, Rows: 100}}
+	tests := []struct {
+		b        []*g.RRAConfig
+		expected bool
+	}{
+		// 顺序和cf的分组不影响
+		{[]*g.RRAConfig{{CF: []string{"MAX"}, Steps: 5, Rows: 100}, {CF: []string{"AVERAGE"}, Steps: 1, Rows: 100}, {CF: []string{"AVERAGE"}, Steps: 5, Rows: 100}}, true},
+		{[]*g.RRAConfig{{CF: []string{"AVERAGE"}, Steps: 1, Rows: 100}, {CF: []string{"AVERAGE"}, Steps: 5, Rows: 100}}, false},
+		{[]*g.RRAConfig{{CF: []string{"AVERAGE"}, Steps: 1, Rows: 100}, {CF: []string{"AVERAGE", "MIN"}, Steps: 5, Rows: 100}}, false},
+		{[]*g.RRAConfig{{CF: []string{"AVERAGE"}, Steps: 1, Rows: 200}, {CF: []string{"AVERAGE", "MAX"}, Steps: 5, Rows: 100}}, false},
+		{nil, false},
+	}
+	for i, tt := range tests {
+		if got := sameRRA(a, tt.b); got != tt.expected {
+			t.Errorf("case %d: sameRRA = %v, expected %v", i, got, tt.expected)
+		}
+	}
+}
+
+var startIoWorker sync.Once
+
+// newRrdFile 用rras创建GAUGE类型, step为60的rrd文件, 写入最近n分钟每分钟一个点, 返回文件名和最后的时间
+func newRrdFile(t *testing.T, dir string, rras []*g.RRAConfig, n int) (string, int64) {
+	startIoWorker.Do(func() {
+		storage = rrdStorage{}
+		go ioWorker()
+	})
+
+	now := time.Now().Unix()
+	last := now - now%60
+	filename := filepath.Join(dir, "test_GAUGE_60.rrd")
+	l := &rrdLayout{DsType: "GAUGE", Step: 60, Heartbeat: 120, Min: "U", Max: "U", RRA: rras}
+	if err := createFile(filename, time.Unix(last-int64(n+1)*60, 0), l); err != nil {
+		t.Fatal(err)
+	}
+	items := []*cmodel.GraphItem{}
+	for i := n - 1; i >= 0; i-- {
+		items = append(items, &cmodel.GraphItem{Timestamp: last - int64(i*60), Value: float64(i), DsType: "GAUGE"})
+	}
+	if err := update(filename, items); err != nil {
+		t.Fatal(err)
+	}
+	return filename, last
+}
+
+func TestReadLayout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "graph-rrd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	rras := []*g.RRAConfig{{CF: []string{"AVERAGE"}, Steps: 1, Rows: 100}, {CF: []string{"AVERAGE", "MAX"}, Steps: 5, Rows: 50}}
+	filename, last := newRrdFile(t, dir, rras, 10)
+
+	l, err := readLayout(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.DsType != "GAUGE" || l.Step != 60 || l.Heartbeat != 120 || l.Min != "U" || l.Max != "U" || l.LastTs != last {
+		t.Errorf("layout %+v", l)
+	}
+	// 相同steps和rows的RRA合并成一个
+	if len(l.RRA) != 2 || !sameRRA(l.RRA, rras) {
+		t.Errorf("layout rra %+v, expected %+v", l.RRA, rras)
+	}
+
+	if got := FileRRA(filename, DefaultRRA); !sameRRA(got, rras) {
+		t.Errorf("FileRRA = %+v, expected %+v", got, rras)
+	}
+	if got := FileRRA(filepath.Join(dir, "missing.rrd"), DefaultRRA); !sameRRA(got, DefaultRRA) {
+		t.Errorf("FileRRA of missing file = %+v, expected default", got)
+	}
+	forgetFileRRA(filename)
+
+	if _, err := readLayout(filepath.Join(dir, "missing.rrd")); err == nil {
+		t.Errorf("readLayout of missing file: expected error")
+	}
+}
+
+func TestRelayoutFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "graph-rrd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	olds := []*g.RRAConfig{{CF: []string{"AVERAGE"}, Steps: 1, Rows: 100}, {CF: []string{"AVERAGE"}, Steps: 5, Rows: 100}}
+	filename, last := newRrdFile(t, dir, olds, 60)
+	before, err := Fetch(filename, "AVERAGE", last-3600, last, 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 和文件中的归档相同时不需要转换
+	if changed, err := relayoutFile(filename, olds, false); changed || err != nil {
+		t.Errorf("relayout with same rra: changed %v, error %v", changed, err)
+	}
+
+	rras := []*g.RRAConfig{{CF: []string{"AVERAGE"}, Steps: 1, Rows: 200}, {CF: []string{"AVERAGE", "MAX"}, Steps: 5, Rows: 50}}
+	if changed, err := relayoutFile(filename, rras, true); !changed || err != nil {
+		t.Errorf("dry run: changed %v, error %v", changed, err)
+	}
+	if l, err := ReadLayout(filename); err != nil || !sameRRA(l.RRA, olds) {
+		t.Fatalf("dry run changed the file: %v", err)
+	}
+
+	if changed, err := relayoutFile(filename, rras, false); !changed || err != nil {
+		t.Fatalf("relayout: changed %v, error %v", changed, err)
+	}
+	l, err := ReadLayout(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameRRA(l.RRA, rras) || l.LastTs != last {
+		t.Errorf("layout after relayout: %+v, last %d, expected %d", l.RRA, l.LastTs, last)
+	}
+
+	// 原来的数据都还在
+	after, err := Fetch(filename, "AVERAGE", last-3600, last, 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := map[int64]float64{}
+	for _, d := range after {
+		values[d.Timestamp] = float64(d.Value)
+	}
+	n := 0
+	for _, d := range before {
+		if math.IsNaN(float64(d.Value)) {
+			continue
+		}
+		n++
+		if v, exists := values[d.Timestamp]; !exists || v != float64(d.Value) {
+			t.Errorf("ts %d: %v after relayout, expected %v", d.Timestamp, v, d.Value)
+		}
+	}
+	if n < 50 {
+		t.Errorf("only %d points before relayout", n)
+	}
+	if _, err := os.Stat(filename + ".relayout"); !os.IsNotExist(err) {
+		t.Errorf("tmp file is not removed: %v", err)
+	}
+}
+
+func TestChooseRRA(t *testing.T) {
+	now := time.Now().Unix()
+	hour, day := int64(3600), int64(86400)
+	sameSteps := []*g.RRAConfig{
+		{CF: []string{"AVERAGE"}, Steps: 1, Rows: 100},
+		{CF: []string{"MAX"}, Steps: 1, Rows: 100},
+	}
+
+	tests := []struct {
+		rras      []*g.RRAConfig
+		cf        string
+		start     int64
+		res       int64
+		fetchStep int
+		fetchCF   string
+	}{
+		// 间隔不超过res的最粗的归档
+		{DefaultRRA, "AVERAGE", now - hour, 300, 300, "AVERAGE"},
+		{DefaultRRA, "AVERAGE", now - hour, 600, 300, "AVERAGE"},
+		{DefaultRRA, "MAX", now - hour, 3600, 1200, "MAX"},
+		// 5分钟的归档只保存2天, 用20分钟的归档
+		{DefaultRRA, "AVERAGE", now - 3*day, 3600, 1200, "AVERAGE"},
+		// 间隔不超过res的归档都覆盖不了start, 选能覆盖start的最细的归档
+		{DefaultRRA, "AVERAGE", now - 3*day, 300, 1200, "AVERAGE"},
+		{DefaultRRA, "MAX", now - 30*day, 60, 10800, "MAX"},
+		// 都覆盖不了时选保留时间最长的
+		{DefaultRRA, "MIN", now - 400*day, 100000, 43200, "MIN"},
+		// 归档没有请求的cf时用AVERAGE
+		{DefaultRRA, "MAX", now - hour, 60, 60, "AVERAGE"},
+		{DefaultRRA, "LAST", now - hour, 300, 300, "AVERAGE"},
+		// 间隔相同时优先有请求的cf的归档
+		{sameSteps, "MAX", now - hour, 300, 60, "MAX"},
+		{[]*g.RRAConfig{}, "MAX", now - hour, 300, 60, "MAX"},
+	}
+	for i, tt := range tests {
+		fetchStep, fetchCF := ChooseRRA(tt.rras, 60, tt.cf, tt.start, tt.res)
+		if fetchStep != tt.fetchStep || fetchCF != tt.fetchCF {
+			t.Errorf("case %d: ChooseRRA(%s, start=now-%d, res=%d) = %d %s, expected %d %s",
+				i, tt.cf, now-tt.start, tt.res, fetchStep, fetchCF, tt.fetchStep, tt.fetchCF)
+		}
+	}
+}
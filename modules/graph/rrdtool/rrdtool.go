@@ -61,7 +61,18 @@ func Start() {
 		log.Fatalln("rrdtool.Start error, bad data dir "+cfg.RRD.Storage+",", err)
 	}
 
+	if storage, err = openStorage(cfg); err != nil {
+		log.Fatalln("rrdtool.Start error, open storage fail,", err)
+	}
+	g.IsRrdFileExist = storage.Exists
+	g.RemoveRrdFile = storage.Remove
+
+	if err = LoadRetention(cfg.Retention); err != nil {
+		log.Fatalln("rrdtool.Start error, bad retention config,", err)
+	}
+
 	migrate_start(cfg)
+	resumeRebalance()
 
 	// sync disk
 	go syncDisk()
@@ -81,35 +92,27 @@ const (
 func create(filename string, item *cmodel.GraphItem) error {
 	now := time.Now()
 	start := now.Add(time.Duration(-24) * time.Hour)
-	step := uint(item.Step)
-
-	c := rrdlite.NewCreator(filename, start, step)
-	c.DS("metric", item.DsType, item.Heartbeat, item.Min, item.Max)
 
 	// 设置各种归档策略
-	// 1分钟一个点存 12小时
-	c.RRA("AVERAGE", 0, 1, RRA1PointCnt)
-
-	// 5m一个点存2d
-	c.RRA("AVERAGE", 0, 5, RRA5PointCnt)
-	c.RRA("MAX", 0, 5, RRA5PointCnt)
-	c.RRA("MIN", 0, 5, RRA5PointCnt)
-
-	// 20m一个点存7d
-	c.RRA("AVERAGE", 0, 20, RRA20PointCnt)
-	c.RRA("MAX", 0, 20, RRA20PointCnt)
-	c.RRA("MIN", 0, 20, RRA20PointCnt)
-
-	// 3小时一个点存3个月
-	c.RRA("AVERAGE", 0, 180, RRA180PointCnt)
-	c.RRA("MAX", 0, 180, RRA180PointCnt)
-	c.RRA("MIN", 0, 180, RRA180PointCnt)
-
-	// 12小时一个点存1year
-	c.RRA("AVERAGE", 0, 720, RRA720PointCnt)
-	c.RRA("MAX", 0, 720, RRA720PointCnt)
-	c.RRA("MIN", 0, 720, RRA720PointCnt)
+	_, rras := RetentionFor(item.Metric, item.Tags)
+	return createFile(filename, start, &rrdLayout{
+		DsType:    item.DsType,
+		Step:      item.Step,
+		Heartbeat: item.Heartbeat,
+		Min:       item.Min,
+		Max:       item.Max,
+		RRA:       rras,
+	})
+}
 
+func createFile(filename string, start time.Time, l *rrdLayout) error {
+	c := rrdlite.NewCreator(filename, start, uint(l.Step))
+	c.DS("metric", l.DsType, l.Heartbeat, l.Min, l.Max)
+	for _, rra := range l.RRA {
+		for _, cf := range rra.CF {
+			c.RRA(cf, 0, rra.Steps, rra.Rows)
+		}
+	}
 	return c.Create(true)
 }
 
@@ -266,11 +269,11 @@ func PullByKey(key string) {
 	if item == nil {
 		return
 	}
-	node, err := Consistent.Get(item.PrimaryKey())
+	ch, err := MigrateTaskChan(item.PrimaryKey())
 	if err != nil {
 		return
 	}
-	Net_task_ch[node] <- &Net_task_t{
+	ch <- &Net_task_t{
 		Method: NET_TASK_M_PULL,
 		Key:    key,
 		Done:   done,
@@ -301,7 +304,7 @@ func FlushRRD(idx int, force bool) {
 		flag, _ := store.GraphItems.GetFlag(key)
 
 		//write err data to local filename
-		if force == false && g.Config().Migrate.Enabled && flag&g.GRAPH_F_MISS != 0 {
+		if force == false && g.Migrating() && flag&g.GRAPH_F_MISS != 0 {
 			if time.Since(begin) > time.Millisecond*g.FLUSH_DISK_STEP {
 				atomic.StoreInt32(&flushrrd_timeout, 1)
 			}
@@ -0,0 +1,204 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rrdtool
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	cmodel "github.com/open-falcon/falcon-plus/common/model"
+	"github.com/toolkits/file"
+
+	"github.com/open-falcon/falcon-plus/modules/graph/g"
+	"github.com/open-falcon/falcon-plus/modules/graph/tsdb"
+)
+
+const (
+	ENGINE_RRD  = "rrd"
+	ENGINE_TSDB = "tsdb"
+)
+
+// 存储引擎, 数据文件的名字由g.RrdFileName生成.
+// 除了Exists和Remove, 其他方法都只在io worker中调用
+type Storage interface {
+	Exists(filename string) bool
+	Flush(filename string, items []*cmodel.GraphItem) error
+	Fetch(filename string, cf string, start, end int64, step int) ([]*cmodel.RRDData, error)
+	// 读取和写入整个数据文件, 用于迁移, 写入时文件必须不存在
+	Read(filename string) ([]byte, error)
+	Write(filename string, data []byte) error
+	Remove(filename string) error
+	Layout(filename string) (*rrdLayout, error)
+}
+
+var storage Storage
+
+func openStorage(cfg *g.GlobalConfig) (Storage, error) {
+	if cfg.RRD.Engine != ENGINE_TSDB {
+		return rrdStorage{}, nil
+	}
+	db, err := tsdb.Open(tsdbDir(cfg.RRD.Storage))
+	if err != nil {
+		return nil, err
+	}
+	go compactTask(db, cfg.RRD.CompactInterval)
+	return &tsdbStorage{db: db}, nil
+}
+
+func tsdbDir(storage string) string {
+	return filepath.Join(storage, "tsdb")
+}
+
+// 每个rrd文件保存一个counter
+type rrdStorage struct{}
+
+func (rrdStorage) Exists(filename string) bool {
+	return file.IsExist(filename)
+}
+
+func (rrdStorage) Flush(filename string, items []*cmodel.GraphItem) error {
+	return flushrrd(filename, items)
+}
+
+func (rrdStorage) Fetch(filename string, cf string, start, end int64, step int) ([]*cmodel.RRDData, error) {
+	return fetch(filename, cf, start, end, step)
+}
+
+func (rrdStorage) Read(filename string) ([]byte, error) {
+	return ioutil.ReadFile(filename)
+}
+
+func (rrdStorage) Write(filename string, data []byte) error {
+	if err := file.InsureDir(file.Dir(filename)); err != nil {
+		return err
+	}
+	return writeFile(filename, data, 0644)
+}
+
+func (rrdStorage) Remove(filename string) error {
+	return os.Remove(filename)
+}
+
+func (rrdStorage) Layout(filename string) (*rrdLayout, error) {
+	return readLayout(filename)
+}
+
+// 所有counter保存在storage/tsdb下的256个数据文件中, 以rrd文件名(md5_dstype_step)作为key
+type tsdbStorage struct {
+	db *tsdb.DB
+}
+
+func tsdbKey(filename string) string {
+	return strings.TrimSuffix(filepath.Base(filename), ".rrd")
+}
+
+func tiersOf(rras []*g.RRAConfig) []*tsdb.Tier {
+	tiers := make([]*tsdb.Tier, len(rras))
+	for i, rra := range rras {
+		tiers[i] = &tsdb.Tier{Steps: rra.Steps, Rows: rra.Rows, CF: rra.CF}
+	}
+	return tiers
+}
+
+func (this *tsdbStorage) Exists(filename string) bool {
+	return this.db.Exists(tsdbKey(filename))
+}
+
+func (this *tsdbStorage) Flush(filename string, items []*cmodel.GraphItem) error {
+	if len(items) == 0 {
+		return nil
+	}
+	key := tsdbKey(filename)
+	if !this.db.Exists(key) {
+		item := items[0]
+		_, rras := RetentionFor(item.Metric, item.Tags)
+		err := this.db.Create(key, &tsdb.Meta{
+			DsType:    item.DsType,
+			Step:      item.Step,
+			Heartbeat: item.Heartbeat,
+			Min:       item.Min,
+			Max:       item.Max,
+			Tiers:     tiersOf(rras),
+		})
+		if err != nil && !os.IsExist(err) {
+			return err
+		}
+	}
+
+	points := make([]tsdb.Point, len(items))
+	for i, item := range items {
+		points[i] = tsdb.Point{Ts: item.Timestamp, Value: item.Value}
+	}
+	return this.db.Append(key, points)
+}
+
+func (this *tsdbStorage) Fetch(filename string, cf string, start, end int64, step int) ([]*cmodel.RRDData, error) {
+	_, points, err := this.db.Fetch(tsdbKey(filename), cf, start, end, step)
+	if err != nil {
+		return []*cmodel.RRDData{}, err
+	}
+	ret := make([]*cmodel.RRDData, len(points))
+	for i, p := range points {
+		ret[i] = &cmodel.RRDData{Timestamp: p.Ts, Value: cmodel.JsonFloat(p.Value)}
+	}
+	return ret, nil
+}
+
+func (this *tsdbStorage) Read(filename string) ([]byte, error) {
+	return this.db.Export(tsdbKey(filename))
+}
+
+func (this *tsdbStorage) Write(filename string, data []byte) error {
+	return this.db.Import(tsdbKey(filename), data)
+}
+
+func (this *tsdbStorage) Remove(filename string) error {
+	return this.db.Delete(tsdbKey(filename))
+}
+
+func (this *tsdbStorage) Layout(filename string) (*rrdLayout, error) {
+	meta, lastTs, err := this.db.Info(tsdbKey(filename))
+	if err != nil {
+		return nil, err
+	}
+	l := &rrdLayout{
+		DsType:    meta.DsType,
+		Step:      meta.Step,
+		Heartbeat: meta.Heartbeat,
+		Min:       meta.Min,
+		Max:       meta.Max,
+		LastTs:    lastTs,
+	}
+	for _, t := range meta.Tiers {
+		l.RRA = append(l.RRA, &g.RRAConfig{CF: t.CF, Steps: t.Steps, Rows: t.Rows})
+	}
+	return l, nil
+}
+
+// 依次合并每个分片, interval内合并一遍
+func compactTask(db *tsdb.DB, interval int) {
+	ticker := time.NewTicker(time.Duration(interval) * time.Second / tsdb.SHARD_NUM)
+	defer ticker.Stop()
+	for i := 0; ; i++ {
+		<-ticker.C
+		if err := db.Compact(i % tsdb.SHARD_NUM); err != nil {
+			log.Printf("tsdb compact shard %d fail: %v", i%tsdb.SHARD_NUM, err)
+		}
+	}
+}
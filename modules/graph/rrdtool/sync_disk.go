@@ -16,14 +16,12 @@ package rrdtool
 
 import (
 	"io"
-	"io/ioutil"
 	"log"
 	"os"
 	"time"
 
 	"github.com/open-falcon/falcon-plus/modules/graph/g"
 	"github.com/open-falcon/falcon-plus/modules/graph/store"
-	"github.com/toolkits/file"
 )
 
 const (
@@ -32,6 +30,8 @@ const (
 	IO_TASK_M_WRITE
 	IO_TASK_M_FLUSH
 	IO_TASK_M_FETCH
+	IO_TASK_M_INFO
+	IO_TASK_M_RELAYOUT
 )
 
 type io_task_t struct {
@@ -93,27 +93,32 @@ func ioWorker() {
 		case task := <-io_task_chan:
 			if task.method == IO_TASK_M_READ {
 				if args, ok := task.args.(*readfile_t); ok {
-					args.data, err = ioutil.ReadFile(args.filename)
+					args.data, err = storage.Read(args.filename)
 					task.done <- err
 				}
 			} else if task.method == IO_TASK_M_WRITE {
 				//filename must not exist
 				if args, ok := task.args.(*g.File); ok {
-					baseDir := file.Dir(args.Filename)
-					if err = file.InsureDir(baseDir); err != nil {
-						task.done <- err
-					}
-					task.done <- writeFile(args.Filename, args.Body, 0644)
+					task.done <- storage.Write(args.Filename, args.Body)
 				}
 			} else if task.method == IO_TASK_M_FLUSH {
 				if args, ok := task.args.(*flushfile_t); ok {
-					task.done <- flushrrd(args.filename, args.items)
+					task.done <- storage.Flush(args.filename, args.items)
 				}
 			} else if task.method == IO_TASK_M_FETCH {
 				if args, ok := task.args.(*fetch_t); ok {
-					args.data, err = fetch(args.filename, args.cf, args.start, args.end, args.step)
+					args.data, err = storage.Fetch(args.filename, args.cf, args.start, args.end, args.step)
 					task.done <- err
 				}
+			} else if task.method == IO_TASK_M_INFO {
+				if args, ok := task.args.(*info_t); ok {
+					args.layout, err = storage.Layout(args.filename)
+					task.done <- err
+				}
+			} else if task.method == IO_TASK_M_RELAYOUT {
+				if args, ok := task.args.(*relayout_t); ok {
+					task.done <- commitRelayout(args)
+				}
 			}
 		}
 	}
@@ -179,7 +179,7 @@ func (this *GraphItemMap) PushFront(key string,
 		safeList := &SafeLinkedList{L: list.New()}
 		safeList.L.PushFront(item)
 
-		if cfg.Migrate.Enabled && !g.IsRrdFileExist(g.RrdFileName(
+		if g.Migrating() && !g.IsRrdFileExist(g.RrdFileName(
 			cfg.RRD.Storage, md5, item.DsType, item.Step)) {
 			safeList.Flag = g.GRAPH_F_MISS
 		}
@@ -0,0 +1,79 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tsdb
+
+import (
+	"io"
+)
+
+// 按bit读写的字节流, 高位在前
+type bstream struct {
+	stream []byte
+	count  uint8 // 最后一个字节中还可以写入的bit数
+}
+
+func (b *bstream) bytes() []byte {
+	return b.stream
+}
+
+func (b *bstream) writeBit(bit bool) {
+	if b.count == 0 {
+		b.stream = append(b.stream, 0)
+		b.count = 8
+	}
+	if bit {
+		b.stream[len(b.stream)-1] |= 1 << (b.count - 1)
+	}
+	b.count--
+}
+
+func (b *bstream) writeBits(u uint64, nbits int) {
+	for i := nbits - 1; i >= 0; i-- {
+		b.writeBit((u>>uint(i))&1 == 1)
+	}
+}
+
+type breader struct {
+	stream []byte
+	pos    int // 已经读取的bit数
+}
+
+func newBReader(b []byte) *breader {
+	return &breader{stream: b}
+}
+
+func (r *breader) readBit() (bool, error) {
+	if r.pos >= len(r.stream)*8 {
+		return false, io.ErrUnexpectedEOF
+	}
+	bit := r.stream[r.pos/8]&(1<<uint(7-r.pos%8)) != 0
+	r.pos++
+	return bit, nil
+}
+
+func (r *breader) readBits(nbits int) (uint64, error) {
+	var u uint64
+	for i := 0; i < nbits; i++ {
+		bit, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		u <<= 1
+		if bit {
+			u |= 1
+		}
+	}
+	return u, nil
+}
@@ -0,0 +1,325 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tsdb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// Gorilla的时间戳编码: 保存相邻两个时间差的差值(delta of delta), 等间隔的数据每个点只需要1bit
+type tsEncoder struct {
+	b     *bstream
+	n     int
+	t     int64
+	delta int64
+}
+
+var dodBuckets = []struct {
+	prefix uint64
+	plen   int
+	nbits  int
+}{
+	{0x02, 2, 7},  // 10
+	{0x06, 3, 9},  // 110
+	{0x0e, 4, 12}, // 1110
+}
+
+func bitRange(x int64, nbits int) bool {
+	return -((1<<uint(nbits-1))-1) <= x && x <= 1<<uint(nbits-1)
+}
+
+func (e *tsEncoder) write(t int64) {
+	if e.n == 0 {
+		e.b.writeBits(uint64(t), 64)
+	} else {
+		delta := t - e.t
+		dod := delta - e.delta
+		e.delta = delta
+		e.writeDod(dod)
+	}
+	e.t = t
+	e.n++
+}
+
+func (e *tsEncoder) writeDod(dod int64) {
+	if dod == 0 {
+		e.b.writeBit(false)
+		return
+	}
+	for _, bucket := range dodBuckets {
+		if bitRange(dod, bucket.nbits) {
+			e.b.writeBits(bucket.prefix, bucket.plen)
+			e.b.writeBits(uint64(dod)&(1<<uint(bucket.nbits)-1), bucket.nbits)
+			return
+		}
+	}
+	e.b.writeBits(0x0f, 4) // 1111
+	e.b.writeBits(uint64(dod), 64)
+}
+
+type tsDecoder struct {
+	r     *breader
+	n     int
+	t     int64
+	delta int64
+}
+
+func (d *tsDecoder) read() (int64, error) {
+	if d.n == 0 {
+		u, err := d.r.readBits(64)
+		if err != nil {
+			return 0, err
+		}
+		d.t = int64(u)
+		d.n++
+		return d.t, nil
+	}
+
+	// 前缀最多4个1
+	var prefix int
+	for prefix < 4 {
+		bit, err := d.r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		if !bit {
+			break
+		}
+		prefix++
+	}
+	var dod int64
+	if prefix == 4 {
+		u, err := d.r.readBits(64)
+		if err != nil {
+			return 0, err
+		}
+		dod = int64(u)
+	} else if prefix > 0 {
+		nbits := dodBuckets[prefix-1].nbits
+		u, err := d.r.readBits(nbits)
+		if err != nil {
+			return 0, err
+		}
+		dod = int64(u)
+		if u > 1<<uint(nbits-1) {
+			dod -= 1 << uint(nbits)
+		}
+	}
+	d.delta += dod
+	d.t += d.delta
+	d.n++
+	return d.t, nil
+}
+
+// Gorilla的浮点数编码: 保存和前一个值异或之后的有效bit
+type xorEncoder struct {
+	b        *bstream
+	n        int
+	v        uint64
+	leading  uint8
+	trailing uint8
+}
+
+// math/bits要go1.9才有
+func leadingZeros64(x uint64) int {
+	if x == 0 {
+		return 64
+	}
+	n := 0
+	for x&(1<<63) == 0 {
+		x <<= 1
+		n++
+	}
+	return n
+}
+
+func trailingZeros64(x uint64) int {
+	if x == 0 {
+		return 64
+	}
+	n := 0
+	for x&1 == 0 {
+		x >>= 1
+		n++
+	}
+	return n
+}
+
+func (e *xorEncoder) write(v float64) {
+	u := math.Float64bits(v)
+	if e.n == 0 {
+		e.b.writeBits(u, 64)
+		e.leading = 0xff
+	} else if delta := u ^ e.v; delta == 0 {
+		e.b.writeBit(false)
+	} else {
+		e.b.writeBit(true)
+		leading := uint8(leadingZeros64(delta))
+		trailing := uint8(trailingZeros64(delta))
+		if leading >= 32 {
+			leading = 31
+		}
+		if e.leading != 0xff && leading >= e.leading && trailing >= e.trailing {
+			// 有效bit在上一个值的范围内
+			e.b.writeBit(false)
+			e.b.writeBits(delta>>e.trailing, 64-int(e.leading)-int(e.trailing))
+		} else {
+			e.leading, e.trailing = leading, trailing
+			sigbits := 64 - int(leading) - int(trailing)
+			e.b.writeBit(true)
+			e.b.writeBits(uint64(leading), 5)
+			e.b.writeBits(uint64(sigbits), 6) // 64写成0
+			e.b.writeBits(delta>>trailing, sigbits)
+		}
+	}
+	e.v = u
+	e.n++
+}
+
+type xorDecoder struct {
+	r        *breader
+	n        int
+	v        uint64
+	leading  uint8
+	trailing uint8
+}
+
+func (d *xorDecoder) read() (float64, error) {
+	if d.n == 0 {
+		u, err := d.r.readBits(64)
+		if err != nil {
+			return 0, err
+		}
+		d.v = u
+		d.n++
+		return math.Float64frombits(d.v), nil
+	}
+
+	d.n++
+	bit, err := d.r.readBit()
+	if err != nil || !bit {
+		return math.Float64frombits(d.v), err
+	}
+	if bit, err = d.r.readBit(); err != nil {
+		return 0, err
+	}
+	if bit {
+		leading, err := d.r.readBits(5)
+		if err != nil {
+			return 0, err
+		}
+		sigbits, err := d.r.readBits(6)
+		if err != nil {
+			return 0, err
+		}
+		if sigbits == 0 {
+			sigbits = 64
+		}
+		d.leading, d.trailing = uint8(leading), uint8(64-leading-sigbits)
+	}
+	u, err := d.r.readBits(64 - int(d.leading) - int(d.trailing))
+	if err != nil {
+		return 0, err
+	}
+	d.v ^= u << d.trailing
+	return math.Float64frombits(d.v), nil
+}
+
+// 原始数据的chunk: 时间戳和值交替编码在一个流中
+func encodeRaw(points []Point) []byte {
+	b := &bstream{}
+	te, ve := &tsEncoder{b: b}, &xorEncoder{b: b}
+	for _, p := range points {
+		te.write(p.Ts)
+		ve.write(p.Value)
+	}
+	return b.bytes()
+}
+
+func decodeRaw(payload []byte, count int) ([]Point, error) {
+	r := newBReader(payload)
+	td, vd := &tsDecoder{r: r}, &xorDecoder{r: r}
+	points := make([]Point, count)
+	for i := range points {
+		ts, err := td.read()
+		if err != nil {
+			return nil, err
+		}
+		v, err := vd.read()
+		if err != nil {
+			return nil, err
+		}
+		points[i] = Point{Ts: ts, Value: v}
+	}
+	return points, nil
+}
+
+// 降采样数据的chunk: 时间戳、avg、max、min、last分别编码成一列, 每列前面是列的字节数
+func encodeTier(points []TierPoint) []byte {
+	cols := make([]*bstream, 5)
+	for i := range cols {
+		cols[i] = &bstream{}
+	}
+	te := &tsEncoder{b: cols[0]}
+	ves := []*xorEncoder{{b: cols[1]}, {b: cols[2]}, {b: cols[3]}, {b: cols[4]}}
+	for _, p := range points {
+		te.write(p.Ts)
+		ves[0].write(p.Avg)
+		ves[1].write(p.Max)
+		ves[2].write(p.Min)
+		ves[3].write(p.Last)
+	}
+
+	buf := []byte{}
+	tmp := make([]byte, binary.MaxVarintLen64)
+	for _, col := range cols {
+		n := binary.PutUvarint(tmp, uint64(len(col.bytes())))
+		buf = append(buf, tmp[:n]...)
+		buf = append(buf, col.bytes()...)
+	}
+	return buf
+}
+
+func decodeTier(payload []byte, count int) ([]TierPoint, error) {
+	cols := make([]*breader, 5)
+	for i := range cols {
+		l, n := binary.Uvarint(payload)
+		if n <= 0 || uint64(len(payload)-n) < l {
+			return nil, fmt.Errorf("bad tier chunk")
+		}
+		cols[i] = newBReader(payload[n : n+int(l)])
+		payload = payload[n+int(l):]
+	}
+
+	td := &tsDecoder{r: cols[0]}
+	vds := []*xorDecoder{{r: cols[1]}, {r: cols[2]}, {r: cols[3]}, {r: cols[4]}}
+	points := make([]TierPoint, count)
+	for i := range points {
+		ts, err := td.read()
+		if err != nil {
+			return nil, err
+		}
+		vals := make([]float64, 4)
+		for j, vd := range vds {
+			if vals[j], err = vd.read(); err != nil {
+				return nil, err
+			}
+		}
+		points[i] = TierPoint{Ts: ts, Avg: vals[0], Max: vals[1], Min: vals[2], Last: vals[3]}
+	}
+	return points, nil
+}
@@ -0,0 +1,114 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tsdb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+)
+
+// 数据文件由记录组成, 只在末尾追加, 合并时整体重写:
+// type(1) keyLen(2) key steps(4) minTs(8) maxTs(8) count(4) lastTs(8) last(8) payloadLen(4) payload crc32(4)
+const (
+	REC_META   byte = 1 // payload为json格式的Meta
+	REC_RAW    byte = 2 // 原始数据, lastTs和last为最后一次写入的时间和原始值
+	REC_TIER   byte = 3 // 降采样数据, steps为每个点包含的step数
+	REC_DELETE byte = 4
+
+	recHeaderSize = 1 + 2 + 4 + 8 + 8 + 4 + 8 + 8 + 4
+	maxPayload    = 64 << 20
+)
+
+type record struct {
+	typ     byte
+	key     string
+	steps   int
+	minTs   int64
+	maxTs   int64
+	count   int
+	lastTs  int64
+	last    float64
+	payload []byte
+}
+
+func (rec *record) size() int {
+	return recHeaderSize + len(rec.key) + len(rec.payload) + 4
+}
+
+func (rec *record) encode() []byte {
+	buf := make([]byte, rec.size())
+	buf[0] = rec.typ
+	binary.LittleEndian.PutUint16(buf[1:], uint16(len(rec.key)))
+	p := 3 + copy(buf[3:], rec.key)
+	binary.LittleEndian.PutUint32(buf[p:], uint32(rec.steps))
+	binary.LittleEndian.PutUint64(buf[p+4:], uint64(rec.minTs))
+	binary.LittleEndian.PutUint64(buf[p+12:], uint64(rec.maxTs))
+	binary.LittleEndian.PutUint32(buf[p+20:], uint32(rec.count))
+	binary.LittleEndian.PutUint64(buf[p+24:], uint64(rec.lastTs))
+	binary.LittleEndian.PutUint64(buf[p+32:], math.Float64bits(rec.last))
+	binary.LittleEndian.PutUint32(buf[p+40:], uint32(len(rec.payload)))
+	p += 44 + copy(buf[p+44:], rec.payload)
+	binary.LittleEndian.PutUint32(buf[p:], crc32.ChecksumIEEE(buf[:p]))
+	return buf
+}
+
+// 读取一条记录, 返回记录的字节数; 文件末尾不完整的记录返回io.ErrUnexpectedEOF
+func readRecord(r io.Reader) (*record, int, error) {
+	head := make([]byte, 3)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return nil, 0, err
+	}
+	keyLen := int(binary.LittleEndian.Uint16(head[1:]))
+	rest := make([]byte, keyLen+recHeaderSize-3)
+	if _, err := io.ReadFull(r, rest); err != nil {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+	p := keyLen
+	payloadLen := int(binary.LittleEndian.Uint32(rest[p+40:]))
+	if payloadLen > maxPayload {
+		return nil, 0, fmt.Errorf("bad payload length %d", payloadLen)
+	}
+	tail := make([]byte, payloadLen+4)
+	if _, err := io.ReadFull(r, tail); err != nil {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+
+	crc := crc32.NewIEEE()
+	crc.Write(head)
+	crc.Write(rest)
+	crc.Write(tail[:payloadLen])
+	if crc.Sum32() != binary.LittleEndian.Uint32(tail[payloadLen:]) {
+		return nil, 0, fmt.Errorf("checksum mismatch")
+	}
+
+	rec := &record{
+		typ:     head[0],
+		key:     string(rest[:keyLen]),
+		steps:   int(binary.LittleEndian.Uint32(rest[p:])),
+		minTs:   int64(binary.LittleEndian.Uint64(rest[p+4:])),
+		maxTs:   int64(binary.LittleEndian.Uint64(rest[p+12:])),
+		count:   int(binary.LittleEndian.Uint32(rest[p+20:])),
+		lastTs:  int64(binary.LittleEndian.Uint64(rest[p+24:])),
+		last:    math.Float64frombits(binary.LittleEndian.Uint64(rest[p+32:])),
+		payload: tail[:payloadLen],
+	}
+	if rec.typ < REC_META || rec.typ > REC_DELETE {
+		return nil, 0, fmt.Errorf("bad record type %d", rec.typ)
+	}
+	return rec, len(head) + len(rest) + len(tail), nil
+}
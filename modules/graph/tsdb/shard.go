@@ -0,0 +1,632 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tsdb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"sync"
+)
+
+type chunkRef struct {
+	off   int64
+	size  int
+	minTs int64
+	maxTs int64
+	count int
+}
+
+type series struct {
+	meta   *Meta
+	lastTs int64
+	last   float64
+	raw    []*chunkRef
+	tiers  map[int][]*chunkRef
+}
+
+type shard struct {
+	sync.RWMutex
+	path   string
+	f      *os.File
+	size   int64
+	series map[string]*series
+	dirty  bool // 上次合并之后是否有写入
+}
+
+func openShard(path string) (*shard, error) {
+	os.Remove(path + ".tmp")
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	sh := &shard{path: path, f: f, series: make(map[string]*series)}
+	if err := sh.scan(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return sh, nil
+}
+
+func (sh *shard) close() {
+	sh.Lock()
+	defer sh.Unlock()
+	sh.f.Close()
+}
+
+// 读取所有记录建立索引, 末尾不完整或者损坏的记录被截掉
+func (sh *shard) scan() error {
+	r := bufio.NewReaderSize(io.NewSectionReader(sh.f, 0, math.MaxInt64), 1<<20)
+	var off int64
+	for {
+		rec, n, err := readRecord(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Printf("tsdb: bad record in %s at %d, truncate: %v", sh.path, off, err)
+			if err := sh.f.Truncate(off); err != nil {
+				return err
+			}
+			break
+		}
+		indexRecord(sh.series, rec, off, n)
+		off += int64(n)
+	}
+	sh.size = off
+	return nil
+}
+
+func indexRecord(m map[string]*series, rec *record, off int64, n int) {
+	s := m[rec.key]
+	switch rec.typ {
+	case REC_META:
+		meta := &Meta{}
+		if err := json.Unmarshal(rec.payload, meta); err != nil {
+			log.Printf("tsdb: bad meta of %s: %v", rec.key, err)
+			return
+		}
+		if s == nil {
+			s = &series{tiers: make(map[int][]*chunkRef)}
+			m[rec.key] = s
+		}
+		s.meta = meta
+	case REC_DELETE:
+		delete(m, rec.key)
+	case REC_RAW:
+		if s == nil {
+			return
+		}
+		if rec.count > 0 {
+			s.raw = append(s.raw, &chunkRef{off: off, size: n, minTs: rec.minTs, maxTs: rec.maxTs, count: rec.count})
+		}
+		if rec.lastTs >= s.lastTs {
+			s.lastTs, s.last = rec.lastTs, rec.last
+		}
+	case REC_TIER:
+		if s == nil {
+			return
+		}
+		s.tiers[rec.steps] = append(s.tiers[rec.steps], &chunkRef{off: off, size: n, minTs: rec.minTs, maxTs: rec.maxTs, count: rec.count})
+	}
+}
+
+// 调用时持有写锁
+func (sh *shard) writeRecords(recs ...*record) error {
+	buf := []byte{}
+	for _, rec := range recs {
+		buf = append(buf, rec.encode()...)
+	}
+	if _, err := sh.f.WriteAt(buf, sh.size); err != nil {
+		sh.f.Truncate(sh.size)
+		return err
+	}
+	off := sh.size
+	for _, rec := range recs {
+		n := rec.size()
+		indexRecord(sh.series, rec, off, n)
+		off += int64(n)
+	}
+	sh.size = off
+	sh.dirty = true
+	return nil
+}
+
+func (sh *shard) readAt(ref *chunkRef) ([]byte, error) {
+	buf := make([]byte, ref.size)
+	_, err := sh.f.ReadAt(buf, ref.off)
+	return buf, err
+}
+
+func (sh *shard) readRecordAt(ref *chunkRef) (*record, error) {
+	buf, err := sh.readAt(ref)
+	if err != nil {
+		return nil, err
+	}
+	rec, _, err := readRecord(bytes.NewReader(buf))
+	return rec, err
+}
+
+// maxTs大于from的chunk中的原始数据, 按时间排序. 损坏的chunk被跳过
+func (sh *shard) readRaw(s *series, from int64) []Point {
+	points := []Point{}
+	for _, ref := range s.raw {
+		if ref.maxTs <= from {
+			continue
+		}
+		rec, err := sh.readRecordAt(ref)
+		if err == nil {
+			var ps []Point
+			if ps, err = decodeRaw(rec.payload, rec.count); err == nil {
+				points = append(points, ps...)
+				continue
+			}
+		}
+		log.Printf("tsdb: read chunk of %s at %d fail: %v", sh.path, ref.off, err)
+	}
+
+	// 时间相同时保留后写入的点
+	sort.Stable(pointSlice(points))
+	ret := points[:0]
+	for i, p := range points {
+		if i+1 < len(points) && points[i+1].Ts == p.Ts {
+			continue
+		}
+		ret = append(ret, p)
+	}
+	return ret
+}
+
+func (sh *shard) readTier(s *series, steps int, from int64) []TierPoint {
+	points := []TierPoint{}
+	for _, ref := range s.tiers[steps] {
+		if ref.maxTs <= from {
+			continue
+		}
+		rec, err := sh.readRecordAt(ref)
+		if err == nil {
+			var ps []TierPoint
+			if ps, err = decodeTier(rec.payload, rec.count); err == nil {
+				points = append(points, ps...)
+				continue
+			}
+		}
+		log.Printf("tsdb: read chunk of %s at %d fail: %v", sh.path, ref.off, err)
+	}
+
+	sort.Stable(tierPointSlice(points))
+	ret := points[:0]
+	for i, p := range points {
+		if p.Ts <= from || (i+1 < len(points) && points[i+1].Ts == p.Ts) {
+			continue
+		}
+		ret = append(ret, p)
+	}
+	return ret
+}
+
+func metaRecord(key string, meta *Meta) *record {
+	payload, _ := json.Marshal(meta)
+	return &record{typ: REC_META, key: key, payload: payload}
+}
+
+// 按CHUNK_MAX_POINT拆分, 没有数据时也写入一条记录保存lastTs和last
+func rawRecords(key string, points []Point, lastTs int64, last float64) []*record {
+	recs := []*record{}
+	for len(recs) == 0 || len(points) > 0 {
+		n := len(points)
+		if n > CHUNK_MAX_POINT {
+			n = CHUNK_MAX_POINT
+		}
+		rec := &record{typ: REC_RAW, key: key, count: n, lastTs: lastTs, last: last, payload: encodeRaw(points[:n])}
+		if n > 0 {
+			rec.minTs, rec.maxTs = points[0].Ts, points[n-1].Ts
+		}
+		recs = append(recs, rec)
+		points = points[n:]
+	}
+	return recs
+}
+
+func tierRecords(key string, steps int, points []TierPoint) []*record {
+	recs := []*record{}
+	for len(points) > 0 {
+		n := len(points)
+		if n > CHUNK_MAX_POINT {
+			n = CHUNK_MAX_POINT
+		}
+		recs = append(recs, &record{
+			typ:     REC_TIER,
+			key:     key,
+			steps:   steps,
+			minTs:   points[0].Ts,
+			maxTs:   points[n-1].Ts,
+			count:   n,
+			payload: encodeTier(points[:n]),
+		})
+		points = points[n:]
+	}
+	return recs
+}
+
+func (sh *shard) exists(key string) bool {
+	sh.RLock()
+	defer sh.RUnlock()
+	_, exists := sh.series[key]
+	return exists
+}
+
+func (sh *shard) create(key string, meta *Meta) error {
+	sh.Lock()
+	defer sh.Unlock()
+	if _, exists := sh.series[key]; exists {
+		return exist(key)
+	}
+	return sh.writeRecords(metaRecord(key, meta))
+}
+
+// 计算需要保存的点, 返回写入之后的lastTs和last
+func (s *series) ingest(points []Point) ([]Point, int64, float64) {
+	m := s.meta
+	min, max := parseLimit(m.Min, math.Inf(-1)), parseLimit(m.Max, math.Inf(1))
+	heartbeat := int64(m.Heartbeat)
+	if heartbeat <= 0 {
+		heartbeat = 2 * int64(m.Step)
+	}
+
+	sort.Stable(pointSlice(points))
+	lastTs, last := s.lastTs, s.last
+	ret := []Point{}
+	for _, p := range points {
+		if p.Ts <= lastTs {
+			continue
+		}
+		prevTs, prev := lastTs, last
+		lastTs, last = p.Ts, p.Value
+
+		v := p.Value
+		switch m.DsType {
+		case "COUNTER", "DERIVE":
+			if prevTs == 0 || math.IsNaN(prev) || p.Ts-prevTs > heartbeat {
+				continue
+			}
+			v = (p.Value - prev) / float64(p.Ts-prevTs)
+			if m.DsType == "COUNTER" && v < 0 {
+				continue
+			}
+		case "ABSOLUTE":
+			if prevTs == 0 || p.Ts-prevTs > heartbeat {
+				continue
+			}
+			v = p.Value / float64(p.Ts-prevTs)
+		}
+		if math.IsNaN(v) || math.IsInf(v, 0) || v < min || v > max {
+			continue
+		}
+		ret = append(ret, Point{Ts: p.Ts, Value: v})
+	}
+	return ret, lastTs, last
+}
+
+func (sh *shard) append(key string, points []Point) error {
+	sh.Lock()
+	defer sh.Unlock()
+	s, exists := sh.series[key]
+	if !exists {
+		return notExist(key)
+	}
+	ps, lastTs, last := s.ingest(points)
+	if lastTs == s.lastTs {
+		return nil
+	}
+	return sh.writeRecords(rawRecords(key, ps, lastTs, last)...)
+}
+
+func (sh *shard) fetch(key string, cf string, start, end int64, reqStep int64) (int64, []Point, error) {
+	sh.RLock()
+	defer sh.RUnlock()
+	s, exists := sh.series[key]
+	if !exists {
+		return 0, nil, notExist(key)
+	}
+	m := s.meta
+	step := int64(m.Step)
+
+	// 选择覆盖整个时间段的最细的归档, 都不能覆盖时选择时间最长的
+	tiers := append([]*Tier{{Steps: 1, Rows: m.rawRows()}}, m.downTiers()...)
+	var tier *Tier
+	for _, t := range tiers {
+		if s.lastTs-int64(t.Steps*t.Rows)*step <= start && int64(t.Steps)*step >= reqStep {
+			tier = t
+			break
+		}
+	}
+	if tier == nil {
+		for _, t := range tiers {
+			if tier == nil || t.Steps*t.Rows > tier.Steps*tier.Rows {
+				tier = t
+			}
+		}
+	}
+
+	res := int64(tier.Steps) * step
+	from, to := start-start%res, end-end%res
+	if end%res != 0 {
+		to += res
+	}
+
+	var points []TierPoint
+	if tier.Steps == 1 {
+		points = downsample([]*source{rawSource(sh.readRaw(s, from), step)}, res, from, to)
+	} else {
+		// 上次合并之后的数据用更细的数据计算
+		points = sh.readTier(s, tier.Steps, from)
+		maxTs := from
+		if len(points) > 0 {
+			maxTs = points[len(points)-1].Ts
+		}
+		complete := s.lastTs - s.lastTs%res
+		if complete > to {
+			complete = to
+		}
+		if complete > maxTs {
+			sources := []*source{rawSource(sh.readRaw(s, maxTs), step)}
+			for _, t := range m.downTiers() {
+				if t.Steps < tier.Steps && tier.Steps%t.Steps == 0 {
+					sources = append(sources, &source{res: int64(t.Steps) * step, points: sh.readTier(s, t.Steps, maxTs)})
+				}
+			}
+			points = append(points, downsample(sources, res, maxTs, complete)...)
+		}
+	}
+
+	ret := make([]Point, 0, (to-from)/res)
+	i := 0
+	for ts := from + res; ts <= to; ts += res {
+		for i < len(points) && points[i].Ts < ts {
+			i++
+		}
+		v := math.NaN()
+		if i < len(points) && points[i].Ts == ts {
+			v = points[i].value(cf)
+		}
+		ret = append(ret, Point{Ts: ts, Value: v})
+	}
+	return res, ret, nil
+}
+
+func (sh *shard) info(key string) (*Meta, int64, error) {
+	sh.RLock()
+	defer sh.RUnlock()
+	s, exists := sh.series[key]
+	if !exists {
+		return nil, 0, notExist(key)
+	}
+	meta := *s.meta
+	return &meta, s.lastTs, nil
+}
+
+func (sh *shard) setTiers(key string, tiers []*Tier) error {
+	sh.Lock()
+	defer sh.Unlock()
+	s, exists := sh.series[key]
+	if !exists {
+		return notExist(key)
+	}
+	meta := *s.meta
+	meta.Tiers = tiers
+	if err := meta.check(); err != nil {
+		return err
+	}
+	return sh.writeRecords(metaRecord(key, &meta))
+}
+
+func (sh *shard) delete(key string) error {
+	sh.Lock()
+	defer sh.Unlock()
+	if _, exists := sh.series[key]; !exists {
+		return notExist(key)
+	}
+	return sh.writeRecords(&record{typ: REC_DELETE, key: key})
+}
+
+func sortedSteps(tiers map[int][]*chunkRef) []int {
+	steps := []int{}
+	for k := range tiers {
+		steps = append(steps, k)
+	}
+	sort.Ints(steps)
+	return steps
+}
+
+// 依次为meta、原始数据、降采样数据和保存lastTs的记录, 相同的数据导出的内容相同
+func (sh *shard) export(key string) ([]byte, error) {
+	sh.RLock()
+	defer sh.RUnlock()
+	s, exists := sh.series[key]
+	if !exists {
+		return nil, notExist(key)
+	}
+
+	refs := append([]*chunkRef{}, s.raw...)
+	for _, steps := range sortedSteps(s.tiers) {
+		refs = append(refs, s.tiers[steps]...)
+	}
+	buf := metaRecord(key, s.meta).encode()
+	for _, ref := range refs {
+		b, err := sh.readAt(ref)
+		if err != nil {
+			return nil, err
+		}
+		buf = append(buf, b...)
+	}
+	buf = append(buf, (&record{typ: REC_RAW, key: key, lastTs: s.lastTs, last: s.last}).encode()...)
+	return buf, nil
+}
+
+func (sh *shard) importData(key string, data []byte) error {
+	recs := []*record{}
+	r := bytes.NewReader(data)
+	for {
+		rec, _, err := readRecord(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if rec.key != key || rec.typ == REC_DELETE {
+			return fmt.Errorf("bad record of %s", rec.key)
+		}
+		recs = append(recs, rec)
+	}
+	if len(recs) == 0 || recs[0].typ != REC_META {
+		return fmt.Errorf("meta of %s not found", key)
+	}
+
+	sh.Lock()
+	defer sh.Unlock()
+	if _, exists := sh.series[key]; exists {
+		return exist(key)
+	}
+	return sh.writeRecords(recs...)
+}
+
+func (sh *shard) load(key string, meta *Meta, raw []Point, tiers map[int][]TierPoint, lastTs int64, last float64) error {
+	recs := []*record{metaRecord(key, meta)}
+	recs = append(recs, rawRecords(key, raw, lastTs, last)...)
+	steps := []int{}
+	for k := range tiers {
+		steps = append(steps, k)
+	}
+	sort.Ints(steps)
+	for _, k := range steps {
+		recs = append(recs, tierRecords(key, k, tiers[k])...)
+	}
+
+	sh.Lock()
+	defer sh.Unlock()
+	if _, exists := sh.series[key]; exists {
+		return exist(key)
+	}
+	return sh.writeRecords(recs...)
+}
+
+// 合并之后每个counter的记录: meta, 原始数据, 降采样数据
+func (sh *shard) compactSeries(key string, s *series) []*record {
+	m := s.meta
+	step := int64(m.Step)
+	raw := sh.readRaw(s, math.MinInt64)
+	sources := []*source{rawSource(raw, step)}
+
+	// 已经不在策略中的归档也可以作为降采样的数据源
+	inMeta := make(map[int]bool)
+	for _, t := range m.downTiers() {
+		inMeta[t.Steps] = true
+	}
+	stored := make(map[int][]TierPoint)
+	for _, steps := range sortedSteps(s.tiers) {
+		stored[steps] = sh.readTier(s, steps, math.MinInt64)
+		if !inMeta[steps] && len(stored[steps]) > 0 {
+			sources = append(sources, &source{res: int64(steps) * step, points: stored[steps]})
+		}
+	}
+
+	tierRecs := []*record{}
+	for _, t := range m.downTiers() {
+		res := int64(t.Steps) * step
+		points := stored[t.Steps]
+		keepFrom := s.lastTs - int64(t.Rows)*res
+		from := keepFrom
+		if len(points) > 0 && points[len(points)-1].Ts > from {
+			from = points[len(points)-1].Ts
+		}
+		if complete := s.lastTs - s.lastTs%res; complete > from {
+			sort.Stable(sourceSlice(sources))
+			points = append(points, downsample(sources, res, from, complete)...)
+		}
+
+		i := sort.Search(len(points), func(i int) bool { return points[i].Ts > keepFrom })
+		points = points[i:]
+		if len(points) > 0 {
+			sources = append(sources, &source{res: res, points: points})
+		}
+		tierRecs = append(tierRecs, tierRecords(key, t.Steps, points)...)
+	}
+
+	keepFrom := s.lastTs - int64(m.rawRows())*step
+	i := sort.Search(len(raw), func(i int) bool { return raw[i].Ts > keepFrom })
+	recs := []*record{metaRecord(key, m)}
+	recs = append(recs, rawRecords(key, raw[i:], s.lastTs, s.last)...)
+	return append(recs, tierRecs...)
+}
+
+// 重写数据文件: 合并chunk, 计算降采样数据, 删除过期的数据和已经删除的counter
+func (sh *shard) compact() error {
+	sh.Lock()
+	defer sh.Unlock()
+	if !sh.dirty {
+		return nil
+	}
+
+	tmp := sh.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriterSize(f, 1<<20)
+	index := make(map[string]*series, len(sh.series))
+	var off int64
+	for key, s := range sh.series {
+		for _, rec := range sh.compactSeries(key, s) {
+			b := rec.encode()
+			if _, err = w.Write(b); err != nil {
+				break
+			}
+			indexRecord(index, rec, off, len(b))
+			off += int64(len(b))
+		}
+		if err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	f.Close()
+	if err == nil {
+		err = os.Rename(tmp, sh.path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	sh.f.Close()
+	if sh.f, err = os.OpenFile(sh.path, os.O_RDWR, 0644); err != nil {
+		return err
+	}
+	sh.series, sh.size, sh.dirty = index, off, false
+	return nil
+}
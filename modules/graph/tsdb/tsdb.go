@@ -0,0 +1,341 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// tsdb是graph的纯Go存储引擎:
+// 按counter的md5前两位分成256个数据文件, 每个文件中保存多个counter的数据块(chunk),
+// 原始数据和降采样数据都使用Gorilla的方式压缩. 写入时在文件末尾追加chunk,
+// 定期合并(compact)时把小的chunk合并成大的chunk, 计算降采样数据并删除过期数据.
+package tsdb
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"syscall"
+)
+
+const (
+	SHARD_NUM       = 256
+	CHUNK_MAX_POINT = 1024
+)
+
+type Point struct {
+	Ts    int64
+	Value float64
+}
+
+type pointSlice []Point
+
+func (this pointSlice) Len() int           { return len(this) }
+func (this pointSlice) Swap(i, j int)      { this[i], this[j] = this[j], this[i] }
+func (this pointSlice) Less(i, j int) bool { return this[i].Ts < this[j].Ts }
+
+// 降采样之后的点, 对应(Ts-res, Ts]这段时间
+type TierPoint struct {
+	Ts   int64
+	Avg  float64
+	Max  float64
+	Min  float64
+	Last float64
+}
+
+type tierPointSlice []TierPoint
+
+func (this tierPointSlice) Len() int           { return len(this) }
+func (this tierPointSlice) Swap(i, j int)      { this[i], this[j] = this[j], this[i] }
+func (this tierPointSlice) Less(i, j int) bool { return this[i].Ts < this[j].Ts }
+
+func (p *TierPoint) value(cf string) float64 {
+	switch cf {
+	case "MAX":
+		return p.Max
+	case "MIN":
+		return p.Min
+	case "LAST":
+		return p.Last
+	}
+	return p.Avg
+}
+
+// 归档策略, 每个点包含Steps个step, 存Rows个点; Steps为1的是原始数据.
+// 每个降采样的点都保存AVERAGE、MAX、MIN、LAST, CF只用于和rrd的配置保持一致
+type Tier struct {
+	Steps int      `json:"steps"`
+	Rows  int      `json:"rows"`
+	CF    []string `json:"cf"`
+}
+
+type tierSlice []*Tier
+
+func (this tierSlice) Len() int           { return len(this) }
+func (this tierSlice) Swap(i, j int)      { this[i], this[j] = this[j], this[i] }
+func (this tierSlice) Less(i, j int) bool { return this[i].Steps < this[j].Steps }
+
+type Meta struct {
+	DsType    string  `json:"dstype"`
+	Step      int     `json:"step"`
+	Heartbeat int     `json:"heartbeat"`
+	Min       string  `json:"min"` // U表示不限制
+	Max       string  `json:"max"`
+	Tiers     []*Tier `json:"tiers"`
+}
+
+func (m *Meta) check() error {
+	if m.Step <= 0 {
+		return fmt.Errorf("bad step %d", m.Step)
+	}
+	if len(m.Tiers) == 0 {
+		return fmt.Errorf("tiers is empty")
+	}
+	for _, t := range m.Tiers {
+		if t.Steps <= 0 || t.Rows <= 0 {
+			return fmt.Errorf("bad tier %+v", *t)
+		}
+	}
+	return nil
+}
+
+// 原始数据保存的点数, 没有配置Steps为1的归档时至少保存两个最小降采样周期
+func (m *Meta) rawRows() int {
+	rows, minSteps := 0, 0
+	for _, t := range m.Tiers {
+		if t.Steps == 1 {
+			rows = t.Rows
+		} else if minSteps == 0 || t.Steps < minSteps {
+			minSteps = t.Steps
+		}
+	}
+	if rows < 2*minSteps {
+		rows = 2 * minSteps
+	}
+	return rows
+}
+
+// 按Steps排序的降采样归档, 不包括原始数据
+func (m *Meta) downTiers() []*Tier {
+	tiers := []*Tier{}
+	for _, t := range m.Tiers {
+		if t.Steps > 1 {
+			tiers = append(tiers, t)
+		}
+	}
+	sort.Sort(tierSlice(tiers))
+	return tiers
+}
+
+func parseLimit(s string, def float64) float64 {
+	if v, err := strconv.ParseFloat(s, 64); err == nil {
+		return v
+	}
+	return def
+}
+
+func notExist(key string) error {
+	return &os.PathError{Op: "open", Path: key, Err: syscall.ENOENT}
+}
+
+func exist(key string) error {
+	return &os.PathError{Op: "open", Path: key, Err: syscall.EEXIST}
+}
+
+// 用于降采样的数据, res为数据的分辨率
+type source struct {
+	res    int64
+	points []TierPoint
+}
+
+type sourceSlice []*source
+
+func (this sourceSlice) Len() int           { return len(this) }
+func (this sourceSlice) Swap(i, j int)      { this[i], this[j] = this[j], this[i] }
+func (this sourceSlice) Less(i, j int) bool { return this[i].res < this[j].res }
+
+func (s *source) first() int64 {
+	return s.points[0].Ts
+}
+
+func (s *source) last() int64 {
+	return s.points[len(s.points)-1].Ts
+}
+
+// (from, to]之间的点
+func (s *source) between(from, to int64) []TierPoint {
+	i := sort.Search(len(s.points), func(i int) bool { return s.points[i].Ts > from })
+	j := sort.Search(len(s.points), func(i int) bool { return s.points[i].Ts > to })
+	return s.points[i:j]
+}
+
+func rawSource(points []Point, step int64) *source {
+	tps := make([]TierPoint, len(points))
+	for i, p := range points {
+		tps[i] = TierPoint{Ts: p.Ts, Avg: p.Value, Max: p.Value, Min: p.Value, Last: p.Value}
+	}
+	return &source{res: step, points: tps}
+}
+
+func aggregate(ts int64, points []TierPoint) (TierPoint, bool) {
+	tp := TierPoint{Ts: ts, Max: math.Inf(-1), Min: math.Inf(1)}
+	n := 0
+	for _, p := range points {
+		if math.IsNaN(p.Avg) {
+			continue
+		}
+		tp.Avg += p.Avg
+		tp.Max = math.Max(tp.Max, p.Max)
+		tp.Min = math.Min(tp.Min, p.Min)
+		tp.Last = p.Last
+		n++
+	}
+	if n == 0 {
+		return tp, false
+	}
+	tp.Avg /= float64(n)
+	return tp, true
+}
+
+// 计算(from, to]之间分辨率为res的点. 每个周期使用能完整覆盖这个周期的最细的数据,
+// 都不能完整覆盖时使用有数据的最细的数据. sources按分辨率从细到粗排序
+func downsample(sources []*source, res int64, from, to int64) []TierPoint {
+	ret := []TierPoint{}
+	for ts := from - from%res + res; ts <= to; ts += res {
+		var points []TierPoint
+		for _, src := range sources {
+			if len(src.points) == 0 || res%src.res != 0 {
+				continue
+			}
+			ps := src.between(ts-res, ts)
+			if len(ps) == 0 {
+				continue
+			}
+			if src.first() <= ts-res+src.res && src.last() >= ts {
+				points = ps
+				break
+			}
+			if points == nil {
+				points = ps
+			}
+		}
+		if tp, ok := aggregate(ts, points); ok {
+			ret = append(ret, tp)
+		}
+	}
+	return ret
+}
+
+type DB struct {
+	dir    string
+	shards []*shard
+}
+
+func Open(dir string) (*DB, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	db := &DB{dir: dir, shards: make([]*shard, SHARD_NUM)}
+	for i := range db.shards {
+		sh, err := openShard(filepath.Join(dir, fmt.Sprintf("%02x.tsd", i)))
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		db.shards[i] = sh
+	}
+	return db, nil
+}
+
+func (db *DB) Close() error {
+	for _, sh := range db.shards {
+		if sh != nil {
+			sh.close()
+		}
+	}
+	return nil
+}
+
+// key的格式为md5_dstype_step, 按md5的前两位分片
+func (db *DB) shard(key string) *shard {
+	if len(key) >= 2 {
+		if i, err := strconv.ParseUint(key[:2], 16, 8); err == nil {
+			return db.shards[i]
+		}
+	}
+	var h uint32
+	for i := 0; i < len(key); i++ {
+		h = h*31 + uint32(key[i])
+	}
+	return db.shards[h%SHARD_NUM]
+}
+
+func (db *DB) Exists(key string) bool {
+	return db.shard(key).exists(key)
+}
+
+func (db *DB) Create(key string, meta *Meta) error {
+	if err := meta.check(); err != nil {
+		return err
+	}
+	return db.shard(key).create(key, meta)
+}
+
+// 写入原始值, COUNTER和DERIVE在写入时计算速率, 早于最后一次写入时间的点被忽略
+func (db *DB) Append(key string, points []Point) error {
+	return db.shard(key).append(key, points)
+}
+
+// 返回(start, end]之间的数据, 按照和rrd相同的方式选择覆盖整个时间段的最细的归档
+func (db *DB) Fetch(key string, cf string, start, end int64, step int) (int64, []Point, error) {
+	if cf != "AVERAGE" && cf != "MAX" && cf != "MIN" && cf != "LAST" {
+		return 0, nil, fmt.Errorf("unknown consolidation function %s", cf)
+	}
+	return db.shard(key).fetch(key, cf, start, end, int64(step))
+}
+
+func (db *DB) Info(key string) (*Meta, int64, error) {
+	return db.shard(key).info(key)
+}
+
+// 修改归档策略, 在下次合并时生效
+func (db *DB) SetTiers(key string, tiers []*Tier) error {
+	return db.shard(key).setTiers(key, tiers)
+}
+
+func (db *DB) Delete(key string) error {
+	return db.shard(key).delete(key)
+}
+
+// 导出一个counter的所有记录, 用于迁移
+func (db *DB) Export(key string) ([]byte, error) {
+	return db.shard(key).export(key)
+}
+
+// 导入Export导出的数据, counter已经存在时返回os.IsExist的错误
+func (db *DB) Import(key string, data []byte) error {
+	return db.shard(key).importData(key, data)
+}
+
+// 直接写入已经计算好的原始数据和降采样数据, 用于从rrd文件转换
+func (db *DB) Load(key string, meta *Meta, raw []Point, tiers map[int][]TierPoint, lastTs int64, last float64) error {
+	if err := meta.check(); err != nil {
+		return err
+	}
+	return db.shard(key).load(key, meta, raw, tiers, lastTs, last)
+}
+
+// 合并第i个分片, 没有新数据的分片直接跳过
+func (db *DB) Compact(i int) error {
+	return db.shards[i%SHARD_NUM].compact()
+}
@@ -0,0 +1,282 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tsdb
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestZeros64(t *testing.T) {
+	tests := []struct {
+		x                 uint64
+		leading, trailing int
+	}{
+		{0, 64, 64},
+		{1, 63, 0},
+		{1 << 63, 0, 63},
+		{0x00f0, 56, 4},
+		{^uint64(0), 0, 0},
+		{math.Float64bits(1.5) ^ math.Float64bits(2), 1, 51},
+	}
+	for _, tt := range tests {
+		if got := leadingZeros64(tt.x); got != tt.leading {
+			t.Errorf("leadingZeros64(%#x) = %d, expected %d", tt.x, got, tt.leading)
+		}
+		if got := trailingZeros64(tt.x); got != tt.trailing {
+			t.Errorf("trailingZeros64(%#x) = %d, expected %d", tt.x, got, tt.trailing)
+		}
+	}
+}
+
+func TestEncodeRaw(t *testing.T) {
+	cases := [][]Point{
+		{},
+		{{Ts: 1500000000, Value: 1}},
+		{{Ts: 60, Value: 0}, {Ts: 120, Value: 0}, {Ts: 180, Value: 0}},
+		{{Ts: 60, Value: math.NaN()}, {Ts: 100, Value: -1.5}, {Ts: 1e9, Value: math.Inf(1)}, {Ts: 1e9 + 1, Value: 1e300}},
+	}
+	r := rand.New(rand.NewSource(1))
+	ps := []Point{}
+	ts := int64(1500000000)
+	for i := 0; i < 2000; i++ {
+		ts += 60 + int64(r.Intn(5)) - 2
+		if i%100 == 0 {
+			ts += int64(r.Intn(100000))
+		}
+		ps = append(ps, Point{Ts: ts, Value: float64(r.Intn(100)) + r.Float64()*float64(i%3)})
+	}
+	cases = append(cases, ps)
+
+	for i, c := range cases {
+		got, err := decodeRaw(encodeRaw(c), len(c))
+		if err != nil {
+			t.Fatalf("case %d: %v", i, err)
+		}
+		for j := range c {
+			if got[j].Ts != c[j].Ts || math.Float64bits(got[j].Value) != math.Float64bits(c[j].Value) {
+				t.Fatalf("case %d point %d: got %v, want %v", i, j, got[j], c[j])
+			}
+		}
+	}
+}
+
+func TestEncodeTier(t *testing.T) {
+	ps := []TierPoint{}
+	for i := int64(1); i <= 300; i++ {
+		v := float64(i % 7)
+		ps = append(ps, TierPoint{Ts: i * 300, Avg: v / 3, Max: v, Min: -v, Last: float64(i)})
+	}
+	got, err := decodeTier(encodeTier(ps), len(ps))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range ps {
+		if got[i] != ps[i] {
+			t.Fatalf("point %d: got %v, want %v", i, got[i], ps[i])
+		}
+	}
+}
+
+func openTestDB(t *testing.T) (*DB, string) {
+	dir, err := ioutil.TempDir("", "tsdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, dir
+}
+
+var testTiers = []*Tier{
+	{Steps: 1, Rows: 60, CF: []string{"AVERAGE"}},
+	{Steps: 5, Rows: 100, CF: []string{"AVERAGE", "MAX", "MIN"}},
+	{Steps: 20, Rows: 100, CF: []string{"AVERAGE", "MAX", "MIN"}},
+}
+
+func TestAppendFetch(t *testing.T) {
+	db, dir := openTestDB(t)
+	defer os.RemoveAll(dir)
+	defer db.Close()
+
+	key := "ab0123_GAUGE_60"
+	if _, _, err := db.Fetch(key, "AVERAGE", 0, 60, 60); !os.IsNotExist(err) {
+		t.Fatalf("fetch not exist: %v", err)
+	}
+	if err := db.Create(key, &Meta{DsType: "GAUGE", Step: 60, Heartbeat: 120, Min: "U", Max: "U", Tiers: testTiers}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(key, &Meta{DsType: "GAUGE", Step: 60, Tiers: testTiers}); !os.IsExist(err) {
+		t.Fatalf("create twice: %v", err)
+	}
+
+	// 每个点的值为分钟数
+	base := int64(1500000000)
+	base -= base % 6000
+	for i := int64(1); i <= 600; i += 6 {
+		ps := []Point{}
+		for j := i; j < i+6; j++ {
+			ps = append(ps, Point{Ts: base + j*60, Value: float64(j)})
+		}
+		if err := db.Append(key, ps); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 早于最后写入时间的点被忽略
+	db.Append(key, []Point{{Ts: base + 60, Value: 1000}})
+
+	check := func(stage string) {
+		res, ps, err := db.Fetch(key, "AVERAGE", base+540*60, base+600*60, 60)
+		if err != nil || res != 60 || len(ps) != 60 {
+			t.Fatalf("%s: res %d, len %d, err %v", stage, res, len(ps), err)
+		}
+		for i, p := range ps {
+			if p.Ts != base+int64(541+i)*60 || p.Value != float64(541+i) {
+				t.Fatalf("%s: raw point %d: %v", stage, i, p)
+			}
+		}
+
+		// 超出原始数据的范围, 使用5个step的归档
+		res, ps, err = db.Fetch(key, "MAX", base+300*60, base+600*60, 60)
+		if err != nil || res != 300 || len(ps) != 60 {
+			t.Fatalf("%s: res %d, len %d, err %v", stage, res, len(ps), err)
+		}
+		for i, p := range ps {
+			if p.Value != float64(300+5*(i+1)) {
+				t.Fatalf("%s: tier point %d: %v", stage, i, p)
+			}
+		}
+		_, ps, _ = db.Fetch(key, "AVERAGE", base+300*60, base+600*60, 60)
+		if ps[0].Value != 303 {
+			t.Fatalf("%s: avg %v", stage, ps[0])
+		}
+	}
+	check("before compact")
+	for i := 0; i < SHARD_NUM; i++ {
+		if err := db.Compact(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check("after compact")
+
+	// 重新打开
+	db.Close()
+	if db, _ = Open(dir); db == nil {
+		t.Fatal("reopen fail")
+	}
+	check("after reopen")
+
+	// 原始数据只保留60个点, 降采样数据保留到了合并之前的数据
+	_, lastTs, _ := db.Info(key)
+	if lastTs != base+600*60 {
+		t.Fatalf("last ts %d", lastTs)
+	}
+	_, ps, _ := db.Fetch(key, "MIN", base, base+600*60, 60)
+	if len(ps) != 30 || ps[0].Value != 1 || ps[29].Value != 581 {
+		t.Fatalf("20 steps tier: %d %v %v", len(ps), ps[0], ps[len(ps)-1])
+	}
+}
+
+func TestCounter(t *testing.T) {
+	db, dir := openTestDB(t)
+	defer os.RemoveAll(dir)
+	defer db.Close()
+
+	key := "cd0123_COUNTER_60"
+	db.Create(key, &Meta{DsType: "COUNTER", Step: 60, Heartbeat: 120, Min: "U", Max: "U", Tiers: testTiers})
+	db.Append(key, []Point{{Ts: 60, Value: 100}, {Ts: 120, Value: 220}, {Ts: 180, Value: 100}, {Ts: 240, Value: 160}})
+	db.Append(key, []Point{{Ts: 480, Value: 400}, {Ts: 540, Value: 460}})
+	_, ps, _ := db.Fetch(key, "AVERAGE", 0, 540, 60)
+	// 计数器重置和超过heartbeat的点没有数据
+	want := []float64{math.NaN(), 2, math.NaN(), 1, math.NaN(), math.NaN(), math.NaN(), math.NaN(), 1}
+	if len(ps) != len(want) {
+		t.Fatalf("len %d", len(ps))
+	}
+	for i, p := range ps {
+		if !(p.Value == want[i] || math.IsNaN(p.Value) && math.IsNaN(want[i])) {
+			t.Fatalf("point %d: %v, want %v", i, p, want[i])
+		}
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	db, dir := openTestDB(t)
+	defer os.RemoveAll(dir)
+	defer db.Close()
+
+	key := "ef0123_GAUGE_60"
+	db.Create(key, &Meta{DsType: "GAUGE", Step: 60, Tiers: testTiers})
+	for i := int64(1); i <= 100; i++ {
+		db.Append(key, []Point{{Ts: i * 60, Value: float64(i)}})
+	}
+	data, err := db.Export(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db2, dir2 := openTestDB(t)
+	defer os.RemoveAll(dir2)
+	defer db2.Close()
+	if err := db2.Import(key, data); err != nil {
+		t.Fatal(err)
+	}
+	if err := db2.Import(key, data); !os.IsExist(err) {
+		t.Fatalf("import twice: %v", err)
+	}
+	data2, _ := db2.Export(key)
+	if !bytes.Equal(data, data2) {
+		t.Fatal("export after import differs")
+	}
+	if err := db2.Import("000000_GAUGE_60", data); err == nil {
+		t.Fatal("import with wrong key")
+	}
+
+	if err := db2.Delete(key); err != nil || db2.Exists(key) {
+		t.Fatalf("delete: %v", err)
+	}
+}
+
+func TestTruncatedTail(t *testing.T) {
+	db, dir := openTestDB(t)
+	defer os.RemoveAll(dir)
+
+	key := "120123_GAUGE_60"
+	db.Create(key, &Meta{DsType: "GAUGE", Step: 60, Tiers: testTiers})
+	db.Append(key, []Point{{Ts: 60, Value: 1}})
+	db.Append(key, []Point{{Ts: 120, Value: 2}})
+	db.Close()
+
+	path := filepath.Join(dir, "12.tsd")
+	fi, _ := os.Stat(path)
+	os.Truncate(path, fi.Size()-3)
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, lastTs, err := db.Info(key); err != nil || lastTs != 60 {
+		t.Fatalf("last ts %d, err %v", lastTs, err)
+	}
+	if err := db.Append(key, []Point{{Ts: 180, Value: 3}}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -26,6 +26,12 @@ type HttpConfig struct {
 	Listen  string `json:"listen"`
 }
 
+// 下发给transfer的judge/graph集群, 格式和transfer配置中的cluster相同
+type ClusterConfig struct {
+	Judge map[string]string `json:"judge"`
+	Graph map[string]string `json:"graph"`
+}
+
 type GlobalConfig struct {
 	Debug     bool        `json:"debug"`
 	Hosts     string      `json:"hosts"`
@@ -35,6 +41,8 @@ type GlobalConfig struct {
 	Listen    string      `json:"listen"`
 	Trustable []string    `json:"trustable"`
 	Http      *HttpConfig `json:"http"`
+
+	Cluster *ClusterConfig `json:"cluster"`
 }
 
 var (
@@ -19,6 +19,7 @@ import (
 	"github.com/open-falcon/falcon-plus/common/model"
 	"github.com/open-falcon/falcon-plus/common/utils"
 	"github.com/open-falcon/falcon-plus/modules/hbs/cache"
+	"github.com/open-falcon/falcon-plus/modules/hbs/g"
 )
 
 func (t *Hbs) GetExpressions(req model.NullRpcRequest, reply *model.ExpressionResponse) error {
@@ -26,6 +27,17 @@ func (t *Hbs) GetExpressions(req model.NullRpcRequest, reply *model.ExpressionRe
 	return nil
 }
 
+// 没有配置时返回空的集群, transfer继续使用自己的配置
+func (t *Hbs) GetCluster(req model.NullRpcRequest, reply *model.ClusterResponse) error {
+	cfg := g.Config().Cluster
+	if cfg == nil {
+		return nil
+	}
+	reply.Judge = cfg.Judge
+	reply.Graph = cfg.Graph
+	return nil
+}
+
 func (t *Hbs) GetStrategies(req model.NullRpcRequest, reply *model.StrategiesResponse) error {
 	reply.HostStrategies = []*model.HostStrategy{}
 	// 一个机器ID对应多个模板ID
@@ -35,4 +35,6 @@ func cleanStale() {
 			store.HistoryBigMap[arr[i]+arr[j]].CleanStale(before)
 		}
 	}
+
+	store.BaselineCache.CleanStale(time.Now().Unix())
 }
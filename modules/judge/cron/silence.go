@@ -0,0 +1,69 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cron
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/open-falcon/falcon-plus/common/model"
+	"github.com/open-falcon/falcon-plus/common/sdk/requests"
+	"github.com/open-falcon/falcon-plus/modules/judge/g"
+)
+
+func SyncSilences() {
+	cfg := g.Config().PlusApi
+	if cfg == nil || !cfg.Enabled {
+		return
+	}
+
+	duration := time.Duration(cfg.Interval) * time.Second
+	for {
+		syncSilences()
+		time.Sleep(duration)
+	}
+}
+
+func syncSilences() {
+	cfg := g.Config().PlusApi
+	uri := fmt.Sprintf("%s/api/v1/silence?active=true", cfg.Addr)
+	req, err := requests.CurlPlus(uri, "GET", "falcon-judge", cfg.Token,
+		map[string]string{}, map[string]string{})
+	if err != nil {
+		log.Println("[ERROR] curl silences:", err)
+		return
+	}
+	req.SetTimeout(time.Duration(cfg.ConnectTimeout)*time.Millisecond,
+		time.Duration(cfg.RequestTimeout)*time.Millisecond)
+
+	var silences []*model.Silence
+	if err = req.ToJson(&silences); err != nil {
+		log.Println("[ERROR] curl silences:", err)
+		return
+	}
+
+	matchers := make([]*model.SilenceMatcher, 0, len(silences))
+	for _, s := range silences {
+		m, err := model.NewSilenceMatcher(s)
+		if err != nil {
+			log.Printf("[ERROR] compile silence %d fail: %v", s.Id, err)
+			continue
+		}
+		matchers = append(matchers, m)
+	}
+
+	g.Silences.ReInit(matchers)
+}
@@ -52,14 +52,37 @@ type AlarmConfig struct {
 	Redis        *RedisConfig `json:"redis"`
 }
 
+type GraphConfig struct {
+	Enabled     bool              `json:"enabled"`
+	ConnTimeout int               `json:"connTimeout"`
+	CallTimeout int               `json:"callTimeout"`
+	MaxConns    int               `json:"maxConns"`
+	MaxIdle     int               `json:"maxIdle"`
+	Replicas    int               `json:"replicas"`
+	CacheTtl    int64             `json:"cacheTtl"`
+	Cluster     map[string]string `json:"cluster"`
+}
+
+// 用于从api同步屏蔽规则，不配置则不同步
+type PlusAPIConfig struct {
+	Enabled        bool   `json:"enabled"`
+	Addr           string `json:"addr"`
+	Token          string `json:"token"`
+	ConnectTimeout int32  `json:"connectTimeout"`
+	RequestTimeout int32  `json:"requestTimeout"`
+	Interval       int64  `json:"interval"`
+}
+
 type GlobalConfig struct {
-	Debug     bool         `json:"debug"`
-	DebugHost string       `json:"debugHost"`
-	Remain    int          `json:"remain"`
-	Http      *HttpConfig  `json:"http"`
-	Rpc       *RpcConfig   `json:"rpc"`
-	Hbs       *HbsConfig   `json:"hbs"`
-	Alarm     *AlarmConfig `json:"alarm"`
+	Debug     bool           `json:"debug"`
+	DebugHost string         `json:"debugHost"`
+	Remain    int            `json:"remain"`
+	Http      *HttpConfig    `json:"http"`
+	Rpc       *RpcConfig     `json:"rpc"`
+	Hbs       *HbsConfig     `json:"hbs"`
+	Alarm     *AlarmConfig   `json:"alarm"`
+	Graph     *GraphConfig   `json:"graph"`
+	PlusApi   *PlusAPIConfig `json:"plus_api"`
 }
 
 var (
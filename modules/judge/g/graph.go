@@ -0,0 +1,80 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package g
+
+import (
+	"fmt"
+	"strings"
+
+	backend "github.com/open-falcon/falcon-plus/common/backend_pool"
+	"github.com/open-falcon/falcon-plus/common/model"
+	cutils "github.com/open-falcon/falcon-plus/common/utils"
+	rings "github.com/toolkits/consistent/rings"
+	nset "github.com/toolkits/container/set"
+)
+
+// 与transfer使用相同的一致性哈希环，才能找到数据所在的graph节点
+var (
+	GraphConnPools *backend.SafeRpcConnPools
+	GraphNodeRing  *rings.ConsistentHashNodeRing
+)
+
+func GraphEnabled() bool {
+	cfg := Config()
+	return cfg != nil && cfg.Graph != nil && cfg.Graph.Enabled
+}
+
+func InitGraphClient() {
+	if !GraphEnabled() {
+		return
+	}
+
+	cfg := Config().Graph
+	GraphNodeRing = rings.NewConsistentHashNodesRing(int32(cfg.Replicas), cutils.KeysOfMap(cfg.Cluster))
+
+	graphInstances := nset.NewStringSet()
+	for _, addrs := range cfg.Cluster {
+		for _, addr := range strings.Split(addrs, ",") {
+			graphInstances.Add(strings.TrimSpace(addr))
+		}
+	}
+	GraphConnPools = backend.CreateSafeRpcConnPools(cfg.MaxConns, cfg.MaxIdle,
+		cfg.ConnTimeout, cfg.CallTimeout, graphInstances.ToSlice())
+}
+
+// 调用Graph.Query查询历史数据，一个graph节点配置了多个地址时，依次尝试
+func GraphQuery(endpoint, metric string, tags map[string]string, param model.GraphQueryParam) (*model.GraphQueryResponse, error) {
+	if !GraphEnabled() {
+		return nil, fmt.Errorf("graph is not enabled")
+	}
+
+	node, err := GraphNodeRing.GetNode(cutils.PK(endpoint, metric, tags))
+	if err != nil {
+		return nil, err
+	}
+
+	param.Endpoint = endpoint
+	param.Counter = cutils.Counter(metric, tags)
+
+	for _, addr := range strings.Split(Config().Graph.Cluster[node], ",") {
+		resp := &model.GraphQueryResponse{}
+		err = GraphConnPools.Call(strings.TrimSpace(addr), "Graph.Query", param, resp)
+		if err == nil {
+			return resp, nil
+		}
+	}
+
+	return nil, err
+}
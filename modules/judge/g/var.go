@@ -33,6 +33,11 @@ type SafeExpressionMap struct {
 	M map[string][]*model.Expression
 }
 
+type SafeSilences struct {
+	sync.RWMutex
+	Matchers []*model.SilenceMatcher
+}
+
 type SafeEventMap struct {
 	sync.RWMutex
 	M map[string]*model.Event
@@ -43,6 +48,7 @@ var (
 	StrategyMap   = &SafeStrategyMap{M: make(map[string][]model.Strategy)}
 	ExpressionMap = &SafeExpressionMap{M: make(map[string][]*model.Expression)}
 	LastEvents    = &SafeEventMap{M: make(map[string]*model.Event)}
+	Silences      = &SafeSilences{}
 )
 
 func InitHbsClient() {
@@ -76,6 +82,25 @@ func (this *SafeExpressionMap) Get() map[string][]*model.Expression {
 	return this.M
 }
 
+func (this *SafeSilences) ReInit(matchers []*model.SilenceMatcher) {
+	this.Lock()
+	defer this.Unlock()
+	this.Matchers = matchers
+}
+
+// judge拿不到endpoint所属的hostgroup，带hostgroup条件的规则由alarm处理
+func (this *SafeSilences) Silenced(event *model.Event) bool {
+	this.RLock()
+	defer this.RUnlock()
+	now := time.Now()
+	for _, m := range this.Matchers {
+		if m.IsActive(now) && m.Match(event, nil) {
+			return true
+		}
+	}
+	return false
+}
+
 func (this *SafeEventMap) Get(key string) (*model.Event, bool) {
 	this.RLock()
 	defer this.RUnlock()
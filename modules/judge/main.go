@@ -39,6 +39,7 @@ func main() {
 
 	g.InitRedisConnPool()
 	g.InitHbsClient()
+	g.InitGraphClient()
 
 	store.InitHistoryBigMap()
 
@@ -46,6 +47,7 @@ func main() {
 	go rpc.Start()
 
 	go cron.SyncStrategies()
+	go cron.SyncSilences()
 	go cron.CleanStale()
 
 	select {}
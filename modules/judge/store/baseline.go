@@ -0,0 +1,196 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/open-falcon/falcon-plus/common/model"
+	"github.com/open-falcon/falcon-plus/modules/judge/g"
+)
+
+// 从graph查到的一段历史数据，[Start, End]是查询的时间范围
+type baselineItem struct {
+	Start  int64
+	End    int64
+	Step   int64
+	Expire int64
+	Values []*model.RRDData
+}
+
+// 查询失败之后，Next之前不再查询，每次失败退避时间翻倍
+type baselineFailure struct {
+	Next    int64
+	Backoff int64
+}
+
+const (
+	baselineMinBackoff = 30
+	baselineMaxBackoff = 600
+)
+
+type SafeBaselineCache struct {
+	sync.RWMutex
+	M        map[string]*baselineItem
+	pending  map[string]bool
+	failures map[string]*baselineFailure
+	// 限制同时查询graph的goroutine数
+	sema chan struct{}
+}
+
+// pk/offset => 历史数据
+var BaselineCache = &SafeBaselineCache{
+	M:        make(map[string]*baselineItem),
+	pending:  make(map[string]bool),
+	failures: make(map[string]*baselineFailure),
+}
+
+func (this *SafeBaselineCache) Get(key string) (*baselineItem, bool) {
+	this.RLock()
+	defer this.RUnlock()
+	item, exists := this.M[key]
+	return item, exists
+}
+
+func (this *SafeBaselineCache) Set(key string, item *baselineItem) {
+	this.Lock()
+	defer this.Unlock()
+	this.M[key] = item
+}
+
+func (this *SafeBaselineCache) Len() int {
+	this.RLock()
+	defer this.RUnlock()
+	return len(this.M)
+}
+
+func (this *SafeBaselineCache) CleanStale(now int64) {
+	this.Lock()
+	defer this.Unlock()
+	for key, item := range this.M {
+		if item.Expire < now {
+			delete(this.M, key)
+		}
+	}
+	for key, f := range this.failures {
+		if f.Next < now-baselineMaxBackoff {
+			delete(this.failures, key)
+		}
+	}
+}
+
+// refresh 在后台查询graph，同一个key同时只查一次，查询失败的key在退避时间内不再查询，
+// 并发数达到上限时直接放弃，下一个点再试，判断数据的流程不会等待graph
+func (this *SafeBaselineCache) refresh(key string, item *model.JudgeItem, param model.GraphQueryParam, cfg *g.GraphConfig, now int64) {
+	this.Lock()
+	if this.sema == nil {
+		n := cfg.MaxConns
+		if n <= 0 {
+			n = 1
+		}
+		this.sema = make(chan struct{}, n)
+	}
+	if f, ok := this.failures[key]; this.pending[key] || ok && f.Next > now {
+		this.Unlock()
+		return
+	}
+	select {
+	case this.sema <- struct{}{}:
+	default:
+		this.Unlock()
+		return
+	}
+	this.pending[key] = true
+	this.Unlock()
+
+	go func() {
+		defer func() { <-this.sema }()
+		resp, err := g.GraphQuery(item.Endpoint, item.Metric, item.Tags, param)
+
+		this.Lock()
+		defer this.Unlock()
+		delete(this.pending, key)
+		if err != nil {
+			log.Printf("[ERROR] query graph for %s fail: %v", item.PrimaryKey(), err)
+			f, ok := this.failures[key]
+			if !ok {
+				f = &baselineFailure{Backoff: baselineMinBackoff / 2}
+				this.failures[key] = f
+			}
+			if f.Backoff *= 2; f.Backoff > baselineMaxBackoff {
+				f.Backoff = baselineMaxBackoff
+			}
+			f.Next = time.Now().Unix() + f.Backoff
+			return
+		}
+		delete(this.failures, key)
+		this.M[key] = &baselineItem{
+			Start:  param.Start,
+			End:    param.End,
+			Step:   int64(resp.Step),
+			Expire: time.Now().Unix() + cfg.CacheTtl,
+			Values: resp.Values,
+		}
+	}()
+}
+
+// 计算offset秒之前[start, end]这段时间的平均值
+// 为了减少对graph的查询，每次多查cacheTtl秒的数据缓存起来，后续的点直接从缓存里取；
+// 缓存中没有数据时在后台查询，本次返回ok=false；没有配置graph时总是返回ok=false
+func baselineAvg(item *model.JudgeItem, offset int64, start int64, end int64) (avg float64, ok bool) {
+	if !g.GraphEnabled() {
+		return
+	}
+	cfg := g.Config().Graph
+	start, end = start-offset, end-offset
+	now := time.Now().Unix()
+
+	key := fmt.Sprintf("%s/%d", item.PrimaryKey(), offset)
+	cached, exists := BaselineCache.Get(key)
+	covered := exists && cached.Start <= start && cached.End >= end
+	if !covered || cached.Expire < now {
+		param := model.GraphQueryParam{
+			Start:     start,
+			End:       end + cfg.CacheTtl,
+			ConsolFun: "AVERAGE",
+		}
+		BaselineCache.refresh(key, item, param, cfg, now)
+	}
+	if !covered {
+		return
+	}
+
+	// judge的点与rrd的点时间戳不对齐，前后各放宽半个周期
+	start, end = start-cached.Step/2, end+cached.Step/2
+
+	sum, cnt := 0.0, 0
+	for _, v := range cached.Values {
+		if v.Timestamp < start || v.Timestamp > end || math.IsNaN(float64(v.Value)) {
+			continue
+		}
+		sum += float64(v.Value)
+		cnt++
+	}
+
+	if cnt == 0 {
+		return
+	}
+
+	return sum / float64(cnt), true
+}
@@ -0,0 +1,142 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/open-falcon/falcon-plus/common/model"
+	"github.com/open-falcon/falcon-plus/modules/judge/g"
+)
+
+func setGraphEnabled(t *testing.T, enabled bool) {
+	f, err := ioutil.TempFile("", "judge-cfg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	fmt.Fprintf(f, `{"graph": {"enabled": %v, "maxConns": 1, "cacheTtl": 600}}`, enabled)
+	f.Close()
+	g.ParseConfig(f.Name())
+}
+
+// fillBaseline 预先放入缓存, 避免查询graph; values为offset之前从start开始每60秒一个点
+func fillBaseline(item *model.JudgeItem, offset, start int64, values ...float64) {
+	data := make([]*model.RRDData, len(values))
+	for i, v := range values {
+		data[i] = model.NewRRDData(start-offset+int64(60*i), v)
+	}
+	BaselineCache.Set(fmt.Sprintf("%s/%d", item.PrimaryKey(), offset), &baselineItem{
+		Start:  start - offset,
+		End:    start - offset + int64(60*len(values)),
+		Step:   60,
+		Expire: time.Now().Unix() + 600,
+		Values: data,
+	})
+}
+
+// skipRefresh 让缓存未命中的key处于退避中, 不会在后台查询graph
+func skipRefresh(item *model.JudgeItem, offset int64) {
+	BaselineCache.Lock()
+	defer BaselineCache.Unlock()
+	BaselineCache.failures[fmt.Sprintf("%s/%d", item.PrimaryKey(), offset)] = &baselineFailure{Next: time.Now().Unix() + 600}
+}
+
+func TestBaselineAvg(t *testing.T) {
+	setGraphEnabled(t, true)
+	item := &model.JudgeItem{Endpoint: "web1", Metric: "qps"}
+	fillBaseline(item, 86400, 1000, 10, 20, math.NaN(), 40)
+	missing := &model.JudgeItem{Endpoint: "web2", Metric: "qps"}
+	skipRefresh(missing, 86400)
+
+	tests := []struct {
+		item       *model.JudgeItem
+		start, end int64
+		avg        float64
+		ok         bool
+	}{
+		{item, 1000, 1180, 70.0 / 3, true},
+		{item, 1060, 1060, 20, true},
+		// 前后各放宽半个周期
+		{item, 1090, 1110, 20, true},
+		// 范围内只有NaN
+		{item, 1120, 1120, 0, false},
+		// 超出缓存的范围
+		{item, 1000, 1300, 0, false},
+		{missing, 1000, 1180, 0, false},
+	}
+	for i, tt := range tests {
+		avg, ok := baselineAvg(tt.item, 86400, tt.start, tt.end)
+		if ok != tt.ok || ok && math.Abs(avg-tt.avg) > 1e-9 {
+			t.Errorf("case %d: got (%v, %v), want (%v, %v)", i, avg, ok, tt.avg, tt.ok)
+		}
+	}
+
+	setGraphEnabled(t, false)
+	if _, ok := baselineAvg(item, 86400, 1000, 1180); ok {
+		t.Errorf("baselineAvg should not be ok when graph is disabled")
+	}
+}
+
+func TestCompareFunction(t *testing.T) {
+	setGraphEnabled(t, true)
+	// newHistory的点的时间戳为60, 120, ..., 历史数据从120开始
+	empty := &model.JudgeItem{JudgeType: "GAUGE"}
+	skipRefresh(empty, 3600)
+
+	tests := []struct {
+		fn        string
+		baseline  []float64
+		values    []float64
+		left      float64
+		triggered bool
+		enough    bool
+	}{
+		{"compare(#3,1d)", []float64{10, 10, 10}, []float64{10, 15, 15, 15}, 50, true, true},
+		{"compare(#2,1d)", []float64{0, 20, 20}, []float64{10, 15, 5, 5}, -75, false, true},
+		{"compare(#3,1d)", []float64{0, 0, 0}, []float64{10, 15, 15, 15}, 0, false, false},
+		{"compare(#5,1d)", []float64{10, 10, 10}, []float64{10, 15, 15, 15}, 0, false, false},
+		// 缓存中没有历史数据
+		{"compare(#3,1h)", nil, []float64{10, 15, 15, 15}, 0, false, false},
+	}
+	for i, tt := range tests {
+		fn, err := ParseFuncFromString(tt.fn, ">", 10)
+		if err != nil {
+			t.Errorf("case %d %s: parse error %v", i, tt.fn, err)
+			continue
+		}
+		if tt.baseline != nil {
+			fillBaseline(empty, 86400, 120, tt.baseline...)
+		}
+		_, left, triggered, enough := fn.Compute(newHistory(tt.values...))
+		if enough != tt.enough {
+			t.Errorf("case %d %s: isEnough = %v, want %v", i, tt.fn, enough, tt.enough)
+			continue
+		}
+		if enough && (math.Abs(left-tt.left) > 1e-9 || triggered != tt.triggered) {
+			t.Errorf("case %d %s: got (%v, %v), want (%v, %v)", i, tt.fn, left, triggered, tt.left, tt.triggered)
+		}
+	}
+
+	setGraphEnabled(t, false)
+	if _, err := ParseFuncFromString("compare(#3,1d)", ">", 10); err == nil {
+		t.Errorf("compare should be rejected when graph is disabled")
+	}
+}
@@ -17,9 +17,11 @@ package store
 import (
 	"fmt"
 	"github.com/open-falcon/falcon-plus/common/model"
+	"github.com/open-falcon/falcon-plus/common/utils"
+	"github.com/open-falcon/falcon-plus/modules/judge/g"
 	"math"
+	"sort"
 	"strconv"
-	"strings"
 )
 
 type Function interface {
@@ -249,43 +251,225 @@ func (this PDiffFunction) Compute(L *SafeLinkedList) (vs []*model.HistoryData, l
 	return
 }
 
-func atois(s string) (ret []int, err error) {
-	a := strings.Split(s, ",")
-	ret = make([]int, len(a))
-	for i, v := range a {
-		ret[i], err = strconv.Atoi(v)
-		if err != nil {
-			return
+type MedianFunction struct {
+	Function
+	Limit      int
+	Operator   string
+	RightValue float64
+}
+
+func (this MedianFunction) Compute(L *SafeLinkedList) (vs []*model.HistoryData, leftValue float64, isTriggered bool, isEnough bool) {
+	vs, isEnough = L.HistoryData(this.Limit)
+	if !isEnough {
+		return
+	}
+
+	leftValue = percentile(vs, 50)
+	isTriggered = checkIsTriggered(leftValue, this.Operator, this.RightValue)
+	return
+}
+
+// percentile(#10,95)，最近10个点的95分位值
+type PercentileFunction struct {
+	Function
+	Limit      int
+	Percent    float64
+	Operator   string
+	RightValue float64
+}
+
+func (this PercentileFunction) Compute(L *SafeLinkedList) (vs []*model.HistoryData, leftValue float64, isTriggered bool, isEnough bool) {
+	vs, isEnough = L.HistoryData(this.Limit)
+	if !isEnough {
+		return
+	}
+
+	leftValue = percentile(vs, this.Percent)
+	isTriggered = checkIsTriggered(leftValue, this.Operator, this.RightValue)
+	return
+}
+
+// nearest-rank方法计算分位值
+func percentile(vs []*model.HistoryData, percent float64) float64 {
+	values := make([]float64, len(vs))
+	for i := range vs {
+		values[i] = vs[i].Value
+	}
+	sort.Float64s(values)
+
+	rank := int(math.Ceil(percent / 100.0 * float64(len(values))))
+	if rank < 1 {
+		rank = 1
+	}
+	return values[rank-1]
+}
+
+// stddev(#20)，最近20个点的总体标准差
+type StdDevFunction struct {
+	Function
+	Limit      int
+	Operator   string
+	RightValue float64
+}
+
+func (this StdDevFunction) Compute(L *SafeLinkedList) (vs []*model.HistoryData, leftValue float64, isTriggered bool, isEnough bool) {
+	vs, isEnough = L.HistoryData(this.Limit)
+	if !isEnough {
+		return
+	}
+
+	sum := 0.0
+	for i := 0; i < this.Limit; i++ {
+		sum += vs[i].Value
+	}
+	avg := sum / float64(this.Limit)
+
+	variance := 0.0
+	for i := 0; i < this.Limit; i++ {
+		variance += (vs[i].Value - avg) * (vs[i].Value - avg)
+	}
+
+	leftValue = math.Sqrt(variance / float64(this.Limit))
+	isTriggered = checkIsTriggered(leftValue, this.Operator, this.RightValue)
+	return
+}
+
+// rate(#3)，最新点与第3个点之间每秒的变化量，适用于按GAUGE上报的累加值
+type RateFunction struct {
+	Function
+	Limit      int
+	Operator   string
+	RightValue float64
+}
+
+func (this RateFunction) Compute(L *SafeLinkedList) (vs []*model.HistoryData, leftValue float64, isTriggered bool, isEnough bool) {
+	vs, isEnough = L.HistoryData(this.Limit)
+	if !isEnough {
+		return
+	}
+
+	first, last := vs[0], vs[this.Limit-1]
+	if first.Timestamp <= last.Timestamp {
+		isEnough = false
+		return
+	}
+
+	leftValue = (first.Value - last.Value) / float64(first.Timestamp-last.Timestamp)
+	isTriggered = checkIsTriggered(leftValue, this.Operator, this.RightValue)
+	return
+}
+
+// count_above(#10,80)，最近10个点中大于80的点的个数
+// count_below(#10,20)，最近10个点中小于20的点的个数
+type CountFunction struct {
+	Function
+	Limit      int
+	Above      bool
+	Threshold  float64
+	Operator   string
+	RightValue float64
+}
+
+func (this CountFunction) Compute(L *SafeLinkedList) (vs []*model.HistoryData, leftValue float64, isTriggered bool, isEnough bool) {
+	vs, isEnough = L.HistoryData(this.Limit)
+	if !isEnough {
+		return
+	}
+
+	count := 0
+	for i := 0; i < this.Limit; i++ {
+		if (this.Above && vs[i].Value > this.Threshold) || (!this.Above && vs[i].Value < this.Threshold) {
+			count++
 		}
 	}
+
+	leftValue = float64(count)
+	isTriggered = checkIsTriggered(leftValue, this.Operator, this.RightValue)
 	return
 }
 
-// @str: e.g. all(#3) sum(#3) avg(#10) diff(#10)
+// compare(#3,1d)，最近3个点的均值与1天前同一时段均值相比的变化百分比
+// 历史数据从graph中查询
+type CompareFunction struct {
+	Function
+	Limit      int
+	Offset     int64
+	Operator   string
+	RightValue float64
+}
+
+func (this CompareFunction) Compute(L *SafeLinkedList) (vs []*model.HistoryData, leftValue float64, isTriggered bool, isEnough bool) {
+	vs, isEnough = L.HistoryData(this.Limit)
+	if !isEnough {
+		return
+	}
+
+	sum := 0.0
+	for i := 0; i < this.Limit; i++ {
+		sum += vs[i].Value
+	}
+	avg := sum / float64(this.Limit)
+
+	firstItem := L.Front().Value.(*model.JudgeItem)
+	base, ok := baselineAvg(firstItem, this.Offset, vs[this.Limit-1].Timestamp, vs[0].Timestamp)
+	if !ok || base == 0 {
+		isEnough = false
+		return
+	}
+
+	leftValue = (avg - base) / math.Abs(base) * 100.0
+	isTriggered = checkIsTriggered(leftValue, this.Operator, this.RightValue)
+	return
+}
+
+// @str: e.g. all(#3) sum(#3) avg(#10) diff(#10) percentile(#10,95) compare(#3,1d)
 func ParseFuncFromString(str string, operator string, rightValue float64) (fn Function, err error) {
-	idx := strings.Index(str, "#")
-	args, err := atois(str[idx+1 : len(str)-1])
+	name, args, err := utils.ParseJudgeFunc(str)
 	if err != nil {
 		return nil, err
 	}
 
-	switch str[:idx-1] {
+	// 参数格式已经由ParseJudgeFunc校验过了
+	limit, _ := strconv.Atoi(args[0])
+
+	switch name {
 	case "max":
-		fn = &MaxFunction{Limit: args[0], Operator: operator, RightValue: rightValue}
+		fn = &MaxFunction{Limit: limit, Operator: operator, RightValue: rightValue}
 	case "min":
-		fn = &MinFunction{Limit: args[0], Operator: operator, RightValue: rightValue}
+		fn = &MinFunction{Limit: limit, Operator: operator, RightValue: rightValue}
 	case "all":
-		fn = &AllFunction{Limit: args[0], Operator: operator, RightValue: rightValue}
+		fn = &AllFunction{Limit: limit, Operator: operator, RightValue: rightValue}
 	case "sum":
-		fn = &SumFunction{Limit: args[0], Operator: operator, RightValue: rightValue}
+		fn = &SumFunction{Limit: limit, Operator: operator, RightValue: rightValue}
 	case "avg":
-		fn = &AvgFunction{Limit: args[0], Operator: operator, RightValue: rightValue}
+		fn = &AvgFunction{Limit: limit, Operator: operator, RightValue: rightValue}
 	case "diff":
-		fn = &DiffFunction{Limit: args[0], Operator: operator, RightValue: rightValue}
+		fn = &DiffFunction{Limit: limit, Operator: operator, RightValue: rightValue}
 	case "pdiff":
-		fn = &PDiffFunction{Limit: args[0], Operator: operator, RightValue: rightValue}
+		fn = &PDiffFunction{Limit: limit, Operator: operator, RightValue: rightValue}
 	case "lookup":
-		fn = &LookupFunction{Num: args[0], Limit: args[1], Operator: operator, RightValue: rightValue}
+		num := limit
+		limit, _ = strconv.Atoi(args[1])
+		fn = &LookupFunction{Num: num, Limit: limit, Operator: operator, RightValue: rightValue}
+	case "median":
+		fn = &MedianFunction{Limit: limit, Operator: operator, RightValue: rightValue}
+	case "percentile":
+		percent, _ := strconv.ParseFloat(args[1], 64)
+		fn = &PercentileFunction{Limit: limit, Percent: percent, Operator: operator, RightValue: rightValue}
+	case "stddev":
+		fn = &StdDevFunction{Limit: limit, Operator: operator, RightValue: rightValue}
+	case "rate":
+		fn = &RateFunction{Limit: limit, Operator: operator, RightValue: rightValue}
+	case "count_above", "count_below":
+		threshold, _ := strconv.ParseFloat(args[1], 64)
+		fn = &CountFunction{Limit: limit, Above: name == "count_above", Threshold: threshold, Operator: operator, RightValue: rightValue}
+	case "compare":
+		// 历史数据要从graph查询
+		if !g.GraphEnabled() {
+			return nil, fmt.Errorf("compare needs graph to be enabled")
+		}
+		offset, _ := utils.ParseOffset(args[1])
+		fn = &CompareFunction{Limit: limit, Offset: offset, Operator: operator, RightValue: rightValue}
 	default:
 		err = fmt.Errorf("not_supported_method")
 	}
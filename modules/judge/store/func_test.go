@@ -0,0 +1,76 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"container/list"
+	"math"
+	"testing"
+
+	"github.com/open-falcon/falcon-plus/common/model"
+)
+
+// newHistory 按时间顺序给出的值, 最后一个是最新的点
+func newHistory(values ...float64) *SafeLinkedList {
+	L := &SafeLinkedList{L: list.New()}
+	for i, v := range values {
+		L.PushFront(&model.JudgeItem{JudgeType: "GAUGE", Value: v, Timestamp: int64(60 * (i + 1))})
+	}
+	return L
+}
+
+func TestFunctionCompute(t *testing.T) {
+	tests := []struct {
+		fn        string
+		values    []float64
+		left      float64
+		triggered bool
+		enough    bool
+	}{
+		{"median(#4)", []float64{4, 1, 3, 2}, 2, true, true},
+		{"percentile(#5,80)", []float64{5, 3, 1, 4, 2}, 4, true, true},
+		{"percentile(#5,100)", []float64{5, 3, 1, 4, 2}, 5, true, true},
+		{"percentile(#5,1)", []float64{5, 3, 1, 4, 2}, 1, false, true},
+		{"percentile(#10,95)", []float64{1, 2, 3}, 0, false, false},
+		{"stddev(#8)", []float64{2, 4, 4, 4, 5, 5, 7, 9}, 2, true, true},
+		{"stddev(#3)", []float64{7, 7, 7}, 0, false, true},
+		{"rate(#3)", []float64{100, 160, 280}, 1.5, false, true},
+		{"rate(#3)", []float64{0, 100, 160, 280}, 1.5, false, true},
+		{"rate(#2)", []float64{280, 100}, -3, false, true},
+		{"count_above(#4,10)", []float64{5, 15, 20, 8}, 2, true, true},
+		{"count_above(#3,100)", []float64{5, 15, 20, 8}, 0, false, true},
+		{"count_below(#4,10)", []float64{5, 15, 20, 8, 1}, 2, true, true},
+		{"count_below(#4,10)", []float64{1, 2, 3, 4}, 4, true, true},
+	}
+
+	for i, tt := range tests {
+		fn, err := ParseFuncFromString(tt.fn, ">", 1.9)
+		if err != nil {
+			t.Errorf("case %d %s: parse error %v", i, tt.fn, err)
+			continue
+		}
+		_, left, triggered, enough := fn.Compute(newHistory(tt.values...))
+		if enough != tt.enough {
+			t.Errorf("case %d %s: isEnough = %v, want %v", i, tt.fn, enough, tt.enough)
+			continue
+		}
+		if !enough {
+			continue
+		}
+		if math.Abs(left-tt.left) > 1e-9 || triggered != tt.triggered {
+			t.Errorf("case %d %s: got (%v, %v), want (%v, %v)", i, tt.fn, left, triggered, tt.left, tt.triggered)
+		}
+	}
+}
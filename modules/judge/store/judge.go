@@ -236,7 +236,12 @@ func sendEventIfNeed(historyData []*model.HistoryData, isTriggered bool, now int
 			return
 		}
 
-		event.CurrentStep = lastEvent.CurrentStep + 1
+		if g.Silences.Silenced(event) {
+			// 屏蔽期间的报警照常入库，但不占用最大报警次数
+			event.CurrentStep = lastEvent.CurrentStep
+		} else {
+			event.CurrentStep = lastEvent.CurrentStep + 1
+		}
 		sendEvent(event)
 	} else {
 		// 如果LastEvent是Problem，报OK，否则啥都不做
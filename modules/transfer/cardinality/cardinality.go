@@ -0,0 +1,226 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cardinality
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	cmodel "github.com/open-falcon/falcon-plus/common/model"
+	"github.com/open-falcon/falcon-plus/modules/transfer/g"
+	"github.com/open-falcon/falcon-plus/modules/transfer/proc"
+)
+
+// 统计每个endpoint、每个metric下不同counter的数目(近似值).
+// 用bloom filter判断一个series在统计周期内是否出现过, 只有新的series会因为超过限制被拒绝,
+// 已经接收过的series不受影响. bloom filter和HyperLogLog都保留上一个周期, 所以停止上报的series最多2个周期后不再计数
+type keyStat struct {
+	prev     *hll
+	cur      *hll
+	rejected int64
+}
+
+func (this *keyStat) estimate() int {
+	merged := *this.cur
+	if this.prev != nil {
+		merged.merge(this.prev)
+	}
+	return merged.estimate()
+}
+
+type Tracker struct {
+	sync.Mutex
+	prev      *bloom
+	cur       *bloom
+	endpoints map[string]*keyStat
+	metrics   map[string]*keyStat
+}
+
+func NewTracker(expectedSeries int) *Tracker {
+	return &Tracker{
+		cur:       newBloom(expectedSeries),
+		endpoints: make(map[string]*keyStat),
+		metrics:   make(map[string]*keyStat),
+	}
+}
+
+func limitOf(key string, limit int, limits map[string]int) int {
+	if l, exists := limits[key]; exists {
+		return l
+	}
+	return limit
+}
+
+func statOf(stats map[string]*keyStat, key string) *keyStat {
+	s, exists := stats[key]
+	if !exists {
+		s = &keyStat{cur: new(hll)}
+		stats[key] = s
+	}
+	return s
+}
+
+// 返回false表示是新的series并且超过了限制
+func (this *Tracker) Admit(cfg *g.CardinalityConfig, item *cmodel.MetaData) bool {
+	x := hashSeries(item.PK())
+
+	this.Lock()
+	defer this.Unlock()
+
+	es := statOf(this.endpoints, item.Endpoint)
+	ms := statOf(this.metrics, item.Metric)
+	if !this.cur.test(x) && (this.prev == nil || !this.prev.test(x)) {
+		ok := true
+		if l := limitOf(item.Endpoint, cfg.EndpointLimit, cfg.EndpointLimits); l > 0 && es.estimate() >= l {
+			es.rejected++
+			ok = false
+		}
+		if l := limitOf(item.Metric, cfg.MetricLimit, cfg.MetricLimits); l > 0 && ms.estimate() >= l {
+			ms.rejected++
+			ok = false
+		}
+		if !ok {
+			return false
+		}
+	}
+
+	this.cur.add(x)
+	es.cur.add(x)
+	ms.cur.add(x)
+	return true
+}
+
+// 开始新的统计周期, 两个周期都没有数据的key被删除
+func (this *Tracker) Rotate(expectedSeries int) {
+	this.Lock()
+	defer this.Unlock()
+
+	this.prev, this.cur = this.cur, newBloom(expectedSeries)
+	for _, stats := range []map[string]*keyStat{this.endpoints, this.metrics} {
+		for key, s := range stats {
+			if *s.cur == (hll{}) {
+				delete(stats, key)
+				continue
+			}
+			s.prev, s.cur = s.cur, new(hll)
+		}
+	}
+}
+
+type Stat struct {
+	Key      string `json:"key"`
+	Series   int    `json:"series"`
+	Limit    int    `json:"limit"`
+	Rejected int64  `json:"rejected"`
+}
+
+type statSorter struct {
+	stats      []*Stat
+	byRejected bool
+}
+
+func (this statSorter) Len() int      { return len(this.stats) }
+func (this statSorter) Swap(i, j int) { this.stats[i], this.stats[j] = this.stats[j], this.stats[i] }
+func (this statSorter) Less(i, j int) bool {
+	a, b := this.stats[i], this.stats[j]
+	if this.byRejected && a.Rejected != b.Rejected {
+		return a.Rejected > b.Rejected
+	}
+	if a.Series != b.Series {
+		return a.Series > b.Series
+	}
+	return a.Key < b.Key
+}
+
+// kind是endpoint或metric, 按series数(byRejected时按被拒绝的数目)从大到小返回前n个
+func (this *Tracker) Top(cfg *g.CardinalityConfig, kind string, n int, byRejected bool) []*Stat {
+	stats, limit, limits := this.endpoints, cfg.EndpointLimit, cfg.EndpointLimits
+	if kind == "metric" {
+		stats, limit, limits = this.metrics, cfg.MetricLimit, cfg.MetricLimits
+	}
+
+	this.Lock()
+	ret := make([]*Stat, 0, len(stats))
+	for key, s := range stats {
+		ret = append(ret, &Stat{Key: key, Series: s.estimate(), Limit: limitOf(key, limit, limits), Rejected: s.rejected})
+	}
+	this.Unlock()
+
+	sort.Sort(statSorter{ret, byRejected})
+	if n > 0 && len(ret) > n {
+		ret = ret[:n]
+	}
+	return ret
+}
+
+var (
+	trackerLock = new(sync.Mutex)
+	tracker     *Tracker
+)
+
+// 第一次开启时创建, 之后通过/config/reload修改的限制立即生效, window和expectedSeries在下一个周期生效
+func getTracker(cfg *g.CardinalityConfig) *Tracker {
+	trackerLock.Lock()
+	defer trackerLock.Unlock()
+	if tracker == nil {
+		tracker = NewTracker(cfg.ExpectedSeries)
+		go rotateTask(tracker)
+	}
+	return tracker
+}
+
+func rotateTask(t *Tracker) {
+	last := time.Now().Unix()
+	for {
+		time.Sleep(time.Minute)
+		cfg := g.Config().Cardinality
+		if cfg == nil || time.Now().Unix()-last < cfg.Window {
+			continue
+		}
+		t.Rotate(cfg.ExpectedSeries)
+		last = time.Now().Unix()
+	}
+}
+
+func Filter(items []*cmodel.MetaData) []*cmodel.MetaData {
+	cfg := g.Config().Cardinality
+	if cfg == nil || !cfg.Enabled {
+		return items
+	}
+
+	t := getTracker(cfg)
+	ret := items[:0]
+	for _, item := range items {
+		if t.Admit(cfg, item) {
+			ret = append(ret, item)
+		} else {
+			proc.CardinalityRejectCnt.Incr()
+		}
+	}
+	return ret
+}
+
+// 没有开启时返回nil
+func Top(kind string, n int, byRejected bool) []*Stat {
+	cfg := g.Config().Cardinality
+	trackerLock.Lock()
+	t := tracker
+	trackerLock.Unlock()
+	if cfg == nil || t == nil {
+		return nil
+	}
+	return t.Top(cfg, kind, n, byRejected)
+}
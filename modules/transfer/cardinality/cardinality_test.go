@@ -0,0 +1,99 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cardinality
+
+import (
+	"fmt"
+	"testing"
+
+	cmodel "github.com/open-falcon/falcon-plus/common/model"
+	"github.com/open-falcon/falcon-plus/modules/transfer/g"
+)
+
+func TestHllEstimate(t *testing.T) {
+	for _, n := range []int{10, 1000, 100000} {
+		h := new(hll)
+		for i := 0; i < n; i++ {
+			h.add(hashSeries(fmt.Sprintf("series%d", i)))
+		}
+		e := h.estimate()
+		if diff := float64(e-n) / float64(n); diff > 0.2 || diff < -0.2 {
+			t.Errorf("n=%d: estimate %d", n, e)
+		}
+	}
+}
+
+func TestLeadingZeros64(t *testing.T) {
+	tests := map[uint64]int{0: 64, 1: 63, 0xff: 56, 1 << 32: 31, 1 << 63: 0, ^uint64(0): 0}
+	for x, expected := range tests {
+		if got := leadingZeros64(x); got != expected {
+			t.Errorf("leadingZeros64(%#x) = %d, expected %d", x, got, expected)
+		}
+	}
+}
+
+func item(endpoint, metric, tag string) *cmodel.MetaData {
+	return &cmodel.MetaData{Endpoint: endpoint, Metric: metric, Tags: map[string]string{"id": tag}}
+}
+
+func TestAdmit(t *testing.T) {
+	cfg := &g.CardinalityConfig{
+		EndpointLimit:  100,
+		EndpointLimits: map[string]int{"big": 0},
+		MetricLimit:    1000,
+	}
+	tr := NewTracker(100000)
+
+	admitted := 0
+	for i := 0; i < 1000; i++ {
+		if tr.Admit(cfg, item("host", "req", fmt.Sprint(i))) {
+			admitted++
+		}
+	}
+	if admitted < 80 || admitted > 120 {
+		t.Errorf("expect about 100 series admitted, got %d", admitted)
+	}
+	// 已经接收过的series不受限制
+	if !tr.Admit(cfg, item("host", "req", "0")) {
+		t.Errorf("known series rejected")
+	}
+	// 不限制的endpoint, 受metric的限制
+	for i := 0; i < 2000; i++ {
+		tr.Admit(cfg, item("big", "req", fmt.Sprint(i)))
+	}
+
+	top := tr.Top(cfg, "endpoint", 1, false)
+	if len(top) != 1 || top[0].Key != "big" || top[0].Limit != 0 {
+		t.Fatalf("unexpected top %+v", top)
+	}
+	top = tr.Top(cfg, "endpoint", 0, true)
+	if len(top) != 2 || top[0].Key != "host" || top[0].Rejected != int64(1000-admitted) {
+		t.Errorf("unexpected top by rejected %+v", top[0])
+	}
+	if top = tr.Top(cfg, "metric", 0, false); top[0].Rejected == 0 || top[0].Series > 1200 {
+		t.Errorf("unexpected metric stat %+v", top[0])
+	}
+
+	// 两个周期都没有数据之后被清除
+	tr.Rotate(100000)
+	if !tr.Admit(cfg, item("host", "req", "0")) {
+		t.Errorf("series of previous window rejected")
+	}
+	tr.Rotate(100000)
+	tr.Rotate(100000)
+	if len(tr.endpoints) != 0 || len(tr.metrics) != 0 {
+		t.Errorf("idle keys not removed")
+	}
+}
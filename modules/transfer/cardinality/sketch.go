@@ -0,0 +1,127 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cardinality
+
+import (
+	"hash/fnv"
+	"math"
+)
+
+// 把series的PK散列成64位, fnv的低位分布不够均匀, 再用splitmix64的finalizer打散
+func hashSeries(pk string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(pk))
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// HyperLogLog, 2^8个寄存器, 每个key占256字节, 标准误差约6.5%
+const (
+	hllPrecision = 8
+	hllRegisters = 1 << hllPrecision
+)
+
+type hll [hllRegisters]uint8
+
+func (this *hll) add(x uint64) {
+	idx := x >> (64 - hllPrecision)
+	rho := uint8(leadingZeros64(x<<hllPrecision|1<<(hllPrecision-1)) + 1)
+	if rho > this[idx] {
+		this[idx] = rho
+	}
+}
+
+// math/bits要go1.9才有
+func leadingZeros64(x uint64) int {
+	if x == 0 {
+		return 64
+	}
+	n := 0
+	for x&(1<<63) == 0 {
+		x <<= 1
+		n++
+	}
+	return n
+}
+
+func (this *hll) merge(other *hll) {
+	for i, v := range other {
+		if v > this[i] {
+			this[i] = v
+		}
+	}
+}
+
+func (this *hll) estimate() int {
+	m := float64(hllRegisters)
+	sum := 0.0
+	zeros := 0
+	for _, v := range this {
+		sum += math.Ldexp(1, -int(v))
+		if v == 0 {
+			zeros++
+		}
+	}
+	e := 0.7213 / (1 + 1.079/m) * m * m / sum
+	// 小基数时用linear counting修正
+	if e <= 2.5*m && zeros > 0 {
+		e = m * math.Log(m/float64(zeros))
+	}
+	return int(e + 0.5)
+}
+
+// bloom filter, 记录一个周期内已经接收过的series
+type bloom struct {
+	bits []uint64
+	m    uint64
+	k    int
+}
+
+// 按1%的误判率计算大小
+func newBloom(n int) *bloom {
+	if n < 1024 {
+		n = 1024
+	}
+	m := uint64(math.Ceil(-float64(n) * math.Log(0.01) / (math.Ln2 * math.Ln2)))
+	m = (m + 63) / 64 * 64
+	return &bloom{bits: make([]uint64, m/64), m: m, k: 7}
+}
+
+func (this *bloom) location(x uint64, i int) uint64 {
+	h1, h2 := x&0xffffffff, x>>32|1
+	return (h1 + uint64(i)*h2) % this.m
+}
+
+func (this *bloom) test(x uint64) bool {
+	for i := 0; i < this.k; i++ {
+		loc := this.location(x, i)
+		if this.bits[loc/64]&(1<<(loc%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (this *bloom) add(x uint64) {
+	for i := 0; i < this.k; i++ {
+		loc := this.location(x, i)
+		this.bits[loc/64] |= 1 << (loc % 64)
+	}
+}
@@ -73,6 +73,80 @@ type TsdbConfig struct {
 	Address     string `json:"address"`
 }
 
+type GraphiteConfig struct {
+	Enabled         bool     `json:"enabled"`
+	Listen          string   `json:"listen"`
+	UdpListen       string   `json:"udpListen"`
+	PickleListen    string   `json:"pickleListen"`
+	Timeout         int      `json:"timeout"`
+	Step            int64    `json:"step"`
+	CounterType     string   `json:"counterType"`
+	DefaultEndpoint string   `json:"defaultEndpoint"`
+	Templates       []string `json:"templates"`
+}
+
+type StatsdConfig struct {
+	Enabled     bool      `json:"enabled"`
+	Listen      string    `json:"listen"`
+	Endpoint    string    `json:"endpoint"`
+	Percentiles []float64 `json:"percentiles"`
+}
+
+type SpillConfig struct {
+	Enabled     bool   `json:"enabled"`
+	Dir         string `json:"dir"`
+	MaxSize     int64  `json:"maxSize"`     //每个后端节点最多占用的磁盘空间,单位MB
+	SegmentSize int64  `json:"segmentSize"` //单位MB
+}
+
+type InfluxConfig struct {
+	Enabled         bool   `json:"enabled"`
+	EndpointTag     string `json:"endpointTag"`
+	DefaultEndpoint string `json:"defaultEndpoint"`
+	Separator       string `json:"separator"`
+	Step            int64  `json:"step"`
+}
+
+type PrometheusConfig struct {
+	Enabled         bool   `json:"enabled"`
+	EndpointLabel   string `json:"endpointLabel"`
+	DefaultEndpoint string `json:"defaultEndpoint"`
+	Step            int64  `json:"step"`
+}
+
+type MembershipConfig struct {
+	Hbs        []string `json:"hbs"`        //从hbs获取judge/graph集群, 为空时只使用配置文件中的集群
+	Interval   int      `json:"interval"`   //从hbs同步的周期,单位sec
+	Timeout    int      `json:"timeout"`    //单位ms
+	TrackMoves int64    `json:"trackMoves"` //集群变化之后记录counter迁移情况的时间,单位sec
+}
+
+type CardinalityConfig struct {
+	Enabled        bool           `json:"enabled"`
+	EndpointLimit  int            `json:"endpointLimit"`  //每个endpoint最多的counter数, 0表示不限制
+	MetricLimit    int            `json:"metricLimit"`    //每个metric最多的counter数, 0表示不限制
+	EndpointLimits map[string]int `json:"endpointLimits"` //单独指定某些endpoint的限制
+	MetricLimits   map[string]int `json:"metricLimits"`
+	Window         int64          `json:"window"`         //统计周期,单位sec
+	ExpectedSeries int            `json:"expectedSeries"` //一个周期内预计的counter总数,决定内存占用
+}
+
+type RewriteMatch struct {
+	Endpoint string            `json:"endpoint"`
+	Metric   string            `json:"metric"`
+	Tags     map[string]string `json:"tags"`
+}
+
+type RewriteRule struct {
+	Name       string            `json:"name"`
+	Match      RewriteMatch      `json:"match"`
+	Drop       bool              `json:"drop"`
+	Metric     string            `json:"metric"`
+	Endpoint   string            `json:"endpoint"`
+	AddTags    map[string]string `json:"addTags"`
+	RemoveTags []string          `json:"removeTags"`
+}
+
 type GlobalConfig struct {
 	Debug   bool          `json:"debug"`
 	MinStep int           `json:"minStep"` //最小周期,单位sec
@@ -82,6 +156,16 @@ type GlobalConfig struct {
 	Judge   *JudgeConfig  `json:"judge"`
 	Graph   *GraphConfig  `json:"graph"`
 	Tsdb    *TsdbConfig   `json:"tsdb"`
+
+	Graphite   *GraphiteConfig   `json:"graphite"`
+	Statsd     *StatsdConfig     `json:"statsd"`
+	Spill      *SpillConfig      `json:"spill"`
+	Prometheus *PrometheusConfig `json:"prometheus"`
+	Influx     *InfluxConfig     `json:"influx"`
+	Rewrite    []*RewriteRule    `json:"rewrite"`
+
+	Cardinality *CardinalityConfig `json:"cardinality"`
+	Membership  *MembershipConfig  `json:"membership"`
 }
 
 var (
@@ -119,8 +203,92 @@ func ParseConfig(cfg string) {
 	}
 
 	// split cluster config
-	c.Judge.ClusterList = formatClusterItems(c.Judge.Cluster)
-	c.Graph.ClusterList = formatClusterItems(c.Graph.Cluster)
+	c.Judge.ClusterList = FormatClusterItems(c.Judge.Cluster)
+	c.Graph.ClusterList = FormatClusterItems(c.Graph.Cluster)
+
+	if c.Graphite != nil {
+		if c.Graphite.Timeout <= 0 {
+			c.Graphite.Timeout = 3600
+		}
+		if c.Graphite.Step <= 0 {
+			c.Graphite.Step = DEFAULT_STEP
+		}
+		if c.Graphite.CounterType == "" {
+			c.Graphite.CounterType = GAUGE
+		}
+		if c.Graphite.CounterType != GAUGE && c.Graphite.CounterType != COUNTER && c.Graphite.CounterType != DERIVE {
+			log.Fatalln("parse config file:", cfg, "fail: invalid graphite counterType", c.Graphite.CounterType)
+		}
+	}
+
+	if c.Statsd != nil {
+		if c.Statsd.Listen == "" {
+			c.Statsd.Listen = "0.0.0.0:8125"
+		}
+		if c.Statsd.Percentiles == nil {
+			c.Statsd.Percentiles = []float64{90, 99}
+		}
+		for _, p := range c.Statsd.Percentiles {
+			if p <= 0 || p > 100 {
+				log.Fatalln("parse config file:", cfg, "fail: invalid statsd percentile", p)
+			}
+		}
+	}
+
+	if c.Spill != nil {
+		if c.Spill.Dir == "" {
+			c.Spill.Dir = "./spill"
+		}
+		if c.Spill.MaxSize <= 0 {
+			c.Spill.MaxSize = 1024
+		}
+		if c.Spill.SegmentSize <= 0 {
+			c.Spill.SegmentSize = 64
+		}
+	}
+
+	if c.Prometheus != nil {
+		if c.Prometheus.EndpointLabel == "" {
+			c.Prometheus.EndpointLabel = "instance"
+		}
+		if c.Prometheus.Step <= 0 {
+			c.Prometheus.Step = 60
+		}
+	}
+
+	if c.Influx != nil {
+		if c.Influx.EndpointTag == "" {
+			c.Influx.EndpointTag = "host"
+		}
+		if c.Influx.Separator == "" {
+			c.Influx.Separator = "."
+		}
+		if c.Influx.Step <= 0 {
+			c.Influx.Step = DEFAULT_STEP
+		}
+	}
+
+	if c.Cardinality != nil {
+		if c.Cardinality.Window <= 0 {
+			c.Cardinality.Window = 86400
+		}
+		if c.Cardinality.ExpectedSeries <= 0 {
+			c.Cardinality.ExpectedSeries = 10000000
+		}
+	}
+
+	if c.Membership == nil {
+		c.Membership = &MembershipConfig{}
+	}
+	if c.Membership.Interval <= 0 {
+		c.Membership.Interval = 60
+	}
+	if c.Membership.Timeout <= 0 {
+		c.Membership.Timeout = 3000
+	}
+	if c.Membership.TrackMoves <= 0 {
+		c.Membership.TrackMoves = 600
+	}
 
 	configLock.Lock()
 	defer configLock.Unlock()
@@ -139,7 +307,7 @@ func NewClusterNode(addrs []string) *ClusterNode {
 }
 
 // map["node"]="host1,host2" --> map["node"]=["host1", "host2"]
-func formatClusterItems(cluster map[string]string) map[string]*ClusterNode {
+func FormatClusterItems(cluster map[string]string) map[string]*ClusterNode {
 	ret := make(map[string]*ClusterNode)
 	for node, clusterStr := range cluster {
 		items := strings.Split(clusterStr, ",")
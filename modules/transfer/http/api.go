@@ -43,4 +43,6 @@ func api_push_datapoints(rw http.ResponseWriter, req *http.Request) {
 
 func configApiRoutes() {
 	http.HandleFunc("/api/push", api_push_datapoints)
+	http.HandleFunc("/api/prometheus/write", api_prometheus_write)
+	http.HandleFunc("/write", api_influx_write)
 }
@@ -17,6 +17,8 @@ package http
 import (
 	"fmt"
 	"github.com/open-falcon/falcon-plus/modules/transfer/g"
+	"github.com/open-falcon/falcon-plus/modules/transfer/rewrite"
+	"github.com/open-falcon/falcon-plus/modules/transfer/sender"
 	"github.com/toolkits/file"
 	"net/http"
 	"strings"
@@ -42,6 +44,11 @@ func configCommonRoutes() {
 	http.HandleFunc("/config/reload", func(w http.ResponseWriter, r *http.Request) {
 		if strings.HasPrefix(r.RemoteAddr, "127.0.0.1") {
 			g.ParseConfig(g.ConfigFile)
+			sender.ReloadCluster()
+			if err := rewrite.Reload(g.Config().Rewrite); err != nil {
+				RenderDataJson(w, fmt.Sprintf("rewrite rules not reloaded: %v", err))
+				return
+			}
 			RenderDataJson(w, "ok")
 		} else {
 			RenderDataJson(w, "no privilege")
@@ -0,0 +1,298 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	cmodel "github.com/open-falcon/falcon-plus/common/model"
+	"github.com/open-falcon/falcon-plus/modules/transfer/g"
+	prpc "github.com/open-falcon/falcon-plus/modules/transfer/receiver/rpc"
+)
+
+const MaxInfluxBodySize = 32 * 1024 * 1024
+
+// influxdb line protocol: measurement[,tag=value...] field=value[,field=value...] [timestamp]
+type InfluxPoint struct {
+	Measurement string
+	Tags        map[string]string
+	Fields      map[string]float64
+	Timestamp   int64 // 按precision换算之前的原始值, 0表示没有带时间戳
+}
+
+// 每个数值类型的field转换成一个GAUGE类型的MetricValue, metric为measurement.field
+func api_influx_write(rw http.ResponseWriter, req *http.Request) {
+	cfg := g.Config().Influx
+	if cfg == nil || !cfg.Enabled {
+		http.Error(rw, "influxdb line protocol is disabled", http.StatusNotFound)
+		return
+	}
+	if req.Method != "POST" {
+		http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	toSeconds, err := influxPrecision(req.URL.Query().Get("precision"))
+	if err != nil {
+		influxError(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var body io.Reader = req.Body
+	if req.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(req.Body)
+		if err != nil {
+			influxError(rw, http.StatusBadRequest, "gzip: "+err.Error())
+			return
+		}
+		defer gz.Close()
+		body = gz
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(body, MaxInfluxBodySize+1))
+	if err != nil {
+		influxError(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(data) > MaxInfluxBodySize {
+		influxError(rw, http.StatusRequestEntityTooLarge, "request body is too large")
+		return
+	}
+
+	metrics := []*cmodel.MetricValue{}
+	parseErrors := []string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), MaxInfluxBodySize)
+	now := time.Now().Unix()
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		p, err := ParseInfluxLine(line)
+		if err != nil {
+			parseErrors = append(parseErrors, err.Error())
+			continue
+		}
+		ts := now
+		if p.Timestamp != 0 {
+			ts = toSeconds(p.Timestamp)
+		}
+		ms, err := InfluxToMetricValues(p, ts, cfg)
+		if err != nil {
+			parseErrors = append(parseErrors, err.Error())
+			continue
+		}
+		metrics = append(metrics, ms...)
+	}
+
+	reply := &cmodel.TransferResponse{}
+	prpc.RecvMetricValues(metrics, reply, "influx")
+
+	if len(parseErrors) > 0 {
+		msg := fmt.Sprintf("partial write: %d lines dropped: %s", len(parseErrors), parseErrors[0])
+		influxError(rw, http.StatusBadRequest, msg)
+		return
+	}
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+func influxError(rw http.ResponseWriter, code int, msg string) {
+	rw.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	rw.Header().Set("X-Influxdb-Error", msg)
+	rw.WriteHeader(code)
+	bs, _ := json.Marshal(map[string]string{"error": msg})
+	rw.Write(bs)
+}
+
+// 返回把时间戳换算成秒的函数, 默认精度是纳秒
+func influxPrecision(precision string) (func(int64) int64, error) {
+	switch precision {
+	case "", "n", "ns":
+		return func(ts int64) int64 { return ts / 1e9 }, nil
+	case "u", "us":
+		return func(ts int64) int64 { return ts / 1e6 }, nil
+	case "ms":
+		return func(ts int64) int64 { return ts / 1e3 }, nil
+	case "s":
+		return func(ts int64) int64 { return ts }, nil
+	case "m":
+		return func(ts int64) int64 { return ts * 60 }, nil
+	case "h":
+		return func(ts int64) int64 { return ts * 3600 }, nil
+	}
+	return nil, fmt.Errorf("invalid precision %q", precision)
+}
+
+func InfluxToMetricValues(p *InfluxPoint, ts int64, cfg *g.InfluxConfig) ([]*cmodel.MetricValue, error) {
+	endpoint := cfg.DefaultEndpoint
+	tags := []string{}
+	for k, v := range p.Tags {
+		if k == cfg.EndpointTag {
+			endpoint = v
+			continue
+		}
+		tags = append(tags, fmt.Sprintf("%s=%s", tagReplacer.Replace(k), tagReplacer.Replace(v)))
+	}
+	if endpoint == "" {
+		return nil, fmt.Errorf("no endpoint in %s", p.Measurement)
+	}
+	sort.Strings(tags)
+	tagstr := strings.Join(tags, ",")
+
+	metrics := []*cmodel.MetricValue{}
+	for field, value := range p.Fields {
+		metrics = append(metrics, &cmodel.MetricValue{
+			Endpoint:  endpoint,
+			Metric:    p.Measurement + cfg.Separator + field,
+			Value:     value,
+			Step:      cfg.Step,
+			Type:      g.GAUGE,
+			Tags:      tagstr,
+			Timestamp: ts,
+		})
+	}
+	return metrics, nil
+}
+
+func ParseInfluxLine(line string) (*InfluxPoint, error) {
+	keyEnd := indexUnescaped(line, ' ', false)
+	if keyEnd <= 0 {
+		return nil, fmt.Errorf("missing fields: %q", line)
+	}
+	rest := strings.TrimLeft(line[keyEnd:], " ")
+	fieldEnd := indexUnescaped(rest, ' ', true)
+	if fieldEnd < 0 {
+		fieldEnd = len(rest)
+	}
+	fieldSection, tsSection := rest[:fieldEnd], strings.TrimSpace(rest[fieldEnd:])
+
+	p := &InfluxPoint{Tags: map[string]string{}, Fields: map[string]float64{}}
+	keys := splitUnescaped(line[:keyEnd], ',', false)
+	p.Measurement = unescapeInflux(keys[0])
+	if p.Measurement == "" {
+		return nil, fmt.Errorf("missing measurement: %q", line)
+	}
+	for _, kv := range keys[1:] {
+		i := indexUnescaped(kv, '=', false)
+		if i <= 0 || i == len(kv)-1 {
+			return nil, fmt.Errorf("invalid tag %q: %q", kv, line)
+		}
+		p.Tags[unescapeInflux(kv[:i])] = unescapeInflux(kv[i+1:])
+	}
+
+	for _, kv := range splitUnescaped(fieldSection, ',', true) {
+		i := indexUnescaped(kv, '=', false)
+		if i <= 0 || i == len(kv)-1 {
+			return nil, fmt.Errorf("invalid field %q: %q", kv, line)
+		}
+		v, numeric, err := parseInfluxValue(kv[i+1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid field %q: %v", kv, err)
+		}
+		// 字符串类型的field忽略
+		if numeric {
+			p.Fields[unescapeInflux(kv[:i])] = v
+		}
+	}
+	if len(p.Fields) == 0 {
+		return nil, fmt.Errorf("no numeric field: %q", line)
+	}
+
+	if tsSection != "" {
+		ts, err := strconv.ParseInt(tsSection, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timestamp %q: %q", tsSection, line)
+		}
+		p.Timestamp = ts
+	}
+	return p, nil
+}
+
+func parseInfluxValue(s string) (float64, bool, error) {
+	switch s {
+	case "t", "T", "true", "True", "TRUE":
+		return 1, true, nil
+	case "f", "F", "false", "False", "FALSE":
+		return 0, true, nil
+	}
+	if s[0] == '"' {
+		if len(s) < 2 || s[len(s)-1] != '"' {
+			return 0, false, errors.New("unterminated string")
+		}
+		return 0, false, nil
+	}
+	last := s[len(s)-1]
+	if last == 'i' {
+		v, err := strconv.ParseInt(s[:len(s)-1], 10, 64)
+		return float64(v), err == nil, err
+	}
+	if last == 'u' {
+		v, err := strconv.ParseUint(s[:len(s)-1], 10, 64)
+		return float64(v), err == nil, err
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, false, err
+	}
+	// NaN/Inf和prometheus一样丢弃
+	return v, !math.IsNaN(v) && !math.IsInf(v, 0), nil
+}
+
+// 第一个没有被转义(并且不在引号中)的c的位置
+func indexUnescaped(s string, c byte, quoted bool) int {
+	inQuote := false
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			i++
+		case quoted && s[i] == '"':
+			inQuote = !inQuote
+		case s[i] == c && !inQuote:
+			return i
+		}
+	}
+	return -1
+}
+
+func splitUnescaped(s string, sep byte, quoted bool) []string {
+	parts := []string{}
+	for {
+		i := indexUnescaped(s, sep, quoted)
+		if i < 0 {
+			return append(parts, s)
+		}
+		parts = append(parts, s[:i])
+		s = s[i+1:]
+	}
+}
+
+var influxUnescaper = strings.NewReplacer(`\,`, ",", `\ `, " ", `\=`, "=", `\"`, `"`, `\\`, `\`)
+
+func unescapeInflux(s string) string {
+	return influxUnescaper.Replace(s)
+}
@@ -0,0 +1,82 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParseInfluxLine(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected string
+	}{
+		{"cpu,host=web01,cpu=cpu-total usage_idle=98.5,usage_user=1i 1500000000000000000",
+			"cpu map[cpu:cpu-total host:web01] map[usage_idle:98.5 usage_user:1] 1500000000000000000"},
+		{`disk\ io,host=web01,path=/data\ 1 used=1u,ok=true,label="a b,c=d" 1500000000`,
+			"disk io map[host:web01 path:/data 1] map[ok:1 used:1] 1500000000"},
+		{"mem,host=web01 free=-1.5e3",
+			"mem map[host:web01] map[free:-1500] 0"},
+		{"mem,host=web01 free=NaN,used=+Inf,total=8",
+			"mem map[host:web01] map[total:8] 0"},
+	}
+	for _, tt := range tests {
+		p, err := ParseInfluxLine(tt.line)
+		if err != nil {
+			t.Errorf("ParseInfluxLine(%q) error: %v", tt.line, err)
+			continue
+		}
+		got := fmt.Sprintf("%s %v %v %d", p.Measurement, p.Tags, p.Fields, p.Timestamp)
+		if got != tt.expected {
+			t.Errorf("ParseInfluxLine(%q) = %s, expected %s", tt.line, got, tt.expected)
+		}
+	}
+
+	for _, line := range []string{
+		"cpu",
+		"cpu,host=web01",
+		"cpu,host usage=1",
+		"cpu usage=abc",
+		`cpu label="only string"`,
+		"cpu usage=1 abc",
+		"cpu usage=NaN,idle=-Inf",
+		`cpu label="unterminated`,
+	} {
+		if _, err := ParseInfluxLine(line); err == nil {
+			t.Errorf("ParseInfluxLine(%q) expected error", line)
+		}
+	}
+}
+
+func TestInfluxPrecision(t *testing.T) {
+	tests := map[string]int64{"": 1500000000123456789, "u": 1500000000123456, "ms": 1500000000123, "s": 1500000000, "m": 25000000, "h": 416666}
+	for precision, ts := range tests {
+		toSeconds, err := influxPrecision(precision)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := int64(1500000000)
+		if precision == "h" {
+			expected = 1499997600
+		}
+		if got := toSeconds(ts); got != expected {
+			t.Errorf("precision %q: %d -> %d, expected %d", precision, ts, got, expected)
+		}
+	}
+	if _, err := influxPrecision("d"); err == nil {
+		t.Errorf("precision d expected error")
+	}
+}
@@ -16,7 +16,9 @@ package http
 
 import (
 	cutils "github.com/open-falcon/falcon-plus/common/utils"
+	"github.com/open-falcon/falcon-plus/modules/transfer/cardinality"
 	"github.com/open-falcon/falcon-plus/modules/transfer/proc"
+	"github.com/open-falcon/falcon-plus/modules/transfer/rewrite"
 	"github.com/open-falcon/falcon-plus/modules/transfer/sender"
 	"net/http"
 	"strconv"
@@ -26,12 +28,56 @@ import (
 func configProcHttpRoutes() {
 	// counter
 	http.HandleFunc("/counter/all", func(w http.ResponseWriter, r *http.Request) {
-		RenderDataJson(w, proc.GetAll())
+		RenderDataJson(w, append(proc.GetAll(), rewrite.Counters()...))
 	})
 
 	// TO BE DISCARDed
 	http.HandleFunc("/statistics/all", func(w http.ResponseWriter, r *http.Request) {
-		RenderDataJson(w, proc.GetAll())
+		RenderDataJson(w, append(proc.GetAll(), rewrite.Counters()...))
+	})
+
+	// spill
+	http.HandleFunc("/proc/spill", func(w http.ResponseWriter, r *http.Request) {
+		RenderDataJson(w, sender.SpillStats())
+	})
+
+	// cardinality, /proc/cardinality?type=endpoint|metric&n=20&sort=series|rejected
+	http.HandleFunc("/proc/cardinality", func(w http.ResponseWriter, r *http.Request) {
+		kind := r.FormValue("type")
+		if kind == "" {
+			kind = "endpoint"
+		}
+		if kind != "endpoint" && kind != "metric" {
+			RenderMsgJson(w, "type should be endpoint or metric")
+			return
+		}
+		n, err := strconv.Atoi(r.FormValue("n"))
+		if err != nil || n <= 0 {
+			n = 20
+		}
+		RenderDataJson(w, cardinality.Top(kind, n, r.FormValue("sort") == "rejected"))
+	})
+
+	// cluster
+	http.HandleFunc("/proc/cluster", func(w http.ResponseWriter, r *http.Request) {
+		RenderDataJson(w, sender.Cluster())
+	})
+
+	// 最近一次集群变化之后迁移的counter, /proc/cluster/moves?backend=judge|graph&n=1000
+	http.HandleFunc("/proc/cluster/moves", func(w http.ResponseWriter, r *http.Request) {
+		backend := r.FormValue("backend")
+		if backend == "" {
+			backend = "graph"
+		}
+		if backend != "judge" && backend != "graph" {
+			RenderMsgJson(w, "backend should be judge or graph")
+			return
+		}
+		n, err := strconv.Atoi(r.FormValue("n"))
+		if err != nil || n <= 0 {
+			n = 1000
+		}
+		RenderDataJson(w, sender.MovedCounters(backend, n))
 	})
 
 	// step
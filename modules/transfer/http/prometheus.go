@@ -0,0 +1,129 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/snappy"
+	cmodel "github.com/open-falcon/falcon-plus/common/model"
+	"github.com/open-falcon/falcon-plus/modules/transfer/g"
+	prpc "github.com/open-falcon/falcon-plus/modules/transfer/receiver/rpc"
+)
+
+var tagReplacer = strings.NewReplacer(",", "_", "=", "_", " ", "_")
+
+const (
+	MaxPromBodySize    = 32 * 1024 * 1024
+	MaxPromDecodedSize = 4 * MaxPromBodySize
+)
+
+// prometheus remote_write: body是snappy压缩后的WriteRequest
+func api_prometheus_write(rw http.ResponseWriter, req *http.Request) {
+	cfg := g.Config().Prometheus
+	if cfg == nil || !cfg.Enabled {
+		http.Error(rw, "prometheus remote_write is disabled", http.StatusNotFound)
+		return
+	}
+
+	compressed, err := ioutil.ReadAll(http.MaxBytesReader(rw, req.Body, MaxPromBodySize))
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if n, err := snappy.DecodedLen(compressed); err != nil || n > MaxPromDecodedSize {
+		http.Error(rw, "snappy decoded body is invalid or too large", http.StatusBadRequest)
+		return
+	}
+	buf, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		http.Error(rw, "snappy decode error: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	var wr PromWriteRequest
+	if err := proto.Unmarshal(buf, &wr); err != nil {
+		http.Error(rw, "protobuf decode error: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	metrics, invalid := PromToMetricValues(&wr, cfg)
+	reply := &cmodel.TransferResponse{}
+	prpc.RecvMetricValues(metrics, reply, "prometheus")
+	reply.Invalid += invalid
+	reply.Total += invalid
+	if g.Config().Debug && reply.Invalid > 0 {
+		log.Printf("prometheus remote_write from %s: %s", req.RemoteAddr, reply.String())
+	}
+
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// 每个sample转换成一个GAUGE类型的MetricValue, __name__作为metric, cfg.EndpointLabel作为endpoint, 其他label作为tags
+func PromToMetricValues(wr *PromWriteRequest, cfg *g.PrometheusConfig) (metrics []*cmodel.MetricValue, invalid int) {
+	metrics = []*cmodel.MetricValue{}
+	for _, ts := range wr.Timeseries {
+		if ts == nil {
+			continue
+		}
+		var metric, endpoint string
+		tags := []string{}
+		for _, l := range ts.Labels {
+			switch l.Name {
+			case "__name__":
+				metric = l.Value
+			case cfg.EndpointLabel:
+				endpoint = l.Value
+			default:
+				if l.Value == "" {
+					continue
+				}
+				tags = append(tags, fmt.Sprintf("%s=%s", tagReplacer.Replace(l.Name), tagReplacer.Replace(l.Value)))
+			}
+		}
+		if endpoint == "" {
+			endpoint = cfg.DefaultEndpoint
+		}
+		if metric == "" || endpoint == "" {
+			invalid += len(ts.Samples)
+			continue
+		}
+		sort.Strings(tags)
+
+		for _, s := range ts.Samples {
+			// 跳过staleness marker等NaN/Inf
+			if s == nil || math.IsNaN(s.Value) || math.IsInf(s.Value, 0) {
+				invalid += 1
+				continue
+			}
+			metrics = append(metrics, &cmodel.MetricValue{
+				Endpoint:  endpoint,
+				Metric:    metric,
+				Value:     s.Value,
+				Step:      cfg.Step,
+				Type:      g.GAUGE,
+				Tags:      strings.Join(tags, ","),
+				Timestamp: s.Timestamp / 1000,
+			})
+		}
+	}
+	return
+}
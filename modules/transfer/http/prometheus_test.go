@@ -0,0 +1,81 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/open-falcon/falcon-plus/modules/transfer/g"
+)
+
+func promSeries(samples []float64, labels ...string) *PromTimeSeries {
+	ts := &PromTimeSeries{}
+	for i := 0; i+1 < len(labels); i += 2 {
+		ts.Labels = append(ts.Labels, &PromLabel{Name: labels[i], Value: labels[i+1]})
+	}
+	for i, v := range samples {
+		ts.Samples = append(ts.Samples, &PromSample{Value: v, Timestamp: int64(1500000000000 + i*60000)})
+	}
+	return ts
+}
+
+func TestPromToMetricValues(t *testing.T) {
+	cfg := &g.PrometheusConfig{EndpointLabel: "instance", Step: 60}
+	stale := math.Float64frombits(0x7ff0000000000002)
+
+	tests := []struct {
+		ts       *PromTimeSeries
+		expected []string
+		invalid  int
+	}{
+		{
+			promSeries([]float64{1.5, 2}, "__name__", "up", "job", "node", "instance", "web01:9100", "path", "/a b,c=d", "empty", ""),
+			[]string{
+				"web01:9100/up job=node,path=/a_b_c_d 1.5 1500000000 GAUGE 60",
+				"web01:9100/up job=node,path=/a_b_c_d 2 1500000060 GAUGE 60",
+			},
+			0,
+		},
+		{
+			promSeries([]float64{stale, math.NaN(), math.Inf(1), 3}, "__name__", "up", "instance", "web01"),
+			[]string{"web01/up  3 1500000180 GAUGE 60"},
+			3,
+		},
+		// 没有endpoint label也没有defaultEndpoint
+		{promSeries([]float64{1, 2}, "__name__", "up", "job", "node"), []string{}, 2},
+		// 没有__name__
+		{promSeries([]float64{1}, "instance", "web01"), []string{}, 1},
+	}
+	for i, tt := range tests {
+		metrics, invalid := PromToMetricValues(&PromWriteRequest{Timeseries: []*PromTimeSeries{tt.ts}}, cfg)
+		got := []string{}
+		for _, m := range metrics {
+			got = append(got, fmt.Sprintf("%s/%s %s %v %d %s %d", m.Endpoint, m.Metric, m.Tags, m.Value, m.Timestamp, m.Type, m.Step))
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.expected) || invalid != tt.invalid {
+			t.Errorf("case %d: got %q invalid:%d, expected %q invalid:%d", i, got, invalid, tt.expected, tt.invalid)
+		}
+	}
+
+	cfg.DefaultEndpoint = "prometheus"
+	metrics, invalid := PromToMetricValues(&PromWriteRequest{Timeseries: []*PromTimeSeries{
+		promSeries([]float64{1}, "__name__", "up", "job", "node"),
+	}}, cfg)
+	if invalid != 0 || len(metrics) != 1 || metrics[0].Endpoint != "prometheus" || metrics[0].Tags != "job=node" {
+		t.Errorf("default endpoint: got %v invalid:%d", metrics, invalid)
+	}
+}
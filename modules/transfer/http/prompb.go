@@ -0,0 +1,57 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"github.com/golang/protobuf/proto"
+)
+
+// prometheus remote_write的消息定义, 和prometheus/prompb/types.proto, remote.proto保持一致
+
+type PromWriteRequest struct {
+	Timeseries []*PromTimeSeries `protobuf:"bytes,1,rep,name=timeseries" json:"timeseries,omitempty"`
+}
+
+func (m *PromWriteRequest) Reset()         { *m = PromWriteRequest{} }
+func (m *PromWriteRequest) String() string { return proto.CompactTextString(m) }
+func (*PromWriteRequest) ProtoMessage()    {}
+
+type PromTimeSeries struct {
+	Labels  []*PromLabel  `protobuf:"bytes,1,rep,name=labels" json:"labels,omitempty"`
+	Samples []*PromSample `protobuf:"bytes,2,rep,name=samples" json:"samples,omitempty"`
+}
+
+func (m *PromTimeSeries) Reset()         { *m = PromTimeSeries{} }
+func (m *PromTimeSeries) String() string { return proto.CompactTextString(m) }
+func (*PromTimeSeries) ProtoMessage()    {}
+
+type PromLabel struct {
+	Name  string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Value string `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+}
+
+func (m *PromLabel) Reset()         { *m = PromLabel{} }
+func (m *PromLabel) String() string { return proto.CompactTextString(m) }
+func (*PromLabel) ProtoMessage()    {}
+
+type PromSample struct {
+	Value float64 `protobuf:"fixed64,1,opt,name=value,proto3" json:"value,omitempty"`
+	// 毫秒
+	Timestamp int64 `protobuf:"varint,2,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+}
+
+func (m *PromSample) Reset()         { *m = PromSample{} }
+func (m *PromSample) String() string { return proto.CompactTextString(m) }
+func (*PromSample) ProtoMessage()    {}
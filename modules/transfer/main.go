@@ -21,7 +21,9 @@ import (
 	"github.com/open-falcon/falcon-plus/modules/transfer/http"
 	"github.com/open-falcon/falcon-plus/modules/transfer/proc"
 	"github.com/open-falcon/falcon-plus/modules/transfer/receiver"
+	"github.com/open-falcon/falcon-plus/modules/transfer/rewrite"
 	"github.com/open-falcon/falcon-plus/modules/transfer/sender"
+	"log"
 	"os"
 )
 
@@ -45,6 +47,10 @@ func main() {
 	// proc
 	proc.Start()
 
+	if err := rewrite.Reload(g.Config().Rewrite); err != nil {
+		log.Fatalln(err)
+	}
+
 	sender.Start()
 	receiver.Start()
 
@@ -36,6 +36,18 @@ var (
 	RpcRecvCnt    = nproc.NewSCounterQps("RpcRecvCnt")
 	HttpRecvCnt   = nproc.NewSCounterQps("HttpRecvCnt")
 	SocketRecvCnt = nproc.NewSCounterQps("SocketRecvCnt")
+	PromRecvCnt   = nproc.NewSCounterQps("PromRecvCnt")
+	InfluxRecvCnt = nproc.NewSCounterQps("InfluxRecvCnt")
+
+	CardinalityRejectCnt = nproc.NewSCounterQps("CardinalityRejectCnt")
+
+	GraphiteRecvCnt    = nproc.NewSCounterQps("GraphiteRecvCnt")
+	GraphiteInvalidCnt = nproc.NewSCounterQps("GraphiteInvalidCnt")
+
+	// statsd收到的原始数据条数, 格式错误的条数, 聚合之后的数据条数
+	StatsdSampleCnt  = nproc.NewSCounterQps("StatsdSampleCnt")
+	StatsdInvalidCnt = nproc.NewSCounterQps("StatsdInvalidCnt")
+	StatsdRecvCnt    = nproc.NewSCounterQps("StatsdRecvCnt")
 
 	SendToJudgeCnt = nproc.NewSCounterQps("SendToJudgeCnt")
 	SendToTsdbCnt  = nproc.NewSCounterQps("SendToTsdbCnt")
@@ -49,6 +61,17 @@ var (
 	SendToTsdbFailCnt  = nproc.NewSCounterQps("SendToTsdbFailCnt")
 	SendToGraphFailCnt = nproc.NewSCounterQps("SendToGraphFailCnt")
 
+	// 写入磁盘缓存, 从磁盘缓存重放, 磁盘缓存满了丢弃的数据条数
+	SendToJudgeSpillCnt = nproc.NewSCounterQps("SendToJudgeSpillCnt")
+	SendToGraphSpillCnt = nproc.NewSCounterQps("SendToGraphSpillCnt")
+	JudgeSpillReplayCnt = nproc.NewSCounterQps("JudgeSpillReplayCnt")
+	GraphSpillReplayCnt = nproc.NewSCounterQps("GraphSpillReplayCnt")
+	JudgeSpillDropCnt   = nproc.NewSCounterQps("JudgeSpillDropCnt")
+	GraphSpillDropCnt   = nproc.NewSCounterQps("GraphSpillDropCnt")
+	// 磁盘缓存中积压的记录数
+	JudgeSpillBacklogCnt = nproc.NewSCounterBase("JudgeSpillBacklogCnt")
+	GraphSpillBacklogCnt = nproc.NewSCounterBase("GraphSpillBacklogCnt")
+
 	// 发送缓存大小
 	JudgeQueuesCnt = nproc.NewSCounterBase("JudgeSendCacheCnt")
 	TsdbQueuesCnt  = nproc.NewSCounterBase("TsdbSendCacheCnt")
@@ -79,6 +102,14 @@ func GetAll() []interface{} {
 	ret = append(ret, RpcRecvCnt.Get())
 	ret = append(ret, HttpRecvCnt.Get())
 	ret = append(ret, SocketRecvCnt.Get())
+	ret = append(ret, PromRecvCnt.Get())
+	ret = append(ret, InfluxRecvCnt.Get())
+	ret = append(ret, CardinalityRejectCnt.Get())
+	ret = append(ret, GraphiteRecvCnt.Get())
+	ret = append(ret, GraphiteInvalidCnt.Get())
+	ret = append(ret, StatsdSampleCnt.Get())
+	ret = append(ret, StatsdInvalidCnt.Get())
+	ret = append(ret, StatsdRecvCnt.Get())
 
 	// send cnt
 	ret = append(ret, SendToJudgeCnt.Get())
@@ -100,6 +131,16 @@ func GetAll() []interface{} {
 	ret = append(ret, TsdbQueuesCnt.Get())
 	ret = append(ret, GraphQueuesCnt.Get())
 
+	// spill cnt
+	ret = append(ret, SendToJudgeSpillCnt.Get())
+	ret = append(ret, SendToGraphSpillCnt.Get())
+	ret = append(ret, JudgeSpillReplayCnt.Get())
+	ret = append(ret, GraphSpillReplayCnt.Get())
+	ret = append(ret, JudgeSpillDropCnt.Get())
+	ret = append(ret, GraphSpillDropCnt.Get())
+	ret = append(ret, JudgeSpillBacklogCnt.Get())
+	ret = append(ret, GraphSpillBacklogCnt.Get())
+
 	// http request
 	ret = append(ret, HistoryRequestCnt.Get())
 	ret = append(ret, InfoRequestCnt.Get())
@@ -0,0 +1,226 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graphite
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	cmodel "github.com/open-falcon/falcon-plus/common/model"
+	"github.com/open-falcon/falcon-plus/modules/transfer/g"
+	"github.com/open-falcon/falcon-plus/modules/transfer/proc"
+	prpc "github.com/open-falcon/falcon-plus/modules/transfer/receiver/rpc"
+)
+
+const (
+	// 长连接上每攒够FlushBatch条或者每隔FlushInterval发送一次
+	FlushBatch     = 1000
+	FlushInterval  = time.Second
+	MaxPickleSize  = 16 * 1024 * 1024
+	MaxLineSize    = 64 * 1024
+	MaxUdpDatagram = 65536
+)
+
+var parser *Parser
+
+func StartGraphite() {
+	cfg := g.Config().Graphite
+	if cfg == nil || !cfg.Enabled {
+		return
+	}
+
+	var err error
+	parser, err = NewParser(cfg.Templates, cfg.DefaultEndpoint, cfg.Step, cfg.CounterType)
+	if err != nil {
+		log.Fatalf("graphite templates fail: %s", err)
+	}
+
+	if cfg.Listen != "" {
+		go listenTcp(cfg.Listen, handlePlaintext)
+	}
+	if cfg.UdpListen != "" {
+		go listenUdp(cfg.UdpListen)
+	}
+	if cfg.PickleListen != "" {
+		go listenTcp(cfg.PickleListen, handlePickle)
+	}
+}
+
+func listenTcp(addr string, handle func(net.Conn)) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatalf("listen %s fail: %s", addr, err)
+	} else {
+		log.Println("graphite listening", addr)
+	}
+	defer listener.Close()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			log.Println("listener.Accept occur error:", err)
+			continue
+		}
+		go handle(conn)
+	}
+}
+
+func listenUdp(addr string) {
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		log.Fatalf("net.ResolveUDPAddr fail: %s", err)
+	}
+	conn, err := net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		log.Fatalf("listen udp %s fail: %s", addr, err)
+	} else {
+		log.Println("graphite listening udp", addr)
+	}
+	defer conn.Close()
+
+	buf := make([]byte, MaxUdpDatagram)
+	for {
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			log.Println("graphite read udp fail:", err)
+			continue
+		}
+		items := []*cmodel.MetaData{}
+		for _, line := range strings.Split(string(buf[:n]), "\n") {
+			if item := parseLine(line); item != nil {
+				items = append(items, item)
+			}
+		}
+		push(items)
+	}
+}
+
+func parseLine(line string) *cmodel.MetaData {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return nil
+	}
+	item, err := parser.ParseLine(line)
+	if err != nil {
+		proc.GraphiteInvalidCnt.Incr()
+		if g.Config().Debug {
+			log.Println("graphite:", err)
+		}
+		return nil
+	}
+	return item
+}
+
+func push(items []*cmodel.MetaData) {
+	if len(items) == 0 {
+		return
+	}
+	prpc.PushMetaData(items, "graphite")
+}
+
+// 读超时时先把已经收到的数据发出去, 空闲超过cfg.Timeout才断开连接
+// 一行超过MaxLineSize时丢弃并断开连接
+func handlePlaintext(conn net.Conn) {
+	defer conn.Close()
+
+	timeout := time.Duration(g.Config().Graphite.Timeout) * time.Second
+	buf := bufio.NewReaderSize(conn, MaxLineSize)
+	items := []*cmodel.MetaData{}
+	lastRead := time.Now()
+	lastFlush := time.Now()
+	// 读超时时可能只读到半行
+	partial := ""
+	for {
+		conn.SetReadDeadline(time.Now().Add(FlushInterval))
+		bs, err := buf.ReadSlice('\n')
+		line := string(bs)
+		if len(line) > 0 {
+			lastRead = time.Now()
+		}
+		if err == bufio.ErrBufferFull || len(partial)+len(line) > MaxLineSize {
+			proc.GraphiteInvalidCnt.Incr()
+			log.Printf("graphite from %s: line exceeds %d bytes, close connection", conn.RemoteAddr(), MaxLineSize)
+			push(items)
+			return
+		}
+		ne, isNetErr := err.(net.Error)
+		timedOut := isNetErr && ne.Timeout()
+		if timedOut {
+			partial += line
+		} else {
+			if item := parseLine(partial + line); item != nil {
+				items = append(items, item)
+			}
+			partial = ""
+		}
+		if len(items) >= FlushBatch || time.Since(lastFlush) >= FlushInterval || (err != nil && !timedOut) {
+			push(items)
+			items = []*cmodel.MetaData{}
+			lastFlush = time.Now()
+		}
+
+		if err != nil {
+			if timedOut && time.Since(lastRead) < timeout {
+				continue
+			}
+			return
+		}
+	}
+}
+
+func handlePickle(conn net.Conn) {
+	defer conn.Close()
+
+	timeout := time.Duration(g.Config().Graphite.Timeout) * time.Second
+	r := bufio.NewReader(conn)
+	var header [4]byte
+	for {
+		conn.SetReadDeadline(time.Now().Add(timeout))
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return
+		}
+		size := binary.BigEndian.Uint32(header[:])
+		if size > MaxPickleSize {
+			log.Printf("graphite pickle from %s: frame of %d bytes is too large", conn.RemoteAddr(), size)
+			return
+		}
+		data := make([]byte, size)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return
+		}
+
+		points, invalid, err := unpickleMetrics(data)
+		if err != nil {
+			log.Printf("graphite pickle from %s: %v", conn.RemoteAddr(), err)
+			return
+		}
+		items := []*cmodel.MetaData{}
+		for _, p := range points {
+			item, err := parser.Convert(p.Path, p.Value, p.Timestamp)
+			if err != nil {
+				invalid += 1
+				continue
+			}
+			items = append(items, item)
+		}
+		proc.GraphiteInvalidCnt.IncrBy(int64(invalid))
+		push(items)
+	}
+}
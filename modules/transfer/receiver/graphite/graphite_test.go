@@ -0,0 +1,97 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graphite
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParseLine(t *testing.T) {
+	p, err := NewParser([]string{
+		"servers.* .endpoint.metric*",
+		"collectd.* .endpoint.metric.instance.metric* dc=bj",
+		"stats.*.*.* ..endpoint.metric",
+	}, "default-host", 60, "GAUGE")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		line     string
+		endpoint string
+		metric   string
+		tags     string
+		ts       int64
+	}{
+		{"servers.web01.cpu.idle 98.5 1500000000", "web01", "cpu.idle", "map[]", 1500000000},
+		{"collectd.web02.cpu.0.idle 1 1500000000.5", "web02", "cpu.idle", "map[dc:bj instance:0]", 1500000000},
+		{"stats.gauges.web03.qps 10 1500000000", "web03", "qps", "map[]", 1500000000},
+		{"web04.disk.io.util 10 1500000000", "web04", "disk.io.util", "map[]", 1500000000},
+		{"servers.web05.load;period=1min 1.5 1500000000", "web05", "load", "map[period:1min]", 1500000000},
+	}
+	for _, tt := range tests {
+		item, err := p.ParseLine(tt.line)
+		if err != nil {
+			t.Errorf("ParseLine(%q) error: %v", tt.line, err)
+			continue
+		}
+		if item.Endpoint != tt.endpoint || item.Metric != tt.metric || fmt.Sprint(item.Tags) != tt.tags || item.Timestamp != tt.ts {
+			t.Errorf("ParseLine(%q) = %v, expected endpoint:%s metric:%s tags:%s ts:%d", tt.line, item, tt.endpoint, tt.metric, tt.tags, tt.ts)
+		}
+	}
+
+	for _, line := range []string{"servers.web01.cpu.idle", "servers.web01.cpu.idle abc 1500000000", "servers.web01.cpu.idle nan 1500000000", "web01 1 1500000000"} {
+		if _, err := p.ParseLine(line); err == nil {
+			t.Errorf("ParseLine(%q) expected error", line)
+		}
+	}
+}
+
+func TestParseTemplate(t *testing.T) {
+	for _, s := range []string{"endpoint.host", "metric*.endpoint", "a.* endpoint.metric b", "endpoint.metric dc"} {
+		if _, err := ParseTemplate(s); err == nil {
+			t.Errorf("ParseTemplate(%q) expected error", s)
+		}
+	}
+}
+
+func TestUnpickleMetrics(t *testing.T) {
+	// python: pickle.dumps([('servers.web01.cpu.idle', (1500000000, 98.5)), ('servers.web01.mem.free', (1500000000.0, 1024))], protocol=p)
+	payloads := map[string]string{
+		"protocol 0": "(lp0\n(Vservers.web01.cpu.idle\np1\n(I1500000000\nF98.5\ntp2\ntp3\na(Vservers.web01.mem.free\np4\n(F1500000000.0\nI1024\ntp5\ntp6\na.",
+		"protocol 2": "\x80\x02]q\x00(X\x16\x00\x00\x00servers.web01.cpu.idleq\x01J\x00/hYG@X\xa0\x00\x00\x00\x00\x00\x86q\x02\x86q\x03X\x16\x00\x00\x00servers.web01.mem.freeq\x04GA\xd6Z\x0b\xc0\x00\x00\x00M\x00\x04\x86q\x05\x86q\x06e.",
+		"protocol 4": "\x80\x04\x95Y\x00\x00\x00\x00\x00\x00\x00]\x94(\x8c\x16servers.web01.cpu.idle\x94J\x00/hYG@X\xa0\x00\x00\x00\x00\x00\x86\x94\x86\x94\x8c\x16servers.web01.mem.free\x94GA\xd6Z\x0b\xc0\x00\x00\x00M\x00\x04\x86\x94\x86\x94e.",
+		"python2":    "(lp0\n(S'servers.web01.cpu.idle'\np1\n(I1500000000\nF98.5\ntp2\ntp3\na(S'servers.web01.mem.free'\np4\n(L1500000000L\nI1024\ntp5\ntp6\na.",
+	}
+	for name, payload := range payloads {
+		points, invalid, err := unpickleMetrics([]byte(payload))
+		if err != nil {
+			t.Errorf("%s: unpickle error: %v", name, err)
+			continue
+		}
+		if invalid != 0 || len(points) != 2 {
+			t.Errorf("%s: got %d points, %d invalid", name, len(points), invalid)
+			continue
+		}
+		if *points[0] != (picklePoint{"servers.web01.cpu.idle", 1500000000, 98.5}) || *points[1] != (picklePoint{"servers.web01.mem.free", 1500000000, 1024}) {
+			t.Errorf("%s: got %+v %+v", name, points[0], points[1])
+		}
+	}
+
+	if _, _, err := unpickleMetrics([]byte("\x80\x02c__builtin__\neval\n.")); err == nil {
+		t.Errorf("unpickle GLOBAL expected error")
+	}
+}
@@ -0,0 +1,448 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graphite
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// carbon pickle协议: 4字节长度(big endian) + pickle数据, pickle数据的内容为 [(path, (timestamp, value)), ...]
+// 这里只实现了python pickle协议0-4中构造list, tuple, 字符串和数字需要的操作码
+
+type pickleList struct {
+	items []interface{}
+}
+
+type pickleMark struct{}
+
+type unpickler struct {
+	r     *bufio.Reader
+	stack []interface{}
+	memo  map[int]interface{}
+}
+
+func unpickle(data []byte) (interface{}, error) {
+	u := &unpickler{r: bufio.NewReader(bytes.NewReader(data)), memo: map[int]interface{}{}}
+	return u.load()
+}
+
+func (u *unpickler) push(v interface{}) {
+	u.stack = append(u.stack, v)
+}
+
+func (u *unpickler) pop() (interface{}, error) {
+	if len(u.stack) == 0 {
+		return nil, errors.New("pickle stack underflow")
+	}
+	v := u.stack[len(u.stack)-1]
+	u.stack = u.stack[:len(u.stack)-1]
+	return v, nil
+}
+
+func (u *unpickler) top() (interface{}, error) {
+	if len(u.stack) == 0 {
+		return nil, errors.New("pickle stack underflow")
+	}
+	return u.stack[len(u.stack)-1], nil
+}
+
+// 弹出最近的mark之上的所有元素
+func (u *unpickler) popMark() ([]interface{}, error) {
+	for i := len(u.stack) - 1; i >= 0; i-- {
+		if _, ok := u.stack[i].(pickleMark); ok {
+			items := append([]interface{}{}, u.stack[i+1:]...)
+			u.stack = u.stack[:i]
+			return items, nil
+		}
+	}
+	return nil, errors.New("pickle mark not found")
+}
+
+func (u *unpickler) readN(n int) ([]byte, error) {
+	if n < 0 || n > 64*1024*1024 {
+		return nil, fmt.Errorf("invalid pickle length %d", n)
+	}
+	buf := make([]byte, n)
+	_, err := io.ReadFull(u.r, buf)
+	return buf, err
+}
+
+func (u *unpickler) readLine() (string, error) {
+	line, err := u.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(line, "\n"), nil
+}
+
+func (u *unpickler) readUint(n int) (int, error) {
+	buf, err := u.readN(n)
+	if err != nil {
+		return 0, err
+	}
+	var v uint32
+	for i := n - 1; i >= 0; i-- {
+		v = v<<8 | uint32(buf[i])
+	}
+	return int(v), nil
+}
+
+func (u *unpickler) load() (interface{}, error) {
+	for {
+		op, err := u.r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case 0x80: // PROTO
+			if _, err = u.r.ReadByte(); err != nil {
+				return nil, err
+			}
+		case 0x95: // FRAME
+			if _, err = u.readN(8); err != nil {
+				return nil, err
+			}
+		case '.': // STOP
+			return u.pop()
+		case '(': // MARK
+			u.push(pickleMark{})
+		case '0': // POP
+			_, err = u.pop()
+		case '1': // POP_MARK
+			_, err = u.popMark()
+		case '2': // DUP
+			var v interface{}
+			if v, err = u.top(); err == nil {
+				u.push(v)
+			}
+		case 'N': // NONE
+			u.push(nil)
+		case 0x88: // NEWTRUE
+			u.push(true)
+		case 0x89: // NEWFALSE
+			u.push(false)
+		case ']': // EMPTY_LIST
+			u.push(&pickleList{})
+		case ')': // EMPTY_TUPLE
+			u.push([]interface{}{})
+		case 'l': // LIST
+			var items []interface{}
+			if items, err = u.popMark(); err == nil {
+				u.push(&pickleList{items: items})
+			}
+		case 't': // TUPLE
+			var items []interface{}
+			if items, err = u.popMark(); err == nil {
+				u.push(items)
+			}
+		case 0x85, 0x86, 0x87: // TUPLE1, TUPLE2, TUPLE3
+			n := int(op-0x85) + 1
+			if len(u.stack) < n {
+				return nil, errors.New("pickle stack underflow")
+			}
+			items := append([]interface{}{}, u.stack[len(u.stack)-n:]...)
+			u.stack = u.stack[:len(u.stack)-n]
+			u.push(items)
+		case 'a': // APPEND
+			var v, l interface{}
+			if v, err = u.pop(); err != nil {
+				return nil, err
+			}
+			if l, err = u.top(); err != nil {
+				return nil, err
+			}
+			list, ok := l.(*pickleList)
+			if !ok {
+				return nil, errors.New("pickle APPEND to non-list")
+			}
+			list.items = append(list.items, v)
+		case 'e': // APPENDS
+			var items []interface{}
+			var l interface{}
+			if items, err = u.popMark(); err != nil {
+				return nil, err
+			}
+			if l, err = u.top(); err != nil {
+				return nil, err
+			}
+			list, ok := l.(*pickleList)
+			if !ok {
+				return nil, errors.New("pickle APPENDS to non-list")
+			}
+			list.items = append(list.items, items...)
+		case 'S': // STRING
+			var line string
+			if line, err = u.readLine(); err == nil {
+				var s string
+				if s, err = unquotePy(line); err == nil {
+					u.push(s)
+				}
+			}
+		case 'V': // UNICODE
+			var line string
+			if line, err = u.readLine(); err == nil {
+				u.push(line)
+			}
+		case 'U', 'C', 0x8c: // SHORT_BINSTRING, SHORT_BINBYTES, SHORT_BINUNICODE
+			var n int
+			var buf []byte
+			if n, err = u.readUint(1); err == nil {
+				if buf, err = u.readN(n); err == nil {
+					u.push(string(buf))
+				}
+			}
+		case 'T', 'B', 'X': // BINSTRING, BINBYTES, BINUNICODE
+			var n int
+			var buf []byte
+			if n, err = u.readUint(4); err == nil {
+				if buf, err = u.readN(n); err == nil {
+					u.push(string(buf))
+				}
+			}
+		case 'I': // INT
+			var line string
+			if line, err = u.readLine(); err != nil {
+				return nil, err
+			}
+			switch line {
+			case "01":
+				u.push(true)
+			case "00":
+				u.push(false)
+			default:
+				var v int64
+				if v, err = strconv.ParseInt(line, 10, 64); err == nil {
+					u.push(v)
+				}
+			}
+		case 'L': // LONG
+			var line string
+			if line, err = u.readLine(); err == nil {
+				var v int64
+				if v, err = strconv.ParseInt(strings.TrimSuffix(line, "L"), 10, 64); err == nil {
+					u.push(v)
+				}
+			}
+		case 'J': // BININT
+			var buf []byte
+			if buf, err = u.readN(4); err == nil {
+				u.push(int64(int32(binary.LittleEndian.Uint32(buf))))
+			}
+		case 'K': // BININT1
+			var n int
+			if n, err = u.readUint(1); err == nil {
+				u.push(int64(n))
+			}
+		case 'M': // BININT2
+			var n int
+			if n, err = u.readUint(2); err == nil {
+				u.push(int64(n))
+			}
+		case 0x8a, 0x8b: // LONG1, LONG4
+			size := 1
+			if op == 0x8b {
+				size = 4
+			}
+			var n int
+			var buf []byte
+			if n, err = u.readUint(size); err != nil {
+				return nil, err
+			}
+			if buf, err = u.readN(n); err != nil {
+				return nil, err
+			}
+			u.push(decodeLong(buf))
+		case 'F': // FLOAT
+			var line string
+			if line, err = u.readLine(); err == nil {
+				var v float64
+				if v, err = strconv.ParseFloat(line, 64); err == nil {
+					u.push(v)
+				}
+			}
+		case 'G': // BINFLOAT
+			var buf []byte
+			if buf, err = u.readN(8); err == nil {
+				u.push(math.Float64frombits(binary.BigEndian.Uint64(buf)))
+			}
+		case 'p': // PUT
+			var line string
+			var idx int
+			if line, err = u.readLine(); err != nil {
+				return nil, err
+			}
+			if idx, err = strconv.Atoi(line); err == nil {
+				err = u.memoize(idx)
+			}
+		case 'q', 'r': // BINPUT, LONG_BINPUT
+			size := 1
+			if op == 'r' {
+				size = 4
+			}
+			var idx int
+			if idx, err = u.readUint(size); err == nil {
+				err = u.memoize(idx)
+			}
+		case 0x94: // MEMOIZE
+			err = u.memoize(len(u.memo))
+		case 'g': // GET
+			var line string
+			var idx int
+			if line, err = u.readLine(); err != nil {
+				return nil, err
+			}
+			if idx, err = strconv.Atoi(line); err == nil {
+				err = u.get(idx)
+			}
+		case 'h', 'j': // BINGET, LONG_BINGET
+			size := 1
+			if op == 'j' {
+				size = 4
+			}
+			var idx int
+			if idx, err = u.readUint(size); err == nil {
+				err = u.get(idx)
+			}
+		default:
+			return nil, fmt.Errorf("unsupported pickle opcode 0x%x", op)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (u *unpickler) memoize(idx int) error {
+	v, err := u.top()
+	if err != nil {
+		return err
+	}
+	u.memo[idx] = v
+	return nil
+}
+
+func (u *unpickler) get(idx int) error {
+	v, ok := u.memo[idx]
+	if !ok {
+		return fmt.Errorf("pickle memo %d not found", idx)
+	}
+	u.push(v)
+	return nil
+}
+
+// little endian的补码
+func decodeLong(buf []byte) interface{} {
+	if len(buf) == 0 {
+		return int64(0)
+	}
+	be := make([]byte, len(buf))
+	for i, b := range buf {
+		be[len(buf)-1-i] = b
+	}
+	v := new(big.Int).SetBytes(be)
+	if buf[len(buf)-1]&0x80 != 0 {
+		v.Sub(v, new(big.Int).Lsh(big.NewInt(1), uint(len(buf)*8)))
+	}
+	if v.IsInt64() {
+		return v.Int64()
+	}
+	f, _ := new(big.Float).SetInt(v).Float64()
+	return f
+}
+
+// python repr格式的字符串, 例如 'a.b.c' 或者 "it's"
+func unquotePy(s string) (string, error) {
+	if len(s) < 2 || s[0] != s[len(s)-1] || (s[0] != '\'' && s[0] != '"') {
+		return "", fmt.Errorf("invalid pickle string %s", s)
+	}
+	inner := s[1 : len(s)-1]
+	if s[0] == '\'' {
+		inner = strings.Replace(strings.Replace(inner, `\'`, `'`, -1), `"`, `\"`, -1)
+	}
+	return strconv.Unquote(`"` + inner + `"`)
+}
+
+type picklePoint struct {
+	Path      string
+	Timestamp int64
+	Value     float64
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	case bool:
+		if n {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+func toSlice(v interface{}) ([]interface{}, bool) {
+	switch l := v.(type) {
+	case []interface{}:
+		return l, true
+	case *pickleList:
+		return l.items, true
+	}
+	return nil, false
+}
+
+// 解析一个pickle帧, 格式不对的数据点会被跳过并计入invalid
+func unpickleMetrics(data []byte) (points []*picklePoint, invalid int, err error) {
+	v, err := unpickle(data)
+	if err != nil {
+		return nil, 0, err
+	}
+	items, ok := toSlice(v)
+	if !ok {
+		return nil, 0, errors.New("pickle data is not a list")
+	}
+	for _, item := range items {
+		pair, ok := toSlice(item)
+		if !ok || len(pair) != 2 {
+			invalid += 1
+			continue
+		}
+		path, ok := pair[0].(string)
+		datapoint, ok2 := toSlice(pair[1])
+		if !ok || !ok2 || len(datapoint) != 2 {
+			invalid += 1
+			continue
+		}
+		ts, ok := toFloat(datapoint[0])
+		value, ok2 := toFloat(datapoint[1])
+		if !ok || !ok2 {
+			invalid += 1
+			continue
+		}
+		points = append(points, &picklePoint{Path: path, Timestamp: int64(ts), Value: value})
+	}
+	return
+}
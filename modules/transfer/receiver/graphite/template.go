@@ -0,0 +1,230 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graphite
+
+import (
+	"fmt"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	cmodel "github.com/open-falcon/falcon-plus/common/model"
+)
+
+// 把graphite的path按模板映射成endpoint, metric和tags, 模板的格式为: [filter] template [tags]
+//   - filter: 按.分段的匹配条件, 每一段支持通配符, 例如 servers.web*
+//   - template: 按.分段, 每一段是endpoint, metric, metric*(剩余的所有段), 空(忽略这一段), 或者tag的名字
+//   - tags: 额外的tags, 例如 dc=bj,service=web
+//
+// 同一个名字对应多段时, 用.连接
+type Template struct {
+	filter []string
+	parts  []string
+	tags   map[string]string
+}
+
+// 没有匹配的模板时, 第一段作为endpoint, 剩下的作为metric
+const DefaultTemplate = "endpoint.metric*"
+
+func ParseTemplate(s string) (*Template, error) {
+	fields := strings.Fields(s)
+	var filter, tmpl, tags string
+	switch len(fields) {
+	case 1:
+		tmpl = fields[0]
+	case 2:
+		if strings.Contains(fields[1], "=") {
+			tmpl, tags = fields[0], fields[1]
+		} else {
+			filter, tmpl = fields[0], fields[1]
+		}
+	case 3:
+		filter, tmpl, tags = fields[0], fields[1], fields[2]
+	default:
+		return nil, fmt.Errorf("invalid template %q", s)
+	}
+
+	t := &Template{parts: strings.Split(tmpl, "."), tags: map[string]string{}}
+	if filter != "" {
+		t.filter = strings.Split(filter, ".")
+		for _, f := range t.filter {
+			if _, err := path.Match(f, ""); err != nil {
+				return nil, fmt.Errorf("invalid filter %q: %v", filter, err)
+			}
+		}
+	}
+
+	hasMetric := false
+	for i, p := range t.parts {
+		if p == "metric*" && i != len(t.parts)-1 {
+			return nil, fmt.Errorf("invalid template %q: metric* must be the last part", s)
+		}
+		if p == "metric" || p == "metric*" {
+			hasMetric = true
+		}
+	}
+	if !hasMetric {
+		return nil, fmt.Errorf("invalid template %q: no metric part", s)
+	}
+
+	if tags != "" {
+		for _, kv := range strings.Split(tags, ",") {
+			pair := strings.SplitN(kv, "=", 2)
+			if len(pair) != 2 || pair[0] == "" || pair[1] == "" {
+				return nil, fmt.Errorf("invalid tags %q in template %q", tags, s)
+			}
+			t.tags[pair[0]] = pair[1]
+		}
+	}
+	return t, nil
+}
+
+func (t *Template) Match(parts []string) bool {
+	if len(t.filter) > len(parts) {
+		return false
+	}
+	for i, f := range t.filter {
+		if ok, _ := path.Match(f, parts[i]); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (t *Template) Apply(parts []string) (endpoint string, metric string, tags map[string]string) {
+	endpoints, metrics := []string{}, []string{}
+	tagParts := map[string][]string{}
+	greedy := t.parts[len(t.parts)-1] == "metric*"
+	for i, p := range parts {
+		var name string
+		if i < len(t.parts) {
+			name = t.parts[i]
+		} else if greedy {
+			name = "metric*"
+		} else {
+			break
+		}
+		switch name {
+		case "":
+		case "endpoint":
+			endpoints = append(endpoints, p)
+		case "metric", "metric*":
+			metrics = append(metrics, p)
+		default:
+			tagParts[name] = append(tagParts[name], p)
+		}
+	}
+
+	tags = map[string]string{}
+	for k, v := range t.tags {
+		tags[k] = v
+	}
+	for k, v := range tagParts {
+		tags[k] = strings.Join(v, ".")
+	}
+	return strings.Join(endpoints, "."), strings.Join(metrics, "."), tags
+}
+
+type Parser struct {
+	Templates       []*Template
+	DefaultEndpoint string
+	Step            int64
+	CounterType     string
+}
+
+func NewParser(templates []string, defaultEndpoint string, step int64, counterType string) (*Parser, error) {
+	p := &Parser{DefaultEndpoint: defaultEndpoint, Step: step, CounterType: counterType}
+	for _, s := range append(templates, DefaultTemplate) {
+		t, err := ParseTemplate(s)
+		if err != nil {
+			return nil, err
+		}
+		p.Templates = append(p.Templates, t)
+	}
+	return p, nil
+}
+
+// plaintext: path value [timestamp], path可以带上graphite 1.1格式的tags, 例如 a.b.c;tag1=v1;tag2=v2
+func (p *Parser) ParseLine(line string) (*cmodel.MetaData, error) {
+	fields := strings.Fields(line)
+	if len(fields) != 2 && len(fields) != 3 {
+		return nil, fmt.Errorf("invalid line %q", line)
+	}
+	v, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value in line %q", line)
+	}
+	var ts float64 = -1
+	if len(fields) == 3 {
+		ts, err = strconv.ParseFloat(fields[2], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timestamp in line %q", line)
+		}
+	}
+	return p.Convert(fields[0], v, int64(ts))
+}
+
+func (p *Parser) Convert(name string, value float64, ts int64) (*cmodel.MetaData, error) {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return nil, fmt.Errorf("invalid value %v of %s", value, name)
+	}
+
+	segs := strings.Split(name, ";")
+	parts := strings.Split(segs[0], ".")
+	var endpoint, metric string
+	var tags map[string]string
+	for _, t := range p.Templates {
+		if t.Match(parts) {
+			endpoint, metric, tags = t.Apply(parts)
+			break
+		}
+	}
+	for _, seg := range segs[1:] {
+		pair := strings.SplitN(seg, "=", 2)
+		if len(pair) == 2 && pair[0] != "" && pair[1] != "" {
+			tags[pair[0]] = pair[1]
+		}
+	}
+
+	if endpoint == "" {
+		endpoint = p.DefaultEndpoint
+	}
+	if endpoint == "" || metric == "" {
+		return nil, fmt.Errorf("no endpoint or metric in %s", name)
+	}
+	tagLen := 0
+	for k, v := range tags {
+		tagLen += len(k) + len(v) + 2
+	}
+	if len(metric)+tagLen > 510 {
+		return nil, fmt.Errorf("metric and tags of %s is too long", name)
+	}
+
+	now := time.Now().Unix()
+	if ts <= 0 || ts > now*2 {
+		ts = now
+	}
+	return &cmodel.MetaData{
+		Endpoint:    endpoint,
+		Metric:      metric,
+		Timestamp:   ts,
+		Step:        p.Step,
+		CounterType: p.CounterType,
+		Tags:        tags,
+		Value:       value,
+	}, nil
+}
@@ -15,11 +15,15 @@
 package receiver
 
 import (
+	"github.com/open-falcon/falcon-plus/modules/transfer/receiver/graphite"
 	"github.com/open-falcon/falcon-plus/modules/transfer/receiver/rpc"
 	"github.com/open-falcon/falcon-plus/modules/transfer/receiver/socket"
+	"github.com/open-falcon/falcon-plus/modules/transfer/receiver/statsd"
 )
 
 func Start() {
 	go rpc.StartRpc()
 	go socket.StartSocket()
+	go graphite.StartGraphite()
+	go statsd.StartStatsd()
 }
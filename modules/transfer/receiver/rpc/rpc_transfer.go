@@ -18,8 +18,10 @@ import (
 	"fmt"
 	cmodel "github.com/open-falcon/falcon-plus/common/model"
 	cutils "github.com/open-falcon/falcon-plus/common/utils"
+	"github.com/open-falcon/falcon-plus/modules/transfer/cardinality"
 	"github.com/open-falcon/falcon-plus/modules/transfer/g"
 	"github.com/open-falcon/falcon-plus/modules/transfer/proc"
+	"github.com/open-falcon/falcon-plus/modules/transfer/rewrite"
 	"github.com/open-falcon/falcon-plus/modules/transfer/sender"
 	"strconv"
 	"time"
@@ -137,6 +139,20 @@ func RecvMetricValues(args []*cmodel.MetricValue, reply *cmodel.TransferResponse
 		items = append(items, fv)
 	}
 
+	PushMetaData(items, from)
+
+	reply.Message = "ok"
+	reply.Total = len(args)
+	reply.Latency = (time.Now().UnixNano() - start.UnixNano()) / 1000000
+
+	return nil
+}
+
+// 执行rewrite规则和counter数目限制, 统计并发送到各个后端的发送缓存队列
+func PushMetaData(items []*cmodel.MetaData, from string) {
+	items = rewrite.Apply(items)
+	items = cardinality.Filter(items)
+
 	// statistics
 	cnt := int64(len(items))
 	proc.RecvCnt.IncrBy(cnt)
@@ -144,6 +160,14 @@ func RecvMetricValues(args []*cmodel.MetricValue, reply *cmodel.TransferResponse
 		proc.RpcRecvCnt.IncrBy(cnt)
 	} else if from == "http" {
 		proc.HttpRecvCnt.IncrBy(cnt)
+	} else if from == "prometheus" {
+		proc.PromRecvCnt.IncrBy(cnt)
+	} else if from == "influx" {
+		proc.InfluxRecvCnt.IncrBy(cnt)
+	} else if from == "graphite" {
+		proc.GraphiteRecvCnt.IncrBy(cnt)
+	} else if from == "statsd" {
+		proc.StatsdRecvCnt.IncrBy(cnt)
 	}
 
 	cfg := g.Config()
@@ -159,10 +183,4 @@ func RecvMetricValues(args []*cmodel.MetricValue, reply *cmodel.TransferResponse
 	if cfg.Tsdb.Enabled {
 		sender.Push2TsdbSendQueue(items)
 	}
-
-	reply.Message = "ok"
-	reply.Total = len(args)
-	reply.Latency = (time.Now().UnixNano() - start.UnixNano()) / 1000000
-
-	return nil
 }
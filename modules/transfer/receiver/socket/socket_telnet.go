@@ -18,8 +18,10 @@ import (
 	"bufio"
 	"fmt"
 	cmodel "github.com/open-falcon/falcon-plus/common/model"
+	"github.com/open-falcon/falcon-plus/modules/transfer/cardinality"
 	"github.com/open-falcon/falcon-plus/modules/transfer/g"
 	"github.com/open-falcon/falcon-plus/modules/transfer/proc"
+	"github.com/open-falcon/falcon-plus/modules/transfer/rewrite"
 	"github.com/open-falcon/falcon-plus/modules/transfer/sender"
 	"net"
 	"strconv"
@@ -72,6 +74,9 @@ func socketTelnetHandle(conn net.Conn) {
 		items = append(items, item)
 	}
 
+	items = rewrite.Apply(items)
+	items = cardinality.Filter(items)
+
 	// statistics
 	proc.SocketRecvCnt.IncrBy(int64(len(items)))
 	proc.RecvCnt.IncrBy(int64(len(items)))
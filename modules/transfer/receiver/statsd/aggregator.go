@@ -0,0 +1,267 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statsd
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	cmodel "github.com/open-falcon/falcon-plus/common/model"
+	cutils "github.com/open-falcon/falcon-plus/common/utils"
+)
+
+// gauge连续这么多个周期没有更新就不再保留, 之后的相对值从0开始累加
+const GaugeIdleFlushes = 10
+
+var (
+	nameReplacer = strings.NewReplacer(" ", "_", "\t", "_")
+	tagReplacer  = strings.NewReplacer(",", "_", "=", "_", " ", "_")
+)
+
+// 一条statsd数据: name:value|type[|@rate][|#k:v,k2:v2]
+type Sample struct {
+	Name     string
+	Value    float64
+	Raw      string // set的原始值
+	Type     string // c, g, s, ms, h, d
+	Rate     float64
+	Relative bool // +/-开头的gauge
+	Tags     map[string]string
+}
+
+func ParseSample(line string) (*Sample, error) {
+	colon := strings.LastIndex(line, ":")
+	pipe := strings.Index(line, "|")
+	// dogstatsd的tags中也有冒号, 所以用第一个|之前的最后一个冒号
+	if pipe > 0 {
+		colon = strings.LastIndex(line[:pipe], ":")
+	}
+	if colon <= 0 || pipe < colon {
+		return nil, fmt.Errorf("invalid line %q", line)
+	}
+
+	s := &Sample{Name: nameReplacer.Replace(line[:colon]), Rate: 1, Tags: map[string]string{}}
+	fields := strings.Split(line[colon+1:], "|")
+	if len(fields) < 2 {
+		return nil, fmt.Errorf("invalid line %q", line)
+	}
+	s.Raw, s.Type = fields[0], fields[1]
+	switch s.Type {
+	case "c", "g", "ms", "h", "d":
+		v, err := strconv.ParseFloat(s.Raw, 64)
+		if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil, fmt.Errorf("invalid value in line %q", line)
+		}
+		s.Value = v
+		s.Relative = s.Type == "g" && (s.Raw[0] == '+' || s.Raw[0] == '-')
+	case "s":
+	default:
+		return nil, fmt.Errorf("invalid type in line %q", line)
+	}
+
+	for _, f := range fields[2:] {
+		if strings.HasPrefix(f, "@") {
+			rate, err := strconv.ParseFloat(f[1:], 64)
+			if err != nil || rate <= 0 || rate > 1 {
+				return nil, fmt.Errorf("invalid sample rate in line %q", line)
+			}
+			s.Rate = rate
+		} else if strings.HasPrefix(f, "#") {
+			for _, kv := range strings.Split(f[1:], ",") {
+				pair := strings.SplitN(kv, ":", 2)
+				if len(pair) == 2 && pair[0] != "" && pair[1] != "" {
+					s.Tags[tagReplacer.Replace(pair[0])] = tagReplacer.Replace(pair[1])
+				}
+			}
+		}
+	}
+	return s, nil
+}
+
+type series struct {
+	endpoint string
+	name     string
+	tags     map[string]string
+}
+
+type counter struct {
+	series
+	value float64
+}
+
+type gauge struct {
+	series
+	value   float64
+	updated bool
+	idle    int
+}
+
+type set struct {
+	series
+	values map[string]struct{}
+}
+
+type timer struct {
+	series
+	values []float64
+	count  float64
+}
+
+// 按周期聚合statsd数据
+type Aggregator struct {
+	sync.Mutex
+	percentiles []float64
+	counters    map[string]*counter
+	gauges      map[string]*gauge
+	sets        map[string]*set
+	timers      map[string]*timer
+}
+
+func NewAggregator(percentiles []float64) *Aggregator {
+	return &Aggregator{
+		percentiles: percentiles,
+		counters:    map[string]*counter{},
+		gauges:      map[string]*gauge{},
+		sets:        map[string]*set{},
+		timers:      map[string]*timer{},
+	}
+}
+
+func (a *Aggregator) Add(endpoint string, s *Sample) {
+	key := cutils.PK(endpoint, s.Name, s.Tags)
+	ser := series{endpoint: endpoint, name: s.Name, tags: s.Tags}
+
+	a.Lock()
+	defer a.Unlock()
+	switch s.Type {
+	case "c":
+		c, exists := a.counters[key]
+		if !exists {
+			c = &counter{series: ser}
+			a.counters[key] = c
+		}
+		c.value += s.Value / s.Rate
+	case "g":
+		g, exists := a.gauges[key]
+		if !exists {
+			g = &gauge{series: ser}
+			a.gauges[key] = g
+		}
+		if s.Relative {
+			g.value += s.Value
+		} else {
+			g.value = s.Value
+		}
+		g.updated = true
+		g.idle = 0
+	case "s":
+		st, exists := a.sets[key]
+		if !exists {
+			st = &set{series: ser, values: map[string]struct{}{}}
+			a.sets[key] = st
+		}
+		st.values[s.Raw] = struct{}{}
+	default:
+		t, exists := a.timers[key]
+		if !exists {
+			t = &timer{series: ser}
+			a.timers[key] = t
+		}
+		t.values = append(t.values, s.Value)
+		t.count += 1 / s.Rate
+	}
+}
+
+// 输出这个周期的聚合结果, ts是周期的开始时间, step是周期的长度(秒)
+//   - counter: name(周期内的总数), name.rate(每秒)
+//   - gauge: name(最新的值)
+//   - set: name(不同值的个数)
+//   - timer: name.count, name.rate, name.sum, name.min, name.max, name.mean, name.pN
+func (a *Aggregator) Flush(ts int64, step int64) []*cmodel.MetaData {
+	a.Lock()
+	counters, sets, timers := a.counters, a.sets, a.timers
+	a.counters, a.sets, a.timers = map[string]*counter{}, map[string]*set{}, map[string]*timer{}
+	items := []*cmodel.MetaData{}
+	newItem := func(ser series, suffix string, value float64) {
+		items = append(items, &cmodel.MetaData{
+			Endpoint:    ser.endpoint,
+			Metric:      ser.name + suffix,
+			Timestamp:   ts,
+			Step:        step,
+			CounterType: "GAUGE",
+			Tags:        ser.tags,
+			Value:       value,
+		})
+	}
+	for key, g := range a.gauges {
+		if g.updated {
+			newItem(g.series, "", g.value)
+			g.updated = false
+		} else {
+			g.idle += 1
+			if g.idle >= GaugeIdleFlushes {
+				delete(a.gauges, key)
+			}
+		}
+	}
+	a.Unlock()
+
+	for _, c := range counters {
+		newItem(c.series, "", c.value)
+		newItem(c.series, ".rate", c.value/float64(step))
+	}
+	for _, st := range sets {
+		newItem(st.series, "", float64(len(st.values)))
+	}
+	for _, t := range timers {
+		sort.Float64s(t.values)
+		n := len(t.values)
+		sum := 0.0
+		for _, v := range t.values {
+			sum += v
+		}
+		newItem(t.series, ".count", t.count)
+		newItem(t.series, ".rate", t.count/float64(step))
+		newItem(t.series, ".sum", sum)
+		newItem(t.series, ".min", t.values[0])
+		newItem(t.series, ".max", t.values[n-1])
+		newItem(t.series, ".mean", sum/float64(n))
+		for _, p := range a.percentiles {
+			newItem(t.series, PercentileSuffix(p), percentile(t.values, p))
+		}
+	}
+	return items
+}
+
+// 90 -> .p90, 99.9 -> .p99_9
+func PercentileSuffix(p float64) string {
+	return ".p" + strings.Replace(strconv.FormatFloat(p, 'f', -1, 64), ".", "_", -1)
+}
+
+// nearest-rank, values已经排好序
+func percentile(values []float64, p float64) float64 {
+	idx := int(math.Ceil(p/100*float64(len(values)))) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	if idx >= len(values) {
+		idx = len(values) - 1
+	}
+	return values[idx]
+}
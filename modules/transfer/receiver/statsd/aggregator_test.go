@@ -0,0 +1,97 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statsd
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParseSample(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected string
+	}{
+		{"api.requests:1|c", "api.requests 1 c 1 false map[]"},
+		{"api.requests:2|c|@0.5|#service:web,dc:bj", "api.requests 2 c 0.5 false map[dc:bj service:web]"},
+		{"queue.size:-3|g", "queue.size -3 g 1 true map[]"},
+		{"api.latency:12.5|ms|#path:/a=b", "api.latency 12.5 ms 1 false map[path:/a_b]"},
+		{"users:alice|s", "users 0 s 1 false map[]"},
+	}
+	for _, tt := range tests {
+		s, err := ParseSample(tt.line)
+		if err != nil {
+			t.Errorf("ParseSample(%q) error: %v", tt.line, err)
+			continue
+		}
+		got := fmt.Sprintf("%s %v %s %v %v %v", s.Name, s.Value, s.Type, s.Rate, s.Relative, s.Tags)
+		if got != tt.expected {
+			t.Errorf("ParseSample(%q) = %s, expected %s", tt.line, got, tt.expected)
+		}
+	}
+
+	for _, line := range []string{"api.requests", "api.requests:1", "api.requests:a|c", "api.requests:1|x", "api.requests:1|c|@2"} {
+		if _, err := ParseSample(line); err == nil {
+			t.Errorf("ParseSample(%q) expected error", line)
+		}
+	}
+}
+
+func TestAggregator(t *testing.T) {
+	a := NewAggregator([]float64{50, 99.9})
+	lines := []string{
+		"hits:1|c", "hits:1|c|@0.1",
+		"temp:10|g", "temp:+5|g",
+		"users:a|s", "users:b|s", "users:a|s",
+	}
+	for i := 1; i <= 10; i++ {
+		lines = append(lines, fmt.Sprintf("latency:%d|ms", i))
+	}
+	for _, line := range lines {
+		s, err := ParseSample(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		a.Add("host01", s)
+	}
+
+	got := map[string]float64{}
+	for _, item := range a.Flush(1500000000, 10) {
+		if item.Timestamp != 1500000000 || item.Step != 10 || item.Endpoint != "host01" {
+			t.Errorf("unexpected item %v", item)
+		}
+		got[item.Metric] = item.Value
+	}
+	expected := map[string]float64{
+		"hits": 11, "hits.rate": 1.1,
+		"temp":          15,
+		"users":         2,
+		"latency.count": 10, "latency.rate": 1, "latency.sum": 55, "latency.min": 1, "latency.max": 10,
+		"latency.mean": 5.5, "latency.p50": 5, "latency.p99_9": 10,
+	}
+	if fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Errorf("Flush() = %v, expected %v", got, expected)
+	}
+
+	// gauge没有更新时不输出, 相对值在上一次的基础上累加
+	if items := a.Flush(1500000010, 10); len(items) != 0 {
+		t.Errorf("second Flush() = %v, expected nothing", items)
+	}
+	s, _ := ParseSample("temp:-1|g")
+	a.Add("host01", s)
+	if items := a.Flush(1500000020, 10); len(items) != 1 || items[0].Value != 14 {
+		t.Errorf("third Flush() = %v, expected temp 14", items)
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statsd
+
+import (
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/open-falcon/falcon-plus/modules/transfer/g"
+	"github.com/open-falcon/falcon-plus/modules/transfer/proc"
+	prpc "github.com/open-falcon/falcon-plus/modules/transfer/receiver/rpc"
+	"github.com/open-falcon/falcon-plus/modules/transfer/sender"
+)
+
+const (
+	MaxUdpDatagram = 65536
+	// 作为endpoint的tag
+	EndpointTag = "endpoint"
+)
+
+var aggregator *Aggregator
+
+func StartStatsd() {
+	cfg := g.Config().Statsd
+	if cfg == nil || !cfg.Enabled {
+		return
+	}
+
+	aggregator = NewAggregator(cfg.Percentiles)
+	go flushLoop()
+
+	udpAddr, err := net.ResolveUDPAddr("udp", cfg.Listen)
+	if err != nil {
+		log.Fatalf("net.ResolveUDPAddr fail: %s", err)
+	}
+	conn, err := net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		log.Fatalf("listen udp %s fail: %s", cfg.Listen, err)
+	} else {
+		log.Println("statsd listening udp", cfg.Listen)
+	}
+	defer conn.Close()
+
+	buf := make([]byte, MaxUdpDatagram)
+	for {
+		n, addr, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			log.Println("statsd read udp fail:", err)
+			continue
+		}
+		handlePacket(string(buf[:n]), addr)
+	}
+}
+
+// endpoint依次取endpoint tag, 配置的endpoint, 发送方的ip
+func handlePacket(packet string, addr *net.UDPAddr) {
+	defaultEndpoint := g.Config().Statsd.Endpoint
+	if defaultEndpoint == "" && addr != nil {
+		defaultEndpoint = addr.IP.String()
+	}
+	for _, line := range strings.Split(packet, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		s, err := ParseSample(line)
+		if err != nil {
+			proc.StatsdInvalidCnt.Incr()
+			if g.Config().Debug {
+				log.Println("statsd:", err)
+			}
+			continue
+		}
+		endpoint := defaultEndpoint
+		if e, exists := s.Tags[EndpointTag]; exists {
+			endpoint = e
+			delete(s.Tags, EndpointTag)
+		}
+		proc.StatsdSampleCnt.Incr()
+		aggregator.Add(endpoint, s)
+	}
+}
+
+// 按MinStep对齐的周期输出聚合结果, 时间戳是周期的开始时间
+func flushLoop() {
+	step := int64(sender.MinStep)
+	for {
+		now := time.Now().Unix()
+		next := now - now%step + step
+		time.Sleep(time.Unix(next, 0).Sub(time.Now()))
+
+		items := aggregator.Flush(next-step, step)
+		if len(items) > 0 {
+			prpc.PushMetaData(items, "statsd")
+		}
+	}
+}
@@ -0,0 +1,215 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rewrite
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+
+	cmodel "github.com/open-falcon/falcon-plus/common/model"
+	cutils "github.com/open-falcon/falcon-plus/common/utils"
+	"github.com/open-falcon/falcon-plus/modules/transfer/g"
+	nproc "github.com/toolkits/proc"
+)
+
+// 在发送到judge/graph/tsdb之前, 按顺序对每条数据执行所有匹配的规则, 被drop的数据不再执行后面的规则
+type Rule struct {
+	Name     string
+	cfg      *g.RewriteRule
+	endpoint *regexp.Regexp
+	metric   *regexp.Regexp
+	tags     map[string]*regexp.Regexp
+	hits     *nproc.SCounterQps
+}
+
+var (
+	rulesLock = new(sync.RWMutex)
+	rules     []*Rule
+	// 规则名 -> 命中次数, reload之后同名规则的计数保留
+	hits    = map[string]*nproc.SCounterQps{}
+	dropCnt = nproc.NewSCounterQps("RewriteDropCnt")
+	// 改写之后不再合法的数据
+	invalidCnt = nproc.NewSCounterQps("RewriteInvalidCnt")
+)
+
+// 和接收数据时的校验一致
+const MaxMetricTagsLen = 510
+
+// 正则都是整体匹配
+func compileRegexp(expr string) (*regexp.Regexp, error) {
+	if expr == "" {
+		return nil, nil
+	}
+	return regexp.Compile("^(?:" + expr + ")$")
+}
+
+func Compile(cfgs []*g.RewriteRule) ([]*Rule, error) {
+	ret := []*Rule{}
+	names := map[string]bool{}
+	for i, cfg := range cfgs {
+		r := &Rule{Name: cfg.Name, cfg: cfg, tags: map[string]*regexp.Regexp{}}
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("rule%d", i)
+		}
+		if names[r.Name] {
+			return nil, fmt.Errorf("duplicate rewrite rule name %s", r.Name)
+		}
+		names[r.Name] = true
+
+		var err error
+		if r.endpoint, err = compileRegexp(cfg.Match.Endpoint); err != nil {
+			return nil, fmt.Errorf("rewrite rule %s: invalid endpoint regexp: %v", r.Name, err)
+		}
+		if r.metric, err = compileRegexp(cfg.Match.Metric); err != nil {
+			return nil, fmt.Errorf("rewrite rule %s: invalid metric regexp: %v", r.Name, err)
+		}
+		for k, expr := range cfg.Match.Tags {
+			if r.tags[k], err = compileRegexp(expr); err != nil {
+				return nil, fmt.Errorf("rewrite rule %s: invalid regexp of tag %s: %v", r.Name, k, err)
+			}
+		}
+		if !cfg.Drop && cfg.Metric == "" && cfg.Endpoint == "" && len(cfg.AddTags) == 0 && len(cfg.RemoveTags) == 0 {
+			return nil, fmt.Errorf("rewrite rule %s does nothing", r.Name)
+		}
+		ret = append(ret, r)
+	}
+	return ret, nil
+}
+
+// 规则有错误时保留原来的规则
+func Reload(cfgs []*g.RewriteRule) error {
+	rs, err := Compile(cfgs)
+	if err != nil {
+		return err
+	}
+
+	rulesLock.Lock()
+	defer rulesLock.Unlock()
+	for _, r := range rs {
+		if _, exists := hits[r.Name]; !exists {
+			hits[r.Name] = nproc.NewSCounterQps("RewriteHit." + r.Name)
+		}
+		r.hits = hits[r.Name]
+	}
+	rules = rs
+	return nil
+}
+
+func Apply(items []*cmodel.MetaData) []*cmodel.MetaData {
+	rulesLock.RLock()
+	rs := rules
+	rulesLock.RUnlock()
+	if len(rs) == 0 {
+		return items
+	}
+
+	ret := items[:0]
+	for _, item := range items {
+		keep, changed := applyRules(rs, item)
+		if !keep {
+			dropCnt.Incr()
+			continue
+		}
+		if changed && !isValid(item) {
+			invalidCnt.Incr()
+			continue
+		}
+		ret = append(ret, item)
+	}
+	return ret
+}
+
+func isValid(item *cmodel.MetaData) bool {
+	return item.Endpoint != "" && item.Metric != "" &&
+		len(item.Metric)+len(cutils.SortedTags(item.Tags)) <= MaxMetricTagsLen
+}
+
+// keep为false表示丢弃, changed表示数据被改写过
+func applyRules(rs []*Rule, item *cmodel.MetaData) (keep bool, changed bool) {
+	// tags可能和其他数据共用, 修改之前先复制
+	copied := false
+	for _, r := range rs {
+		var endpointIdx, metricIdx []int
+		if r.endpoint != nil {
+			if endpointIdx = r.endpoint.FindStringSubmatchIndex(item.Endpoint); endpointIdx == nil {
+				continue
+			}
+		}
+		if r.metric != nil {
+			if metricIdx = r.metric.FindStringSubmatchIndex(item.Metric); metricIdx == nil {
+				continue
+			}
+		}
+		matched := true
+		for k, re := range r.tags {
+			v, exists := item.Tags[k]
+			if !exists || !re.MatchString(v) {
+				matched = false
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+
+		r.hits.Incr()
+		if r.cfg.Drop {
+			return false, changed
+		}
+		changed = true
+		if r.cfg.Endpoint != "" {
+			item.Endpoint = expand(r.endpoint, r.cfg.Endpoint, item.Endpoint, endpointIdx)
+		}
+		if r.cfg.Metric != "" {
+			item.Metric = expand(r.metric, r.cfg.Metric, item.Metric, metricIdx)
+		}
+		if len(r.cfg.RemoveTags) > 0 || len(r.cfg.AddTags) > 0 {
+			if !copied {
+				tags := make(map[string]string, len(item.Tags))
+				for k, v := range item.Tags {
+					tags[k] = v
+				}
+				item.Tags = tags
+				copied = true
+			}
+			for _, k := range r.cfg.RemoveTags {
+				delete(item.Tags, k)
+			}
+			for k, v := range r.cfg.AddTags {
+				item.Tags[k] = v
+			}
+		}
+	}
+	return true, changed
+}
+
+// 没有对应的正则时template按原样使用, 否则可以用$1, ${name}引用分组
+func expand(re *regexp.Regexp, template string, src string, idx []int) string {
+	if re == nil {
+		return template
+	}
+	return string(re.ExpandString(nil, template, src, idx))
+}
+
+func Counters() []interface{} {
+	rulesLock.RLock()
+	defer rulesLock.RUnlock()
+	ret := []interface{}{dropCnt.Get(), invalidCnt.Get()}
+	for _, r := range rules {
+		ret = append(ret, r.hits.Get())
+	}
+	return ret
+}
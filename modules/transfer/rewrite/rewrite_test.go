@@ -0,0 +1,104 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rewrite
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	cmodel "github.com/open-falcon/falcon-plus/common/model"
+	"github.com/open-falcon/falcon-plus/modules/transfer/g"
+)
+
+func TestApply(t *testing.T) {
+	err := Reload([]*g.RewriteRule{
+		{Name: "drop_debug", Match: g.RewriteMatch{Metric: `debug\..*`}, Drop: true},
+		{Name: "rename", Match: g.RewriteMatch{Metric: `old\.(.*)`}, Metric: "new.$1"},
+		{Name: "pod", Match: g.RewriteMatch{Tags: map[string]string{"pod": ".+"}}, RemoveTags: []string{"pod"}, AddTags: map[string]string{"k8s": "1"}},
+		{Name: "endpoint", Match: g.RewriteMatch{Endpoint: `(.*)\.example\.com`}, Endpoint: "$1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	shared := map[string]string{"pod": "web-7f9c8d", "svc": "web"}
+	items := []*cmodel.MetaData{
+		{Endpoint: "host1.example.com", Metric: "debug.gc", Tags: map[string]string{}},
+		{Endpoint: "host1.example.com", Metric: "old.cpu", Tags: map[string]string{}},
+		{Endpoint: "host2", Metric: "requests", Tags: shared},
+		{Endpoint: "host2", Metric: "errors", Tags: shared},
+	}
+	items = Apply(items)
+
+	if len(items) != 3 {
+		t.Fatalf("expect 3 items, got %d", len(items))
+	}
+	if items[0].Endpoint != "host1" || items[0].Metric != "new.cpu" {
+		t.Errorf("unexpected %s/%s", items[0].Endpoint, items[0].Metric)
+	}
+	for _, item := range items[1:] {
+		if !reflect.DeepEqual(item.Tags, map[string]string{"svc": "web", "k8s": "1"}) {
+			t.Errorf("unexpected tags %v", item.Tags)
+		}
+	}
+	if shared["pod"] != "web-7f9c8d" {
+		t.Errorf("shared tags modified: %v", shared)
+	}
+
+	for name, expect := range map[string]int64{"drop_debug": 1, "rename": 1, "pod": 2, "endpoint": 1} {
+		if cnt := hits[name].Get().Cnt; cnt != expect {
+			t.Errorf("rule %s: expect %d hits, got %d", name, expect, cnt)
+		}
+	}
+}
+
+func TestApplyInvalid(t *testing.T) {
+	err := Reload([]*g.RewriteRule{
+		{Name: "empty_endpoint", Match: g.RewriteMatch{Endpoint: `tmp-(.*)`}, Endpoint: "$2"},
+		{Name: "long_tag", Match: g.RewriteMatch{Metric: "long"}, AddTags: map[string]string{"k": strings.Repeat("v", MaxMetricTagsLen)}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	items := Apply([]*cmodel.MetaData{
+		{Endpoint: "tmp-1", Metric: "cpu", Tags: map[string]string{}},
+		{Endpoint: "host1", Metric: "long", Tags: map[string]string{}},
+		{Endpoint: "host1", Metric: "cpu", Tags: map[string]string{}},
+	})
+	if len(items) != 1 || items[0].Endpoint != "host1" || items[0].Metric != "cpu" {
+		t.Errorf("unexpected items %v", items)
+	}
+}
+
+func TestReloadInvalid(t *testing.T) {
+	if err := Reload([]*g.RewriteRule{{Name: "ok", Drop: true}}); err != nil {
+		t.Fatal(err)
+	}
+	cases := [][]*g.RewriteRule{
+		{{Name: "bad", Match: g.RewriteMatch{Metric: "("}, Drop: true}},
+		{{Name: "noop", Match: g.RewriteMatch{Metric: "cpu"}}},
+		{{Name: "dup", Drop: true}, {Name: "dup", Drop: true}},
+	}
+	for i, c := range cases {
+		if err := Reload(c); err == nil {
+			t.Errorf("case %d: expect error", i)
+		}
+	}
+	if len(rules) != 1 || rules[0].Name != "ok" {
+		t.Errorf("old rules should be kept")
+	}
+}
@@ -0,0 +1,458 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sender
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/rpc"
+	"os"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	cmodel "github.com/open-falcon/falcon-plus/common/model"
+	cutils "github.com/open-falcon/falcon-plus/common/utils"
+	"github.com/open-falcon/falcon-plus/modules/transfer/g"
+	"github.com/open-falcon/falcon-plus/modules/transfer/proc"
+	"github.com/open-falcon/falcon-plus/modules/transfer/spill"
+	rings "github.com/toolkits/consistent/rings"
+	nlist "github.com/toolkits/container/list"
+	tnet "github.com/toolkits/net"
+)
+
+// judge/graph集群可以在运行时变化(配置文件reload或者从hbs同步), 变化时重建一致性哈希环,
+// 新节点创建发送队列、磁盘缓存、连接池和发送任务, 删除的节点停止发送任务, 剩余的数据按新的哈希环重新分配.
+// 哈希环、发送队列、磁盘缓存和发送任务都由clusterLock保护
+var (
+	clusterLock   = new(sync.RWMutex)
+	judgeCluster  map[string]string         // node -> addr
+	graphCluster  map[string]*g.ClusterNode // node -> addrs
+	judgeReplicas int
+	graphReplicas int
+	judgeTasks    = make(map[string]*sendTask) // node -> task
+	graphTasks    = make(map[string]*sendTask) // node+addr -> task
+	clusterFrom   = "config"
+	clusterTs     int64
+
+	// 从hbs同步到的集群, 为空时使用配置文件
+	hbsLock  = new(sync.Mutex)
+	hbsJudge map[string]string
+	hbsGraph map[string]string
+)
+
+// 一个后端节点的发送任务和磁盘缓存重放任务, 节点从集群中删除或者地址变化时停止
+type sendTask struct {
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+func newSendTask() *sendTask {
+	return &sendTask{stop: make(chan struct{})}
+}
+
+func (this *sendTask) stopped() bool {
+	select {
+	case <-this.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// 返回false表示在等待期间任务被停止
+func (this *sendTask) sleep(d time.Duration) bool {
+	select {
+	case <-this.stop:
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+// 等待发送任务、重放任务以及正在进行中的发送都结束
+func (this *sendTask) Stop() {
+	close(this.stop)
+	this.wg.Wait()
+}
+
+func startJudgeTask(t *sendTask, node, addr string, Q *nlist.SafeListLimited, S *spill.Queue) {
+	cfg := g.Config()
+	concurrent := cfg.Judge.MaxConns
+	if concurrent < 1 {
+		concurrent = 1
+	}
+	t.wg.Add(1)
+	go forward2JudgeTask(t, Q, S, node, addr, concurrent)
+	if S != nil {
+		t.wg.Add(1)
+		go replaySpillTask(t, S, "judge "+node, cfg.Judge.Batch, sendJudgeSpill(addr))
+	}
+}
+
+func startGraphTask(t *sendTask, node, addr string, Q *nlist.SafeListLimited, S *spill.Queue) {
+	cfg := g.Config()
+	concurrent := cfg.Graph.MaxConns
+	if concurrent < 1 {
+		concurrent = 1
+	}
+	t.wg.Add(1)
+	go forward2GraphTask(t, Q, S, node, addr, concurrent)
+	if S != nil {
+		t.wg.Add(1)
+		go replaySpillTask(t, S, "graph "+node+":"+addr, cfg.Graph.Batch, sendGraphSpill(addr))
+	}
+}
+
+// 当前应该使用的集群: hbs下发的优先, 否则使用配置文件
+func desiredCluster() (map[string]string, map[string]*g.ClusterNode, string) {
+	cfg := g.Config()
+	judge, graph, from := cfg.Judge.Cluster, cfg.Graph.ClusterList, "config"
+
+	hbsLock.Lock()
+	defer hbsLock.Unlock()
+	if len(hbsJudge) > 0 {
+		judge, from = hbsJudge, "hbs"
+	}
+	if len(hbsGraph) > 0 {
+		graph, from = g.FormatClusterItems(hbsGraph), "hbs"
+	}
+	if judge == nil {
+		judge = map[string]string{}
+	}
+	if graph == nil {
+		graph = map[string]*g.ClusterNode{}
+	}
+	return judge, graph, from
+}
+
+// 在/config/reload之后调用
+func ReloadCluster() {
+	judge, graph, from := desiredCluster()
+	applyCluster(judge, graph, from)
+}
+
+type removedNode struct {
+	backend string
+	key     string
+	addr    string
+	task    *sendTask
+	queue   *nlist.SafeListLimited
+	spill   *spill.Queue
+	repush  bool // graph节点的多个地址中的数据相同, 只重新分配其中一个地址的数据
+}
+
+func applyCluster(judge map[string]string, graph map[string]*g.ClusterNode, from string) {
+	cfg := g.Config()
+
+	clusterLock.Lock()
+	startup := judgeCluster == nil
+	judgeChanged := !reflect.DeepEqual(judge, judgeCluster) || judgeReplicas != cfg.Judge.Replicas
+	graphChanged := !reflect.DeepEqual(graph, graphCluster) || graphReplicas != cfg.Graph.Replicas
+	if !judgeChanged && !graphChanged {
+		clusterLock.Unlock()
+		return
+	}
+
+	removed := []*removedNode{}
+	restarted := []func(){}
+
+	if judgeChanged {
+		if JudgeNodeRing != nil {
+			judgeMoves.start(JudgeNodeRing, cfg.Membership.TrackMoves)
+		}
+		JudgeNodeRing = rings.NewConsistentHashNodesRing(int32(cfg.Judge.Replicas), cutils.KeysOfMap(judge))
+
+		for node, addr := range judgeCluster {
+			newAddr, exists := judge[node]
+			if exists && newAddr == addr {
+				continue
+			}
+			old := judgeTasks[node]
+			if exists {
+				// 地址变化, 保留发送队列和磁盘缓存, 旧的发送任务结束之后再启动新的
+				t := newSendTask()
+				judgeTasks[node] = t
+				JudgeConnPools.Add(newAddr)
+				Q, S, node, newAddr := JudgeQueues[node], JudgeSpills[node], node, newAddr
+				restarted = append(restarted, func() {
+					old.Stop()
+					startJudgeTask(t, node, newAddr, Q, S)
+				})
+				removed = append(removed, &removedNode{backend: "judge", key: node, addr: addr})
+				continue
+			}
+			removed = append(removed, &removedNode{backend: "judge", key: node, addr: addr, task: old,
+				queue: JudgeQueues[node], spill: JudgeSpills[node], repush: true})
+			delete(judgeTasks, node)
+			delete(JudgeQueues, node)
+			delete(JudgeSpills, node)
+		}
+		for node, addr := range judge {
+			if _, exists := judgeCluster[node]; exists {
+				continue
+			}
+			JudgeConnPools.Add(addr)
+			JudgeQueues[node] = nlist.NewSafeListLimited(DefaultSendQueueMaxSize)
+			if S := openSpillQueue("judge", node, startup); S != nil {
+				JudgeSpills[node] = S
+			}
+			judgeTasks[node] = newSendTask()
+			startJudgeTask(judgeTasks[node], node, addr, JudgeQueues[node], JudgeSpills[node])
+		}
+		judgeCluster = judge
+		judgeReplicas = cfg.Judge.Replicas
+	}
+
+	if graphChanged {
+		if GraphNodeRing != nil {
+			graphMoves.start(GraphNodeRing, cfg.Membership.TrackMoves)
+		}
+		GraphNodeRing = rings.NewConsistentHashNodesRing(int32(cfg.Graph.Replicas), graphNodeNames(graph))
+
+		newKeys := map[string]bool{}
+		for node, nitem := range graph {
+			for _, addr := range nitem.Addrs {
+				newKeys[node+addr] = true
+			}
+		}
+		for node, nitem := range graphCluster {
+			_, nodeExists := graph[node]
+			repushed := false
+			for _, addr := range nitem.Addrs {
+				key := node + addr
+				if newKeys[key] {
+					continue
+				}
+				removed = append(removed, &removedNode{backend: "graph", key: key, addr: addr, task: graphTasks[key],
+					queue: GraphQueues[key], spill: GraphSpills[key], repush: !nodeExists && !repushed})
+				repushed = true
+				delete(graphTasks, key)
+				delete(GraphQueues, key)
+				delete(GraphSpills, key)
+			}
+		}
+		for node, nitem := range graph {
+			for _, addr := range nitem.Addrs {
+				key := node + addr
+				if _, exists := GraphQueues[key]; exists {
+					continue
+				}
+				GraphConnPools.Add(addr)
+				GraphQueues[key] = nlist.NewSafeListLimited(DefaultSendQueueMaxSize)
+				if S := openSpillQueue("graph", key, startup); S != nil {
+					GraphSpills[key] = S
+				}
+				graphTasks[key] = newSendTask()
+				startGraphTask(graphTasks[key], node, addr, GraphQueues[key], GraphSpills[key])
+			}
+		}
+		graphCluster = graph
+		graphReplicas = cfg.Graph.Replicas
+	}
+
+	clusterFrom = from
+	clusterTs = time.Now().Unix()
+	clusterLock.Unlock()
+
+	if !startup {
+		log.Printf("cluster updated from %s, judge: %v, graph: %v", from, cutils.KeysOfMap(judge), graphNodeNames(graph))
+	}
+
+	for _, f := range restarted {
+		go f()
+	}
+	if len(removed) > 0 {
+		go removeNodes(removed)
+	}
+}
+
+func graphNodeNames(graph map[string]*g.ClusterNode) []string {
+	names := make([]string, 0, len(graph))
+	for node := range graph {
+		names = append(names, node)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// 停止删除节点的发送任务, 把发送队列和磁盘缓存中剩余的数据按新的哈希环重新分配, 最后关闭不再使用的连接池
+func removeNodes(nodes []*removedNode) {
+	for _, n := range nodes {
+		if n.task != nil {
+			n.task.Stop()
+		}
+		if n.queue != nil {
+			for {
+				items := n.queue.PopBackBy(1000)
+				if len(items) == 0 {
+					break
+				}
+				if n.repush {
+					repushItems(n.backend, items)
+				}
+			}
+		}
+		if n.spill != nil {
+			drainSpill(n)
+		}
+	}
+
+	clusterLock.RLock()
+	judgeAddrs, graphAddrs := map[string]bool{}, map[string]bool{}
+	for _, addr := range judgeCluster {
+		judgeAddrs[addr] = true
+	}
+	for _, nitem := range graphCluster {
+		for _, addr := range nitem.Addrs {
+			graphAddrs[addr] = true
+		}
+	}
+	clusterLock.RUnlock()
+
+	for _, n := range nodes {
+		if n.backend == "judge" && !judgeAddrs[n.addr] {
+			JudgeConnPools.Remove(n.addr)
+		}
+		if n.backend == "graph" && !graphAddrs[n.addr] {
+			GraphConnPools.Remove(n.addr)
+		}
+	}
+}
+
+func drainSpill(n *removedNode) {
+	for n.repush {
+		records, err := n.spill.Read(1000)
+		if err != nil {
+			log.Printf("[ERROR] read spill of removed %s %s fail: %v", n.backend, n.key, err)
+			return
+		}
+		if len(records) == 0 {
+			break
+		}
+		for _, r := range records {
+			var items []interface{}
+			if n.backend == "judge" {
+				var judgeItems []*cmodel.JudgeItem
+				json.Unmarshal(r.Data, &judgeItems)
+				for _, item := range judgeItems {
+					items = append(items, item)
+				}
+			} else {
+				var graphItems []*cmodel.GraphItem
+				json.Unmarshal(r.Data, &graphItems)
+				for _, item := range graphItems {
+					items = append(items, item)
+				}
+			}
+			repushItems(n.backend, items)
+		}
+		if err := n.spill.Ack(records[len(records)-1]); err != nil {
+			log.Printf("[ERROR] ack spill of removed %s %s fail: %v", n.backend, n.key, err)
+			return
+		}
+	}
+	n.spill.Close()
+	if err := os.RemoveAll(spillDir(n.backend, n.key)); err != nil {
+		log.Printf("[ERROR] remove spill of %s %s fail: %v", n.backend, n.key, err)
+	}
+}
+
+func repushItems(backend string, items []interface{}) {
+	clusterLock.RLock()
+	defer clusterLock.RUnlock()
+
+	for _, item := range items {
+		switch it := item.(type) {
+		case *cmodel.JudgeItem:
+			node, err := JudgeNodeRing.GetNode(cutils.PK(it.Endpoint, it.Metric, it.Tags))
+			if err != nil || !pushJudgeItem(node, it) {
+				proc.SendToJudgeDropCnt.Incr()
+			}
+		case *cmodel.GraphItem:
+			node, err := GraphNodeRing.GetNode(cutils.PK(it.Endpoint, it.Metric, it.Tags))
+			if err != nil {
+				proc.SendToGraphDropCnt.Incr()
+				continue
+			}
+			for _, addr := range graphCluster[node].Addrs {
+				if !pushGraphItem(node+addr, it) {
+					proc.SendToGraphDropCnt.Incr()
+				}
+			}
+		}
+	}
+}
+
+// 定期从hbs同步集群, hbs没有配置集群时使用配置文件
+func startMembershipSync() {
+	for {
+		cfg := g.Config().Membership
+		if len(cfg.Hbs) > 0 {
+			if err := syncMembership(cfg); err != nil {
+				log.Printf("[ERROR] sync cluster from hbs fail: %v", err)
+			}
+		}
+		time.Sleep(time.Duration(cfg.Interval) * time.Second)
+	}
+}
+
+func syncMembership(cfg *g.MembershipConfig) error {
+	var err error
+	for _, addr := range cfg.Hbs {
+		var client *rpc.Client
+		client, err = tnet.JsonRpcClient("tcp", addr, time.Duration(cfg.Timeout)*time.Millisecond)
+		if err != nil {
+			continue
+		}
+		resp := cmodel.ClusterResponse{}
+		done := make(chan error, 1)
+		go func() {
+			done <- client.Call("Hbs.GetCluster", cmodel.NullRpcRequest{}, &resp)
+		}()
+		select {
+		case err = <-done:
+		case <-time.After(time.Duration(cfg.Timeout) * time.Millisecond):
+			err = fmt.Errorf("call Hbs.GetCluster of %s timeout", addr)
+		}
+		client.Close()
+		if err != nil {
+			continue
+		}
+
+		hbsLock.Lock()
+		hbsJudge, hbsGraph = resp.Judge, resp.Graph
+		hbsLock.Unlock()
+		ReloadCluster()
+		return nil
+	}
+	return err
+}
+
+type ClusterStat struct {
+	From    string                    `json:"from"`
+	Updated int64                     `json:"updated"`
+	Judge   map[string]string         `json:"judge"`
+	Graph   map[string]*g.ClusterNode `json:"graph"`
+}
+
+// 当前使用的集群
+func Cluster() *ClusterStat {
+	clusterLock.RLock()
+	defer clusterLock.RUnlock()
+	return &ClusterStat{From: clusterFrom, Updated: clusterTs, Judge: judgeCluster, Graph: graphCluster}
+}
@@ -0,0 +1,90 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sender
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	backend "github.com/open-falcon/falcon-plus/common/backend_pool"
+	cmodel "github.com/open-falcon/falcon-plus/common/model"
+	"github.com/open-falcon/falcon-plus/modules/transfer/g"
+)
+
+func TestApplyCluster(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transfer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cfg := filepath.Join(dir, "cfg.json")
+	ioutil.WriteFile(cfg, []byte(`{"minStep": 30,
+		"judge": {"batch": 200, "maxConns": 1, "maxIdle": 1, "replicas": 500, "cluster": {}},
+		"graph": {"batch": 200, "maxConns": 1, "maxIdle": 1, "replicas": 500, "cluster": {}},
+		"tsdb": {}}`), 0644)
+	g.ParseConfig(cfg)
+	MinStep = 30
+	JudgeConnPools = backend.CreateSafeRpcConnPools(1, 1, 100, 100, nil)
+	GraphConnPools = backend.CreateSafeRpcConnPools(1, 1, 100, 100, nil)
+
+	applyCluster(map[string]string{"judge-00": "127.0.0.1:1"},
+		g.FormatClusterItems(map[string]string{"graph-00": "127.0.0.1:2,127.0.0.1:3"}), "config")
+	if len(JudgeQueues) != 1 || len(GraphQueues) != 2 || len(graphTasks) != 2 {
+		t.Fatalf("unexpected queues %v %v", JudgeQueues, GraphQueues)
+	}
+
+	items := []*cmodel.MetaData{}
+	for _, endpoint := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+		items = append(items, &cmodel.MetaData{Endpoint: endpoint, Metric: "cpu.idle", Step: 60, CounterType: g.GAUGE, Timestamp: 1500000000})
+	}
+	Push2GraphSendQueue(items)
+
+	applyCluster(map[string]string{"judge-00": "127.0.0.1:1"},
+		g.FormatClusterItems(map[string]string{"graph-00": "127.0.0.1:2", "graph-01": "127.0.0.1:4"}), "hbs")
+	if len(GraphQueues) != 2 || GraphQueues["graph-01127.0.0.1:4"] == nil || GraphQueues["graph-00127.0.0.1:3"] != nil {
+		t.Fatalf("unexpected graph queues %v", GraphQueues)
+	}
+	if Cluster().From != "hbs" {
+		t.Errorf("unexpected cluster %+v", Cluster())
+	}
+
+	// 变化之后收到的counter按新旧哈希环分别计算节点
+	Push2GraphSendQueue(items)
+	moves := MovedCounters("graph", 0)
+	if moves.Total == 0 || moves.Total != moves.Pairs["graph-00->graph-01"] || len(moves.Counters) != moves.Total {
+		t.Errorf("unexpected moves %+v", moves)
+	}
+	for _, c := range moves.Counters {
+		if c.From != "graph-00" || c.To != "graph-01" {
+			t.Errorf("unexpected move %+v", c)
+		}
+	}
+
+	applyCluster(map[string]string{}, map[string]*g.ClusterNode{}, "config")
+	if len(JudgeQueues) != 0 || len(GraphQueues) != 0 || len(judgeTasks) != 0 {
+		t.Errorf("queues of removed nodes not deleted")
+	}
+	// 发送任务停止之后才关闭连接池
+	for i := 0; i < 50; i++ {
+		if _, exists := GraphConnPools.Get("127.0.0.1:4"); !exists {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Errorf("conn pool of removed node not destroyed")
+}
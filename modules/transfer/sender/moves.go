@@ -0,0 +1,134 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sender
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	rings "github.com/toolkits/consistent/rings"
+)
+
+const (
+	// 最多记录的迁移counter数, 超过之后无法去重, 不再统计, 结果标记为truncated
+	DefaultMaxMovedCounters = 100000
+)
+
+// 集群变化之后的一段时间内, 对收到的每个counter同时计算变化前的节点, 记录从哪个节点迁移到了哪个节点,
+// 用于迁移graph的历史数据. 一个step内所有活跃的counter都会上报, 所以记录的时间要大于最大的step
+type moveTracker struct {
+	sync.Mutex
+	ring      *rings.ConsistentHashNodeRing // 变化之前的哈希环
+	since     int64
+	until     int64
+	pairs     map[string]int // from->to -> counter数
+	counters  map[string]*MovedCounter
+	total     int
+	max       int
+	truncated bool
+}
+
+type MovedCounter struct {
+	Counter string `json:"counter"`
+	From    string `json:"from"`
+	To      string `json:"to"`
+}
+
+type movedCounterSlice []*MovedCounter
+
+func (this movedCounterSlice) Len() int           { return len(this) }
+func (this movedCounterSlice) Swap(i, j int)      { this[i], this[j] = this[j], this[i] }
+func (this movedCounterSlice) Less(i, j int) bool { return this[i].Counter < this[j].Counter }
+
+var (
+	judgeMoves = &moveTracker{}
+	graphMoves = &moveTracker{}
+)
+
+func (this *moveTracker) start(ring *rings.ConsistentHashNodeRing, seconds int64) {
+	this.Lock()
+	defer this.Unlock()
+	now := time.Now().Unix()
+	this.ring = ring
+	this.since = now
+	this.pairs = map[string]int{}
+	this.counters = map[string]*MovedCounter{}
+	this.total = 0
+	this.max = DefaultMaxMovedCounters
+	this.truncated = false
+	atomic.StoreInt64(&this.until, now+seconds)
+}
+
+func (this *moveTracker) record(pk string, node string) {
+	if atomic.LoadInt64(&this.until) < time.Now().Unix() {
+		return
+	}
+
+	this.Lock()
+	defer this.Unlock()
+	if _, exists := this.counters[pk]; exists {
+		return
+	}
+	from, err := this.ring.GetNode(pk)
+	if err != nil || from == node {
+		return
+	}
+	if len(this.counters) >= this.max {
+		this.truncated = true
+		return
+	}
+	this.total++
+	this.pairs[from+"->"+node]++
+	this.counters[pk] = &MovedCounter{Counter: pk, From: from, To: node}
+}
+
+type MovesStat struct {
+	Since     int64           `json:"since"`
+	Until     int64           `json:"until"`
+	Total     int             `json:"total"`
+	Pairs     map[string]int  `json:"pairs"`
+	Counters  []*MovedCounter `json:"counters"`
+	Truncated bool            `json:"truncated"`
+}
+
+// 最近一次集群变化之后迁移的counter, 最多返回n个
+func (this *moveTracker) stat(n int) *MovesStat {
+	this.Lock()
+	defer this.Unlock()
+	ret := &MovesStat{Since: this.since, Until: atomic.LoadInt64(&this.until), Total: this.total,
+		Pairs: map[string]int{}, Counters: []*MovedCounter{}}
+	for k, v := range this.pairs {
+		ret.Pairs[k] = v
+	}
+	for _, c := range this.counters {
+		ret.Counters = append(ret.Counters, c)
+	}
+	sort.Sort(movedCounterSlice(ret.Counters))
+	if n > 0 && len(ret.Counters) > n {
+		ret.Counters = ret.Counters[:n]
+	}
+	ret.Truncated = this.truncated || len(ret.Counters) < ret.Total
+	return ret
+}
+
+// backend是judge或graph
+func MovedCounters(backend string, n int) *MovesStat {
+	if backend == "judge" {
+		return judgeMoves.stat(n)
+	}
+	return graphMoves.stat(n)
+}
@@ -0,0 +1,48 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sender
+
+import (
+	"fmt"
+	"testing"
+
+	rings "github.com/toolkits/consistent/rings"
+)
+
+func TestMoveTrackerLimit(t *testing.T) {
+	tracker := &moveTracker{}
+	tracker.start(rings.NewConsistentHashNodesRing(500, []string{"old"}), 600)
+	tracker.max = 3
+
+	// 达到上限之前重复的counter只统计一次
+	for i := 0; i < 2; i++ {
+		for j := 0; j < 3; j++ {
+			tracker.record(fmt.Sprintf("pk%d", j), "new")
+		}
+	}
+	moves := tracker.stat(0)
+	if moves.Total != 3 || moves.Pairs["old->new"] != 3 || len(moves.Counters) != 3 || moves.Truncated {
+		t.Errorf("unexpected moves %+v", moves)
+	}
+
+	// 超过上限之后不再统计
+	for i := 0; i < 2; i++ {
+		tracker.record("pk3", "new")
+	}
+	moves = tracker.stat(0)
+	if moves.Total != 3 || moves.Pairs["old->new"] != 3 || !moves.Truncated {
+		t.Errorf("unexpected moves after limit %+v", moves)
+	}
+}
@@ -20,19 +20,8 @@ import (
 )
 
 func initSendQueues() {
+	// judge/graph的发送队列在applyCluster中创建
 	cfg := g.Config()
-	for node := range cfg.Judge.Cluster {
-		Q := nlist.NewSafeListLimited(DefaultSendQueueMaxSize)
-		JudgeQueues[node] = Q
-	}
-
-	for node, nitem := range cfg.Graph.ClusterList {
-		for _, addr := range nitem.Addrs {
-			Q := nlist.NewSafeListLimited(DefaultSendQueueMaxSize)
-			GraphQueues[node+addr] = Q
-		}
-	}
-
 	if cfg.Tsdb.Enabled {
 		TsdbQueue = nlist.NewSafeListLimited(DefaultSendQueueMaxSize)
 	}
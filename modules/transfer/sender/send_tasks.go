@@ -19,6 +19,7 @@ import (
 	cmodel "github.com/open-falcon/falcon-plus/common/model"
 	"github.com/open-falcon/falcon-plus/modules/transfer/g"
 	"github.com/open-falcon/falcon-plus/modules/transfer/proc"
+	"github.com/open-falcon/falcon-plus/modules/transfer/spill"
 	nsema "github.com/toolkits/concurrent/semaphore"
 	"github.com/toolkits/container/list"
 	"log"
@@ -31,54 +32,30 @@ const (
 )
 
 // TODO 添加对发送任务的控制,比如stop等
+// judge/graph的发送任务在applyCluster中启动
 func startSendTasks() {
 	cfg := g.Config()
 	// init semaphore
-	judgeConcurrent := cfg.Judge.MaxConns
-	graphConcurrent := cfg.Graph.MaxConns
 	tsdbConcurrent := cfg.Tsdb.MaxConns
-
 	if tsdbConcurrent < 1 {
 		tsdbConcurrent = 1
 	}
 
-	if judgeConcurrent < 1 {
-		judgeConcurrent = 1
-	}
-
-	if graphConcurrent < 1 {
-		graphConcurrent = 1
-	}
-
-	// init send go-routines
-	for node := range cfg.Judge.Cluster {
-		queue := JudgeQueues[node]
-		go forward2JudgeTask(queue, node, judgeConcurrent)
-	}
-
-	for node, nitem := range cfg.Graph.ClusterList {
-		for _, addr := range nitem.Addrs {
-			queue := GraphQueues[node+addr]
-			go forward2GraphTask(queue, node, addr, graphConcurrent)
-		}
-	}
-
 	if cfg.Tsdb.Enabled {
 		go forward2TsdbTask(tsdbConcurrent)
 	}
 }
 
-// Judge定时任务, 将 Judge发送缓存中的数据 通过rpc连接池 发送到Judge
-func forward2JudgeTask(Q *list.SafeListLimited, node string, concurrent int) {
+func forward2JudgeTask(t *sendTask, Q *list.SafeListLimited, S *spill.Queue, node string, addr string, concurrent int) {
+	defer t.wg.Done()
 	batch := g.Config().Judge.Batch // 一次发送,最多batch条数据
-	addr := g.Config().Judge.Cluster[node]
 	sema := nsema.NewSemaphore(concurrent)
 
-	for {
+	for !t.stopped() {
 		items := Q.PopBackBy(batch)
 		count := len(items)
 		if count == 0 {
-			time.Sleep(DefaultSendTaskSleepInterval)
+			t.sleep(DefaultSendTaskSleepInterval)
 			continue
 		}
 
@@ -89,7 +66,9 @@ func forward2JudgeTask(Q *list.SafeListLimited, node string, concurrent int) {
 
 		//	同步Call + 有限并发 进行发送
 		sema.Acquire()
+		t.wg.Add(1)
 		go func(addr string, judgeItems []*cmodel.JudgeItem, count int) {
+			defer t.wg.Done()
 			defer sema.Release()
 
 			resp := &cmodel.SimpleRpcResponse{}
@@ -107,7 +86,9 @@ func forward2JudgeTask(Q *list.SafeListLimited, node string, concurrent int) {
 			// statistics
 			if !sendOk {
 				log.Printf("send judge %s:%s fail: %v", node, addr, err)
-				proc.SendToJudgeFailCnt.IncrBy(int64(count))
+				if !spillJudgeItems(S, judgeItems) {
+					proc.SendToJudgeFailCnt.IncrBy(int64(count))
+				}
 			} else {
 				proc.SendToJudgeCnt.IncrBy(int64(count))
 			}
@@ -116,15 +97,16 @@ func forward2JudgeTask(Q *list.SafeListLimited, node string, concurrent int) {
 }
 
 // Graph定时任务, 将 Graph发送缓存中的数据 通过rpc连接池 发送到Graph
-func forward2GraphTask(Q *list.SafeListLimited, node string, addr string, concurrent int) {
+func forward2GraphTask(t *sendTask, Q *list.SafeListLimited, S *spill.Queue, node string, addr string, concurrent int) {
+	defer t.wg.Done()
 	batch := g.Config().Graph.Batch // 一次发送,最多batch条数据
 	sema := nsema.NewSemaphore(concurrent)
 
-	for {
+	for !t.stopped() {
 		items := Q.PopBackBy(batch)
 		count := len(items)
 		if count == 0 {
-			time.Sleep(DefaultSendTaskSleepInterval)
+			t.sleep(DefaultSendTaskSleepInterval)
 			continue
 		}
 
@@ -134,7 +116,9 @@ func forward2GraphTask(Q *list.SafeListLimited, node string, addr string, concur
 		}
 
 		sema.Acquire()
+		t.wg.Add(1)
 		go func(addr string, graphItems []*cmodel.GraphItem, count int) {
+			defer t.wg.Done()
 			defer sema.Release()
 
 			resp := &cmodel.SimpleRpcResponse{}
@@ -152,7 +136,9 @@ func forward2GraphTask(Q *list.SafeListLimited, node string, addr string, concur
 			// statistics
 			if !sendOk {
 				log.Printf("send to graph %s:%s fail: %v", node, addr, err)
-				proc.SendToGraphFailCnt.IncrBy(int64(count))
+				if !spillGraphItems(S, graphItems) {
+					proc.SendToGraphFailCnt.IncrBy(int64(count))
+				}
 			} else {
 				proc.SendToGraphCnt.IncrBy(int64(count))
 			}
@@ -34,7 +34,7 @@ var (
 	MinStep int //最小上报周期,单位sec
 )
 
-// 服务节点的一致性哈希环
+// 服务节点的一致性哈希环, 集群变化时重建
 // pk -> node
 var (
 	JudgeNodeRing *rings.ConsistentHashNodeRing
@@ -67,15 +67,20 @@ func Start() {
 	//
 	initConnPools()
 	initSendQueues()
-	initNodeRings()
+	// 创建judge/graph的哈希环、发送队列、磁盘缓存, 并启动发送任务
+	ReloadCluster()
 	// SendTasks依赖基础组件的初始化,要最后启动
 	startSendTasks()
 	startSenderCron()
+	go startMembershipSync()
 	log.Println("send.Start, ok")
 }
 
 // 将数据 打入 某个Judge的发送缓存队列, 具体是哪一个Judge 由一致性哈希 决定
 func Push2JudgeSendQueue(items []*cmodel.MetaData) {
+	clusterLock.RLock()
+	defer clusterLock.RUnlock()
+
 	for _, item := range items {
 		pk := item.PK()
 		node, err := JudgeNodeRing.GetNode(pk)
@@ -83,6 +88,7 @@ func Push2JudgeSendQueue(items []*cmodel.MetaData) {
 			log.Println("E:", err)
 			continue
 		}
+		judgeMoves.record(pk, node)
 
 		// align ts
 		step := int(item.Step)
@@ -99,8 +105,7 @@ func Push2JudgeSendQueue(items []*cmodel.MetaData) {
 			JudgeType: item.CounterType,
 			Tags:      item.Tags,
 		}
-		Q := JudgeQueues[node]
-		isSuccess := Q.PushFront(judgeItem)
+		isSuccess := pushJudgeItem(node, judgeItem)
 
 		// statistics
 		if !isSuccess {
@@ -111,7 +116,8 @@ func Push2JudgeSendQueue(items []*cmodel.MetaData) {
 
 // 将数据 打入 某个Graph的发送缓存队列, 具体是哪一个Graph 由一致性哈希 决定
 func Push2GraphSendQueue(items []*cmodel.MetaData) {
-	cfg := g.Config().Graph
+	clusterLock.RLock()
+	defer clusterLock.RUnlock()
 
 	for _, item := range items {
 		graphItem, err := convert2GraphItem(item)
@@ -130,12 +136,12 @@ func Push2GraphSendQueue(items []*cmodel.MetaData) {
 			log.Println("E:", err)
 			continue
 		}
+		graphMoves.record(pk, node)
 
-		cnode := cfg.ClusterList[node]
+		cnode := graphCluster[node]
 		errCnt := 0
 		for _, addr := range cnode.Addrs {
-			Q := GraphQueues[node+addr]
-			if !Q.PushFront(graphItem) {
+			if !pushGraphItem(node+addr, graphItem) {
 				errCnt += 1
 			}
 		}
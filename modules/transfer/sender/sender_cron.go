@@ -48,8 +48,12 @@ func startLogCron() {
 }
 
 func refreshSendingCacheSize() {
+	clusterLock.RLock()
+	defer clusterLock.RUnlock()
 	proc.JudgeQueuesCnt.SetCnt(calcSendCacheSize(JudgeQueues))
 	proc.GraphQueuesCnt.SetCnt(calcSendCacheSize(GraphQueues))
+	proc.JudgeSpillBacklogCnt.SetCnt(calcSpillBacklog(JudgeSpills))
+	proc.GraphSpillBacklogCnt.SetCnt(calcSpillBacklog(GraphSpills))
 }
 func calcSendCacheSize(mapList map[string]*list.SafeListLimited) int64 {
 	var cnt int64 = 0
@@ -0,0 +1,237 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sender
+
+import (
+	"encoding/json"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+
+	cmodel "github.com/open-falcon/falcon-plus/common/model"
+	"github.com/open-falcon/falcon-plus/modules/transfer/g"
+	"github.com/open-falcon/falcon-plus/modules/transfer/proc"
+	"github.com/open-falcon/falcon-plus/modules/transfer/spill"
+)
+
+const (
+	DefaultSpillRetryInterval    = time.Second
+	DefaultSpillMaxRetryInterval = time.Second * 30
+)
+
+// 后端节点的磁盘缓存, 发送缓存队列满了或者发送失败的数据写入磁盘, 节点恢复之后按顺序重放
+// node -> spill_queue, graph的key和GraphQueues一样是node+addr
+var (
+	JudgeSpills = make(map[string]*spill.Queue)
+	GraphSpills = make(map[string]*spill.Queue)
+)
+
+// 没有开启磁盘缓存时返回nil. 启动时打开失败直接退出, 运行中新增节点时打开失败则不使用磁盘缓存
+func openSpillQueue(backend string, key string, startup bool) *spill.Queue {
+	cfg := g.Config().Spill
+	if cfg == nil || !cfg.Enabled {
+		return nil
+	}
+	dir := spillDir(backend, key)
+	Q, err := spill.Open(dir, cfg.MaxSize*1024*1024, cfg.SegmentSize*1024*1024)
+	if err != nil {
+		if startup {
+			log.Fatalln("open spill queue", dir, "fail:", err)
+		}
+		log.Printf("[ERROR] open spill queue %s fail: %v", dir, err)
+		return nil
+	}
+	return Q
+}
+
+func spillDir(backend string, key string) string {
+	name := strings.NewReplacer("/", "_", ":", "_").Replace(key)
+	return filepath.Join(g.Config().Spill.Dir, backend, name)
+}
+
+// 磁盘缓存中有积压时, 新数据也写入磁盘缓存, 保证重放的顺序
+func pushJudgeItem(node string, item *cmodel.JudgeItem) bool {
+	S := JudgeSpills[node]
+	if S == nil || S.Len() == 0 {
+		if JudgeQueues[node].PushFront(item) {
+			return true
+		}
+	}
+	return spillJudgeItems(S, []*cmodel.JudgeItem{item})
+}
+
+func pushGraphItem(key string, item *cmodel.GraphItem) bool {
+	S := GraphSpills[key]
+	if S == nil || S.Len() == 0 {
+		if GraphQueues[key].PushFront(item) {
+			return true
+		}
+	}
+	return spillGraphItems(S, []*cmodel.GraphItem{item})
+}
+
+func spillJudgeItems(S *spill.Queue, items []*cmodel.JudgeItem) bool {
+	if S == nil {
+		return false
+	}
+	if err := putSpill(S, items); err != nil {
+		proc.JudgeSpillDropCnt.IncrBy(int64(len(items)))
+		return false
+	}
+	proc.SendToJudgeSpillCnt.IncrBy(int64(len(items)))
+	return true
+}
+
+func spillGraphItems(S *spill.Queue, items []*cmodel.GraphItem) bool {
+	if S == nil {
+		return false
+	}
+	if err := putSpill(S, items); err != nil {
+		proc.GraphSpillDropCnt.IncrBy(int64(len(items)))
+		return false
+	}
+	proc.SendToGraphSpillCnt.IncrBy(int64(len(items)))
+	return true
+}
+
+func putSpill(S *spill.Queue, items interface{}) error {
+	bs, err := json.Marshal(items)
+	if err != nil {
+		return err
+	}
+	return S.Put(bs)
+}
+
+// 按batch条数据读取并发送, 返回实际发送的记录数
+type spillSender func(records []*spill.Record) (int, error)
+
+func sendJudgeSpill(addr string) spillSender {
+	return func(records []*spill.Record) (int, error) {
+		batch := g.Config().Judge.Batch
+		judgeItems := []*cmodel.JudgeItem{}
+		n := 0
+		for _, r := range records {
+			var items []*cmodel.JudgeItem
+			if err := json.Unmarshal(r.Data, &items); err != nil {
+				log.Printf("[ERROR] decode judge spill record fail: %v", err)
+			}
+			judgeItems = append(judgeItems, items...)
+			n += 1
+			if len(judgeItems) >= batch {
+				break
+			}
+		}
+		if len(judgeItems) == 0 {
+			return n, nil
+		}
+		resp := &cmodel.SimpleRpcResponse{}
+		if err := JudgeConnPools.Call(addr, "Judge.Send", judgeItems, resp); err != nil {
+			return 0, err
+		}
+		proc.SendToJudgeCnt.IncrBy(int64(len(judgeItems)))
+		proc.JudgeSpillReplayCnt.IncrBy(int64(len(judgeItems)))
+		return n, nil
+	}
+}
+
+func sendGraphSpill(addr string) spillSender {
+	return func(records []*spill.Record) (int, error) {
+		batch := g.Config().Graph.Batch
+		graphItems := []*cmodel.GraphItem{}
+		n := 0
+		for _, r := range records {
+			var items []*cmodel.GraphItem
+			if err := json.Unmarshal(r.Data, &items); err != nil {
+				log.Printf("[ERROR] decode graph spill record fail: %v", err)
+			}
+			graphItems = append(graphItems, items...)
+			n += 1
+			if len(graphItems) >= batch {
+				break
+			}
+		}
+		if len(graphItems) == 0 {
+			return n, nil
+		}
+		resp := &cmodel.SimpleRpcResponse{}
+		if err := GraphConnPools.Call(addr, "Graph.Send", graphItems, resp); err != nil {
+			return 0, err
+		}
+		proc.SendToGraphCnt.IncrBy(int64(len(graphItems)))
+		proc.GraphSpillReplayCnt.IncrBy(int64(len(graphItems)))
+		return n, nil
+	}
+}
+
+// 重放磁盘缓存, 发送失败时说明节点还没有恢复, 退避之后重试同一批数据
+func replaySpillTask(t *sendTask, S *spill.Queue, name string, batch int, send spillSender) {
+	defer t.wg.Done()
+	interval := DefaultSpillRetryInterval
+	for !t.stopped() {
+		records, err := S.Read(batch)
+		if err != nil {
+			log.Printf("[ERROR] read spill of %s fail: %v", name, err)
+			t.sleep(DefaultSpillRetryInterval)
+			continue
+		}
+		if len(records) == 0 {
+			t.sleep(DefaultSendTaskSleepInterval)
+			continue
+		}
+
+		n, err := send(records)
+		if err != nil {
+			log.Printf("replay spill to %s fail: %v, retry after %v", name, err, interval)
+			t.sleep(interval)
+			interval *= 2
+			if interval > DefaultSpillMaxRetryInterval {
+				interval = DefaultSpillMaxRetryInterval
+			}
+			continue
+		}
+		interval = DefaultSpillRetryInterval
+		if err := S.Ack(records[n-1]); err != nil {
+			log.Printf("[ERROR] ack spill of %s fail: %v", name, err)
+		}
+	}
+}
+
+type SpillStat struct {
+	Judge map[string]spill.Stat `json:"judge"`
+	Graph map[string]spill.Stat `json:"graph"`
+}
+
+// 每个后端节点的磁盘缓存积压情况
+func SpillStats() *SpillStat {
+	ret := &SpillStat{Judge: map[string]spill.Stat{}, Graph: map[string]spill.Stat{}}
+	clusterLock.RLock()
+	defer clusterLock.RUnlock()
+	for node, S := range JudgeSpills {
+		ret.Judge[node] = S.Stat()
+	}
+	for key, S := range GraphSpills {
+		ret.Graph[key] = S.Stat()
+	}
+	return ret
+}
+
+func calcSpillBacklog(spills map[string]*spill.Queue) int64 {
+	var cnt int64 = 0
+	for _, S := range spills {
+		cnt += S.Len()
+	}
+	return cnt
+}
@@ -0,0 +1,453 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spill
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 基于本地磁盘的先进先出队列, 后端不可用时暂存待发送的数据
+// 数据按顺序追加到dir下的segment文件中, 每条记录的格式为: length(4) + crc32(4) + data
+// 已确认的读取位置保存在dir/cursor文件中, 读完的segment会被删除
+
+var (
+	ErrFull   = errors.New("spill queue is full")
+	ErrClosed = errors.New("spill queue is closed")
+)
+
+const (
+	headerSize    = 8
+	cursorFile    = "cursor"
+	segmentSuffix = ".seg"
+	flushInterval = time.Second
+)
+
+type Position struct {
+	Seq    int64 `json:"seq"`
+	Offset int64 `json:"offset"`
+}
+
+// Read返回的记录, Ack之后这条记录以及它之前的记录都不会再被读到
+type Record struct {
+	Data  []byte
+	next  Position
+	bytes int64 // 从读取位置到这条记录末尾的字节数
+	count int64 // 从读取位置到这条记录的记录数
+}
+
+type Queue struct {
+	sync.Mutex
+	dir          string
+	maxBytes     int64
+	segmentBytes int64
+
+	w    *os.File
+	wbuf *bufio.Writer
+	wpos Position // 写入位置
+	rpos Position // 已确认的读取位置
+
+	bytes   int64 // 未确认的字节数
+	records int64 // 未确认的记录数
+
+	closed bool
+	stop   chan struct{}
+}
+
+func Open(dir string, maxBytes, segmentBytes int64) (*Queue, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	q := &Queue{
+		dir:          dir,
+		maxBytes:     maxBytes,
+		segmentBytes: segmentBytes,
+		stop:         make(chan struct{}),
+	}
+
+	seqs, err := q.segments()
+	if err != nil {
+		return nil, err
+	}
+	q.rpos, err = q.readCursor()
+	if err != nil {
+		log.Printf("[WARN] spill %s: %v, read from the oldest segment", dir, err)
+		q.rpos = Position{}
+	}
+	if len(seqs) == 0 {
+		q.rpos = Position{Seq: q.rpos.Seq}
+	} else if q.rpos.Seq < seqs[0] || q.rpos.Seq > seqs[len(seqs)-1] {
+		q.rpos = Position{Seq: seqs[0]}
+	}
+
+	// 删除已经读完的segment, 统计剩余的数据, 截断最后一个segment中不完整的记录
+	for _, seq := range seqs {
+		if seq < q.rpos.Seq {
+			os.Remove(q.segmentPath(seq))
+			continue
+		}
+		from := int64(0)
+		if seq == q.rpos.Seq {
+			from = q.rpos.Offset
+		}
+		count, end, err := scanSegment(q.segmentPath(seq), from)
+		if err != nil {
+			return nil, err
+		}
+		q.records += count
+		q.bytes += end - from
+		q.wpos = Position{Seq: seq, Offset: end}
+	}
+	if len(seqs) == 0 {
+		q.wpos = q.rpos
+	}
+
+	q.w, err = os.OpenFile(q.segmentPath(q.wpos.Seq), os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err = q.w.Truncate(q.wpos.Offset); err != nil {
+		q.w.Close()
+		return nil, err
+	}
+	if _, err = q.w.Seek(q.wpos.Offset, io.SeekStart); err != nil {
+		q.w.Close()
+		return nil, err
+	}
+	q.wbuf = bufio.NewWriter(q.w)
+
+	go q.flushLoop()
+	return q, nil
+}
+
+func (q *Queue) Put(data []byte) error {
+	q.Lock()
+	defer q.Unlock()
+	if q.closed {
+		return ErrClosed
+	}
+
+	size := int64(headerSize + len(data))
+	if q.bytes+size > q.maxBytes {
+		return ErrFull
+	}
+	if q.wpos.Offset > 0 && q.wpos.Offset+size > q.segmentBytes {
+		if err := q.rotate(); err != nil {
+			return err
+		}
+	}
+
+	var header [headerSize]byte
+	binary.BigEndian.PutUint32(header[0:4], uint32(len(data)))
+	binary.BigEndian.PutUint32(header[4:8], crc32.ChecksumIEEE(data))
+	if _, err := q.wbuf.Write(header[:]); err != nil {
+		return err
+	}
+	if _, err := q.wbuf.Write(data); err != nil {
+		return err
+	}
+	q.wpos.Offset += size
+	q.bytes += size
+	q.records += 1
+	return nil
+}
+
+// 从已确认的位置开始读取最多max条记录, 同一个队列只能有一个读取者
+func (q *Queue) Read(max int) ([]*Record, error) {
+	q.Lock()
+	defer q.Unlock()
+	if q.closed {
+		return nil, ErrClosed
+	}
+	if err := q.wbuf.Flush(); err != nil {
+		return nil, err
+	}
+
+	records := []*Record{}
+	pos := q.rpos
+	var bytes, count int64
+	for len(records) < max && pos != q.wpos {
+		end := q.wpos.Offset
+		if pos.Seq < q.wpos.Seq {
+			fi, err := os.Stat(q.segmentPath(pos.Seq))
+			if err != nil && !os.IsNotExist(err) {
+				return records, err
+			}
+			end = 0
+			if err == nil {
+				end = fi.Size()
+			}
+		}
+
+		if pos.Offset < end {
+			rs, next, err := readSegment(q.segmentPath(pos.Seq), pos.Offset, end, max-len(records))
+			for _, r := range rs {
+				count += 1
+				bytes += r.next.Offset - pos.Offset
+				pos.Offset = r.next.Offset
+				r.next = pos
+				r.bytes = bytes
+				r.count = count
+				records = append(records, r)
+			}
+			if err == nil {
+				continue
+			}
+			// 损坏的记录, 跳过这个segment剩余的部分
+			log.Printf("[ERROR] spill %s: segment %d offset %d: %v", q.dir, pos.Seq, next, err)
+			bytes += end - pos.Offset
+			pos.Offset = end
+			if pos.Seq == q.wpos.Seq {
+				break
+			}
+		}
+		if pos.Seq < q.wpos.Seq {
+			pos = Position{Seq: pos.Seq + 1}
+		}
+	}
+
+	// 只有损坏的数据时也要能越过它
+	if len(records) == 0 && pos != q.rpos {
+		q.ack(pos, bytes, 0)
+	}
+	return records, nil
+}
+
+func (q *Queue) Ack(r *Record) error {
+	q.Lock()
+	defer q.Unlock()
+	if q.closed {
+		return ErrClosed
+	}
+	return q.ack(r.next, r.bytes, r.count)
+}
+
+func (q *Queue) ack(pos Position, bytes, count int64) error {
+	for seq := q.rpos.Seq; seq < pos.Seq; seq++ {
+		os.Remove(q.segmentPath(seq))
+	}
+	q.rpos = pos
+	q.bytes -= bytes
+	q.records -= count
+	if q.bytes < 0 || q.records <= 0 {
+		q.bytes, q.records = 0, 0
+	}
+
+	// 数据都已经发送, 换一个新的segment以便回收磁盘空间
+	if q.rpos == q.wpos && q.wpos.Offset > 0 {
+		if err := q.rotate(); err != nil {
+			return err
+		}
+		os.Remove(q.segmentPath(q.rpos.Seq))
+		q.rpos = q.wpos
+	}
+	return q.writeCursor()
+}
+
+func (q *Queue) rotate() error {
+	if err := q.wbuf.Flush(); err != nil {
+		return err
+	}
+	q.w.Close()
+	f, err := os.OpenFile(q.segmentPath(q.wpos.Seq+1), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	q.w = f
+	q.wbuf.Reset(f)
+	q.wpos = Position{Seq: q.wpos.Seq + 1}
+	return nil
+}
+
+// 未确认的记录数
+func (q *Queue) Len() int64 {
+	q.Lock()
+	defer q.Unlock()
+	return q.records
+}
+
+type Stat struct {
+	Records int64    `json:"records"`
+	Bytes   int64    `json:"bytes"`
+	Read    Position `json:"read"`
+	Write   Position `json:"write"`
+}
+
+func (q *Queue) Stat() Stat {
+	q.Lock()
+	defer q.Unlock()
+	return Stat{Records: q.records, Bytes: q.bytes, Read: q.rpos, Write: q.wpos}
+}
+
+func (q *Queue) Close() error {
+	q.Lock()
+	defer q.Unlock()
+	if q.closed {
+		return nil
+	}
+	q.closed = true
+	close(q.stop)
+	q.wbuf.Flush()
+	q.writeCursor()
+	return q.w.Close()
+}
+
+func (q *Queue) flushLoop() {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-q.stop:
+			return
+		case <-ticker.C:
+			q.Lock()
+			if !q.closed {
+				if err := q.wbuf.Flush(); err != nil {
+					log.Printf("[ERROR] spill %s flush fail: %v", q.dir, err)
+				}
+			}
+			q.Unlock()
+		}
+	}
+}
+
+func (q *Queue) segmentPath(seq int64) string {
+	return filepath.Join(q.dir, fmt.Sprintf("%020d%s", seq, segmentSuffix))
+}
+
+func (q *Queue) segments() ([]int64, error) {
+	// ReadDir按文件名排序, 文件名是补齐到20位的序号, 顺序就是序号的顺序
+	files, err := ioutil.ReadDir(q.dir)
+	if err != nil {
+		return nil, err
+	}
+	seqs := []int64{}
+	for _, f := range files {
+		name := f.Name()
+		if f.IsDir() || !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+		seq, err := strconv.ParseInt(strings.TrimSuffix(name, segmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		seqs = append(seqs, seq)
+	}
+	return seqs, nil
+}
+
+func (q *Queue) readCursor() (pos Position, err error) {
+	bs, err := ioutil.ReadFile(filepath.Join(q.dir, cursorFile))
+	if os.IsNotExist(err) {
+		return pos, nil
+	}
+	if err != nil {
+		return
+	}
+	_, err = fmt.Sscanf(string(bs), "%d %d", &pos.Seq, &pos.Offset)
+	return
+}
+
+func (q *Queue) writeCursor() error {
+	tmp := filepath.Join(q.dir, cursorFile+".tmp")
+	if err := ioutil.WriteFile(tmp, []byte(fmt.Sprintf("%d %d", q.rpos.Seq, q.rpos.Offset)), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(q.dir, cursorFile))
+}
+
+// 读取[from, end)之间最多max条记录, 返回的Record.next.Offset是记录结束的位置
+// 遇到损坏的记录时返回error和损坏记录的位置
+func readSegment(path string, from, end int64, max int) ([]*Record, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, from, err
+	}
+	defer f.Close()
+	if _, err = f.Seek(from, io.SeekStart); err != nil {
+		return nil, from, err
+	}
+	r := bufio.NewReader(io.LimitReader(f, end-from))
+
+	records := []*Record{}
+	off := from
+	for len(records) < max && off < end {
+		data, err := readRecord(r, end-off-headerSize)
+		if err != nil {
+			return records, off, err
+		}
+		off += int64(headerSize + len(data))
+		records = append(records, &Record{Data: data, next: Position{Offset: off}})
+	}
+	return records, off, nil
+}
+
+// max是segment中剩余可读的字节数, 记录的长度超过它说明header已经损坏
+func readRecord(r io.Reader, max int64) ([]byte, error) {
+	var header [headerSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	length := binary.BigEndian.Uint32(header[0:4])
+	if int64(length) > max {
+		return nil, fmt.Errorf("record length %d exceeds remaining %d bytes", length, max)
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	if crc32.ChecksumIEEE(data) != binary.BigEndian.Uint32(header[4:8]) {
+		return nil, errors.New("checksum mismatch")
+	}
+	return data, nil
+}
+
+// 返回from之后完整记录的条数和最后一条完整记录结束的位置
+func scanSegment(path string, from int64) (count int64, end int64, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return
+	}
+	if _, err = f.Seek(from, io.SeekStart); err != nil {
+		return
+	}
+	r := bufio.NewReader(f)
+	end = from
+	for {
+		data, e := readRecord(r, fi.Size()-end-headerSize)
+		if e != nil {
+			return
+		}
+		end += int64(headerSize + len(data))
+		count += 1
+	}
+}
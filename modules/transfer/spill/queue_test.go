@@ -0,0 +1,168 @@
+// Copyright 2017 Xiaomi, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spill
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func readAll(t *testing.T, q *Queue, max int) []string {
+	records, err := q.Read(max)
+	if err != nil {
+		t.Fatalf("read error: %v", err)
+	}
+	ret := []string{}
+	for _, r := range records {
+		ret = append(ret, string(r.Data))
+	}
+	return ret
+}
+
+func TestQueue(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spill")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// 每个segment最多放两条记录
+	q, err := Open(dir, 1024, 40)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		if err := q.Put([]byte(fmt.Sprintf("item-%d", i))); err != nil {
+			t.Fatalf("put error: %v", err)
+		}
+	}
+	if q.Len() != 5 {
+		t.Errorf("len = %d, expected 5", q.Len())
+	}
+
+	records, _ := q.Read(3)
+	if len(records) != 3 || string(records[2].Data) != "item-2" {
+		t.Fatalf("read 3 records: %v", readAll(t, q, 3))
+	}
+	// 没有确认之前重复读到相同的数据
+	if got := readAll(t, q, 1); got[0] != "item-0" {
+		t.Errorf("read before ack = %v, expected item-0", got)
+	}
+	if err := q.Ack(records[1]); err != nil {
+		t.Fatal(err)
+	}
+	if q.Len() != 3 {
+		t.Errorf("len after ack = %d, expected 3", q.Len())
+	}
+	if err := q.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重新打开后从确认的位置继续读
+	q, err = Open(dir, 1024, 40)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := readAll(t, q, 10)
+	expected := []string{"item-2", "item-3", "item-4"}
+	if fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Errorf("read after reopen = %v, expected %v", got, expected)
+	}
+	records, _ = q.Read(10)
+	q.Ack(records[len(records)-1])
+	if q.Len() != 0 || q.Stat().Bytes != 0 {
+		t.Errorf("stat after ack all = %+v", q.Stat())
+	}
+	segs, _ := filepath.Glob(filepath.Join(dir, "*"+segmentSuffix))
+	if len(segs) != 1 {
+		t.Errorf("segments after ack all = %v, expected 1", segs)
+	}
+
+	// 超过maxBytes
+	for err == nil {
+		err = q.Put([]byte("0123456789"))
+	}
+	if err != ErrFull {
+		t.Errorf("put error = %v, expected ErrFull", err)
+	}
+	q.Close()
+}
+
+func TestQueueTornWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spill")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	q, err := Open(dir, 1024, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.Put([]byte("a"))
+	q.Put([]byte("b"))
+	q.Close()
+
+	// 模拟写到一半时进程退出
+	f, _ := os.OpenFile(q.segmentPath(0), os.O_APPEND|os.O_WRONLY, 0644)
+	f.Write([]byte{0, 0, 0, 9, 1, 2})
+	f.Close()
+
+	q, err = Open(dir, 1024, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.Put([]byte("c"))
+	got := readAll(t, q, 10)
+	if fmt.Sprint(got) != "[a b c]" {
+		t.Errorf("read = %v, expected [a b c]", got)
+	}
+	q.Close()
+}
+
+func TestQueueCorruptLength(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spill")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	q, err := Open(dir, 1024, 40)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4; i++ {
+		q.Put([]byte(fmt.Sprintf("item-%d", i)))
+	}
+	q.Close()
+
+	// 第一个segment中记录的长度被改写成一个很大的值
+	f, _ := os.OpenFile(q.segmentPath(0), os.O_WRONLY, 0644)
+	f.WriteAt([]byte{0xff, 0xff, 0xff, 0xff}, 0)
+	f.Close()
+
+	q, err = Open(dir, 1024, 40)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := readAll(t, q, 10)
+	if fmt.Sprint(got) != "[item-2 item-3]" {
+		t.Errorf("read = %v, expected [item-2 item-3]", got)
+	}
+	q.Close()
+}
@@ -56,6 +56,32 @@ CREATE TABLE `session` (
   KEY `idx_session_sig` (`sig`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8;
 
+DROP TABLE if exists `oncall_schedule`;
+CREATE TABLE `oncall_schedule` (
+  `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
+  `team_id` int(10) unsigned NOT NULL,
+  `rotation` varchar(16) NOT NULL DEFAULT 'weekly',
+  `handoff` varchar(5) NOT NULL DEFAULT '09:00',
+  `timezone` varchar(64) NOT NULL DEFAULT 'UTC',
+  `start_date` varchar(10) NOT NULL DEFAULT '',
+  `users` varchar(1024) NOT NULL DEFAULT '',
+  `creator` int(10) unsigned NOT NULL DEFAULT 0,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_oncall_schedule_team` (`team_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+DROP TABLE if exists `oncall_override`;
+CREATE TABLE `oncall_override` (
+  `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
+  `schedule_id` int(10) unsigned NOT NULL,
+  `user_id` int(10) unsigned NOT NULL,
+  `start_at` int(10) unsigned NOT NULL,
+  `end_at` int(10) unsigned NOT NULL,
+  `creator` int(10) unsigned NOT NULL DEFAULT 0,
+  PRIMARY KEY (`id`),
+  KEY `idx_oncall_override_schedule` (`schedule_id`, `end_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
 /*900150983cd24fb0d6963f7d28e17f72*/
 /*insert into `user`(`name`, `passwd`, `role`, `created`) values('root', md5('abc'), 2, now());*/
 
@@ -159,12 +159,53 @@ CREATE TABLE `action` (
   `before_callback_mail` TINYINT(4)       NOT NULL DEFAULT '0',
   `after_callback_sms`   TINYINT(4)       NOT NULL DEFAULT '0',
   `after_callback_mail`  TINYINT(4)       NOT NULL DEFAULT '0',
+  `channels`             VARCHAR(255)     NOT NULL DEFAULT '',
   PRIMARY KEY (`id`)
 )
   ENGINE =InnoDB
   DEFAULT CHARSET =utf8
   COLLATE =utf8_unicode_ci;
 
+/**
+ * action的升级策略，告警在after_minutes分钟内没有被确认时通知对应的uic
+ */
+DROP TABLE IF EXISTS `action_escalation`;
+CREATE TABLE `action_escalation` (
+  `id`            INT(10) UNSIGNED NOT NULL AUTO_INCREMENT,
+  `action_id`     INT(10) UNSIGNED NOT NULL,
+  `step`          INT(10) UNSIGNED NOT NULL,
+  `after_minutes` INT(10) UNSIGNED NOT NULL,
+  `uic`           VARCHAR(255)     NOT NULL DEFAULT '',
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_action_step` (`action_id`, `step`)
+)
+  ENGINE =InnoDB
+  DEFAULT CHARSET =utf8
+  COLLATE =utf8_unicode_ci;
+
+/**
+ * 告警消息模板(Go text/template)，按action或者template配置，action优先
+ * 字段为空时使用alarm内置的格式
+ */
+DROP TABLE IF EXISTS `message_tpl`;
+CREATE TABLE `message_tpl` (
+  `id`           INT(10) UNSIGNED NOT NULL AUTO_INCREMENT,
+  `action_id`    INT(10) UNSIGNED NOT NULL DEFAULT '0',
+  `tpl_id`       INT(10) UNSIGNED NOT NULL DEFAULT '0',
+  `sms`          VARCHAR(1024)    NOT NULL DEFAULT '',
+  `im`           VARCHAR(1024)    NOT NULL DEFAULT '',
+  `mail_subject` VARCHAR(1024)    NOT NULL DEFAULT '',
+  `mail`         TEXT             NOT NULL,
+  `creator`      VARCHAR(64)      NOT NULL DEFAULT '',
+  `t_create`     DATETIME         NOT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_action_id` (`action_id`),
+  KEY `idx_tpl_id` (`tpl_id`)
+)
+  ENGINE =InnoDB
+  DEFAULT CHARSET =utf8
+  COLLATE =utf8_unicode_ci;
+
 /**
  * nodata mock config
  */
@@ -30,6 +30,11 @@ CREATE TABLE IF NOT EXISTS event_cases(
                 template_id int(10) unsigned,
                 process_note MEDIUMINT,
                 process_status VARCHAR(20) DEFAULT 'unresolved',
+                ack_user VARCHAR(64) NOT NULL DEFAULT '',
+                ack_at Timestamp NULL DEFAULT NULL,
+                action_id int(10) unsigned NOT NULL DEFAULT 0,
+                escalation_step int(10) unsigned NOT NULL DEFAULT 0,
+                escalated_at Timestamp NULL DEFAULT NULL,
                 PRIMARY KEY (id),
                 INDEX (endpoint, strategy_id, template_id)
 )
@@ -77,3 +82,86 @@ CREATE TABLE IF NOT EXISTS event_note (
     ON DELETE CASCADE
     ON UPDATE CASCADE
 );
+
+/*
+* 告警抑制规则表, 源告警处于PROBLEM状态时, 与之关联的目标告警不再发送通知
+*/
+CREATE TABLE IF NOT EXISTS inhibit_rule (
+  id                 INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  name               VARCHAR(255) NOT NULL DEFAULT '',
+  source_endpoint    VARCHAR(255) NOT NULL DEFAULT '',
+  source_metric      VARCHAR(128) NOT NULL DEFAULT '',
+  source_tags        VARCHAR(255) NOT NULL DEFAULT '',
+  source_strategy_id INT UNSIGNED NOT NULL DEFAULT 0,
+  target_endpoint    VARCHAR(255) NOT NULL DEFAULT '',
+  target_metric      VARCHAR(128) NOT NULL DEFAULT '',
+  target_tags        VARCHAR(255) NOT NULL DEFAULT '',
+  equal              VARCHAR(255) NOT NULL DEFAULT '',
+  note               VARCHAR(500) NOT NULL DEFAULT '',
+  creator            VARCHAR(64)  NOT NULL DEFAULT '',
+  t_create           DATETIME     NOT NULL,
+  PRIMARY KEY (id)
+)
+  ENGINE =InnoDB
+  DEFAULT CHARSET =utf8;
+
+/*
+* 告警屏蔽表, 匹配的告警仍然记录到event_cases, 但不发送通知
+*/
+CREATE TABLE IF NOT EXISTS silence (
+  id            INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  endpoint      VARCHAR(255) NOT NULL DEFAULT '',
+  metric        VARCHAR(128) NOT NULL DEFAULT '',
+  tags          VARCHAR(255) NOT NULL DEFAULT '',
+  strategy_id   INT UNSIGNED NOT NULL DEFAULT 0,
+  expression_id INT UNSIGNED NOT NULL DEFAULT 0,
+  hostgroup     VARCHAR(255) NOT NULL DEFAULT '',
+  creator       VARCHAR(64)  NOT NULL DEFAULT '',
+  comment       VARCHAR(500) NOT NULL DEFAULT '',
+  start_at      DATETIME     NOT NULL,
+  end_at        DATETIME     NOT NULL,
+  t_create      DATETIME     NOT NULL,
+  PRIMARY KEY (id),
+  INDEX (end_at)
+)
+  ENGINE =InnoDB
+  DEFAULT CHARSET =utf8;
+
+/*
+* 告警屏蔽的操作记录
+*/
+CREATE TABLE IF NOT EXISTS silence_log (
+  id         INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  silence_id INT UNSIGNED NOT NULL,
+  action     VARCHAR(20)  NOT NULL,
+  user       VARCHAR(64)  NOT NULL DEFAULT '',
+  content    VARCHAR(2048) NOT NULL DEFAULT '',
+  timestamp  TIMESTAMP    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  INDEX (silence_id)
+)
+  ENGINE =InnoDB
+  DEFAULT CHARSET =utf8;
+
+
+/*
+* callback的每次发送记录
+*/
+DROP TABLE IF EXISTS callback_delivery;
+CREATE TABLE IF NOT EXISTS callback_delivery (
+  id           INT UNSIGNED  NOT NULL AUTO_INCREMENT,
+  event_caseId VARCHAR(50)   NOT NULL,
+  action_id    INT UNSIGNED  NOT NULL DEFAULT 0,
+  url          VARCHAR(255)  NOT NULL DEFAULT '',
+  method       VARCHAR(10)   NOT NULL DEFAULT '',
+  attempt      INT UNSIGNED  NOT NULL DEFAULT 0,
+  status       VARCHAR(20)   NOT NULL DEFAULT '',
+  resp_code    INT           NOT NULL DEFAULT 0,
+  resp         VARCHAR(1024) NOT NULL DEFAULT '',
+  error        VARCHAR(1024) NOT NULL DEFAULT '',
+  timestamp    TIMESTAMP     NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  INDEX (event_caseId)
+)
+  ENGINE =InnoDB
+  DEFAULT CHARSET =utf8;
@@ -0,0 +1,153 @@
+/*
+* 已有数据的环境升级用, 只新增表和字段, 不会删除数据
+* 全新安装请直接使用 db_schema 下的建表语句
+*/
+
+USE alarms;
+SET NAMES utf8;
+
+CREATE TABLE IF NOT EXISTS inhibit_rule (
+  id                 INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  name               VARCHAR(255) NOT NULL DEFAULT '',
+  source_endpoint    VARCHAR(255) NOT NULL DEFAULT '',
+  source_metric      VARCHAR(128) NOT NULL DEFAULT '',
+  source_tags        VARCHAR(255) NOT NULL DEFAULT '',
+  source_strategy_id INT UNSIGNED NOT NULL DEFAULT 0,
+  target_endpoint    VARCHAR(255) NOT NULL DEFAULT '',
+  target_metric      VARCHAR(128) NOT NULL DEFAULT '',
+  target_tags        VARCHAR(255) NOT NULL DEFAULT '',
+  equal              VARCHAR(255) NOT NULL DEFAULT '',
+  note               VARCHAR(500) NOT NULL DEFAULT '',
+  creator            VARCHAR(64)  NOT NULL DEFAULT '',
+  t_create           DATETIME     NOT NULL,
+  PRIMARY KEY (id)
+)
+  ENGINE =InnoDB
+  DEFAULT CHARSET =utf8;
+
+CREATE TABLE IF NOT EXISTS silence (
+  id            INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  endpoint      VARCHAR(255) NOT NULL DEFAULT '',
+  metric        VARCHAR(128) NOT NULL DEFAULT '',
+  tags          VARCHAR(255) NOT NULL DEFAULT '',
+  strategy_id   INT UNSIGNED NOT NULL DEFAULT 0,
+  expression_id INT UNSIGNED NOT NULL DEFAULT 0,
+  hostgroup     VARCHAR(255) NOT NULL DEFAULT '',
+  creator       VARCHAR(64)  NOT NULL DEFAULT '',
+  comment       VARCHAR(500) NOT NULL DEFAULT '',
+  start_at      DATETIME     NOT NULL,
+  end_at        DATETIME     NOT NULL,
+  t_create      DATETIME     NOT NULL,
+  PRIMARY KEY (id),
+  INDEX (end_at)
+)
+  ENGINE =InnoDB
+  DEFAULT CHARSET =utf8;
+
+CREATE TABLE IF NOT EXISTS silence_log (
+  id         INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  silence_id INT UNSIGNED NOT NULL,
+  action     VARCHAR(20)  NOT NULL,
+  user       VARCHAR(64)  NOT NULL DEFAULT '',
+  content    VARCHAR(2048) NOT NULL DEFAULT '',
+  timestamp  TIMESTAMP    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  INDEX (silence_id)
+)
+  ENGINE =InnoDB
+  DEFAULT CHARSET =utf8;
+
+ALTER TABLE event_cases
+  ADD COLUMN ack_user VARCHAR(64) NOT NULL DEFAULT '',
+  ADD COLUMN ack_at Timestamp NULL DEFAULT NULL,
+  ADD COLUMN action_id int(10) unsigned NOT NULL DEFAULT 0,
+  ADD COLUMN escalation_step int(10) unsigned NOT NULL DEFAULT 0,
+  ADD COLUMN escalated_at Timestamp NULL DEFAULT NULL;
+
+
+USE falcon_portal;
+SET NAMES utf8;
+
+CREATE TABLE IF NOT EXISTS `action_escalation` (
+  `id`            INT(10) UNSIGNED NOT NULL AUTO_INCREMENT,
+  `action_id`     INT(10) UNSIGNED NOT NULL,
+  `step`          INT(10) UNSIGNED NOT NULL,
+  `after_minutes` INT(10) UNSIGNED NOT NULL,
+  `uic`           VARCHAR(255)     NOT NULL DEFAULT '',
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_action_step` (`action_id`, `step`)
+)
+  ENGINE =InnoDB
+  DEFAULT CHARSET =utf8
+  COLLATE =utf8_unicode_ci;
+
+ALTER TABLE `action`
+  ADD COLUMN `channels` VARCHAR(255) NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS `message_tpl` (
+  `id`           INT(10) UNSIGNED NOT NULL AUTO_INCREMENT,
+  `action_id`    INT(10) UNSIGNED NOT NULL DEFAULT '0',
+  `tpl_id`       INT(10) UNSIGNED NOT NULL DEFAULT '0',
+  `sms`          VARCHAR(1024)    NOT NULL DEFAULT '',
+  `im`           VARCHAR(1024)    NOT NULL DEFAULT '',
+  `mail_subject` VARCHAR(1024)    NOT NULL DEFAULT '',
+  `mail`         TEXT             NOT NULL,
+  `creator`      VARCHAR(64)      NOT NULL DEFAULT '',
+  `t_create`     DATETIME         NOT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_action_id` (`action_id`),
+  KEY `idx_tpl_id` (`tpl_id`)
+)
+  ENGINE =InnoDB
+  DEFAULT CHARSET =utf8
+  COLLATE =utf8_unicode_ci;
+
+
+USE alarms;
+SET NAMES utf8;
+
+CREATE TABLE IF NOT EXISTS callback_delivery (
+  id           INT UNSIGNED  NOT NULL AUTO_INCREMENT,
+  event_caseId VARCHAR(50)   NOT NULL,
+  action_id    INT UNSIGNED  NOT NULL DEFAULT 0,
+  url          VARCHAR(255)  NOT NULL DEFAULT '',
+  method       VARCHAR(10)   NOT NULL DEFAULT '',
+  attempt      INT UNSIGNED  NOT NULL DEFAULT 0,
+  status       VARCHAR(20)   NOT NULL DEFAULT '',
+  resp_code    INT           NOT NULL DEFAULT 0,
+  resp         VARCHAR(1024) NOT NULL DEFAULT '',
+  error        VARCHAR(1024) NOT NULL DEFAULT '',
+  timestamp    TIMESTAMP     NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  INDEX (event_caseId)
+)
+  ENGINE =InnoDB
+  DEFAULT CHARSET =utf8;
+
+
+USE uic;
+SET NAMES utf8;
+
+CREATE TABLE IF NOT EXISTS `oncall_schedule` (
+  `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
+  `team_id` int(10) unsigned NOT NULL,
+  `rotation` varchar(16) NOT NULL DEFAULT 'weekly',
+  `handoff` varchar(5) NOT NULL DEFAULT '09:00',
+  `timezone` varchar(64) NOT NULL DEFAULT 'UTC',
+  `start_date` varchar(10) NOT NULL DEFAULT '',
+  `users` varchar(1024) NOT NULL DEFAULT '',
+  `creator` int(10) unsigned NOT NULL DEFAULT 0,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_oncall_schedule_team` (`team_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE IF NOT EXISTS `oncall_override` (
+  `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
+  `schedule_id` int(10) unsigned NOT NULL,
+  `user_id` int(10) unsigned NOT NULL,
+  `start_at` int(10) unsigned NOT NULL,
+  `end_at` int(10) unsigned NOT NULL,
+  `creator` int(10) unsigned NOT NULL DEFAULT 0,
+  PRIMARY KEY (`id`),
+  KEY `idx_oncall_override_schedule` (`schedule_id`, `end_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;